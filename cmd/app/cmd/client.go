@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/fancar/tmp_xm/internal/api"
+	"github.com/fancar/tmp_xm/internal/config"
+)
+
+// Flags of the commands using the gRPC api of a running server.
+var (
+	clientServer   string
+	clientTLS      bool
+	clientInsecure bool
+	clientToken    string
+	clientUser     string
+	clientPassword string
+)
+
+// addClientFlags adds the api connection flags to the given command.
+func addClientFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&clientServer, "server", "", "host:port of the api server (default derived from external_api.bind)")
+	cmd.PersistentFlags().BoolVar(&clientTLS, "tls", false, "connect with TLS (default when external_api.tls_cert is set)")
+	cmd.PersistentFlags().BoolVar(&clientInsecure, "insecure-skip-verify", false, "do not verify the TLS certificate of the api server")
+	cmd.PersistentFlags().StringVar(&clientToken, "token", "", "jwt token, see the login api")
+	cmd.PersistentFlags().StringVar(&clientUser, "user", "admin", "username to log in with when no token is given")
+	cmd.PersistentFlags().StringVar(&clientPassword, "password", "", "password to log in with when no token is given")
+}
+
+// apiTLSEnabled returns true if the api server is configured with TLS.
+func apiTLSEnabled(conf config.Config) bool {
+	return conf.ExternalAPI.TLSCert != "" && conf.ExternalAPI.TLSKey != ""
+}
+
+// apiLocalAddress returns the local host:port of the api server.
+func apiLocalAddress(conf config.Config) string {
+	port := "8085"
+	if parts := strings.SplitN(conf.ExternalAPI.Bind, ":", 2); len(parts) == 2 && parts[1] != "" {
+		port = parts[1]
+	}
+	return "localhost:" + port
+}
+
+// dialAPI connects to the gRPC api and returns the client with a context
+// carrying the jwt token, logging in first when no token is given.
+func dialAPI(ctx context.Context) (api.CompanyServiceClient, context.Context, func() error, error) {
+	addr := clientServer
+	if addr == "" {
+		addr = apiLocalAddress(config.C)
+	}
+
+	creds := insecure.NewCredentials()
+	if clientTLS || (clientServer == "" && apiTLSEnabled(config.C)) {
+		creds = credentials.NewTLS(&tls.Config{InsecureSkipVerify: clientInsecure})
+	}
+
+	conn, err := grpc.DialContext(ctx, addr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("dial api server error: %w", err)
+	}
+	client := api.NewCompanyServiceClient(conn)
+
+	token := clientToken
+	if token == "" {
+		resp, err := client.Login(ctx, &api.LoginRequest{User: clientUser, Password: clientPassword})
+		if err != nil {
+			conn.Close()
+			return nil, nil, nil, fmt.Errorf("login error: %w", err)
+		}
+		token = resp.Jwt
+	}
+
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+	return client, ctx, conn.Close, nil
+}
@@ -0,0 +1,272 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/fancar/tmp_xm/internal/api"
+)
+
+var (
+	importFormat     string
+	importBestEffort bool
+	importBatchSize  int32
+	importForce      bool
+
+	exportFormat     string
+	exportType       string
+	exportRegistered string
+	exportNamePrefix string
+	exportAttributes []string
+	exportSelector   string
+)
+
+var companyCmd = &cobra.Command{
+	Use:   "company",
+	Short: "Manage the companies via the api of a running server",
+}
+
+var companyImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Import the companies from a CSV or JSON Lines file",
+	Long: `Streams the companies of the file to the api server and prints the
+rows which were not imported.
+
+The CSV file must start with a header naming its columns, in any order:
+  id,name,description,employeescnt,registered,type,parent_id,status,
+  jurisdiction,registration_number,vat_id,lei,attributes,labels
+The attributes are a JSON object, the labels comma separated key=value pairs.
+The JSON Lines file holds a Company object per line, e.g.:
+  {"id": "...", "name": "acme", "employeescnt": 10, "type": "NonProfit"}
+
+By default the rows are inserted in batches, each batch in a transaction,
+a failing row rolls back its batch. With --best-effort every row is inserted
+on its own. The rows which can't be parsed are reported and skipped.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format := importFormat
+		if format == "" {
+			f, err := api.FormatFromFilename(args[0])
+			if err != nil {
+				return err
+			}
+			format = f
+		}
+
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		reader, err := api.NewCompanyReader(f, format)
+		if err != nil {
+			return err
+		}
+
+		cmd.SilenceUsage = true
+		return importCompanies(cmd.Context(), reader)
+	},
+}
+
+var companyExportCmd = &cobra.Command{
+	Use:   "export [file]",
+	Short: "Export the companies to a CSV or JSON Lines file",
+	Long: `Streams the companies matching the filters from the api server, ordered
+by name, and writes them to the file or to stdout, in the format read by the
+import command. The excel format is a CSV file opened safely by the
+spreadsheets: it starts with a UTF-8 BOM and the cells which would be taken
+as formulas (starting with = + - @) are prefixed with a quote.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		req := &api.ExportCompaniesRequest{
+			NamePrefix:    exportNamePrefix,
+			Attributes:    exportAttributes,
+			LabelSelector: exportSelector,
+		}
+		if exportType != "" {
+			t, ok := api.CompanyType_value[exportType]
+			if !ok || t == 0 {
+				return fmt.Errorf("invalid type: %s", exportType)
+			}
+			req.Type = api.CompanyType(t)
+		}
+		if exportRegistered != "" {
+			b, err := strconv.ParseBool(exportRegistered)
+			if err != nil {
+				return fmt.Errorf("invalid registered: %s", exportRegistered)
+			}
+			req.Registered = wrapperspb.Bool(b)
+		}
+
+		format := exportFormat
+		if format == "" && len(args) == 1 {
+			f, err := api.FormatFromFilename(args[0])
+			if err != nil {
+				return err
+			}
+			format = f
+		}
+		if format == "" {
+			format = api.FormatCSV
+		}
+
+		out := io.Writer(os.Stdout)
+		if len(args) == 1 {
+			f, err := os.Create(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+
+		writer, err := api.NewCompanyWriter(out, format)
+		if err != nil {
+			return err
+		}
+
+		cmd.SilenceUsage = true
+		return exportCompanies(cmd.Context(), req, writer)
+	},
+}
+
+func init() {
+	addClientFlags(companyCmd)
+
+	companyImportCmd.Flags().StringVar(&importFormat, "format", "", "file format: csv, excel or jsonl (default by the file extension)")
+	companyImportCmd.Flags().BoolVar(&importBestEffort, "best-effort", false, "insert every row on its own instead of in transactional batches")
+	companyImportCmd.Flags().Int32Var(&importBatchSize, "batch-size", 100, "number of rows per transaction")
+	companyImportCmd.Flags().BoolVar(&importForce, "force", false, "import the companies which may be duplicates of existing ones")
+
+	companyExportCmd.Flags().StringVar(&exportFormat, "format", "", "file format: csv, excel or jsonl (default by the file extension, csv for stdout)")
+	companyExportCmd.Flags().StringVar(&exportType, "type", "", "export the companies of the given type only, e.g. NonProfit")
+	companyExportCmd.Flags().StringVar(&exportRegistered, "registered", "", "export the registered (true) or unregistered (false) companies only")
+	companyExportCmd.Flags().StringVar(&exportNamePrefix, "name-prefix", "", "export the companies which names start with the given prefix only")
+	companyExportCmd.Flags().StringArrayVar(&exportAttributes, "attribute", nil, "export the companies having the given custom attribute value only, as name=value (repeatable)")
+	companyExportCmd.Flags().StringVar(&exportSelector, "selector", "", "export the companies matching the given label selector only, e.g. 'env=prod,tier in (gold,silver)'")
+
+	companyCmd.AddCommand(companyImportCmd)
+	companyCmd.AddCommand(companyExportCmd)
+}
+
+func importCompanies(ctx context.Context, reader *api.CompanyReader) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	client, ctx, closeConn, err := dialAPI(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+
+	stream, err := client.ImportCompanies(ctx)
+	if err != nil {
+		return fmt.Errorf("start import error: %w", err)
+	}
+
+	mode := api.ImportMode_BATCH
+	if importBestEffort {
+		mode = api.ImportMode_BEST_EFFORT
+	}
+
+	var parseErrors []*api.ImportRowError
+	first := true
+	for {
+		rec, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read file error: %w", err)
+		}
+		if rec.Err != nil {
+			parseErrors = append(parseErrors, &api.ImportRowError{
+				Row:     rec.Row,
+				Code:    int32(codes.InvalidArgument),
+				Message: rec.Err.Error(),
+			})
+			continue
+		}
+
+		req := &api.ImportCompaniesRequest{Row: rec.Row, Company: rec.Company}
+		if first {
+			req.Mode = mode
+			req.BatchSize = importBatchSize
+			req.Force = importForce
+			first = false
+		}
+		if err := stream.Send(req); err != nil {
+			if err == io.EOF {
+				// the server closed the stream, its error is returned by CloseAndRecv
+				break
+			}
+			return fmt.Errorf("send error: %w", err)
+		}
+	}
+
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return fmt.Errorf("import error: %w", err)
+	}
+
+	rowErrors := append(parseErrors, resp.Errors...)
+	sort.Slice(rowErrors, func(i, j int) bool { return rowErrors[i].Row < rowErrors[j].Row })
+	for _, e := range rowErrors {
+		fmt.Printf("row %d\t%s\t%s: %s\n", e.Row, e.Id, codes.Code(e.Code), e.Message)
+	}
+	fmt.Printf("total: %d, imported: %d, failed: %d\n",
+		resp.Total+int64(len(parseErrors)), resp.Imported, len(rowErrors))
+
+	if len(rowErrors) != 0 {
+		return fmt.Errorf("%d rows were not imported", len(rowErrors))
+	}
+	return nil
+}
+
+func exportCompanies(ctx context.Context, req *api.ExportCompaniesRequest, writer *api.CompanyWriter) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	client, ctx, closeConn, err := dialAPI(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+
+	stream, err := client.ExportCompanies(ctx, req)
+	if err != nil {
+		return fmt.Errorf("start export error: %w", err)
+	}
+
+	var n int
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("export error: %w", err)
+		}
+		if err := writer.Write(resp.Company); err != nil {
+			return fmt.Errorf("write file error: %w", err)
+		}
+		n++
+	}
+
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("write file error: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "exported: %d\n", n)
+	return nil
+}
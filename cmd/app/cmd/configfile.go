@@ -18,6 +18,12 @@ const configTemplate = `[general]
 # debug=5, info=4, warning=3, error=2, fatal=1, panic=0
 log_level={{ .General.LogLevel }}
 
+# Shutdown timeout.
+#
+# On SIGTERM / SIGINT the api server stops accepting new requests and the
+# in-flight requests and Kafka messages are given this much time to complete.
+shutdown_timeout="{{ .General.ShutdownTimeout }}"
+
 [external_api]
   # ip:port to bind the (user facing) http server to (web-interface and REST / gRPC api)
   bind="{{ .ExternalAPI.Bind }}"
@@ -39,6 +45,91 @@ log_level={{ .General.LogLevel }}
   # When left blank (default), CORS will not be used.
   cors_allow_origin="{{ .ExternalAPI.CORSAllowOrigin }}"
 
+  # Idempotency keys TTL.
+  #
+  # A Create, Update or Delete request sent with an Idempotency-Key header
+  # (or idempotency-key gRPC metadata) is run once, the retries with the same
+  # key and payload get the stored response during this time. Set to 0 to
+  # ignore the idempotency keys.
+  idempotency_ttl="{{ .ExternalAPI.IdempotencyTTL }}"
+
+  # Ultimate beneficial owners threshold.
+  #
+  # The natural persons owning directly or indirectly at least this percentage
+  # of a company are its ultimate beneficial owners. The GetUltimateBeneficialOwners
+  # requests may set another threshold.
+  ubo_threshold={{ .ExternalAPI.UBOThreshold }}
+
+  # Four-eyes approval settings.
+  #
+  # The matching changes are not applied right away, a pending change request
+  # is created instead. It is applied once approved by another user with the
+  # approver permission (or an admin), see the ChangeRequests endpoints.
+  [external_api.approval]
+    # Require an approval for the deletes of the companies.
+    delete={{ .ExternalAPI.Approval.Delete }}
+
+    # Require an approval for the changes of the company type.
+    type_change={{ .ExternalAPI.Approval.TypeChange }}
+
+    # Require an approval for the changes of the employee count larger than
+    # this number. Set to 0 to disable it.
+    employees_threshold={{ .ExternalAPI.Approval.EmployeesThreshold }}
+
+    # The change requests not decided during this time expire.
+    ttl="{{ .ExternalAPI.Approval.TTL }}"
+
+  # Max. size (in bytes) of the files attached to the companies.
+  max_attachment_size={{ .ExternalAPI.MaxAttachmentSize }}
+
+
+# Attachments storage.
+#
+# The metadata of the files attached to the companies is kept in the
+# database, their contents in the blob store.
+[blob_store]
+  # Blob store backend, one of:
+  #
+  # * local - files under the dir directory, created on the first upload
+  # * s3 - objects of an S3 compatible object store (AWS, MinIO, ...), see [blob_store.s3]
+  backend="{{ .BlobStore.Backend }}"
+
+  # Directory of the local backend.
+  dir="{{ .BlobStore.Dir }}"
+
+  [blob_store.s3]
+    # Endpoint URL of an S3 compatible server, e.g. http://localhost:9000.
+    # Leave empty for AWS.
+    endpoint="{{ .BlobStore.S3.Endpoint }}"
+
+    # Region.
+    region="{{ .BlobStore.S3.Region }}"
+
+    # Bucket, it must exist.
+    bucket="{{ .BlobStore.S3.Bucket }}"
+
+    # Prefix of the object keys (optional), e.g. "xm/".
+    prefix="{{ .BlobStore.S3.Prefix }}"
+
+    # Static credentials (optional). When empty, the AWS credential chain is
+    # used (environment, shared credentials file, instance role).
+    access_key_id="{{ .BlobStore.S3.AccessKeyID }}"
+    secret_access_key="{{ .BlobStore.S3.SecretAccessKey }}"
+
+    # Address the bucket by path instead of by sub-domain, most S3
+    # compatible servers require it.
+    path_style={{ .BlobStore.S3.PathStyle }}
+
+
+# Storage settings.
+#
+[storage]
+  # Storage backend, one of:
+  #
+  # * postgres - PostgreSQL, or SQLite with a sqlite:// dsn, see the [postgre] section
+  # * memory - in-memory storage for the tests and demos, the data is lost on exit
+  backend="{{ .Storage.Backend }}"
+
 
 # PostgreSQL settings.
 #
@@ -49,6 +140,11 @@ log_level={{ .General.LogLevel }}
   # it is also possible to use the following format:
   # 'user=app dbname=app sslmode=disable'.
   #
+  # A sqlite:// dsn selects the embedded SQLite database instead, e.g.
+  # 'sqlite:///var/lib/xm/xm.db' or 'sqlite://:memory:'. The foreign_keys and
+  # busy_timeout pragmas are enabled unless set by the _pragma parameters.
+  # SQLite uses a single connection, the pool settings below are ignored.
+  #
   # The following connection parameters are supported:
   #
   # * dbname - The name of the database to connect to
@@ -72,6 +168,12 @@ log_level={{ .General.LogLevel }}
   #   by a trusted CA and the server host name matches the one in the certificate)
   dsn="{{ .PostgreSQL.DSN }}"
 
+  # Automatically apply the pending migrations on start.
+  #
+  # When disabled, apply them with the 'migrate up' command. The service
+  # refuses to start when the schema is dirty or newer than the binary.
+  automigrate={{ .PostgreSQL.Automigrate }}
+
   # Max open connections.
   #
   # This sets the max. number of open connections that are allowed in the
@@ -84,6 +186,12 @@ log_level={{ .General.LogLevel }}
   # pool (0 = no idle connections are retained).
   max_idle_connections={{ .PostgreSQL.MaxIdleConnections }}
 
+  # Statement timeout.
+  #
+  # The server aborts the statements running longer than this (0 = no timeout).
+  # The deadlines of the api clients are applied as well, whichever is shorter.
+  statement_timeout="{{ .PostgreSQL.StatementTimeout }}"
+
  # Kafka events producer configuration.
   [kafka]
   # Broker list, e.g.: brokers=[localhost:9092]
@@ -118,6 +226,39 @@ log_level={{ .General.LogLevel }}
   # SHA256 or SHA512 
   algorithm="{{ .Kafka.Algorithm }}"
 
+
+# OpenTelemetry tracing.
+#
+# When enabled, spans are recorded for the HTTP gateway, the gRPC api,
+# the PostgreSQL queries and the published Kafka messages. The W3C trace
+# context is propagated in the Kafka message headers.
+[tracing]
+  # Enable tracing.
+  enabled={{ .Tracing.Enabled }}
+
+  # Exporter, one of:
+  #
+  # * otlp - export using OTLP over gRPC (e.g. to an OpenTelemetry collector or Jaeger)
+  # * stdout - print the spans to stdout (local use)
+  # * file - append the spans as JSON to the given file (local use)
+  exporter="{{ .Tracing.Exporter }}"
+
+  # OTLP endpoint (host:port). Only used if exporter == otlp.
+  endpoint="{{ .Tracing.Endpoint }}"
+
+  # Disable TLS for the OTLP exporter. Only used if exporter == otlp.
+  insecure={{ .Tracing.Insecure }}
+
+  # Output file. Only used if exporter == file.
+  file="{{ .Tracing.File }}"
+
+  # Service name reported with the spans.
+  service_name="{{ .Tracing.ServiceName }}"
+
+  # Fraction of the traces to sample (0.0 - 1.0). Traces started by an
+  # upstream caller follow its sampling decision.
+  sample_ratio={{ .Tracing.SampleRatio }}
+
 `
 
 var configCmd = &cobra.Command{
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/fancar/tmp_xm/internal/config"
+)
+
+var (
+	healthcheckURL      string
+	healthcheckLiveness bool
+	healthcheckTimeout  time.Duration
+)
+
+var healthcheckCmd = &cobra.Command{
+	Use:   "healthcheck",
+	Short: "Check the health of the running api server (e.g. as Docker HEALTHCHECK)",
+	Long: `Requests the /readyz (or /healthz with --liveness) endpoint of the
+running api server and exits with a non-zero code when it is not healthy.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		url := healthcheckURL
+		if url == "" {
+			url = healthcheckBaseURL(config.C)
+		}
+		if healthcheckLiveness {
+			url += "/healthz"
+		} else {
+			url += "/readyz"
+		}
+
+		client := http.Client{
+			Timeout: healthcheckTimeout,
+			Transport: &http.Transport{
+				// the api server is queried via localhost, skip the hostname check
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		}
+
+		resp, err := client.Get(url)
+		if err != nil {
+			return fmt.Errorf("healthcheck request error: %w", err)
+		}
+		defer resp.Body.Close()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("read healthcheck response error: %w", err)
+		}
+		fmt.Fprint(os.Stdout, string(b))
+
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("unhealthy: %s", resp.Status)
+		}
+		return nil
+	},
+}
+
+func init() {
+	healthcheckCmd.Flags().StringVar(&healthcheckURL, "url", "", "base url of the api server (default derived from external_api.bind)")
+	healthcheckCmd.Flags().BoolVar(&healthcheckLiveness, "liveness", false, "check the liveness instead of the readiness")
+	healthcheckCmd.Flags().DurationVar(&healthcheckTimeout, "timeout", 5*time.Second, "request timeout")
+}
+
+// healthcheckBaseURL returns the local url of the api server.
+func healthcheckBaseURL(conf config.Config) string {
+	scheme := "http"
+	if apiTLSEnabled(conf) {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s", scheme, apiLocalAddress(conf))
+}
@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/fancar/tmp_xm/internal/config"
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+var (
+	migrateDryRun bool
+	migrateDir    string
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Manage the database schema migrations",
+	Long: `Applies or reverts the data migrations embedded in the binary, or
+creates the files of a new one in the source tree. With --dry-run the
+migrations which would be applied are listed only.`,
+}
+
+var migrateUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Apply all the pending migrations",
+	Args:  cobra.NoArgs,
+	RunE: withMigrator(func(m *storage.Migrator, args []string) error {
+		status, err := m.Status()
+		if err != nil {
+			return err
+		}
+		if migrateDryRun {
+			return printMigrationPlan(m, status.Latest)
+		}
+		return m.Up()
+	}),
+}
+
+var migrateDownCmd = &cobra.Command{
+	Use:   "down [n]",
+	Short: "Revert the last n applied migrations (default 1)",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: withMigrator(func(m *storage.Migrator, args []string) error {
+		n := 1
+		if len(args) == 1 {
+			v, err := strconv.Atoi(args[0])
+			if err != nil || v < 1 {
+				return fmt.Errorf("invalid number of migrations: %s", args[0])
+			}
+			n = v
+		}
+		if migrateDryRun {
+			target, err := m.DownTarget(n)
+			if err != nil {
+				return err
+			}
+			return printMigrationPlan(m, target)
+		}
+		return m.Down(n)
+	}),
+}
+
+var migrateGotoCmd = &cobra.Command{
+	Use:   "goto <version>",
+	Short: "Migrate the schema up or down to the given version (0 reverts all)",
+	Args:  cobra.ExactArgs(1),
+	RunE: withMigrator(func(m *storage.Migrator, args []string) error {
+		version, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid version: %s", args[0])
+		}
+		if migrateDryRun {
+			return printMigrationPlan(m, uint(version))
+		}
+		if _, err := m.Plan(uint(version)); err != nil {
+			return err
+		}
+		return m.Goto(uint(version))
+	}),
+}
+
+var migrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Print the schema version and the embedded migrations",
+	Args:  cobra.NoArgs,
+	RunE: withMigrator(func(m *storage.Migrator, args []string) error {
+		status, err := m.Status()
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("version: %d\n", status.Version)
+		fmt.Printf("dirty:   %t\n", status.Dirty)
+		fmt.Printf("latest:  %d\n\n", status.Latest)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS")
+		for _, mi := range status.Migrations {
+			state := "pending"
+			switch {
+			case mi.Version == status.Version && status.Dirty:
+				state = "dirty"
+			case mi.Version <= status.Version:
+				state = "applied"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", mi.Version, mi.Identifier, state)
+		}
+		return w.Flush()
+	}),
+}
+
+var migrateCreateCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Create the empty files of a new migration for PostgreSQL and SQLite",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// the arguments are valid, don't print the usage on errors
+		cmd.SilenceUsage = true
+
+		if migrateDryRun {
+			fmt.Printf("would create the migration %s in %s\n", args[0], migrateDir)
+			return nil
+		}
+		paths, err := storage.CreateMigration(migrateDir, args[0])
+		for _, p := range paths {
+			fmt.Println(p)
+		}
+		return err
+	},
+}
+
+var migrateForceCmd = &cobra.Command{
+	Use:   "force <version>",
+	Short: "Set the schema version and clear the dirty flag without running migrations (-1 = none applied)",
+	Args:  cobra.ExactArgs(1),
+	RunE: withMigrator(func(m *storage.Migrator, args []string) error {
+		version, err := strconv.Atoi(args[0])
+		if err != nil || version < -1 {
+			return fmt.Errorf("invalid version: %s", args[0])
+		}
+		if migrateDryRun {
+			fmt.Printf("would force the schema version to %d\n", version)
+			return nil
+		}
+		return m.Force(version)
+	}),
+}
+
+func init() {
+	migrateCmd.PersistentFlags().BoolVar(&migrateDryRun, "dry-run", false, "list the migrations which would be applied, without applying them")
+
+	migrateCmd.AddCommand(migrateUpCmd)
+	migrateCmd.AddCommand(migrateDownCmd)
+	migrateCmd.AddCommand(migrateGotoCmd)
+	migrateCmd.AddCommand(migrateStatusCmd)
+	migrateCmd.AddCommand(migrateForceCmd)
+
+	migrateCreateCmd.Flags().StringVar(&migrateDir, "dir", "internal/storage", "source directory holding the migrations directories")
+	migrateCmd.AddCommand(migrateCreateCmd)
+}
+
+// withMigrator connects to the configured database and runs the given
+// function with its migrator.
+func withMigrator(f func(*storage.Migrator, []string) error) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		// the arguments are valid, don't print the usage on errors
+		cmd.SilenceUsage = true
+		log.SetLevel(log.Level(uint8(config.C.General.LogLevel)))
+
+		if config.C.Storage.Backend == storage.BackendMemory {
+			return fmt.Errorf("the %s storage backend has no migrations", storage.BackendMemory)
+		}
+
+		if err := storage.Connect(config.C); err != nil {
+			return err
+		}
+		defer storage.Close()
+
+		m, err := storage.NewMigrator(storage.DB().DB)
+		if err != nil {
+			return err
+		}
+		return f(m, args)
+	}
+}
+
+// printMigrationPlan prints the migrations to apply to get to the given
+// version.
+func printMigrationPlan(m *storage.Migrator, target uint) error {
+	steps, err := m.Plan(target)
+	if err != nil {
+		return err
+	}
+	if len(steps) == 0 {
+		fmt.Println("no pending migrations")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tDIRECTION")
+	for _, s := range steps {
+		fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Identifier, s.Direction)
+	}
+	return w.Flush()
+}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"bytes"
 	"io/ioutil"
+	"time"
 
 	"github.com/fancar/tmp_xm/internal/config"
 	log "github.com/sirupsen/logrus"
@@ -45,12 +46,27 @@ func init() {
 		"config", "c", "", "path to configuration file (optional). Default config.toml")
 	rootCmd.PersistentFlags().Int("log-level", 4, "debug=5, info=4, error=2, fatal=1, panic=0")
 
+	rootCmd.PersistentFlags().String("storage", "postgres", "storage backend: postgres (PostgreSQL or SQLite, by the postgre.dsn scheme), or memory for a demo (the data is lost on exit)")
+
 	viper.BindPFlag("general.log_level", rootCmd.PersistentFlags().Lookup("log-level"))
+	viper.BindPFlag("storage.backend", rootCmd.PersistentFlags().Lookup("storage"))
+	viper.SetDefault("general.shutdown_timeout", 30*time.Second)
+
+	viper.SetDefault("external_api.bind", "0.0.0.0:8085")
+	viper.SetDefault("external_api.idempotency_ttl", 24*time.Hour)
+	viper.SetDefault("external_api.ubo_threshold", 25)
+	viper.SetDefault("external_api.approval.ttl", 72*time.Hour)
+	viper.SetDefault("external_api.max_attachment_size", 20<<20)
+
+	viper.SetDefault("blob_store.backend", "local")
+	viper.SetDefault("blob_store.dir", "/var/lib/xm/attachments")
+	viper.SetDefault("blob_store.s3.region", "us-east-1")
 
 	viper.SetDefault("postgre.dsn", "postgres://app@localhost/app?sslmode=disable")
 	viper.SetDefault("postgre.max_idle_connections", 2)
 	viper.SetDefault("postgre.max_open_connections", 10)
 	viper.SetDefault("postgre.automigrate", true)
+	viper.SetDefault("postgre.statement_timeout", 30*time.Second)
 
 	viper.SetDefault("kafka.brokers", []string{"localhost:9092"})
 	viper.SetDefault("kafka.topic", "epam-xm")
@@ -58,8 +74,16 @@ func init() {
 	viper.SetDefault("kafka.mechanism", "PLAIN")
 	viper.SetDefault("algorithm", "SHA512")
 
+	viper.SetDefault("tracing.exporter", "otlp")
+	viper.SetDefault("tracing.endpoint", "localhost:4317")
+	viper.SetDefault("tracing.insecure", true)
+	viper.SetDefault("tracing.sample_ratio", 1.0)
+
 	rootCmd.AddCommand(versionCmd)
 	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(healthcheckCmd)
+	rootCmd.AddCommand(migrateCmd)
+	rootCmd.AddCommand(companyCmd)
 }
 
 func initConfig() {
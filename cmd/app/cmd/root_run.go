@@ -7,6 +7,7 @@ import (
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -15,12 +16,14 @@ import (
 	"github.com/fancar/tmp_xm/internal/config"
 	"github.com/fancar/tmp_xm/internal/kafka"
 	"github.com/fancar/tmp_xm/internal/storage"
+	"github.com/fancar/tmp_xm/internal/tracing"
 )
 
 func run(cnd *cobra.Command, args []string) error {
 	tasks := []func(context.Context, *sync.WaitGroup) error{
 		setLogLevel,
 		printStartMessage,
+		setupTracing,
 		setupStorage,
 		setupAPI,
 		setupKafka,
@@ -35,22 +38,46 @@ func run(cnd *cobra.Command, args []string) error {
 		}
 	}
 
+	// the order matters: first stop the incoming requests, then flush
+	// the events they produced and finally release the resources
+	shutdownTasks := []func(context.Context, *sync.WaitGroup) error{
+		shutdownAPI,
+		shutdownKafka,
+		shutdownStorage,
+		shutdownTracing,
+	}
+
 	exitChan := make(chan struct{})
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 	<-sigChan
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(
+		context.Background(), config.C.General.ShutdownTimeout)
+	defer shutdownCancel()
+
 	go func() {
 		cancel()
-		log.Info("Stopping gracefully ...")
-		wg.Wait()
+		log.WithField("timeout", config.C.General.ShutdownTimeout).Info("Stopping gracefully ...")
+		for _, t := range shutdownTasks {
+			if err := t(shutdownCtx, &wg); err != nil {
+				log.WithError(err).Error("shutdown error")
+			}
+		}
 		log.Info("Bye!")
 		exitChan <- struct{}{}
 	}()
-	cancel()
 	select {
 	case <-exitChan:
 	case s := <-sigChan:
 		log.WithField("signal", s).Info("signal received, terminated")
+	case <-shutdownCtx.Done():
+		// give the tasks a moment to report the timeout themselves
+		select {
+		case <-exitChan:
+		case <-time.After(time.Second):
+			log.Warning("shutdown timeout exceeded, terminated")
+		}
 	}
 
 	return nil
@@ -69,6 +96,13 @@ func printStartMessage(ctx context.Context, wg *sync.WaitGroup) error {
 	return nil
 }
 
+func setupTracing(ctx context.Context, wg *sync.WaitGroup) error {
+	if err := tracing.Setup(ctx, config.C); err != nil {
+		return fmt.Errorf("can't setup tracing: %v", err)
+	}
+	return nil
+}
+
 func setupStorage(ctx context.Context, wg *sync.WaitGroup) error {
 	if err := storage.Setup(config.C); err != nil {
 		return fmt.Errorf("can't setup storage: %v", err)
@@ -90,3 +124,31 @@ func setupKafka(ctx context.Context, wg *sync.WaitGroup) error {
 	}
 	return nil
 }
+
+func shutdownAPI(ctx context.Context, wg *sync.WaitGroup) error {
+	if err := api.Shutdown(ctx); err != nil {
+		return fmt.Errorf("can't shutdown api: %v", err)
+	}
+	return nil
+}
+
+func shutdownKafka(ctx context.Context, wg *sync.WaitGroup) error {
+	if err := kafka.Close(ctx); err != nil {
+		return fmt.Errorf("can't close kafka writer: %v", err)
+	}
+	return nil
+}
+
+func shutdownStorage(ctx context.Context, wg *sync.WaitGroup) error {
+	if err := storage.Close(); err != nil {
+		return fmt.Errorf("can't close storage: %v", err)
+	}
+	return nil
+}
+
+func shutdownTracing(ctx context.Context, wg *sync.WaitGroup) error {
+	if err := tracing.Shutdown(ctx); err != nil {
+		return fmt.Errorf("can't shutdown tracing: %v", err)
+	}
+	return nil
+}
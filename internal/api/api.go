@@ -8,16 +8,22 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/grpc-ecosystem/grpc-gateway/runtime"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
 
 	"github.com/fancar/tmp_xm/internal/api/auth"
+	"github.com/fancar/tmp_xm/internal/blobstore"
 	"github.com/fancar/tmp_xm/internal/config"
 	"github.com/fancar/tmp_xm/internal/storage"
 	"github.com/fancar/tmp_xm/static"
@@ -30,6 +36,24 @@ var (
 	tlsKey          string
 	jwtSecret       string
 	corsAllowOrigin string
+	// uboThreshold is the default min. stake (in percent) of the ultimate
+	// beneficial owners.
+	uboThreshold = 25.0
+	// approval defines the changes which must be approved by a second
+	// user, none by default.
+	approval approvalPolicy
+
+	httpServer    *http.Server
+	grpcServer    *grpc.Server
+	companyAPI    *CompanyAPI
+	gatewayCancel context.CancelFunc
+
+	// grpcRequests counts the in-flight gRPC requests. They are served by
+	// the http handler over hijacked h2c connections which are not tracked
+	// by http.Server.Shutdown.
+	grpcRequests int64
+	// shuttingDown is set once the new gRPC requests must be rejected.
+	shuttingDown int32
 )
 
 // Setup configures the API endpoints.
@@ -43,18 +67,47 @@ func Setup(ctx context.Context, conf config.Config) error {
 	tlsKey = conf.ExternalAPI.TLSKey
 	jwtSecret = conf.ExternalAPI.JWTSecret
 	corsAllowOrigin = conf.ExternalAPI.CORSAllowOrigin
+	uboThreshold = conf.ExternalAPI.UBOThreshold
+	approval = approvalPolicy{
+		delete:             conf.ExternalAPI.Approval.Delete,
+		typeChange:         conf.ExternalAPI.Approval.TypeChange,
+		employeesThreshold: conf.ExternalAPI.Approval.EmployeesThreshold,
+		ttl:                conf.ExternalAPI.Approval.TTL,
+	}
+
+	blobs, err := blobstore.New(conf)
+	if err != nil {
+		return fmt.Errorf("setup blob store error: %w", err)
+	}
 
 	// init grpc server and register it
-	validator := auth.NewJWTValidator(storage.DB(), "HS256", jwtSecret)
+	validator := auth.NewJWTValidator(storage.Repo(), "HS256", jwtSecret)
 	// ctx := context.Background()
-	grpcServer := grpc.NewServer() // getgRPCServerOptions()...
+	grpcServer = grpc.NewServer(append(getgRPCServerOptions(),
+		grpc.ChainUnaryInterceptor(idempotencyInterceptor(validator, storage.Repo(), conf.ExternalAPI.IdempotencyTTL)),
+	)...)
+	if conf.ExternalAPI.IdempotencyTTL > 0 {
+		go purgeIdempotencyKeys(ctx, storage.Repo())
+	}
+	// the requests made before the policy was disabled expire too
+	go expireChangeRequests(ctx, storage.Repo())
 
 	// RegisterInternalServiceServer(grpcServer, NewMainAPI()) // temp no validator
-	RegisterCompanyServiceServer(grpcServer, NewCompanyAPI(validator))
+	companyAPI = NewCompanyAPI(validator, storage.Repo(), blobs, conf.ExternalAPI.MaxAttachmentSize)
+	go companyAPI.purgeOrphanAttachments(ctx)
+	RegisterCompanyServiceServer(grpcServer, companyAPI)
+	registerHealthServer(ctx, grpcServer)
 
 	return startHTTPServer(ctx, conf, grpcServer)
 }
 
+func getgRPCServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.UnaryInterceptor(otelgrpc.UnaryServerInterceptor()),
+		grpc.StreamInterceptor(otelgrpc.StreamServerInterceptor()),
+	}
+}
+
 // startHTTPServer init http1/http2 servers
 // setup the client http interface variable
 // we need to start the gRPC service first, as it is used by the
@@ -65,15 +118,20 @@ func startHTTPServer(ctx context.Context,
 	if grpcServer == nil {
 		return fmt.Errorf("grpcServer is nil")
 	}
-	var err error
-	var clientHTTPHandler http.Handler
+
+	// setup the HTTP handler
+	clientHTTPHandler, err := setupHTTPAPI(conf)
+	if err != nil {
+		return err
+	}
+
 	// switch between gRPC and "plain" http handler
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.ProtoMajor == 2 &&
 			strings.Contains(
 				r.Header.Get("Content-Type"),
 				"application/grpc") {
-			grpcServer.ServeHTTP(w, r)
+			serveGRPC(grpcServer, w, r)
 		} else {
 			if clientHTTPHandler == nil {
 				w.WriteHeader(http.StatusNotImplemented)
@@ -96,6 +154,11 @@ func startHTTPServer(ctx context.Context,
 		}
 	})
 
+	httpServer = &http.Server{
+		Addr:    bind,
+		Handler: h2c.NewHandler(handler, &http2.Server{}),
+	}
+
 	// start the API server
 	go func() {
 		log.WithFields(log.Fields{
@@ -104,32 +167,97 @@ func startHTTPServer(ctx context.Context,
 			"tls-key":  tlsKey,
 		}).Info("api/external: starting api server ...")
 
+		var err error
 		if tlsCert == "" || tlsKey == "" {
-			log.Fatal(http.ListenAndServe(bind, h2c.NewHandler(handler, &http2.Server{})))
+			err = httpServer.ListenAndServe()
 		} else {
-			log.Fatal(http.ListenAndServeTLS(
-				bind,
-				tlsCert,
-				tlsKey,
-				h2c.NewHandler(handler, &http2.Server{}),
-			))
+			err = httpServer.ListenAndServeTLS(tlsCert, tlsKey)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
 		}
 	}()
 
-	// setup the HTTP handler
-	clientHTTPHandler, err = setupHTTPAPI(conf)
+	return nil
+}
+
+// serveGRPC serves the gRPC request and keeps track of it, so that Shutdown
+// can wait for it.
+func serveGRPC(grpcServer *grpc.Server, w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt64(&grpcRequests, 1)
+	defer atomic.AddInt64(&grpcRequests, -1)
+
+	if atomic.LoadInt32(&shuttingDown) == 1 {
+		// trailers-only response with the UNAVAILABLE status
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Grpc-Status", "14")
+		w.Header().Set("Grpc-Message", "server is shutting down")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	grpcServer.ServeHTTP(w, r)
+}
+
+// Shutdown gracefully stops the api server. It stops accepting new
+// connections, waits for the in-flight HTTP and gRPC requests to complete
+// and then stops the gRPC server. When ctx expires first, the remaining
+// gRPC requests are cancelled.
+func Shutdown(ctx context.Context) error {
+	if httpServer == nil {
+		return nil
+	}
+
+	log.Info("api/external: shutting down api server ...")
+
+	// this waits for the in-flight grpc-gateway requests, including their
+	// gRPC calls over the loopback connection
+	err := httpServer.Shutdown(ctx)
 	if err != nil {
-		return err
+		err = fmt.Errorf("http server shutdown error: %w", err)
+	}
+
+	atomic.StoreInt32(&shuttingDown, 1)
+	if wErr := waitGRPCRequests(ctx); wErr != nil {
+		grpcServer.Stop()
+		if err == nil {
+			err = fmt.Errorf("wait for grpc requests error: %w", wErr)
+		}
+	} else {
+		grpcServer.GracefulStop()
+	}
+
+	if gatewayCancel != nil {
+		gatewayCancel()
 	}
 
+	return err
+}
+
+// waitGRPCRequests waits until all the in-flight gRPC requests are completed
+// or ctx expires.
+func waitGRPCRequests(ctx context.Context) error {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for atomic.LoadInt64(&grpcRequests) > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
 	return nil
 }
 
 func setupHTTPAPI(conf config.Config) (http.Handler, error) {
 	r := mux.NewRouter()
 
-	// setup json api handler
-	jsonHandler, err := getJSONGateway(context.Background())
+	// setup json api handler, its connection to the gRPC server is closed
+	// by Shutdown
+	var gatewayCtx context.Context
+	gatewayCtx, gatewayCancel = context.WithCancel(context.Background())
+	jsonHandler, err := getJSONGateway(gatewayCtx)
 	if err != nil {
 		return nil, err
 	}
@@ -144,17 +272,53 @@ func setupHTTPAPI(conf config.Config) (http.Handler, error) {
 		}
 		w.Write(data)
 	}).Methods("get")
+	// the export is served as a file download instead of the JSON stream
+	// of the gateway
+	r.HandleFunc("/api/Companies:export", companyAPI.exportHandler).Methods("get")
+	// the attachments are uploaded and downloaded as files too
+	r.HandleFunc("/api/Companies/{company_id}/attachments", companyAPI.uploadHandler).Methods("post")
+	r.HandleFunc("/api/Companies/{company_id}/attachments/{id}:download", companyAPI.downloadHandler).Methods("get")
 	r.PathPrefix("/api").Handler(jsonHandler)
 
+	// setup the health endpoints
+	r.HandleFunc("/healthz", healthzHandler).Methods("get")
+	r.HandleFunc("/readyz", readyzHandler).Methods("get")
+
 	// setup static file server
 	r.PathPrefix("/").Handler(http.FileServer(http.FS(static.FS)))
 
-	return r, nil
+	return otelhttp.NewHandler(r, "api/external",
+		otelhttp.WithSpanNameFormatter(func(operation string, r *http.Request) string {
+			return r.Method + " " + r.URL.Path
+		}),
+		// do not trace the probes
+		otelhttp.WithFilter(func(r *http.Request) bool {
+			return r.URL.Path != "/healthz" && r.URL.Path != "/readyz"
+		}),
+	), nil
+}
+
+// httpAuthContext returns the context of the request of a plain HTTP
+// handler with the JWT of the Authorization or the
+// Grpc-Metadata-Authorization header, as the api methods expect it.
+func httpAuthContext(r *http.Request) context.Context {
+	token := r.Header.Get("Authorization")
+	if token == "" {
+		token = r.Header.Get("Grpc-Metadata-Authorization")
+	}
+	ctx := r.Context()
+	if token != "" {
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", token))
+	}
+	return ctx
 }
 
 func getJSONGateway(ctx context.Context) (http.Handler, error) {
 	// dial options for the grpc-gateway
-	var grpcDialOpts []grpc.DialOption
+	grpcDialOpts := []grpc.DialOption{
+		grpc.WithUnaryInterceptor(otelgrpc.UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(otelgrpc.StreamClientInterceptor()),
+	}
 
 	if tlsCert == "" || tlsKey == "" {
 		grpcDialOpts = append(grpcDialOpts, grpc.WithInsecure())
@@ -180,13 +344,19 @@ func getJSONGateway(ctx context.Context) (http.Handler, error) {
 	}
 	apiEndpoint := fmt.Sprintf("localhost:%s", bindParts[1])
 
-	mux := runtime.NewServeMux(runtime.WithMarshalerOption(
-		runtime.MIMEWildcard,
-		&runtime.JSONPb{
-			EnumsAsInts:  false,
-			EmitDefaults: true,
-		},
-	))
+	mux := runtime.NewServeMux(
+		runtime.WithMarshalerOption(
+			runtime.MIMEWildcard,
+			&runtime.JSONPb{
+				EnumsAsInts:  false,
+				EmitDefaults: true,
+			},
+		),
+		runtime.WithIncomingHeaderMatcher(incomingHeaderMatcher),
+		runtime.WithOutgoingHeaderMatcher(outgoingHeaderMatcher),
+		runtime.WithForwardResponseOption(changeRequestResponseStatus),
+		runtime.WithProtoErrorHandler(httpError),
+	)
 
 	if err := RegisterCompanyServiceHandlerFromEndpoint(
 		ctx, mux, apiEndpoint, grpcDialOpts); err != nil {
@@ -195,3 +365,25 @@ func getJSONGateway(ctx context.Context) (http.Handler, error) {
 
 	return mux, nil
 }
+
+// incomingHeaderMatcher forwards the Idempotency-Key header to the gRPC
+// metadata, in addition to the default headers.
+func incomingHeaderMatcher(key string) (string, bool) {
+	if strings.EqualFold(key, "Idempotency-Key") {
+		return idempotencyKeyMetadata, true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// outgoingHeaderMatcher returns the Idempotency-Replayed header of the
+// replayed responses and the Change-Request-Id header of the changes waiting
+// for an approval, the other metadata with the default prefix.
+func outgoingHeaderMatcher(key string) (string, bool) {
+	if key == idempotencyReplayedMetadata {
+		return "Idempotency-Replayed", true
+	}
+	if key == changeRequestIDMetadata {
+		return "Change-Request-Id", true
+	}
+	return fmt.Sprintf("%s%s", runtime.MetadataHeaderPrefix, key), true
+}
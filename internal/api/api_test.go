@@ -0,0 +1,47 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func TestShutdownHelpers(t *testing.T) {
+	t.Run("waitGRPCRequests", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(waitGRPCRequests(context.Background()))
+
+		atomic.AddInt64(&grpcRequests, 1)
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		assert.Equal(context.DeadlineExceeded, waitGRPCRequests(ctx))
+
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			atomic.AddInt64(&grpcRequests, -1)
+		}()
+		assert.NoError(waitGRPCRequests(context.Background()))
+	})
+
+	t.Run("serveGRPC rejects new requests while shutting down", func(t *testing.T) {
+		assert := require.New(t)
+
+		atomic.StoreInt32(&shuttingDown, 1)
+		defer atomic.StoreInt32(&shuttingDown, 0)
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api.CompanyService/Get", nil)
+		serveGRPC(grpc.NewServer(), rec, req)
+
+		assert.Equal(http.StatusOK, rec.Code)
+		assert.Equal("14", rec.Header().Get("Grpc-Status"))
+		assert.Equal(int64(0), atomic.LoadInt64(&grpcRequests))
+	})
+}
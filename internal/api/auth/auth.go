@@ -6,12 +6,12 @@ import (
 
 	"github.com/gofrs/uuid"
 	jwt "github.com/golang-jwt/jwt/v4"
-	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc/metadata"
-	// "github.com/fancar/tmp_xm/internal/storage"
+
+	"github.com/fancar/tmp_xm/internal/storage"
 )
 
 var validAuthorizationRegexp = regexp.MustCompile(`(?i)^bearer (.*)$`)
@@ -45,7 +45,7 @@ type Validator interface {
 	GetSubject(context.Context) (string, error)
 
 	// GetUser returns the user object.
-	// GetUser(context.Context) (storage.User, error)
+	GetUser(context.Context) (storage.User, error)
 
 	// GetAPIKey returns the API key ID.
 	GetAPIKeyID(context.Context) (uuid.UUID, error)
@@ -54,19 +54,19 @@ type Validator interface {
 // ValidatorFunc defines the signature of a claim validator function.
 // It returns a bool indicating if the validation passed or failed and an
 // error in case an error occurred (e.g. db connectivity).
-type ValidatorFunc func(sqlx.Queryer, *Claims) (bool, error)
+type ValidatorFunc func(context.Context, storage.UserRepository, *Claims) (bool, error)
 
 // JWTValidator validates JWT tokens.
 type JWTValidator struct {
-	db        sqlx.Ext
+	users     storage.UserRepository
 	secret    string
 	algorithm string
 }
 
 // NewJWTValidator creates a new JWTValidator.
-func NewJWTValidator(db sqlx.Ext, algorithm, secret string) *JWTValidator {
+func NewJWTValidator(users storage.UserRepository, algorithm, secret string) *JWTValidator {
 	return &JWTValidator{
-		db:        db,
+		users:     users,
 		secret:    secret,
 		algorithm: algorithm,
 	}
@@ -85,7 +85,7 @@ func (v JWTValidator) Validate(ctx context.Context, funcs ...ValidatorFunc) erro
 	}
 
 	for _, f := range funcs {
-		ok, err := f(v.db, claims)
+		ok, err := f(ctx, v.users, claims)
 		if err != nil {
 			return errors.Wrap(err, "validator func error")
 		}
@@ -117,27 +117,19 @@ func (v JWTValidator) GetAPIKeyID(ctx context.Context) (uuid.UUID, error) {
 	return claims.APIKeyID, nil
 }
 
-// GetUser returns the user object.
-// func (v JWTValidator) GetUser(ctx context.Context) (storage.User, error) {
-// 	claims, err := v.getClaims(ctx)
-// 	if err != nil {
-// 		return storage.User{}, err
-// 	}
-
-// 	if claims.Subject != SubjectUser {
-// 		return storage.User{}, errors.New("subject must be user")
-// 	}
-
-// 	if claims.UserID != 0 {
-// 		return storage.GetUser(ctx, v.db, claims.UserID)
-// 	}
+// GetUser returns the user of the claims.
+func (v JWTValidator) GetUser(ctx context.Context) (storage.User, error) {
+	claims, err := v.getClaims(ctx)
+	if err != nil {
+		return storage.User{}, err
+	}
 
-// 	if claims.Username != "" {
-// 		return storage.GetUserByEmail(ctx, v.db, claims.Username)
-// 	}
+	if claims.Subject != SubjectUser {
+		return storage.User{}, errors.New("subject must be user")
+	}
 
-// 	return storage.User{}, errors.New("no username or user_id in claims")
-// }
+	return getUser(ctx, v.users, claims)
+}
 
 func (v JWTValidator) getClaims(ctx context.Context) (*Claims, error) {
 	tokenStr, err := getTokenFromContext(ctx)
@@ -10,13 +10,14 @@ import (
 
 	"github.com/gofrs/uuid"
 	jwt "github.com/golang-jwt/jwt/v4"
-	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
+
+	"github.com/fancar/tmp_xm/internal/storage"
 )
 
 func testValidator(pass bool, err error) ValidatorFunc {
-	return func(db sqlx.Queryer, claims *Claims) (bool, error) {
+	return func(ctx context.Context, users storage.UserRepository, claims *Claims) (bool, error) {
 		return pass, err
 	}
 }
@@ -99,3 +100,26 @@ func TestJWTValidator(t *testing.T) {
 	}
 
 }
+
+func TestJWTValidatorGetUser(t *testing.T) {
+	assert := require.New(t)
+
+	v := NewJWTValidator(storage.NewMemoryRepository(), "HS256", "verysecret")
+	contextFor := func(claims Claims) context.Context {
+		ss, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("verysecret"))
+		assert.NoError(err)
+		return metadata.NewIncomingContext(context.Background(), metadata.MD{
+			"authorization": []string{ss},
+		})
+	}
+
+	u, err := v.GetUser(contextFor(Claims{Username: "admin", StandardClaims: jwt.StandardClaims{Subject: SubjectUser}}))
+	assert.NoError(err)
+	assert.Equal(int64(1), u.ID)
+
+	_, err = v.GetUser(contextFor(Claims{Username: "nobody", StandardClaims: jwt.StandardClaims{Subject: SubjectUser}}))
+	assert.Equal(storage.ErrDoesNotExist, err)
+
+	_, err = v.GetUser(contextFor(Claims{APIKeyID: uuid.Must(uuid.NewV4()), StandardClaims: jwt.StandardClaims{Subject: SubjectAPIKey}}))
+	assert.Error(err)
+}
@@ -1,10 +1,10 @@
 package auth
 
 import (
+	"context"
 	"fmt"
-	"strings"
 
-	"github.com/jmoiron/sqlx"
+	"github.com/fancar/tmp_xm/internal/storage"
 )
 
 // API key subjects.
@@ -33,21 +33,17 @@ func (f Flag) String() string {
 
 // ValidateActiveUser validates if the user in the JWT claim is active.
 func ValidateActiveUser() ValidatorFunc {
-	query := `
-		select
-			1
-		from
-			"user" u
-	`
-
-	where := [][]string{
-		{"(u.username = $1 or u.id = $2)"},
-	}
-
-	return func(db sqlx.Queryer, claims *Claims) (bool, error) {
+	return func(ctx context.Context, users storage.UserRepository, claims *Claims) (bool, error) {
 		switch claims.Subject {
 		case SubjectUser:
-			return executeQuery(db, query, where, claims.Username, claims.UserID)
+			_, err := getUser(ctx, users, claims)
+			if err == storage.ErrDoesNotExist {
+				return false, nil
+			}
+			if err != nil {
+				return false, fmt.Errorf("validator get user error %v", err)
+			}
+			return true, nil
 		case SubjectAPIKey:
 			return false, nil
 		default:
@@ -56,18 +52,53 @@ func ValidateActiveUser() ValidatorFunc {
 	}
 }
 
-func executeQuery(db sqlx.Queryer, query string, where [][]string, args ...interface{}) (bool, error) {
-	var ors []string
-	for _, ands := range where {
-		ors = append(ors, "(("+strings.Join(ands, ") and (")+"))")
+// ValidateIsAdmin validates if the user in the JWT claim is an admin.
+func ValidateIsAdmin() ValidatorFunc {
+	return func(ctx context.Context, users storage.UserRepository, claims *Claims) (bool, error) {
+		if claims.Subject != SubjectUser {
+			return false, nil
+		}
+
+		u, err := getUser(ctx, users, claims)
+		if err == storage.ErrDoesNotExist {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("validator get user error %v", err)
+		}
+		return u.IsAdmin, nil
 	}
-	whereStr := strings.Join(ors, " or ")
-	query = "select count(*) from (" + query + " where " + whereStr + " limit 1) count_only"
+}
 
-	var count int64
+// ValidateIsApprover validates if the user in the JWT claim can approve the
+// change requests, the admins can approve them too.
+func ValidateIsApprover() ValidatorFunc {
+	return func(ctx context.Context, users storage.UserRepository, claims *Claims) (bool, error) {
+		if claims.Subject != SubjectUser {
+			return false, nil
+		}
+
+		u, err := getUser(ctx, users, claims)
+		if err == storage.ErrDoesNotExist {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("validator get user error %v", err)
+		}
+		return u.IsApprover || u.IsAdmin, nil
+	}
+}
 
-	if err := sqlx.Get(db, &count, query, args...); err != nil {
-		return false, fmt.Errorf("validator select error %v", err)
+// getUser returns the user matching the username or the id of the claims.
+func getUser(ctx context.Context, users storage.UserRepository, claims *Claims) (storage.User, error) {
+	if claims.Username != "" {
+		u, err := users.GetUserByUsername(ctx, claims.Username)
+		if err != storage.ErrDoesNotExist || claims.UserID == 0 {
+			return u, err
+		}
+	}
+	if claims.UserID != 0 {
+		return users.GetUser(ctx, claims.UserID)
 	}
-	return count > 0, nil
+	return storage.User{}, storage.ErrDoesNotExist
 }
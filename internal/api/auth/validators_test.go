@@ -40,13 +40,14 @@ func (ts *ValidatorTestSuite) SetupTest() {
 	assert.NoError(storage.MigrateUp(storage.DB().DB))
 }
 
-func (ts *ValidatorTestSuite) CreateUser(username string, isActive, isAdmin bool) (int64, error) {
+func (ts *ValidatorTestSuite) CreateUser(username string, isActive, isAdmin, isApprover bool) (int64, error) {
 	u := storage.User{
-		IsAdmin:  isAdmin,
-		Username: username,
+		IsAdmin:    isAdmin,
+		IsApprover: isApprover,
+		Username:   username,
 	}
 
-	err := storage.CreateUser(context.Background(), storage.DB(), &u)
+	err := storage.Repo().CreateUser(context.Background(), &u)
 	return u.ID, err
 }
 
@@ -62,7 +63,7 @@ func (ts *ValidatorTestSuite) RunTests(t *testing.T, tests []validatorTest) {
 			}
 
 			for _, v := range tst.Validators {
-				ok, err := v(storage.DB(), &tst.Claims)
+				ok, err := v(context.Background(), storage.Repo(), &tst.Claims)
 				assert.NoError(err)
 				assert.Equal(tst.ExpectedOK, ok)
 			}
@@ -74,16 +75,18 @@ func (ts *ValidatorTestSuite) TestUser() {
 	assert := require.New(ts.T())
 
 	users := []struct {
-		id       int64
-		username string
-		isActive bool
-		isAdmin  bool
+		id         int64
+		username   string
+		isActive   bool
+		isAdmin    bool
+		isApprover bool
 	}{
 		// {username: "admin", isAdmin: true},
 		{username: "user", isAdmin: false},
+		{username: "approver", isApprover: true},
 	}
 	for i, user := range users {
-		id, err := ts.CreateUser(user.username, user.isActive, user.isAdmin)
+		id, err := ts.CreateUser(user.username, user.isActive, user.isAdmin, user.isApprover)
 		assert.NoError(err)
 		users[i].id = id
 	}
@@ -102,6 +105,36 @@ func (ts *ValidatorTestSuite) TestUser() {
 				Claims:     Claims{UserID: 9999},
 				ExpectedOK: false,
 			},
+			{
+				Name:       "admin",
+				Validators: []ValidatorFunc{ValidateIsAdmin()},
+				Claims:     Claims{Username: "admin"},
+				ExpectedOK: true,
+			},
+			{
+				Name:       "user is not admin",
+				Validators: []ValidatorFunc{ValidateIsAdmin()},
+				Claims:     Claims{UserID: users[0].id},
+				ExpectedOK: false,
+			},
+			{
+				Name:       "approver",
+				Validators: []ValidatorFunc{ValidateIsApprover()},
+				Claims:     Claims{UserID: users[1].id},
+				ExpectedOK: true,
+			},
+			{
+				Name:       "admin is approver",
+				Validators: []ValidatorFunc{ValidateIsApprover()},
+				Claims:     Claims{Username: "admin"},
+				ExpectedOK: true,
+			},
+			{
+				Name:       "user is not approver",
+				Validators: []ValidatorFunc{ValidateIsApprover()},
+				Claims:     Claims{UserID: users[0].id},
+				ExpectedOK: false,
+			},
 		}
 
 		ts.RunTests(t, tests)
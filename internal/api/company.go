@@ -15,6 +15,7 @@ import (
 
 	"github.com/fancar/tmp_xm/internal/api/auth"
 	"github.com/fancar/tmp_xm/internal/api/helpers"
+	"github.com/fancar/tmp_xm/internal/blobstore"
 	"github.com/fancar/tmp_xm/internal/kafka"
 	"github.com/fancar/tmp_xm/internal/storage"
 )
@@ -22,18 +23,30 @@ import (
 // CompanyAPI exports the internal User related functions.
 type CompanyAPI struct {
 	validator auth.Validator
+	repo      storage.Repository
+	// blobs keeps the contents of the attachments.
+	blobs blobstore.Store
+	// maxAttachmentSize is the max. size (in bytes) of the attachments.
+	maxAttachmentSize int64
 }
 
 // NewCompanyAPI creates a new api for companies funcs.
-func NewCompanyAPI(validator auth.Validator) *CompanyAPI { // validator auth.Validator
+func NewCompanyAPI(validator auth.Validator, repo storage.Repository, blobs blobstore.Store, maxAttachmentSize int64) *CompanyAPI {
 	return &CompanyAPI{
-		validator: validator,
+		validator:         validator,
+		repo:              repo,
+		blobs:             blobs,
+		maxAttachmentSize: maxAttachmentSize,
 	}
 }
 
 // Login validates the login request and returns a JWT token.
 func (a *CompanyAPI) Login(ctx context.Context, req *LoginRequest) (*LoginResponse, error) {
-	jwt, err := storage.LoginUserByPassword(ctx, storage.DB(), req.User, req.Password)
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	jwt, err := storage.LoginUserByPassword(ctx, a.repo, req.User, req.Password)
 	if nil != err {
 		return nil, helpers.ErrToRPCError(err)
 	}
@@ -49,18 +62,28 @@ func (a *CompanyAPI) Create(ctx context.Context,
 	if err := a.validator.Validate(ctx, auth.ValidateActiveUser()); err != nil {
 		return &empty.Empty{}, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
 	}
+	if err := validate(req); err != nil {
+		return nil, err
+	}
 
-	item, err := a.convertCompany(ctx, req.Company)
+	item, err := a.convertNewCompany(ctx, a.repo, req.Company)
 	if err != nil {
-		return nil, grpc.Errorf(codes.InvalidArgument, "check your body: %s", err)
+		return nil, invalidArgument("check your body", prefixed("Company.", err))
 	}
 
-	err = storage.CreateCompany(ctx, storage.DB(), item)
+	user, err := a.validator.GetUser(ctx)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	err = a.repo.Transaction(ctx, func(tx storage.Repository) error {
+		return applyCreate(ctx, tx, user.Username, item, req.Force)
+	})
 	if err != nil {
 		return &empty.Empty{}, helpers.ErrToRPCError(err)
 	}
 
-	go sendEvent(ctx, item, req.Company.Id, "created")
+	sendEvent(ctx, a.companyEvent(ctx, item, "created"), req.Company.Id, "created")
 
 	return &empty.Empty{}, nil
 }
@@ -69,27 +92,29 @@ func (a *CompanyAPI) Create(ctx context.Context,
 func (a *CompanyAPI) Get(ctx context.Context, req *GetCompanyRequest) (*GetCompanyResponse, error) {
 	log.Debug("api/Get request:", req)
 
-	ID, err := uuid.FromString(req.Id)
-	if err != nil {
-		return nil, grpc.Errorf(codes.InvalidArgument, "bad value: %s", err)
+	if err := validate(req); err != nil {
+		return nil, err
 	}
+	ID := uuid.FromStringOrNil(req.Id)
 
 	result := &GetCompanyResponse{}
-	d, err := storage.GetCompany(ctx, storage.DB(), ID)
+	d, err := a.repo.GetCompany(ctx, ID)
+	if err == storage.ErrDoesNotExist {
+		// the company may have been merged into another one
+		target, rErr := a.repo.GetCompanyRedirect(ctx, ID)
+		if rErr == nil {
+			d, err = a.repo.GetCompany(ctx, target)
+			result.MergedInto = target.String()
+		} else if rErr != storage.ErrDoesNotExist {
+			err = rErr
+		}
+	}
 	if err != nil {
-		return result, helpers.ErrToRPCError(err)
+		return &GetCompanyResponse{}, helpers.ErrToRPCError(err)
 	}
 
-	return &GetCompanyResponse{
-		Company: &Company{
-			Id:           d.ID.String(),
-			Name:         d.Name,
-			Description:  d.Description,
-			Employeescnt: d.EmployeesCnt,
-			Registered:   d.Registered,
-			Type:         CompanyType(d.Type),
-		},
-	}, nil
+	result.Company = companyFromStorage(d)
+	return result, nil
 }
 
 // Update the item
@@ -99,18 +124,36 @@ func (a *CompanyAPI) Update(ctx context.Context, req *UpdateCompanyRequest) (*em
 	if err := a.validator.Validate(ctx, auth.ValidateActiveUser()); err != nil {
 		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
 	}
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	item, err := a.convertCompany(ctx, a.repo, req.Company)
+	if err != nil {
+		return nil, invalidArgument("bad value", prefixed("Company.", err))
+	}
 
-	item, err := a.convertCompany(ctx, req.Company)
+	user, err := a.validator.GetUser(ctx)
 	if err != nil {
-		return nil, grpc.Errorf(codes.InvalidArgument, "bad value: %s", err)
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
 	}
 
-	err = storage.UpdateCompany(ctx, storage.DB(), item)
+	var cr *storage.ChangeRequest
+	err = a.repo.Transaction(ctx, func(tx storage.Repository) error {
+		var err error
+		cr, err = a.applyUpdate(ctx, tx, user, req, item)
+		return err
+	})
 	if err != nil {
 		return nil, helpers.ErrToRPCError(err)
 	}
 
-	go sendEvent(ctx, item, req.Company.Id, "updated")
+	if cr != nil {
+		changeRequested(ctx, cr)
+		return &empty.Empty{}, nil
+	}
+
+	sendEvent(ctx, a.companyEvent(ctx, item, "updated"), req.Company.Id, "updated")
 
 	return &empty.Empty{}, nil
 }
@@ -122,56 +165,268 @@ func (a *CompanyAPI) Delete(ctx context.Context, req *DeleteCompanyRequest) (*em
 	if err := a.validator.Validate(ctx, auth.ValidateActiveUser()); err != nil {
 		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
 	}
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+	ID := uuid.FromStringOrNil(req.Id)
 
-	ID, err := uuid.FromString(req.Id)
+	user, err := a.validator.GetUser(ctx)
 	if err != nil {
-		return nil, grpc.Errorf(codes.InvalidArgument, "bad value: %s", err)
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
 	}
 
-	err = storage.DeleteCompany(ctx, storage.DB(), ID)
+	var d companyDeletion
+	err = a.repo.Transaction(ctx, func(tx storage.Repository) error {
+		var err error
+		d, err = a.applyDelete(ctx, tx, user, req)
+		return err
+	})
 	if err != nil {
 		return nil, helpers.ErrToRPCError(err)
 	}
 
-	go sendEvent(ctx, nil, req.Id, "deleted")
+	if d.cr != nil {
+		changeRequested(ctx, d.cr)
+		return &empty.Empty{}, nil
+	}
+
+	a.sendDeleteEvents(ctx, ID, d.deleted, d.reparented)
 
 	return &empty.Empty{}, nil
 }
 
-// convertCompany validates all the fields and converts it to local struct
-func (a *CompanyAPI) convertCompany(ctx context.Context, in *Company) (*storage.Company, error) {
+// applyCreate creates the company and records its initial status, without
+// force it fails if the company may be a duplicate of an existing one. It
+// must be called in a transaction.
+func applyCreate(ctx context.Context, tx storage.Repository, username string, item *storage.Company, force bool) error {
+	if !force {
+		if err := checkDuplicates(ctx, tx, item); err != nil {
+			return err
+		}
+	}
+	if err := tx.CreateCompany(ctx, item); err != nil {
+		return err
+	}
+
+	ch := storage.CompanyStatusChange{
+		CompanyID:  item.ID,
+		FromStatus: uint32(CompanyStatus_UnknownStatus),
+		ToStatus:   item.Status,
+		Username:   username,
+	}
+	var err error
+	ch.ID, err = uuid.NewV4()
+	if err != nil {
+		return grpc.Errorf(codes.Internal, "new uuid error: %s", err)
+	}
+	return tx.CreateCompanyStatusChange(ctx, &ch)
+}
 
-	ID, err := uuid.FromString(in.Id)
+// applyUpdate updates the company, or creates the change request of the
+// update if the approval policy requires it. The company can't be changed
+// while it has a pending change request, which is applied as requested once
+// approved. It must be called in a transaction.
+func (a *CompanyAPI) applyUpdate(ctx context.Context, tx storage.Repository, user storage.User, req *UpdateCompanyRequest, item *storage.Company) (*storage.ChangeRequest, error) {
+	old, err := tx.GetCompany(ctx, item.ID)
 	if err != nil {
 		return nil, err
 	}
+	if approval.requiresUpdateApproval(old, *item) {
+		return a.requestChange(ctx, tx, user, item.ID, ChangeKind_CompanyUpdate, req)
+	}
 
-	if in.Name == "" {
-		return nil, fmt.Errorf("you must specify the 'name' field")
+	if err := checkNoPendingChange(ctx, tx, item.ID); err != nil {
+		return nil, err
+	}
+	if err := tx.UpdateCompany(ctx, item); err != nil {
+		return nil, err
 	}
+	return nil, recordFieldChanges(ctx, tx, user.Username, old, *item)
+}
+
+// companyDeletion is the result of a deletion: the change request waiting
+// for its approval, or the deleted and the reparented subsidiaries.
+type companyDeletion struct {
+	cr         *storage.ChangeRequest
+	deleted    []uuid.UUID
+	reparented []storage.CompanyNode
+}
 
-	if in.Employeescnt == 0 {
-		return nil, fmt.Errorf("you must specify 'EmployeesCnt'")
+// applyDelete deletes the company as requested, or creates the change
+// request of the deletion if the approval policy requires it. It must be
+// called in a transaction.
+func (a *CompanyAPI) applyDelete(ctx context.Context, tx storage.Repository, user storage.User, req *DeleteCompanyRequest) (companyDeletion, error) {
+	var d companyDeletion
+	id := uuid.FromStringOrNil(req.Id)
+
+	if approval.delete {
+		if _, err := tx.GetCompany(ctx, id); err != nil {
+			return d, err
+		}
+		var err error
+		d.cr, err = a.requestChange(ctx, tx, user, id, ChangeKind_CompanyDeletion, req)
+		return d, err
 	}
 
-	if in.Type.Number() == 0 {
-		return nil, fmt.Errorf("you must specify 'Type'")
+	var err error
+	d.deleted, d.reparented, err = deleteCompany(ctx, tx, id, req.Children)
+	return d, err
+}
+
+// deleteCompany deletes the company and handles its subsidiaries as given,
+// it returns the deleted and the reparented subsidiaries. It must be called
+// in a transaction.
+func deleteCompany(ctx context.Context, tx storage.Repository, id uuid.UUID, children DeleteChildren) ([]uuid.UUID, []storage.CompanyNode, error) {
+	var deleted []uuid.UUID
+	var reparented []storage.CompanyNode
+
+	switch children {
+	case DeleteChildren_CascadeChildren:
+		descendants, err := tx.GetCompanyDescendants(ctx, id)
+		if err != nil {
+			return nil, nil, err
+		}
+		// the deepest first
+		for i := len(descendants) - 1; i >= 0; i-- {
+			if err := tx.DeleteCompany(ctx, descendants[i].ID); err != nil {
+				return nil, nil, err
+			}
+			deleted = append(deleted, descendants[i].ID)
+		}
+	case DeleteChildren_ReparentChildren:
+		descendants, err := tx.GetCompanyDescendants(ctx, id)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, d := range descendants {
+			if d.Depth == 1 {
+				reparented = append(reparented, d)
+			}
+		}
+		if err := tx.ReparentCompanyChildren(ctx, id); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := tx.DeleteCompany(ctx, id); err != nil {
+		return nil, nil, err
+	}
+	return deleted, reparented, nil
+}
+
+// sendDeleteEvents sends the deleted events of the company and of its
+// deleted subsidiaries and the updated events of the reparented ones.
+func (a *CompanyAPI) sendDeleteEvents(ctx context.Context, id uuid.UUID, deleted []uuid.UUID, reparented []storage.CompanyNode) {
+	for _, id := range deleted {
+		sendEvent(ctx, nil, id.String(), "deleted")
+	}
+	sendEvent(ctx, nil, id.String(), "deleted")
+	for _, d := range reparented {
+		c, err := a.repo.GetCompany(ctx, d.ID)
+		if err != nil {
+			log.WithError(err).WithField("company_id", d.ID).Error("api: get reparented company error")
+			continue
+		}
+		sendEvent(ctx, a.companyEvent(ctx, &c, "updated"), d.ID.String(), "updated")
+	}
+}
+
+// convertCompany validates all the fields and converts it to local struct,
+// the violations are returned relative to the company. The attributes are
+// validated by the definitions read from repo.
+func (a *CompanyAPI) convertCompany(ctx context.Context, repo storage.Repository, in *Company) (*storage.Company, error) {
+	if in == nil {
+		return nil, fmt.Errorf("the company is empty")
+	}
+
+	var violations fieldViolations
+	validateMessage(in.ProtoReflect(), "", &violations)
+	if err := violations.err(); err != nil {
+		return nil, err
 	}
 
 	result := &storage.Company{
-		ID:           ID,
+		ID:           uuid.FromStringOrNil(in.Id),
 		Name:         in.Name,
 		Description:  in.Description,
 		EmployeesCnt: in.Employeescnt,
 		Registered:   in.Registered,
 		Type:         uint32(in.Type.Number()),
+		Status:       uint32(initialStatus(in)),
+	}
+	if in.ParentId != "" {
+		result.ParentID = uuid.NullUUID{UUID: uuid.FromStringOrNil(in.ParentId), Valid: true}
+	}
+	if len(in.Labels) != 0 {
+		result.Labels = storage.CompanyLabels(in.Labels)
+	}
+	convertCompanyIdentifiers(in, result)
+	if err := convertCompanyAttributes(ctx, repo, in, result); err != nil {
+		return nil, err
 	}
 
 	return result, nil
 }
 
-// sendEvent prepeares data and sends the event via kafka producer
-func sendEvent(ctx context.Context, item *storage.Company, id, event string) {
+// convertNewCompany converts the given company like convertCompany and
+// checks its initial status.
+func (a *CompanyAPI) convertNewCompany(ctx context.Context, repo storage.Repository, in *Company) (*storage.Company, error) {
+	item, err := a.convertCompany(ctx, repo, in)
+	if err != nil {
+		return nil, err
+	}
+
+	var violations fieldViolations
+	checkInitialStatus(in, &violations)
+	if err := violations.err(); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// companyEvent is the payload of the company events: the company with its
+// addresses and contacts.
+type companyEvent struct {
+	*storage.Company
+	Addresses []storage.CompanyAddress
+	Contacts  []storage.CompanyContact
+}
+
+// companyEvent returns the payload of the given event of the company, nil
+// if there is no company. The addresses and contacts are loaded, except for
+// the created companies which have none.
+func (a *CompanyAPI) companyEvent(ctx context.Context, item *storage.Company, event string) *companyEvent {
+	if item == nil {
+		return nil
+	}
+
+	ev := &companyEvent{
+		Company:   item,
+		Addresses: []storage.CompanyAddress{},
+		Contacts:  []storage.CompanyContact{},
+	}
+	if event == "created" {
+		return ev
+	}
+
+	addresses, err := a.repo.GetCompanyAddresses(ctx, item.ID)
+	if err != nil {
+		log.WithError(err).WithField("company_id", item.ID).Error("api: load event addresses error")
+		return ev
+	}
+	contacts, err := a.repo.GetCompanyContacts(ctx, item.ID)
+	if err != nil {
+		log.WithError(err).WithField("company_id", item.ID).Error("api: load event contacts error")
+		return ev
+	}
+
+	ev.Addresses = append(ev.Addresses, addresses...)
+	ev.Contacts = append(ev.Contacts, contacts...)
+	return ev
+}
+
+// sendEvent prepeares data and sends the event via kafka producer, in the
+// background
+func sendEvent(ctx context.Context, item *companyEvent, id, event string) {
 	b := []byte{}
 	var err error
 	if item != nil {
@@ -184,5 +439,13 @@ func sendEvent(ctx context.Context, item *storage.Company, id, event string) {
 			return
 		}
 	}
-	kafka.PublishMessage(ctx, id, event, b)
+	publishEvent(ctx, id, event, b)
+}
+
+// publishEvent publishes the marshalled event of the company in the
+// background, the shutdown waits for it.
+func publishEvent(ctx context.Context, id, event string, b []byte) {
+	kafka.Go(func() {
+		kafka.PublishMessage(ctx, id, event, b)
+	})
 }
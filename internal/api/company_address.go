@@ -0,0 +1,180 @@
+package api
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/ptypes/empty"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/fancar/tmp_xm/internal/api/auth"
+	"github.com/fancar/tmp_xm/internal/api/helpers"
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+// CreateAddress creates the given address of the company.
+func (a *CompanyAPI) CreateAddress(ctx context.Context, req *CreateAddressRequest) (*Address, error) {
+	log.Debug("api/CreateAddress request:", req)
+
+	companyID, err := a.validateSubresource(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	item := convertAddress(req.Address)
+	item.ID, err = uuid.NewV4()
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, "new uuid error: %s", err)
+	}
+	item.CompanyID = companyID
+
+	if err := a.repo.CreateCompanyAddress(ctx, item); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	a.sendSubresourceEvent(ctx, companyID)
+
+	return addressFromStorage(*item), nil
+}
+
+// GetAddress returns the address of the company.
+func (a *CompanyAPI) GetAddress(ctx context.Context, req *GetAddressRequest) (*Address, error) {
+	log.Debug("api/GetAddress request:", req)
+
+	companyID, err := a.validateSubresource(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	id := uuid.FromStringOrNil(req.Id)
+
+	item, err := a.repo.GetCompanyAddress(ctx, companyID, id)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+	return addressFromStorage(item), nil
+}
+
+// UpdateAddress updates the given address of the company.
+func (a *CompanyAPI) UpdateAddress(ctx context.Context, req *UpdateAddressRequest) (*Address, error) {
+	log.Debug("api/UpdateAddress request:", req)
+
+	companyID, err := a.validateSubresource(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	item := convertAddress(req.Address)
+	item.ID = uuid.FromStringOrNil(req.Address.Id)
+	item.CompanyID = companyID
+
+	if err := a.repo.UpdateCompanyAddress(ctx, item); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	a.sendSubresourceEvent(ctx, companyID)
+
+	return addressFromStorage(*item), nil
+}
+
+// DeleteAddress deletes the address of the company.
+func (a *CompanyAPI) DeleteAddress(ctx context.Context, req *DeleteAddressRequest) (*empty.Empty, error) {
+	log.Debug("api/DeleteAddress request:", req)
+
+	companyID, err := a.validateSubresource(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	id := uuid.FromStringOrNil(req.Id)
+
+	if err := a.repo.DeleteCompanyAddress(ctx, companyID, id); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	a.sendSubresourceEvent(ctx, companyID)
+
+	return &empty.Empty{}, nil
+}
+
+// ListAddresses returns the addresses of the company.
+func (a *CompanyAPI) ListAddresses(ctx context.Context, req *ListAddressesRequest) (*ListAddressesResponse, error) {
+	log.Debug("api/ListAddresses request:", req)
+
+	companyID, err := a.validateSubresource(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// an unknown company has no addresses, tell it apart
+	if _, err := a.repo.GetCompany(ctx, companyID); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+	list, err := a.repo.GetCompanyAddresses(ctx, companyID)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	resp := &ListAddressesResponse{Addresses: make([]*Address, 0, len(list))}
+	for _, item := range list {
+		resp.Addresses = append(resp.Addresses, addressFromStorage(item))
+	}
+	return resp, nil
+}
+
+// subresourceRequest is a request on a sub-resource of a company.
+type subresourceRequest interface {
+	proto.Message
+	GetCompanyId() string
+}
+
+// validateSubresource authenticates and validates the request on a
+// sub-resource of the company and returns the company ID.
+func (a *CompanyAPI) validateSubresource(ctx context.Context, req subresourceRequest) (uuid.UUID, error) {
+	if err := a.validator.Validate(ctx, auth.ValidateActiveUser()); err != nil {
+		return uuid.Nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+	if err := validate(req); err != nil {
+		return uuid.Nil, err
+	}
+	return uuid.FromStringOrNil(req.GetCompanyId()), nil
+}
+
+// sendSubresourceEvent sends the updated event of the given company after
+// a change of its addresses or contacts.
+func (a *CompanyAPI) sendSubresourceEvent(ctx context.Context, companyID uuid.UUID) {
+	c, err := a.repo.GetCompany(ctx, companyID)
+	if err != nil {
+		log.WithError(err).WithField("company_id", companyID).Error("api: get company of the event error")
+		return
+	}
+	sendEvent(ctx, a.companyEvent(ctx, &c, "updated"), companyID.String(), "updated")
+}
+
+// convertAddress converts the given validated address, without its IDs.
+func convertAddress(in *Address) *storage.CompanyAddress {
+	return &storage.CompanyAddress{
+		Type:       uint32(in.Type),
+		Country:    strings.ToUpper(strings.TrimSpace(in.Country)),
+		Region:     in.Region,
+		City:       in.City,
+		PostalCode: in.PostalCode,
+		Line1:      in.Line1,
+		Line2:      in.Line2,
+	}
+}
+
+func addressFromStorage(a storage.CompanyAddress) *Address {
+	return &Address{
+		Id:         a.ID.String(),
+		Type:       AddressType(a.Type),
+		Country:    a.Country,
+		Region:     a.Region,
+		City:       a.City,
+		PostalCode: a.PostalCode,
+		Line1:      a.Line1,
+		Line2:      a.Line2,
+	}
+}
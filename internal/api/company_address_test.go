@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+func TestCompanyAddressesContacts(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+
+	repo := storage.NewMemoryRepository()
+	api := NewCompanyAPI(&TestValidator{returnSubject: "user"}, repo, nil, 0)
+
+	company := &Company{
+		Id:           uuid.Must(uuid.NewV4()).String(),
+		Name:         "Acme",
+		Employeescnt: 1,
+		Type:         CompanyType_Corporations,
+	}
+	_, err := api.Create(ctx, &CreateCompanyRequest{Company: company})
+	assert.NoError(err)
+
+	t.Run("Address", func(t *testing.T) {
+		assert := require.New(t)
+
+		a, err := api.CreateAddress(ctx, &CreateAddressRequest{
+			CompanyId: company.Id,
+			Address: &Address{
+				Type:    AddressType_BillingAddress,
+				Country: "cy",
+				City:    "Limassol",
+				Line1:   "1 Main St",
+			},
+		})
+		assert.NoError(err)
+		assert.NotEmpty(a.Id)
+		assert.Equal("CY", a.Country)
+
+		a.City = "Nicosia"
+		_, err = api.UpdateAddress(ctx, &UpdateAddressRequest{CompanyId: company.Id, Address: a})
+		assert.NoError(err)
+
+		resp, err := api.ListAddresses(ctx, &ListAddressesRequest{CompanyId: company.Id})
+		assert.NoError(err)
+		assert.Len(resp.Addresses, 1)
+		assert.Equal("Nicosia", resp.Addresses[0].City)
+
+		_, err = api.ListAddresses(ctx, &ListAddressesRequest{CompanyId: uuid.Must(uuid.NewV4()).String()})
+		assert.Equal(codes.NotFound, status.Code(err))
+
+		_, err = api.DeleteAddress(ctx, &DeleteAddressRequest{CompanyId: company.Id, Id: a.Id})
+		assert.NoError(err)
+		_, err = api.GetAddress(ctx, &GetAddressRequest{CompanyId: company.Id, Id: a.Id})
+		assert.Equal(codes.NotFound, status.Code(err))
+	})
+
+	t.Run("Address validation", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			address *Address
+		}{
+			{"empty", nil},
+			{"no type", &Address{Country: "CY", City: "Limassol", Line1: "1 Main St"}},
+			{"unknown country", &Address{Type: AddressType_RegisteredAddress, Country: "XX", City: "Limassol", Line1: "1 Main St"}},
+			{"no city", &Address{Type: AddressType_RegisteredAddress, Country: "CY", Line1: "1 Main St"}},
+			{"long postal code", &Address{Type: AddressType_RegisteredAddress, Country: "CY", City: "Limassol", Line1: "1 Main St", PostalCode: "123456789012345678901"}},
+		}
+
+		for _, tst := range tests {
+			t.Run(tst.name, func(t *testing.T) {
+				_, err := api.CreateAddress(ctx, &CreateAddressRequest{CompanyId: company.Id, Address: tst.address})
+				require.Equal(t, codes.InvalidArgument, status.Code(err))
+			})
+		}
+	})
+
+	t.Run("Contact", func(t *testing.T) {
+		assert := require.New(t)
+
+		c, err := api.CreateContact(ctx, &CreateContactRequest{
+			CompanyId: company.Id,
+			Contact:   &Contact{Name: "John", Role: "CFO", Email: "john@example.com", Phone: "+35725123456"},
+		})
+		assert.NoError(err)
+
+		got, err := api.GetContact(ctx, &GetContactRequest{CompanyId: company.Id, Id: c.Id})
+		assert.NoError(err)
+		assert.Equal("CFO", got.Role)
+
+		_, err = api.CreateContact(ctx, &CreateContactRequest{
+			CompanyId: uuid.Must(uuid.NewV4()).String(),
+			Contact:   &Contact{Name: "John"},
+		})
+		assert.Equal(codes.NotFound, status.Code(err))
+
+		// the contacts are deleted with the company
+		_, err = api.Delete(ctx, &DeleteCompanyRequest{Id: company.Id})
+		assert.NoError(err)
+		_, err = api.GetContact(ctx, &GetContactRequest{CompanyId: company.Id, Id: c.Id})
+		assert.Equal(codes.NotFound, status.Code(err))
+	})
+
+	t.Run("Contact validation", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			contact *Contact
+		}{
+			{"empty", nil},
+			{"no name", &Contact{Email: "john@example.com"}},
+			{"bad email", &Contact{Name: "John", Email: "John <john@example.com>"}},
+			{"phone without plus", &Contact{Name: "John", Phone: "35725123456"}},
+			{"phone too long", &Contact{Name: "John", Phone: "+1234567890123456"}},
+		}
+
+		for _, tst := range tests {
+			t.Run(tst.name, func(t *testing.T) {
+				_, err := api.CreateContact(ctx, &CreateContactRequest{CompanyId: company.Id, Contact: tst.contact})
+				require.Equal(t, codes.InvalidArgument, status.Code(err))
+			})
+		}
+	})
+}
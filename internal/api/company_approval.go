@@ -0,0 +1,403 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/fancar/tmp_xm/internal/api/auth"
+	"github.com/fancar/tmp_xm/internal/api/helpers"
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+const (
+	// changeRequestIDMetadata is set in the header of the responses of the
+	// changes waiting for an approval, the JSON gateway returns it as the
+	// Change-Request-Id header with the 202 status.
+	changeRequestIDMetadata = "change-request-id"
+
+	// changeCommentMaxLength is the max. length of the comment of a
+	// decision.
+	changeCommentMaxLength = 500
+
+	// changeRequestExpiryInterval defines how often the change requests
+	// are expired.
+	changeRequestExpiryInterval = time.Minute
+)
+
+// approvalPolicy defines the changes which must be approved by a second
+// user, see the external_api.approval settings.
+type approvalPolicy struct {
+	delete             bool
+	typeChange         bool
+	employeesThreshold int32
+	ttl                time.Duration
+}
+
+// enabled returns true if some changes must be approved.
+func (p approvalPolicy) enabled() bool {
+	return p.delete || p.typeChange || p.employeesThreshold > 0
+}
+
+// requiresUpdateApproval returns true if the update of the old company to
+// the new one must be approved.
+func (p approvalPolicy) requiresUpdateApproval(old, new storage.Company) bool {
+	if p.typeChange && old.Type != new.Type {
+		return true
+	}
+	diff := int64(new.EmployeesCnt) - int64(old.EmployeesCnt)
+	if diff < 0 {
+		diff = -diff
+	}
+	return p.employeesThreshold > 0 && diff > int64(p.employeesThreshold)
+}
+
+// changeRequestEvent is the payload of the change_requested,
+// change_approved, change_rejected and change_expired events, the kind and
+// the status are the values of ChangeKind and ChangeRequestStatus.
+type changeRequestEvent struct {
+	ID          uuid.UUID
+	CompanyID   uuid.UUID
+	Kind        uint32
+	Status      uint32
+	RequestedBy string
+	DecidedBy   string
+	Comment     string
+	ExpiresAt   time.Time
+}
+
+// requestChange creates the pending change request of the given API
+// request in the given transaction, FailedPrecondition is returned if the
+// company already has one.
+func (a *CompanyAPI) requestChange(ctx context.Context, tx storage.Repository, user storage.User, companyID uuid.UUID, kind ChangeKind, req proto.Message) (*storage.ChangeRequest, error) {
+	if err := checkNoPendingChange(ctx, tx, companyID); err != nil {
+		return nil, err
+	}
+
+	payload, err := (&jsonpb.Marshaler{}).MarshalToString(req)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, "marshal change error: %s", err)
+	}
+
+	cr := storage.ChangeRequest{
+		CompanyID:   companyID,
+		ExpiresAt:   time.Now().Add(approval.ttl),
+		Kind:        uint32(kind),
+		Payload:     payload,
+		RequestedBy: user.Username,
+	}
+	cr.ID, err = uuid.NewV4()
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, "new uuid error: %s", err)
+	}
+	if err := tx.CreateChangeRequest(ctx, &cr); err != nil {
+		return nil, err
+	}
+	return &cr, nil
+}
+
+// checkNoPendingChange returns FailedPrecondition if the company has a
+// pending change request, the company can't be changed meanwhile.
+func checkNoPendingChange(ctx context.Context, tx storage.Repository, companyID uuid.UUID) error {
+	pending, err := tx.GetPendingChangeRequest(ctx, companyID)
+	if err == nil {
+		return grpc.Errorf(codes.FailedPrecondition, "the company has the pending change request %s", pending.ID)
+	}
+	if err != storage.ErrDoesNotExist {
+		return err
+	}
+	return nil
+}
+
+// changeRequested returns the id of the given change request in the header
+// of the response and sends its change_requested event.
+func changeRequested(ctx context.Context, cr *storage.ChangeRequest) {
+	if err := grpc.SetHeader(ctx, metadata.Pairs(changeRequestIDMetadata, cr.ID.String())); err != nil {
+		log.WithError(err).Error("api: set change request header error")
+	}
+	sendChangeRequestEvent(ctx, *cr, "change_requested")
+}
+
+// ListChangeRequests returns the change requests, the newest first.
+func (a *CompanyAPI) ListChangeRequests(ctx context.Context, req *ListChangeRequestsRequest) (*ListChangeRequestsResponse, error) {
+	log.Debug("api/ListChangeRequests request:", req)
+
+	if err := a.validator.Validate(ctx, auth.ValidateActiveUser()); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	filters := storage.ChangeRequestFilters{Status: uint32(req.Status)}
+	if req.CompanyId != "" {
+		filters.CompanyID = uuid.NullUUID{UUID: uuid.FromStringOrNil(req.CompanyId), Valid: true}
+	}
+
+	list, err := a.repo.GetChangeRequests(ctx, filters)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	resp := &ListChangeRequestsResponse{ChangeRequests: make([]*ChangeRequest, 0, len(list))}
+	for _, cr := range list {
+		resp.ChangeRequests = append(resp.ChangeRequests, changeRequestFromStorage(cr))
+	}
+	return resp, nil
+}
+
+// GetChangeRequest returns the change request.
+func (a *CompanyAPI) GetChangeRequest(ctx context.Context, req *GetChangeRequestRequest) (*ChangeRequest, error) {
+	log.Debug("api/GetChangeRequest request:", req)
+
+	if err := a.validator.Validate(ctx, auth.ValidateActiveUser()); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	cr, err := a.repo.GetChangeRequest(ctx, uuid.FromStringOrNil(req.Id))
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+	return changeRequestFromStorage(cr), nil
+}
+
+// ApproveChangeRequest applies the pending change and records its
+// approval.
+func (a *CompanyAPI) ApproveChangeRequest(ctx context.Context, req *DecideChangeRequestRequest) (*ChangeRequest, error) {
+	log.Debug("api/ApproveChangeRequest request:", req)
+
+	var deleted []uuid.UUID
+	var reparented []storage.CompanyNode
+	var updated, merged *storage.Company
+	cr, err := a.decideChangeRequest(ctx, req, ChangeRequestStatus_Approved, func(tx storage.Repository, cr storage.ChangeRequest) error {
+		switch ChangeKind(cr.Kind) {
+		case ChangeKind_CompanyUpdate:
+			var ur UpdateCompanyRequest
+			if err := jsonpb.UnmarshalString(cr.Payload, &ur); err != nil {
+				return grpc.Errorf(codes.Internal, "unmarshal change error: %s", err)
+			}
+			item, err := a.convertCompany(ctx, tx, ur.Company)
+			if err != nil {
+				return grpc.Errorf(codes.FailedPrecondition, "bad value: %s", err)
+			}
+			updated = item
+			return updateCompany(ctx, tx, cr.RequestedBy, item)
+		case ChangeKind_CompanyDeletion:
+			var dr DeleteCompanyRequest
+			if err := jsonpb.UnmarshalString(cr.Payload, &dr); err != nil {
+				return grpc.Errorf(codes.Internal, "unmarshal change error: %s", err)
+			}
+			var err error
+			deleted, reparented, err = deleteCompany(ctx, tx, cr.CompanyID, dr.Children)
+			return err
+		case ChangeKind_CompanyMerge:
+			var mr MergeCompaniesRequest
+			if err := jsonpb.UnmarshalString(cr.Payload, &mr); err != nil {
+				return grpc.Errorf(codes.Internal, "unmarshal change error: %s", err)
+			}
+			if err := checkNoPendingChange(ctx, tx, uuid.FromStringOrNil(mr.TargetId)); err != nil {
+				return err
+			}
+			item, err := applyMerge(ctx, tx, cr.RequestedBy, &mr)
+			merged = &item
+			return err
+		default:
+			return grpc.Errorf(codes.Internal, "unknown change kind: %d", cr.Kind)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sendChangeRequestEvent(ctx, cr, "change_approved")
+	switch {
+	case updated != nil:
+		sendEvent(ctx, a.companyEvent(ctx, updated, "updated"), updated.ID.String(), "updated")
+	case merged != nil:
+		sendMergedEvent(ctx, cr.CompanyID, a.companyEvent(ctx, merged, "merged"))
+	default:
+		a.sendDeleteEvents(ctx, cr.CompanyID, deleted, reparented)
+	}
+
+	return changeRequestFromStorage(cr), nil
+}
+
+// RejectChangeRequest records the rejection of the pending change, which
+// is not applied.
+func (a *CompanyAPI) RejectChangeRequest(ctx context.Context, req *DecideChangeRequestRequest) (*ChangeRequest, error) {
+	log.Debug("api/RejectChangeRequest request:", req)
+
+	cr, err := a.decideChangeRequest(ctx, req, ChangeRequestStatus_Rejected, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	sendChangeRequestEvent(ctx, cr, "change_rejected")
+
+	return changeRequestFromStorage(cr), nil
+}
+
+// decideChangeRequest moves the pending change request to the given status
+// and runs apply, if set, in the same transaction. The decision must be
+// made by an approver other than the requester, before the expiry.
+func (a *CompanyAPI) decideChangeRequest(ctx context.Context, req *DecideChangeRequestRequest, status ChangeRequestStatus,
+	apply func(storage.Repository, storage.ChangeRequest) error) (storage.ChangeRequest, error) {
+	var cr storage.ChangeRequest
+
+	if err := a.validator.Validate(ctx, auth.ValidateIsApprover()); err != nil {
+		return cr, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+	user, err := a.validator.GetUser(ctx)
+	if err != nil {
+		return cr, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	if err := validate(req); err != nil {
+		return cr, err
+	}
+	id := uuid.FromStringOrNil(req.Id)
+
+	err = a.repo.Transaction(ctx, func(tx storage.Repository) error {
+		var err error
+		cr, err = tx.GetChangeRequest(ctx, id)
+		if err != nil {
+			return err
+		}
+		if cr.Status != storage.ChangeRequestPending {
+			return storage.ErrChangeRequestDecided
+		}
+		if !time.Now().Before(cr.ExpiresAt) {
+			return grpc.Errorf(codes.FailedPrecondition, "the change request has expired")
+		}
+		if cr.RequestedBy == user.Username {
+			return grpc.Errorf(codes.PermissionDenied, "the change must be decided by another user than the requester")
+		}
+
+		cr.Status = uint32(status)
+		cr.DecidedBy = user.Username
+		cr.Comment = req.Comment
+		if err := tx.DecideChangeRequest(ctx, &cr); err != nil {
+			return err
+		}
+		if apply != nil {
+			return apply(tx, cr)
+		}
+		return nil
+	})
+	if err != nil {
+		return cr, helpers.ErrToRPCError(err)
+	}
+	return cr, nil
+}
+
+// expireChangeRequests expires the stale change requests and sends their
+// change_expired events until the context is canceled.
+func expireChangeRequests(ctx context.Context, repo storage.ChangeRequestRepository) {
+	ticker := time.NewTicker(changeRequestExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			list, err := repo.ExpireChangeRequests(ctx, time.Now())
+			if err != nil {
+				log.WithError(err).Error("api: expire change requests error")
+				continue
+			}
+			for _, cr := range list {
+				sendChangeRequestEvent(ctx, cr, "change_expired")
+			}
+		}
+	}
+}
+
+// changeRequestFromStorage converts the given change request, with the
+// requested change.
+func changeRequestFromStorage(cr storage.ChangeRequest) *ChangeRequest {
+	out := ChangeRequest{
+		Id:          cr.ID.String(),
+		CompanyId:   cr.CompanyID.String(),
+		Kind:        ChangeKind(cr.Kind),
+		Status:      ChangeRequestStatus(cr.Status),
+		RequestedBy: cr.RequestedBy,
+		DecidedBy:   cr.DecidedBy,
+		Comment:     cr.Comment,
+		CreatedAt:   cr.CreatedAt.UTC().Format(time.RFC3339),
+		ExpiresAt:   cr.ExpiresAt.UTC().Format(time.RFC3339),
+	}
+	if cr.DecidedAt.Valid {
+		out.DecidedAt = cr.DecidedAt.Time.UTC().Format(time.RFC3339)
+	}
+
+	switch out.Kind {
+	case ChangeKind_CompanyUpdate:
+		var ur UpdateCompanyRequest
+		if err := jsonpb.UnmarshalString(cr.Payload, &ur); err != nil {
+			log.WithError(err).WithField("change_request_id", cr.ID).Error("api: unmarshal change error")
+			break
+		}
+		out.Company = ur.Company
+	case ChangeKind_CompanyDeletion:
+		var dr DeleteCompanyRequest
+		if err := jsonpb.UnmarshalString(cr.Payload, &dr); err != nil {
+			log.WithError(err).WithField("change_request_id", cr.ID).Error("api: unmarshal change error")
+			break
+		}
+		out.Children = dr.Children
+	case ChangeKind_CompanyMerge:
+		var mr MergeCompaniesRequest
+		if err := jsonpb.UnmarshalString(cr.Payload, &mr); err != nil {
+			log.WithError(err).WithField("change_request_id", cr.ID).Error("api: unmarshal change error")
+			break
+		}
+		out.Merge = &mr
+	}
+	return &out
+}
+
+// changeRequestResponseStatus returns the 202 status to the JSON gateway
+// clients when the change is waiting for an approval.
+func changeRequestResponseStatus(ctx context.Context, w http.ResponseWriter, _ proto.Message) error {
+	md, ok := runtime.ServerMetadataFromContext(ctx)
+	if ok && len(md.HeaderMD.Get(changeRequestIDMetadata)) != 0 {
+		w.WriteHeader(http.StatusAccepted)
+	}
+	return nil
+}
+
+// sendChangeRequestEvent publishes the given event of the change request.
+func sendChangeRequestEvent(ctx context.Context, cr storage.ChangeRequest, event string) {
+	b, err := json.Marshal(changeRequestEvent{
+		ID:          cr.ID,
+		CompanyID:   cr.CompanyID,
+		Kind:        cr.Kind,
+		Status:      cr.Status,
+		RequestedBy: cr.RequestedBy,
+		DecidedBy:   cr.DecidedBy,
+		Comment:     cr.Comment,
+		ExpiresAt:   cr.ExpiresAt,
+	})
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"company_id": cr.CompanyID,
+			"event":      event,
+		}).Error("unable to marshal data")
+		return
+	}
+	publishEvent(ctx, cr.CompanyID.String(), event, b)
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+func TestCompanyApproval(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+
+	defer func(p approvalPolicy) { approval = p }(approval)
+	approval = approvalPolicy{delete: true, typeChange: true, employeesThreshold: 100, ttl: time.Hour}
+
+	alice := storage.User{ID: 2, Username: "alice"}
+	bob := storage.User{ID: 3, Username: "bob", IsApprover: true}
+	validator := &TestValidator{returnSubject: "user", returnUser: alice}
+	repo := storage.NewMemoryRepository()
+	api := NewCompanyAPI(validator, repo, nil, 0)
+
+	create := func(name string) *Company {
+		c := &Company{
+			Id:           uuid.Must(uuid.NewV4()).String(),
+			Name:         name,
+			Employeescnt: 50,
+			Type:         CompanyType_Corporations,
+		}
+		_, err := api.Create(ctx, &CreateCompanyRequest{Company: c})
+		assert.NoError(err)
+		return c
+	}
+	get := func(id string) *Company {
+		resp, err := api.Get(ctx, &GetCompanyRequest{Id: id})
+		assert.NoError(err)
+		return resp.Company
+	}
+	pending := func(companyID string) *ChangeRequest {
+		resp, err := api.ListChangeRequests(ctx, &ListChangeRequestsRequest{
+			Status:    ChangeRequestStatus_Pending,
+			CompanyId: companyID,
+		})
+		assert.NoError(err)
+		assert.Len(resp.ChangeRequests, 1)
+		return resp.ChangeRequests[0]
+	}
+
+	t.Run("Delete", func(t *testing.T) {
+		assert := require.New(t)
+
+		c := create("Delete Co")
+		validator.returnUser = alice
+		_, err := api.Delete(ctx, &DeleteCompanyRequest{Id: c.Id, Children: DeleteChildren_CascadeChildren})
+		assert.NoError(err)
+		get(c.Id)
+
+		cr := pending(c.Id)
+		assert.Equal(ChangeKind_CompanyDeletion, cr.Kind)
+		assert.Equal(DeleteChildren_CascadeChildren, cr.Children)
+		assert.Equal("alice", cr.RequestedBy)
+
+		// the requester can't approve the change
+		_, err = api.ApproveChangeRequest(ctx, &DecideChangeRequestRequest{Id: cr.Id})
+		assert.Equal(codes.PermissionDenied, status.Code(err))
+
+		validator.returnUser = bob
+		resp, err := api.ApproveChangeRequest(ctx, &DecideChangeRequestRequest{Id: cr.Id, Comment: "checked"})
+		assert.NoError(err)
+		assert.Equal(ChangeRequestStatus_Approved, resp.Status)
+		assert.Equal("bob", resp.DecidedBy)
+		assert.Equal("checked", resp.Comment)
+		assert.NotEmpty(resp.DecidedAt)
+
+		_, err = api.Get(ctx, &GetCompanyRequest{Id: c.Id})
+		assert.Equal(codes.NotFound, status.Code(err))
+
+		// the decided request is kept once the company is gone
+		got, err := api.GetChangeRequest(ctx, &GetChangeRequestRequest{Id: cr.Id})
+		assert.NoError(err)
+		assert.Equal(ChangeRequestStatus_Approved, got.Status)
+		assert.Equal("bob", got.DecidedBy)
+	})
+
+	t.Run("Type change", func(t *testing.T) {
+		assert := require.New(t)
+
+		c := create("Type Co")
+		validator.returnUser = alice
+		c.Type = CompanyType_Cooperative
+		_, err := api.Update(ctx, &UpdateCompanyRequest{Company: c})
+		assert.NoError(err)
+		assert.Equal(CompanyType_Corporations, get(c.Id).Type)
+
+		// the company can't be changed while the change is pending
+		c.Type = CompanyType_Corporations
+		c.Description = "meanwhile"
+		_, err = api.Update(ctx, &UpdateCompanyRequest{Company: c})
+		assert.Equal(codes.FailedPrecondition, status.Code(err))
+
+		cr := pending(c.Id)
+		assert.Equal(ChangeKind_CompanyUpdate, cr.Kind)
+		assert.Equal(CompanyType_Cooperative, cr.Company.Type)
+
+		validator.returnUser = bob
+		resp, err := api.RejectChangeRequest(ctx, &DecideChangeRequestRequest{Id: cr.Id, Comment: "no"})
+		assert.NoError(err)
+		assert.Equal(ChangeRequestStatus_Rejected, resp.Status)
+		assert.Equal(CompanyType_Corporations, get(c.Id).Type)
+
+		// decided once
+		_, err = api.ApproveChangeRequest(ctx, &DecideChangeRequestRequest{Id: cr.Id})
+		assert.Equal(codes.FailedPrecondition, status.Code(err))
+
+		_, err = api.Update(ctx, &UpdateCompanyRequest{Company: c})
+		assert.NoError(err)
+		assert.Equal("meanwhile", get(c.Id).Description)
+	})
+
+	t.Run("Employee count", func(t *testing.T) {
+		assert := require.New(t)
+
+		c := create("Staff Co")
+		validator.returnUser = alice
+
+		// within the threshold
+		c.Employeescnt = 150
+		_, err := api.Update(ctx, &UpdateCompanyRequest{Company: c})
+		assert.NoError(err)
+		assert.Equal(int32(150), get(c.Id).Employeescnt)
+
+		c.Employeescnt = 10
+		_, err = api.Update(ctx, &UpdateCompanyRequest{Company: c})
+		assert.NoError(err)
+		assert.Equal(int32(150), get(c.Id).Employeescnt)
+
+		validator.returnUser = bob
+		_, err = api.ApproveChangeRequest(ctx, &DecideChangeRequestRequest{Id: pending(c.Id).Id})
+		assert.NoError(err)
+		assert.Equal(int32(10), get(c.Id).Employeescnt)
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		assert := require.New(t)
+
+		c := create("Stale Co")
+		validator.returnUser = alice
+		approval.ttl = -time.Minute
+		_, err := api.Delete(ctx, &DeleteCompanyRequest{Id: c.Id})
+		approval.ttl = time.Hour
+		assert.NoError(err)
+		cr := pending(c.Id)
+
+		validator.returnUser = bob
+		_, err = api.ApproveChangeRequest(ctx, &DecideChangeRequestRequest{Id: cr.Id})
+		assert.Equal(codes.FailedPrecondition, status.Code(err))
+
+		expired, err := repo.ExpireChangeRequests(ctx, time.Now())
+		assert.NoError(err)
+		assert.Len(expired, 1)
+		resp, err := api.GetChangeRequest(ctx, &GetChangeRequestRequest{Id: cr.Id})
+		assert.NoError(err)
+		assert.Equal(ChangeRequestStatus_Expired, resp.Status)
+		get(c.Id)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		assert := require.New(t)
+
+		defer func(p approvalPolicy) { approval = p }(approval)
+		approval = approvalPolicy{}
+
+		c := create("Free Co")
+		c.Type = CompanyType_Cooperative
+		_, err := api.Update(ctx, &UpdateCompanyRequest{Company: c})
+		assert.NoError(err)
+		assert.Equal(CompanyType_Cooperative, get(c.Id).Type)
+
+		_, err = api.Delete(ctx, &DeleteCompanyRequest{Id: c.Id})
+		assert.NoError(err)
+		_, err = api.Get(ctx, &GetCompanyRequest{Id: c.Id})
+		assert.Equal(codes.NotFound, status.Code(err))
+	})
+}
@@ -0,0 +1,514 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/gorilla/mux"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/fancar/tmp_xm/internal/api/auth"
+	"github.com/fancar/tmp_xm/internal/api/helpers"
+	"github.com/fancar/tmp_xm/internal/blobstore"
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+const (
+	// attachmentChunkSize is the size of the chunks of the downloads.
+	attachmentChunkSize = 64 << 10
+	// attachmentSniffLength is the number of bytes used to detect the
+	// content type, see http.DetectContentType.
+	attachmentSniffLength = 512
+	// attachmentFormOverhead is the max. size of the multipart form around
+	// the file of the HTTP uploads.
+	attachmentFormOverhead = 64 << 10
+
+	// attachmentPurgeInterval defines how often the contents of the deleted
+	// attachments are deleted from the blob store.
+	attachmentPurgeInterval = 5 * time.Minute
+	// attachmentPurgeBatch is the max. number of attachments purged at once.
+	attachmentPurgeBatch = 100
+)
+
+// sha256Pattern matches the hex encoded SHA-256 checksums.
+var sha256Pattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// errAttachmentTooLarge is returned by the reader of the uploads past the
+// max. size of the attachments.
+var errAttachmentTooLarge = errors.New("attachment too large")
+
+// UploadAttachment stores the file streamed by the client and attaches it to
+// the company.
+func (a *CompanyAPI) UploadAttachment(stream CompanyService_UploadAttachmentServer) error {
+	req, err := stream.Recv()
+	if err == io.EOF {
+		// reported as the missing info
+		req, err = &UploadAttachmentRequest{}, nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Debug("api/UploadAttachment request:", req.Info)
+
+	att, err := a.uploadAttachment(stream.Context(), req.Info, &uploadStreamReader{stream: stream, buf: req.Chunk})
+	if err != nil {
+		return err
+	}
+	return stream.SendAndClose(att)
+}
+
+// uploadAttachment stores the content read from r as an attachment of the
+// company of info. The content type is detected from the content, its size
+// and checksum are computed as it is stored.
+func (a *CompanyAPI) uploadAttachment(ctx context.Context, info *AttachmentInfo, r io.Reader) (*Attachment, error) {
+	if err := a.validator.Validate(ctx, auth.ValidateActiveUser()); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+	if err := validate(&UploadAttachmentRequest{Info: info}); err != nil {
+		return nil, err
+	}
+	user, err := a.validator.GetUser(ctx)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	companyID := uuid.FromStringOrNil(info.CompanyId)
+	if _, err := a.repo.GetCompany(ctx, companyID); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	br := bufio.NewReaderSize(r, attachmentSniffLength)
+	head, err := br.Peek(attachmentSniffLength)
+	if err != nil && err != io.EOF {
+		return nil, a.uploadReadError(err)
+	}
+	if len(head) == 0 {
+		return nil, grpc.Errorf(codes.InvalidArgument, "bad value: the file is empty")
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, "new uuid error: %s", err)
+	}
+	item := &storage.CompanyAttachment{
+		ID:          id,
+		CompanyID:   uuid.NullUUID{UUID: companyID, Valid: true},
+		Filename:    info.Filename,
+		ContentType: http.DetectContentType(head),
+		BlobKey:     "attachments/" + id.String(),
+		UploadedBy:  user.Username,
+	}
+
+	content := &countingReader{r: br, hash: sha256.New(), limit: a.maxAttachmentSize}
+	if err := a.blobs.Put(ctx, item.BlobKey, content); err != nil {
+		switch {
+		case content.err == errAttachmentTooLarge:
+			return nil, grpc.Errorf(codes.InvalidArgument, "bad value: the file is larger than %d bytes", a.maxAttachmentSize)
+		case content.err != nil:
+			return nil, a.uploadReadError(content.err)
+		default:
+			log.WithError(err).WithField("key", item.BlobKey).Error("api/UploadAttachment: put blob error")
+			return nil, grpc.Errorf(codes.Internal, "store file error")
+		}
+	}
+	item.Size = content.n
+	item.SHA256 = hex.EncodeToString(content.hash.Sum(nil))
+
+	if info.Sha256 != "" && !strings.EqualFold(info.Sha256, item.SHA256) {
+		a.deleteBlob(item.BlobKey)
+		var v fieldViolations
+		v.add("info.sha256", "does not match the checksum of the content %s", item.SHA256)
+		return nil, invalidArgument("invalid request", v)
+	}
+
+	if err := a.repo.CreateCompanyAttachment(ctx, item); err != nil {
+		a.deleteBlob(item.BlobKey)
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	log.WithFields(log.Fields{
+		"company_id": companyID,
+		"id":         item.ID,
+		"size":       item.Size,
+	}).Info("api/UploadAttachment: attachment uploaded")
+	return attachmentFromStorage(*item), nil
+}
+
+// DownloadAttachment streams the metadata, then the content of the
+// attachment.
+func (a *CompanyAPI) DownloadAttachment(req *DownloadAttachmentRequest, stream CompanyService_DownloadAttachmentServer) error {
+	log.Debug("api/DownloadAttachment request:", req)
+
+	item, rc, err := a.openAttachment(stream.Context(), req)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if err := stream.Send(&DownloadAttachmentResponse{Attachment: attachmentFromStorage(item)}); err != nil {
+		return err
+	}
+	return readAttachment(rc, item, func(chunk []byte) error {
+		return stream.Send(&DownloadAttachmentResponse{Chunk: chunk})
+	})
+}
+
+// openAttachment returns the metadata and the content of the attachment.
+func (a *CompanyAPI) openAttachment(ctx context.Context, req *DownloadAttachmentRequest) (storage.CompanyAttachment, io.ReadCloser, error) {
+	companyID, err := a.validateSubresource(ctx, req)
+	if err != nil {
+		return storage.CompanyAttachment{}, nil, err
+	}
+
+	item, err := a.repo.GetCompanyAttachment(ctx, companyID, uuid.FromStringOrNil(req.Id))
+	if err != nil {
+		return item, nil, helpers.ErrToRPCError(err)
+	}
+	rc, err := a.blobs.Get(ctx, item.BlobKey)
+	if err == blobstore.ErrNotFound {
+		return item, nil, grpc.Errorf(codes.DataLoss, "the content of the attachment is missing")
+	}
+	if err != nil {
+		log.WithError(err).WithField("key", item.BlobKey).Error("api/DownloadAttachment: get blob error")
+		return item, nil, grpc.Errorf(codes.Internal, "read file error")
+	}
+	return item, rc, nil
+}
+
+// readAttachment calls fn with the chunks of the content of the attachment
+// read from r. The content is checked against the size and the checksum of
+// the metadata once read, fn gets the chunks before, the callers must abort
+// the download on error.
+func readAttachment(r io.Reader, item storage.CompanyAttachment, fn func(chunk []byte) error) error {
+	h := sha256.New()
+	var n int64
+	buf := make([]byte, attachmentChunkSize)
+	for {
+		m, err := io.ReadFull(r, buf)
+		if m > 0 {
+			h.Write(buf[:m])
+			n += int64(m)
+			if err := fn(buf[:m]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			log.WithError(err).WithField("key", item.BlobKey).Error("api/DownloadAttachment: read blob error")
+			return grpc.Errorf(codes.Internal, "read file error")
+		}
+	}
+
+	if n != item.Size || hex.EncodeToString(h.Sum(nil)) != item.SHA256 {
+		log.WithField("key", item.BlobKey).Error("api/DownloadAttachment: checksum mismatch")
+		return grpc.Errorf(codes.DataLoss, "the content of the attachment does not match its checksum")
+	}
+	return nil
+}
+
+// GetAttachment returns the metadata of the attachment of the company.
+func (a *CompanyAPI) GetAttachment(ctx context.Context, req *GetAttachmentRequest) (*Attachment, error) {
+	log.Debug("api/GetAttachment request:", req)
+
+	companyID, err := a.validateSubresource(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := a.repo.GetCompanyAttachment(ctx, companyID, uuid.FromStringOrNil(req.Id))
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+	return attachmentFromStorage(item), nil
+}
+
+// ListAttachments returns the metadata of the attachments of the company.
+func (a *CompanyAPI) ListAttachments(ctx context.Context, req *ListAttachmentsRequest) (*ListAttachmentsResponse, error) {
+	log.Debug("api/ListAttachments request:", req)
+
+	companyID, err := a.validateSubresource(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := a.repo.GetCompany(ctx, companyID); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+	list, err := a.repo.GetCompanyAttachments(ctx, companyID)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	resp := &ListAttachmentsResponse{Attachments: make([]*Attachment, 0, len(list))}
+	for _, item := range list {
+		resp.Attachments = append(resp.Attachments, attachmentFromStorage(item))
+	}
+	return resp, nil
+}
+
+// DeleteAttachment deletes the attachment of the company, then its content.
+// The content left by a failure is deleted by purgeOrphanAttachments.
+func (a *CompanyAPI) DeleteAttachment(ctx context.Context, req *DeleteAttachmentRequest) (*empty.Empty, error) {
+	log.Debug("api/DeleteAttachment request:", req)
+
+	companyID, err := a.validateSubresource(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	id := uuid.FromStringOrNil(req.Id)
+
+	item, err := a.repo.GetCompanyAttachment(ctx, companyID, id)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+	if err := a.repo.DeleteCompanyAttachment(ctx, companyID, id); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	a.purgeAttachment(ctx, item)
+	return &empty.Empty{}, nil
+}
+
+// uploadHandler serves POST /api/Companies/{company_id}/attachments, it
+// uploads the "file" part of the multipart/form-data body. The expected
+// checksum may be given by the sha256 query parameter.
+func (a *CompanyAPI) uploadHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := httpAuthContext(r)
+
+	r.Body = http.MaxBytesReader(w, r.Body, a.maxAttachmentSize+attachmentFormOverhead)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		writeHTTPError(w, grpc.Errorf(codes.InvalidArgument, "bad value: %s", err))
+		return
+	}
+	var file io.Reader
+	var filename string
+	for file == nil {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			writeHTTPError(w, grpc.Errorf(codes.InvalidArgument, "bad value: the file part is missing"))
+			return
+		}
+		if err != nil {
+			writeHTTPError(w, grpc.Errorf(codes.InvalidArgument, "bad value: %s", err))
+			return
+		}
+		if part.FormName() == "file" {
+			file, filename = part, part.FileName()
+		}
+	}
+
+	att, err := a.uploadAttachment(ctx, &AttachmentInfo{
+		CompanyId: mux.Vars(r)["company_id"],
+		Filename:  filename,
+		Sha256:    r.URL.Query().Get("sha256"),
+	}, file)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+
+	b, err := (&runtime.JSONPb{EmitDefaults: true}).Marshal(att)
+	if err != nil {
+		writeHTTPError(w, grpc.Errorf(codes.Internal, "marshal response error: %s", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// downloadHandler serves GET
+// /api/Companies/{company_id}/attachments/{id}:download, it writes the
+// content of the attachment as a file download.
+func (a *CompanyAPI) downloadHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	req := &DownloadAttachmentRequest{CompanyId: vars["company_id"], Id: vars["id"]}
+	log.Debug("api/DownloadAttachment request:", req)
+
+	item, rc, err := a.openAttachment(httpAuthContext(r), req)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	defer rc.Close()
+
+	w.Header().Set("Content-Type", item.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(item.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": item.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("ETag", `"`+item.SHA256+`"`)
+
+	err = readAttachment(rc, item, func(chunk []byte) error {
+		_, err := w.Write(chunk)
+		return err
+	})
+	if err != nil {
+		// the status is sent already, abort the response so that the
+		// client does not take the content as complete
+		log.WithError(err).Error("api/DownloadAttachment: download aborted")
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// purgeOrphanAttachments deletes the attachments of the deleted companies
+// and the deleted attachments left by a failure, with their contents,
+// until ctx is done.
+func (a *CompanyAPI) purgeOrphanAttachments(ctx context.Context) {
+	ticker := time.NewTicker(attachmentPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			list, err := a.repo.GetOrphanAttachments(ctx, attachmentPurgeBatch)
+			if err != nil {
+				log.WithError(err).Error("api: get orphan attachments error")
+				continue
+			}
+			for _, item := range list {
+				a.purgeAttachment(ctx, item)
+			}
+		}
+	}
+}
+
+// purgeAttachment deletes the content of the orphan attachment, then its
+// metadata. The errors are logged, the purge is retried by
+// purgeOrphanAttachments.
+func (a *CompanyAPI) purgeAttachment(ctx context.Context, item storage.CompanyAttachment) {
+	logger := log.WithFields(log.Fields{"id": item.ID, "key": item.BlobKey})
+	if err := a.blobs.Delete(ctx, item.BlobKey); err != nil {
+		logger.WithError(err).Error("api: delete attachment blob error")
+		return
+	}
+	// it is deleted already by a concurrent purge if it does not exist
+	if err := a.repo.DeleteOrphanAttachment(ctx, item.ID); err != nil && err != storage.ErrDoesNotExist {
+		logger.WithError(err).Error("api: delete orphan attachment error")
+	}
+}
+
+// deleteBlob deletes the content of an upload which failed once stored,
+// the request may be canceled already.
+func (a *CompanyAPI) deleteBlob(key string) {
+	if err := a.blobs.Delete(context.Background(), key); err != nil {
+		log.WithError(err).WithField("key", key).Error("api/UploadAttachment: delete blob error")
+	}
+}
+
+// uploadReadError returns the error of the reader of an upload, the gRPC
+// errors of the stream as is.
+func (a *CompanyAPI) uploadReadError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	var maxBytes *http.MaxBytesError
+	if errors.As(err, &maxBytes) {
+		return grpc.Errorf(codes.InvalidArgument, "bad value: the file is larger than %d bytes", a.maxAttachmentSize)
+	}
+	return grpc.Errorf(codes.InvalidArgument, "bad value: read file error: %s", err)
+}
+
+// uploadStreamReader reads the chunks of an upload stream.
+type uploadStreamReader struct {
+	stream CompanyService_UploadAttachmentServer
+	buf    []byte
+}
+
+func (r *uploadStreamReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		req, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		r.buf = req.Chunk
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// countingReader counts and hashes the bytes read from r, it fails past
+// limit bytes. The error of r, or errAttachmentTooLarge, is kept in err as
+// the blob stores may wrap it.
+type countingReader struct {
+	r     io.Reader
+	hash  hash.Hash
+	limit int64
+	n     int64
+	err   error
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	r.hash.Write(p[:n])
+	if r.n > r.limit {
+		r.err = errAttachmentTooLarge
+		return 0, r.err
+	}
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+// attachmentFilename checks that the string is a file name, without
+// directories and control characters.
+func attachmentFilename() check {
+	return func(_ protoreflect.FieldDescriptor, v protoreflect.Value) string {
+		s := v.String()
+		if s == "." || s == ".." || strings.ContainsAny(s, `/\`) || strings.IndexFunc(s, unicode.IsControl) >= 0 {
+			return "must be a file name, without directories and control characters"
+		}
+		return ""
+	}
+}
+
+// sha256Hex checks that the string is a hex encoded SHA-256 checksum.
+func sha256Hex() check {
+	return func(_ protoreflect.FieldDescriptor, v protoreflect.Value) string {
+		if !sha256Pattern.MatchString(v.String()) {
+			return "must be a hex encoded SHA-256 checksum"
+		}
+		return ""
+	}
+}
+
+func attachmentFromStorage(a storage.CompanyAttachment) *Attachment {
+	return &Attachment{
+		Id:          a.ID.String(),
+		CompanyId:   a.CompanyID.UUID.String(),
+		Filename:    a.Filename,
+		ContentType: a.ContentType,
+		Size:        a.Size,
+		Sha256:      a.SHA256,
+		UploadedBy:  a.UploadedBy,
+		CreatedAt:   a.CreatedAt.UTC().Format(time.RFC3339),
+	}
+}
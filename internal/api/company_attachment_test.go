@@ -0,0 +1,270 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/fancar/tmp_xm/internal/blobstore"
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+// testUploadStream implements CompanyService_UploadAttachmentServer.
+type testUploadStream struct {
+	grpc.ServerStream
+	reqs []*UploadAttachmentRequest
+	resp *Attachment
+}
+
+func (s *testUploadStream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *testUploadStream) Recv() (*UploadAttachmentRequest, error) {
+	if len(s.reqs) == 0 {
+		return nil, io.EOF
+	}
+	req := s.reqs[0]
+	s.reqs = s.reqs[1:]
+	return req, nil
+}
+
+func (s *testUploadStream) SendAndClose(resp *Attachment) error {
+	s.resp = resp
+	return nil
+}
+
+// testDownloadStream implements CompanyService_DownloadAttachmentServer.
+type testDownloadStream struct {
+	grpc.ServerStream
+	attachment *Attachment
+	content    bytes.Buffer
+}
+
+func (s *testDownloadStream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *testDownloadStream) Send(resp *DownloadAttachmentResponse) error {
+	if resp.Attachment != nil {
+		s.attachment = resp.Attachment
+	}
+	s.content.Write(resp.Chunk)
+	return nil
+}
+
+func TestCompanyAttachments(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	const maxSize = 1 << 20
+
+	repo := storage.NewMemoryRepository()
+	api := NewCompanyAPI(&TestValidator{returnSubject: "user", returnUser: storage.User{Username: "alice"}}, repo, blobstore.NewLocal(dir), maxSize)
+
+	company := &Company{
+		Id:           uuid.Must(uuid.NewV4()).String(),
+		Name:         "Files",
+		Employeescnt: 1,
+		Type:         CompanyType_Corporations,
+	}
+	_, err := api.Create(ctx, &CreateCompanyRequest{Company: company})
+	require.NoError(t, err)
+
+	pdf := append([]byte("%PDF-1.4\n"), bytes.Repeat([]byte("certificate "), 20000)...)
+	sum := sha256.Sum256(pdf)
+	pdfSum := hex.EncodeToString(sum[:])
+
+	upload := func(info *AttachmentInfo, content []byte, chunkSize int) (*Attachment, error) {
+		stream := &testUploadStream{reqs: []*UploadAttachmentRequest{{Info: info}}}
+		for len(content) > 0 {
+			n := chunkSize
+			if n > len(content) {
+				n = len(content)
+			}
+			stream.reqs = append(stream.reqs, &UploadAttachmentRequest{Chunk: content[:n]})
+			content = content[n:]
+		}
+		err := api.UploadAttachment(stream)
+		return stream.resp, err
+	}
+
+	multipartRequest := func(url, filename string, content []byte) *http.Request {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		require.NoError(t, mw.WriteField("comment", "ignored"))
+		fw, err := mw.CreateFormFile("file", filename)
+		require.NoError(t, err)
+		fw.Write(content)
+		require.NoError(t, mw.Close())
+
+		r := httptest.NewRequest("POST", url, &body)
+		r.Header.Set("Content-Type", mw.FormDataContentType())
+		return r
+	}
+	router := mux.NewRouter()
+	router.HandleFunc("/api/Companies/{company_id}/attachments", api.uploadHandler).Methods("post")
+	router.HandleFunc("/api/Companies/{company_id}/attachments/{id}:download", api.downloadHandler).Methods("get")
+
+	var uploaded *Attachment
+
+	t.Run("Upload", func(t *testing.T) {
+		assert := require.New(t)
+
+		att, err := upload(&AttachmentInfo{CompanyId: company.Id, Filename: "certificate.pdf", Sha256: pdfSum}, pdf, 1000)
+		assert.NoError(err)
+		assert.Equal(company.Id, att.CompanyId)
+		assert.Equal("certificate.pdf", att.Filename)
+		assert.Equal("application/pdf", att.ContentType)
+		assert.Equal(int64(len(pdf)), att.Size)
+		assert.Equal(pdfSum, att.Sha256)
+		assert.Equal("alice", att.UploadedBy)
+		uploaded = att
+
+		// the content type is sniffed, not taken from the name
+		att, err = upload(&AttachmentInfo{CompanyId: company.Id, Filename: "contract.pdf"}, []byte("plain text"), 3)
+		assert.NoError(err)
+		assert.Equal("text/plain; charset=utf-8", att.ContentType)
+
+		_, err = upload(&AttachmentInfo{CompanyId: company.Id, Filename: "large.bin"}, make([]byte, maxSize+1), 64<<10)
+		assert.Equal(codes.InvalidArgument, status.Code(err))
+		assert.Contains(status.Convert(err).Message(), "larger than")
+		_, err = upload(&AttachmentInfo{CompanyId: company.Id, Filename: "empty.txt"}, nil, 1)
+		assert.Equal(codes.InvalidArgument, status.Code(err))
+
+		_, err = upload(&AttachmentInfo{CompanyId: company.Id, Filename: "bad.pdf", Sha256: hex.EncodeToString(make([]byte, 32))}, pdf, 1000)
+		assert.Equal([]string{"info.sha256"}, violatedFields(t, err))
+
+		_, err = upload(&AttachmentInfo{CompanyId: "bad", Filename: "../etc/passwd", Sha256: "abc"}, pdf, 1000)
+		assert.Equal([]string{"info.company_id", "info.filename", "info.sha256"}, violatedFields(t, err))
+		_, err = upload(nil, pdf, 1000)
+		assert.Equal([]string{"info"}, violatedFields(t, err))
+
+		_, err = upload(&AttachmentInfo{CompanyId: uuid.Must(uuid.NewV4()).String(), Filename: "a.pdf"}, pdf, 1000)
+		assert.Equal(codes.NotFound, status.Code(err))
+
+		// only the stored attachments are left in the blob store
+		entries, err := os.ReadDir(filepath.Join(dir, "attachments"))
+		assert.NoError(err)
+		assert.Len(entries, 2)
+	})
+
+	t.Run("UploadHTTP", func(t *testing.T) {
+		assert := require.New(t)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, multipartRequest("/api/Companies/"+company.Id+"/attachments?sha256="+pdfSum, "scan.pdf", pdf))
+		assert.Equal(http.StatusOK, w.Code, w.Body.String())
+		var att struct {
+			ID          string `json:"id"`
+			Filename    string `json:"filename"`
+			ContentType string `json:"contentType"`
+			Size        string `json:"size"`
+		}
+		assert.NoError(json.Unmarshal(w.Body.Bytes(), &att))
+		assert.Equal("scan.pdf", att.Filename)
+		assert.Equal("application/pdf", att.ContentType)
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, multipartRequest("/api/Companies/"+company.Id+"/attachments", "large.bin", make([]byte, maxSize+1)))
+		assert.Equal(http.StatusBadRequest, w.Code)
+		assert.Contains(w.Body.String(), "larger than")
+
+		w = httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/api/Companies/"+company.Id+"/attachments", bytes.NewReader(pdf))
+		r.Header.Set("Content-Type", "application/pdf")
+		router.ServeHTTP(w, r)
+		assert.Equal(http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Download", func(t *testing.T) {
+		assert := require.New(t)
+
+		stream := &testDownloadStream{}
+		assert.NoError(api.DownloadAttachment(&DownloadAttachmentRequest{CompanyId: company.Id, Id: uploaded.Id}, stream))
+		assert.Equal(uploaded.Sha256, stream.attachment.Sha256)
+		assert.Equal(pdf, stream.content.Bytes())
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/api/Companies/"+company.Id+"/attachments/"+uploaded.Id+":download", nil))
+		assert.Equal(http.StatusOK, w.Code)
+		assert.Equal("application/pdf", w.Header().Get("Content-Type"))
+		assert.Equal(`attachment; filename=certificate.pdf`, w.Header().Get("Content-Disposition"))
+		assert.Equal("nosniff", w.Header().Get("X-Content-Type-Options"))
+		assert.Equal(pdf, w.Body.Bytes())
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/api/Companies/"+company.Id+"/attachments/"+uuid.Must(uuid.NewV4()).String()+":download", nil))
+		assert.Equal(http.StatusNotFound, w.Code)
+
+		// a corrupted content is detected
+		item, err := repo.GetCompanyAttachment(ctx, uuid.FromStringOrNil(company.Id), uuid.FromStringOrNil(uploaded.Id))
+		assert.NoError(err)
+		path := filepath.Join(dir, filepath.FromSlash(item.BlobKey))
+		assert.NoError(os.WriteFile(path, append(pdf[:len(pdf)-1], '!'), 0o600))
+		err = api.DownloadAttachment(&DownloadAttachmentRequest{CompanyId: company.Id, Id: uploaded.Id}, &testDownloadStream{})
+		assert.Equal(codes.DataLoss, status.Code(err))
+		assert.Panics(func() {
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/Companies/"+company.Id+"/attachments/"+uploaded.Id+":download", nil))
+		})
+
+		assert.NoError(os.Remove(path))
+		err = api.DownloadAttachment(&DownloadAttachmentRequest{CompanyId: company.Id, Id: uploaded.Id}, &testDownloadStream{})
+		assert.Equal(codes.DataLoss, status.Code(err))
+	})
+
+	t.Run("GetListDelete", func(t *testing.T) {
+		assert := require.New(t)
+
+		att, err := api.GetAttachment(ctx, &GetAttachmentRequest{CompanyId: company.Id, Id: uploaded.Id})
+		assert.NoError(err)
+		assert.Equal("certificate.pdf", att.Filename)
+
+		resp, err := api.ListAttachments(ctx, &ListAttachmentsRequest{CompanyId: company.Id})
+		assert.NoError(err)
+		assert.Len(resp.Attachments, 3)
+		assert.Equal(uploaded.Id, resp.Attachments[0].Id)
+
+		_, err = api.DeleteAttachment(ctx, &DeleteAttachmentRequest{CompanyId: company.Id, Id: resp.Attachments[1].Id})
+		assert.NoError(err)
+		_, err = api.GetAttachment(ctx, &GetAttachmentRequest{CompanyId: company.Id, Id: resp.Attachments[1].Id})
+		assert.Equal(codes.NotFound, status.Code(err))
+		_, err = api.DeleteAttachment(ctx, &DeleteAttachmentRequest{CompanyId: company.Id, Id: resp.Attachments[1].Id})
+		assert.Equal(codes.NotFound, status.Code(err))
+
+		// the attachments of the deleted companies are purged
+		_, err = api.Delete(ctx, &DeleteCompanyRequest{Id: company.Id})
+		assert.NoError(err)
+		orphans, err := repo.GetOrphanAttachments(ctx, attachmentPurgeBatch)
+		assert.NoError(err)
+		assert.Len(orphans, 2)
+		for _, item := range orphans {
+			api.purgeAttachment(ctx, item)
+		}
+		orphans, err = repo.GetOrphanAttachments(ctx, attachmentPurgeBatch)
+		assert.NoError(err)
+		assert.Empty(orphans)
+		entries, err := os.ReadDir(filepath.Join(dir, "attachments"))
+		assert.NoError(err)
+		assert.Empty(entries)
+
+		_, err = api.ListAttachments(ctx, &ListAttachmentsRequest{CompanyId: company.Id})
+		assert.Equal(codes.NotFound, status.Code(err))
+	})
+}
@@ -0,0 +1,386 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/ptypes/empty"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/fancar/tmp_xm/internal/api/auth"
+	"github.com/fancar/tmp_xm/internal/api/helpers"
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+const (
+	attributeStringMaxLength    = 500
+	maxAttributeEnumValues      = 100
+	attributeEnumValueMaxLength = 100
+
+	// maxAttributeInt is the largest integer a JSON number holds exactly.
+	maxAttributeInt = 1 << 53
+)
+
+// attributeNamePattern matches the names of the custom attributes, they
+// are used as JSON keys and paths without quoting.
+var attributeNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,49}$`)
+
+// CreateAttributeDefinition defines a custom attribute of the companies of
+// a type.
+func (a *CompanyAPI) CreateAttributeDefinition(ctx context.Context, req *CreateAttributeDefinitionRequest) (*AttributeDefinition, error) {
+	log.Debug("api/CreateAttributeDefinition request:", req)
+
+	if err := a.validator.Validate(ctx, auth.ValidateIsAdmin()); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	d := attributeDefinitionToStorage(req.Definition)
+	if err := a.repo.CreateAttributeDefinition(ctx, &d); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+	return attributeDefinitionFromStorage(d), nil
+}
+
+// ListAttributeDefinitions returns the custom attributes of a company
+// type, of all the types if it is not set.
+func (a *CompanyAPI) ListAttributeDefinitions(ctx context.Context, req *ListAttributeDefinitionsRequest) (*ListAttributeDefinitionsResponse, error) {
+	log.Debug("api/ListAttributeDefinitions request:", req)
+
+	if err := a.validator.Validate(ctx, auth.ValidateActiveUser()); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	list, err := a.repo.GetAttributeDefinitions(ctx, uint32(req.CompanyType))
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	resp := &ListAttributeDefinitionsResponse{Definitions: make([]*AttributeDefinition, 0, len(list))}
+	for _, d := range list {
+		resp.Definitions = append(resp.Definitions, attributeDefinitionFromStorage(d))
+	}
+	return resp, nil
+}
+
+// UpdateAttributeDefinition updates the required flag, the enum values and
+// the description of a custom attribute. The stored values are validated by
+// the new definition on the next update of their companies.
+func (a *CompanyAPI) UpdateAttributeDefinition(ctx context.Context, req *UpdateAttributeDefinitionRequest) (*AttributeDefinition, error) {
+	log.Debug("api/UpdateAttributeDefinition request:", req)
+
+	if err := a.validator.Validate(ctx, auth.ValidateIsAdmin()); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	d := attributeDefinitionToStorage(req.Definition)
+	err := a.repo.Transaction(ctx, func(tx storage.Repository) error {
+		old, err := tx.GetAttributeDefinition(ctx, d.CompanyType, d.Name)
+		if err != nil {
+			return err
+		}
+		if old.Kind != d.Kind {
+			return grpc.Errorf(codes.FailedPrecondition, "the kind of an attribute can't be changed, delete and create it again")
+		}
+		return tx.UpdateAttributeDefinition(ctx, &d)
+	})
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+	return attributeDefinitionFromStorage(d), nil
+}
+
+// DeleteAttributeDefinition deletes a custom attribute and its values.
+func (a *CompanyAPI) DeleteAttributeDefinition(ctx context.Context, req *DeleteAttributeDefinitionRequest) (*empty.Empty, error) {
+	log.Debug("api/DeleteAttributeDefinition request:", req)
+
+	if err := a.validator.Validate(ctx, auth.ValidateIsAdmin()); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	if err := a.repo.DeleteAttributeDefinition(ctx, uint32(req.CompanyType), req.Name); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+	return &empty.Empty{}, nil
+}
+
+// convertCompanyAttributes validates the attributes of the company by the
+// definitions of its type, read from repo, and sets them to out. The
+// violations are relative to the company.
+func convertCompanyAttributes(ctx context.Context, repo storage.Repository, in *Company, out *storage.Company) error {
+	defs, err := repo.GetAttributeDefinitions(ctx, out.Type)
+	if err != nil {
+		return helpers.ErrToRPCError(err)
+	}
+
+	values := in.GetAttributes().GetFields()
+	attributes := make(storage.CompanyAttributes, len(values))
+	defined := make(map[string]bool, len(defs))
+	var v fieldViolations
+	for _, d := range defs {
+		defined[d.Name] = true
+		field := "attributes." + d.Name
+
+		value, ok := values[d.Name]
+		if _, null := value.GetKind().(*structpb.Value_NullValue); !ok || null {
+			if d.Required {
+				v.add(field, "is required")
+			}
+			continue
+		}
+		if desc := checkAttributeValue(d, value.AsInterface()); desc != "" {
+			v.add(field, "%s", desc)
+			continue
+		}
+		attributes[d.Name] = value.AsInterface()
+	}
+
+	var unknown []string
+	for name := range values {
+		if !defined[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		v.add("attributes."+name, "is not an attribute of the %s companies", CompanyType(out.Type))
+	}
+
+	if err := v.err(); err != nil {
+		return err
+	}
+	if len(attributes) != 0 {
+		out.Attributes = attributes
+	}
+	return nil
+}
+
+// checkAttributeValue returns the description of the violation of the
+// given value of the attribute, "" if the value is valid. The value is a
+// string, a float64 or a bool, like the ones of structpb.Value.AsInterface.
+func checkAttributeValue(d storage.AttributeDefinition, value interface{}) string {
+	switch d.Kind {
+	case storage.AttributeString:
+		s, ok := value.(string)
+		if !ok {
+			return "must be a string"
+		}
+		if utf8.RuneCountInString(s) > attributeStringMaxLength {
+			return fmt.Sprintf("must be at most %d characters", attributeStringMaxLength)
+		}
+	case storage.AttributeInt:
+		n, ok := value.(float64)
+		if !ok || n != math.Trunc(n) || math.Abs(n) > maxAttributeInt {
+			return "must be an integer"
+		}
+	case storage.AttributeBool:
+		if _, ok := value.(bool); !ok {
+			return "must be a boolean"
+		}
+	case storage.AttributeDate:
+		s, ok := value.(string)
+		if !ok {
+			return "must be in the YYYY-MM-DD format"
+		}
+		if _, err := time.Parse(dateLayout, s); err != nil {
+			return "must be in the YYYY-MM-DD format"
+		}
+	case storage.AttributeEnum:
+		s, _ := value.(string)
+		for _, e := range d.EnumValues {
+			if s == e {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(d.EnumValues, ", ")
+	default:
+		return fmt.Sprintf("has the unknown kind %d", d.Kind)
+	}
+	return ""
+}
+
+// attributeFilters parses the "name=value" filters of the custom attributes
+// by the definitions of the given company type, of all the types if it is
+// 0. The values are converted by the kinds of the attributes, an attribute
+// defined with different kinds for several types needs the type.
+func attributeFilters(ctx context.Context, repo storage.Repository, companyType uint32, filters []string) (storage.CompanyAttributes, error) {
+	if len(filters) == 0 {
+		return nil, nil
+	}
+
+	defs, err := repo.GetAttributeDefinitions(ctx, companyType)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+	byName := make(map[string][]storage.AttributeDefinition)
+	for _, d := range defs {
+		byName[d.Name] = append(byName[d.Name], d)
+	}
+
+	result := make(storage.CompanyAttributes, len(filters))
+	var v fieldViolations
+	for _, f := range filters {
+		name, s, _ := strings.Cut(f, "=")
+		matching := byName[name]
+		if len(matching) == 0 {
+			v.add("attributes", "unknown attribute %s", name)
+			continue
+		}
+		kind := matching[0].Kind
+		for _, d := range matching[1:] {
+			if d.Kind != kind {
+				kind = 0
+			}
+		}
+		if kind == 0 {
+			v.add("attributes", "the attribute %s has different kinds, filter by type", name)
+			continue
+		}
+
+		// the value must be valid for one of the types, e.g. a value of
+		// the enums of the types
+		value, err := parseAttributeValue(kind, s)
+		desc := checkAttributeValue(matching[0], nil)
+		if err == nil {
+			for _, d := range matching {
+				if desc = checkAttributeValue(d, value); desc == "" {
+					break
+				}
+			}
+		}
+		if desc != "" {
+			v.add("attributes", "the value of %s %s", name, desc)
+			continue
+		}
+		result[name] = value
+	}
+	if err := v.err(); err != nil {
+		return nil, invalidArgument("invalid filters", err)
+	}
+	return result, nil
+}
+
+// parseAttributeValue converts the text of a filter to a value of the given
+// kind.
+func parseAttributeValue(kind uint32, s string) (interface{}, error) {
+	switch kind {
+	case storage.AttributeInt:
+		n, err := strconv.ParseInt(s, 10, 64)
+		return float64(n), err
+	case storage.AttributeBool:
+		return strconv.ParseBool(s)
+	default:
+		return s, nil
+	}
+}
+
+// attributesFromStorage returns the attributes of the API, nil if there
+// are none.
+func attributesFromStorage(attributes storage.CompanyAttributes) *structpb.Struct {
+	if len(attributes) == 0 {
+		return nil
+	}
+	s, err := structpb.NewStruct(attributes)
+	if err != nil {
+		log.WithError(err).Error("api: convert the attributes error")
+		return nil
+	}
+	return s
+}
+
+func attributeDefinitionToStorage(in *AttributeDefinition) storage.AttributeDefinition {
+	return storage.AttributeDefinition{
+		CompanyType: uint32(in.CompanyType),
+		Name:        in.Name,
+		Kind:        uint32(in.Kind),
+		Required:    in.Required,
+		EnumValues:  storage.StringList(in.EnumValues),
+		Description: in.Description,
+	}
+}
+
+func attributeDefinitionFromStorage(d storage.AttributeDefinition) *AttributeDefinition {
+	return &AttributeDefinition{
+		CompanyType: CompanyType(d.CompanyType),
+		Name:        d.Name,
+		Kind:        AttributeKind(d.Kind),
+		Required:    d.Required,
+		EnumValues:  d.EnumValues,
+		Description: d.Description,
+	}
+}
+
+// attributeName checks the name of a custom attribute.
+func attributeName() check {
+	return func(_ protoreflect.FieldDescriptor, v protoreflect.Value) string {
+		if !attributeNamePattern.MatchString(v.String()) {
+			return "must be lower case letters, digits and underscores, starting with a letter, max 50 characters"
+		}
+		return ""
+	}
+}
+
+// attributeFilterSyntax checks that the items are "name=value" filters of
+// the custom attributes.
+func attributeFilterSyntax() check {
+	return func(_ protoreflect.FieldDescriptor, v protoreflect.Value) string {
+		list := v.List()
+		for i := 0; i < list.Len(); i++ {
+			name, _, ok := strings.Cut(list.Get(i).String(), "=")
+			if !ok || !attributeNamePattern.MatchString(name) {
+				return fmt.Sprintf("item %d must be an attribute name=value filter", i)
+			}
+		}
+		return ""
+	}
+}
+
+// checkEnumValues validates the enum values of an attribute definition,
+// they are only allowed, and required, for the enum attributes.
+func checkEnumValues(m proto.Message, v *fieldViolations) {
+	d := m.(*AttributeDefinition)
+	if d.Kind != AttributeKind_EnumAttribute {
+		if len(d.EnumValues) != 0 {
+			v.add("enum_values", "is only allowed for the EnumAttribute attributes")
+		}
+		return
+	}
+	if len(d.EnumValues) == 0 {
+		v.add("enum_values", "is required for the EnumAttribute attributes")
+		return
+	}
+
+	seen := make(map[string]bool, len(d.EnumValues))
+	for i, e := range d.EnumValues {
+		switch {
+		case e == "" || utf8.RuneCountInString(e) > attributeEnumValueMaxLength:
+			v.add(fmt.Sprintf("enum_values[%d]", i), "must have 1 to %d characters", attributeEnumValueMaxLength)
+		case seen[e]:
+			v.add(fmt.Sprintf("enum_values[%d]", i), "is a duplicate")
+		}
+		seen[e] = true
+	}
+}
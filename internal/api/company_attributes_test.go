@@ -0,0 +1,163 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+func TestCompanyAttributes(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+
+	api := NewCompanyAPI(&TestValidator{returnSubject: "user"}, storage.NewMemoryRepository(), nil, 0)
+
+	for _, d := range []*AttributeDefinition{
+		{CompanyType: CompanyType_Corporations, Name: "tier", Kind: AttributeKind_EnumAttribute,
+			EnumValues: []string{"gold", "silver"}, Required: true},
+		{CompanyType: CompanyType_Corporations, Name: "seats", Kind: AttributeKind_IntAttribute},
+		{CompanyType: CompanyType_Corporations, Name: "listed", Kind: AttributeKind_BoolAttribute},
+		{CompanyType: CompanyType_Corporations, Name: "founded", Kind: AttributeKind_DateAttribute},
+		{CompanyType: CompanyType_NonProfit, Name: "tier", Kind: AttributeKind_StringAttribute},
+	} {
+		_, err := api.CreateAttributeDefinition(ctx, &CreateAttributeDefinitionRequest{Definition: d})
+		assert.NoError(err)
+	}
+
+	newCompany := func(name string, attributes map[string]interface{}) *Company {
+		s, err := structpb.NewStruct(attributes)
+		assert.NoError(err)
+		return &Company{
+			Id:           uuid.Must(uuid.NewV4()).String(),
+			Name:         name,
+			Employeescnt: 1,
+			Type:         CompanyType_Corporations,
+			Attributes:   s,
+		}
+	}
+
+	gold := newCompany("Gold", map[string]interface{}{"tier": "gold", "seats": 10, "listed": true, "founded": "2001-02-03"})
+	_, err := api.Create(ctx, &CreateCompanyRequest{Company: gold})
+	assert.NoError(err)
+	silver := newCompany("Silver", map[string]interface{}{"tier": "silver", "seats": 10})
+	_, err = api.Create(ctx, &CreateCompanyRequest{Company: silver})
+	assert.NoError(err)
+
+	t.Run("Definitions", func(t *testing.T) {
+		assert := require.New(t)
+
+		resp, err := api.ListAttributeDefinitions(ctx, &ListAttributeDefinitionsRequest{CompanyType: CompanyType_Corporations})
+		assert.NoError(err)
+		var names []string
+		for _, d := range resp.Definitions {
+			names = append(names, d.Name)
+		}
+		assert.Equal([]string{"founded", "listed", "seats", "tier"}, names)
+
+		_, err = api.CreateAttributeDefinition(ctx, &CreateAttributeDefinitionRequest{Definition: &AttributeDefinition{
+			CompanyType: CompanyType_Corporations, Name: "tier", Kind: AttributeKind_StringAttribute,
+		}})
+		assert.Equal(codes.AlreadyExists, status.Code(err))
+
+		_, err = api.CreateAttributeDefinition(ctx, &CreateAttributeDefinitionRequest{Definition: &AttributeDefinition{
+			Name: "Bad-Name", Kind: AttributeKind_StringAttribute, EnumValues: []string{"a"},
+		}})
+		assert.Equal([]string{"definition.company_type", "definition.name", "definition.enum_values"}, violatedFields(t, err))
+
+		_, err = api.UpdateAttributeDefinition(ctx, &UpdateAttributeDefinitionRequest{Definition: &AttributeDefinition{
+			CompanyType: CompanyType_Corporations, Name: "seats", Kind: AttributeKind_StringAttribute,
+		}})
+		assert.Equal(codes.FailedPrecondition, status.Code(err))
+	})
+
+	t.Run("Values", func(t *testing.T) {
+		assert := require.New(t)
+
+		resp, err := api.Get(ctx, &GetCompanyRequest{Id: gold.Id})
+		assert.NoError(err)
+		assert.Equal(map[string]interface{}{"tier": "gold", "seats": float64(10), "listed": true, "founded": "2001-02-03"},
+			resp.Company.Attributes.AsMap())
+
+		c := newCompany("Invalid", map[string]interface{}{"seats": 1.5, "listed": "yes", "founded": "2001-2-3", "color": "red"})
+		_, err = api.Create(ctx, &CreateCompanyRequest{Company: c})
+		assert.Equal([]string{
+			"Company.attributes.founded",
+			"Company.attributes.listed",
+			"Company.attributes.seats",
+			"Company.attributes.tier",
+			"Company.attributes.color",
+		}, violatedFields(t, err))
+
+		// the attributes are defined per type
+		c = newCompany("Other", map[string]interface{}{"tier": "platinum"})
+		c.Type = CompanyType_NonProfit
+		_, err = api.Create(ctx, &CreateCompanyRequest{Company: c})
+		assert.NoError(err)
+		c.Type = CompanyType_Corporations
+		_, err = api.Update(ctx, &UpdateCompanyRequest{Company: c})
+		assert.Equal([]string{"Company.attributes.tier"}, violatedFields(t, err))
+	})
+
+	t.Run("Filters", func(t *testing.T) {
+		assert := require.New(t)
+
+		export := func(req *ExportCompaniesRequest) []string {
+			var names []string
+			assert.NoError(api.exportCompanies(ctx, req, func(c *Company) error {
+				names = append(names, c.Name)
+				return nil
+			}))
+			return names
+		}
+		assert.Equal([]string{"Gold", "Silver"}, export(&ExportCompaniesRequest{Attributes: []string{"seats=10"}}))
+		assert.Equal([]string{"Gold"}, export(&ExportCompaniesRequest{Attributes: []string{"seats=10", "listed=true"}}))
+		assert.Equal([]string{"Other"}, export(&ExportCompaniesRequest{
+			Type:       CompanyType_NonProfit,
+			Attributes: []string{"tier=platinum"},
+		}))
+
+		// tier has different kinds, the type is needed
+		err := api.exportCompanies(ctx, &ExportCompaniesRequest{Attributes: []string{"tier=gold"}}, nil)
+		assert.Equal([]string{"attributes"}, violatedFields(t, err))
+		err = api.exportCompanies(ctx, &ExportCompaniesRequest{Attributes: []string{"seats=ten", "color=red", "bad"}}, nil)
+		assert.Equal([]string{"attributes"}, violatedFields(t, err))
+		err = api.exportCompanies(ctx, &ExportCompaniesRequest{Attributes: []string{"seats=ten", "color=red"}}, nil)
+		assert.Len(violatedFields(t, err), 2)
+
+		resp, err := api.SearchCompanies(ctx, &SearchCompaniesRequest{
+			Query:      "l",
+			Type:       CompanyType_Corporations,
+			Attributes: []string{"tier=silver"},
+		})
+		assert.NoError(err)
+		assert.Len(resp.Results, 1)
+		assert.Equal("Silver", resp.Results[0].Company.Name)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := api.DeleteAttributeDefinition(ctx, &DeleteAttributeDefinitionRequest{
+			CompanyType: CompanyType_Corporations,
+			Name:        "listed",
+		})
+		assert.NoError(err)
+
+		resp, err := api.Get(ctx, &GetCompanyRequest{Id: gold.Id})
+		assert.NoError(err)
+		assert.NotContains(resp.Company.Attributes.AsMap(), "listed")
+
+		_, err = api.DeleteAttributeDefinition(ctx, &DeleteAttributeDefinitionRequest{
+			CompanyType: CompanyType_Corporations,
+			Name:        "listed",
+		})
+		assert.Equal(codes.NotFound, status.Code(err))
+	})
+}
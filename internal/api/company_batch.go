@@ -0,0 +1,235 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gofrs/uuid"
+	log "github.com/sirupsen/logrus"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"github.com/fancar/tmp_xm/internal/api/auth"
+	"github.com/fancar/tmp_xm/internal/api/helpers"
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+// maxBatchSize defines the max. number of items of a batch request.
+const maxBatchSize = 1000
+
+// batchItem holds an item of a batch request.
+type batchItem struct {
+	id   string
+	uid  uuid.UUID
+	in   *Company
+	item *storage.Company
+	err  error
+}
+
+// batchResult is the result of an applied item of a batch.
+type batchResult struct {
+	// cr is the change request created when the change must be approved.
+	cr *storage.ChangeRequest
+	// sendEvents sends the events of the applied change, once committed.
+	sendEvents func()
+}
+
+// BatchCreate creates the given companies like Create.
+func (a *CompanyAPI) BatchCreate(ctx context.Context, req *BatchCreateCompaniesRequest) (*BatchCompaniesResponse, error) {
+	user, err := a.validator.GetUser(ctx)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	items := func() []batchItem {
+		return a.companyBatchItems(ctx, req.Companies, a.convertNewCompany)
+	}
+
+	return a.batch(ctx, "BatchCreate", req, req.Atomic, items,
+		func(tx storage.Repository, it batchItem) (batchResult, error) {
+			if err := applyCreate(ctx, tx, user.Username, it.item, req.Force); err != nil {
+				return batchResult{}, err
+			}
+			return batchResult{sendEvents: func() {
+				sendEvent(ctx, a.companyEvent(ctx, it.item, "created"), it.id, "created")
+			}}, nil
+		})
+}
+
+// BatchUpdate updates the given companies like Update, the updates
+// requiring an approval create their change request.
+func (a *CompanyAPI) BatchUpdate(ctx context.Context, req *BatchUpdateCompaniesRequest) (*BatchCompaniesResponse, error) {
+	user, err := a.validator.GetUser(ctx)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	items := func() []batchItem {
+		return a.companyBatchItems(ctx, req.Companies, a.convertCompany)
+	}
+
+	return a.batch(ctx, "BatchUpdate", req, req.Atomic, items,
+		func(tx storage.Repository, it batchItem) (batchResult, error) {
+			cr, err := a.applyUpdate(ctx, tx, user, &UpdateCompanyRequest{Company: it.in}, it.item)
+			if err != nil {
+				return batchResult{}, err
+			}
+			return batchResult{cr: cr, sendEvents: func() {
+				sendEvent(ctx, a.companyEvent(ctx, it.item, "updated"), it.id, "updated")
+			}}, nil
+		})
+}
+
+// BatchDelete deletes the companies of the given IDs like Delete, the
+// deletions requiring an approval create their change request.
+func (a *CompanyAPI) BatchDelete(ctx context.Context, req *BatchDeleteCompaniesRequest) (*BatchCompaniesResponse, error) {
+	user, err := a.validator.GetUser(ctx)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	items := func() []batchItem {
+		items := make([]batchItem, len(req.Ids))
+		for i, id := range req.Ids {
+			items[i].id = id
+			items[i].uid, items[i].err = uuid.FromString(id)
+		}
+		return items
+	}
+
+	return a.batch(ctx, "BatchDelete", req, req.Atomic, items,
+		func(tx storage.Repository, it batchItem) (batchResult, error) {
+			d, err := a.applyDelete(ctx, tx, user, &DeleteCompanyRequest{Id: it.id, Children: req.Children})
+			if err != nil {
+				return batchResult{}, err
+			}
+			return batchResult{cr: d.cr, sendEvents: func() {
+				a.sendDeleteEvents(ctx, it.uid, d.deleted, d.reparented)
+			}}, nil
+		})
+}
+
+// companyBatchItems validates the given companies and converts them to
+// batch items with convert.
+func (a *CompanyAPI) companyBatchItems(ctx context.Context, companies []*Company,
+	convert func(context.Context, storage.Repository, *Company) (*storage.Company, error)) []batchItem {
+	items := make([]batchItem, len(companies))
+	for i, c := range companies {
+		items[i] = batchItem{id: c.GetId(), in: c}
+		items[i].item, items[i].err = convert(ctx, a.repo, c)
+	}
+	return items
+}
+
+// batch validates the request, then the items returned by newItems, and
+// applies them with apply, each like its single item request. With atomic
+// the items are applied in a transaction and the error of the first
+// failing item is returned, otherwise every item is applied in its own
+// transaction and its result is set in the response. The events are sent
+// once the items are committed.
+func (a *CompanyAPI) batch(ctx context.Context, method string, req proto.Message, atomic bool, newItems func() []batchItem,
+	apply func(storage.Repository, batchItem) (batchResult, error)) (*BatchCompaniesResponse, error) {
+	if err := a.validator.Validate(ctx, auth.ValidateActiveUser()); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	// the size is checked before the items are converted
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	items := newItems()
+	log.WithFields(log.Fields{
+		"items":  len(items),
+		"atomic": atomic,
+	}).Debugf("api/%s request", method)
+
+	resp := &BatchCompaniesResponse{Statuses: make([]*spb.Status, len(items))}
+
+	if atomic {
+		for i, it := range items {
+			if it.err != nil {
+				// the violations of the companies are relative to the request
+				return nil, invalidArgument(fmt.Sprintf("item %d: check your body", i),
+					prefixed(fmt.Sprintf("companies[%d].", i), it.err))
+			}
+		}
+
+		results := make([]batchResult, len(items))
+		failed := -1
+		err := a.repo.Transaction(ctx, func(tx storage.Repository) error {
+			for i, it := range items {
+				var err error
+				if results[i], err = apply(tx, it); err != nil {
+					failed = i
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			s := status.Convert(helpers.ErrToRPCError(err))
+			if failed >= 0 {
+				// the details are kept, e.g. the duplicate candidates
+				p := s.Proto()
+				p.Message = fmt.Sprintf("item %d: %s", failed, p.Message)
+				return nil, status.FromProto(p).Err()
+			}
+			return nil, s.Err()
+		}
+
+		for i := range items {
+			resp.Statuses[i] = batchApplied(ctx, results[i])
+		}
+		return resp, nil
+	}
+
+	for i, it := range items {
+		var res batchResult
+		err := it.err
+		if err != nil {
+			err = invalidArgument("check your body", err)
+		} else {
+			err = a.repo.Transaction(ctx, func(tx storage.Repository) error {
+				var err error
+				res, err = apply(tx, it)
+				return err
+			})
+			if err != nil {
+				err = helpers.ErrToRPCError(err)
+			}
+		}
+		if err != nil {
+			resp.Statuses[i] = status.Convert(err).Proto()
+			continue
+		}
+
+		resp.Statuses[i] = batchApplied(ctx, res)
+	}
+	return resp, nil
+}
+
+// batchApplied sends the events of the committed item of a batch and
+// returns its status. The status of a change waiting for an approval has
+// the created change request in its details.
+func batchApplied(ctx context.Context, res batchResult) *spb.Status {
+	s := &spb.Status{Code: int32(codes.OK)}
+	if res.cr == nil {
+		res.sendEvents()
+		return s
+	}
+
+	s.Message = "the change is waiting for an approval"
+	details, err := anypb.New(changeRequestFromStorage(*res.cr))
+	if err != nil {
+		log.WithError(err).Error("api: change request status details error")
+	} else {
+		s.Details = append(s.Details, details)
+	}
+	sendChangeRequestEvent(ctx, *res.cr, "change_requested")
+	return s
+}
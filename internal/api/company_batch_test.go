@@ -0,0 +1,264 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+func TestBatchCompanies(t *testing.T) {
+	ctx := context.Background()
+	storage.HashIterations = 1
+
+	company := func(name string) *Company {
+		return &Company{
+			Id:           uuid.Must(uuid.NewV4()).String(),
+			Name:         name,
+			Employeescnt: 1,
+			Type:         CompanyType_Corporations,
+		}
+	}
+	statusCodes := func(resp *BatchCompaniesResponse) []codes.Code {
+		var out []codes.Code
+		for _, s := range resp.Statuses {
+			out = append(out, codes.Code(s.Code))
+		}
+		return out
+	}
+
+	t.Run("Create", func(t *testing.T) {
+		assert := require.New(t)
+		api := NewCompanyAPI(&TestValidator{returnSubject: "user"}, storage.NewMemoryRepository(), nil, 0)
+
+		invalid := company("invalid")
+		invalid.Employeescnt = 0
+		a, b := company("batch_a"), company("batch_b")
+		dup := company("batch_a")
+
+		// atomic, a failing item rolls back the whole batch
+		_, err := api.BatchCreate(ctx, &BatchCreateCompaniesRequest{
+			Atomic:    true,
+			Companies: []*Company{a, b, dup},
+		})
+		assert.Equal(codes.AlreadyExists, status.Code(err))
+		assert.Contains(status.Convert(err).Message(), "item 2:")
+		_, err = api.Get(ctx, &GetCompanyRequest{Id: a.Id})
+		assert.Equal(codes.NotFound, status.Code(err))
+
+		_, err = api.BatchCreate(ctx, &BatchCreateCompaniesRequest{
+			Atomic:    true,
+			Companies: []*Company{a, invalid},
+		})
+		s := status.Convert(err)
+		assert.Equal(codes.InvalidArgument, s.Code())
+		assert.Len(s.Details(), 1)
+		br, ok := s.Details()[0].(*errdetails.BadRequest)
+		assert.True(ok)
+		assert.Len(br.FieldViolations, 1)
+		assert.Equal("companies[1].employeescnt", br.FieldViolations[0].Field)
+
+		// non-atomic, every item is applied on its own
+		resp, err := api.BatchCreate(ctx, &BatchCreateCompaniesRequest{
+			Companies: []*Company{a, invalid, dup, b},
+		})
+		assert.NoError(err)
+		assert.Equal([]codes.Code{codes.OK, codes.InvalidArgument, codes.AlreadyExists, codes.OK}, statusCodes(resp))
+		for _, c := range []*Company{a, b} {
+			_, err = api.Get(ctx, &GetCompanyRequest{Id: c.Id})
+			assert.NoError(err)
+		}
+
+		// the details of the error of the failing item are kept
+		_, err = api.BatchCreate(ctx, &BatchCreateCompaniesRequest{
+			Atomic:    true,
+			Companies: []*Company{company("batch_c"), company("BATCH A.")},
+		})
+		s = status.Convert(err)
+		assert.Equal(codes.FailedPrecondition, s.Code())
+		assert.Contains(s.Message(), "item 1:")
+		assert.Len(s.Details(), 1)
+		pf, ok := s.Details()[0].(*errdetails.PreconditionFailure)
+		assert.True(ok)
+		assert.Equal(a.Id, pf.Violations[0].Subject)
+
+		_, err = api.BatchCreate(ctx, &BatchCreateCompaniesRequest{})
+		assert.Equal(codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("Update and Delete", func(t *testing.T) {
+		assert := require.New(t)
+		api := NewCompanyAPI(&TestValidator{returnSubject: "user"}, storage.NewMemoryRepository(), nil, 0)
+
+		a, b := company("batch_a"), company("batch_b")
+		resp, err := api.BatchCreate(ctx, &BatchCreateCompaniesRequest{
+			Atomic:    true,
+			Companies: []*Company{a, b},
+		})
+		assert.NoError(err)
+		assert.Equal([]codes.Code{codes.OK, codes.OK}, statusCodes(resp))
+
+		a.Description = "changed"
+		b.Name = "batch_a" // taken
+		_, err = api.BatchUpdate(ctx, &BatchUpdateCompaniesRequest{
+			Atomic:    true,
+			Companies: []*Company{a, b},
+		})
+		assert.Equal(codes.AlreadyExists, status.Code(err))
+		got, err := api.Get(ctx, &GetCompanyRequest{Id: a.Id})
+		assert.NoError(err)
+		assert.Empty(got.Company.Description)
+
+		resp, err = api.BatchUpdate(ctx, &BatchUpdateCompaniesRequest{
+			Companies: []*Company{a, b},
+		})
+		assert.NoError(err)
+		assert.Equal([]codes.Code{codes.OK, codes.AlreadyExists}, statusCodes(resp))
+
+		missing := uuid.Must(uuid.NewV4()).String()
+		_, err = api.BatchDelete(ctx, &BatchDeleteCompaniesRequest{
+			Atomic: true,
+			Ids:    []string{a.Id, missing},
+		})
+		assert.Equal(codes.NotFound, status.Code(err))
+		_, err = api.Get(ctx, &GetCompanyRequest{Id: a.Id})
+		assert.NoError(err)
+
+		resp, err = api.BatchDelete(ctx, &BatchDeleteCompaniesRequest{
+			Ids: []string{a.Id, missing, "invalid", b.Id},
+		})
+		assert.NoError(err)
+		assert.Equal([]codes.Code{codes.OK, codes.NotFound, codes.InvalidArgument, codes.OK}, statusCodes(resp))
+	})
+
+	t.Run("Duplicates", func(t *testing.T) {
+		assert := require.New(t)
+		api := NewCompanyAPI(&TestValidator{returnSubject: "user"}, storage.NewMemoryRepository(), nil, 0)
+
+		_, err := api.Create(ctx, &CreateCompanyRequest{Company: company("Acme Ltd")})
+		assert.NoError(err)
+
+		dup, other := company("Acme, LLC"), company("Other")
+		resp, err := api.BatchCreate(ctx, &BatchCreateCompaniesRequest{Companies: []*Company{dup, other}})
+		assert.NoError(err)
+		assert.Equal([]codes.Code{codes.FailedPrecondition, codes.OK}, statusCodes(resp))
+
+		resp, err = api.BatchCreate(ctx, &BatchCreateCompaniesRequest{Force: true, Companies: []*Company{dup}})
+		assert.NoError(err)
+		assert.Equal([]codes.Code{codes.OK}, statusCodes(resp))
+
+		// the items created before in the same batch are checked too
+		_, err = api.BatchCreate(ctx, &BatchCreateCompaniesRequest{
+			Atomic:    true,
+			Companies: []*Company{company("Beta"), company("Beta GmbH")},
+		})
+		assert.Equal(codes.FailedPrecondition, status.Code(err))
+		assert.Contains(status.Convert(err).Message(), "item 1:")
+	})
+
+	t.Run("Children", func(t *testing.T) {
+		assert := require.New(t)
+		api := NewCompanyAPI(&TestValidator{returnSubject: "user"}, storage.NewMemoryRepository(), nil, 0)
+
+		parent := func(name string, parent *Company) *Company {
+			c := company(name)
+			if parent != nil {
+				c.ParentId = parent.Id
+			}
+			_, err := api.Create(ctx, &CreateCompanyRequest{Company: c})
+			assert.NoError(err)
+			return c
+		}
+		holding := parent("Holding", nil)
+		a := parent("Sub A", holding)
+		a1 := parent("Sub A1", a)
+		b := parent("Sub B", holding)
+
+		resp, err := api.BatchDelete(ctx, &BatchDeleteCompaniesRequest{Ids: []string{holding.Id}})
+		assert.NoError(err)
+		assert.Equal([]codes.Code{codes.FailedPrecondition}, statusCodes(resp))
+
+		resp, err = api.BatchDelete(ctx, &BatchDeleteCompaniesRequest{Ids: []string{a.Id}, Children: DeleteChildren_ReparentChildren})
+		assert.NoError(err)
+		assert.Equal([]codes.Code{codes.OK}, statusCodes(resp))
+		got, err := api.Get(ctx, &GetCompanyRequest{Id: a1.Id})
+		assert.NoError(err)
+		assert.Equal(holding.Id, got.Company.ParentId)
+
+		resp, err = api.BatchDelete(ctx, &BatchDeleteCompaniesRequest{Atomic: true, Ids: []string{holding.Id}, Children: DeleteChildren_CascadeChildren})
+		assert.NoError(err)
+		assert.Equal([]codes.Code{codes.OK}, statusCodes(resp))
+		for _, c := range []*Company{holding, b, a1} {
+			_, err = api.Get(ctx, &GetCompanyRequest{Id: c.Id})
+			assert.Equal(codes.NotFound, status.Code(err))
+		}
+	})
+
+	t.Run("Approval", func(t *testing.T) {
+		assert := require.New(t)
+		api := NewCompanyAPI(&TestValidator{returnSubject: "user", returnUser: storage.User{ID: 2, Username: "alice"}}, storage.NewMemoryRepository(), nil, 0)
+
+		defer func(p approvalPolicy) { approval = p }(approval)
+		approval = approvalPolicy{delete: true, employeesThreshold: 100, ttl: time.Hour}
+
+		a, b := company("batch_a"), company("batch_b")
+		_, err := api.BatchCreate(ctx, &BatchCreateCompaniesRequest{Atomic: true, Companies: []*Company{a, b}})
+		assert.NoError(err)
+		changeRequest := func(s *spb.Status) *ChangeRequest {
+			assert.Len(s.Details, 1)
+			var cr ChangeRequest
+			assert.NoError(s.Details[0].UnmarshalTo(&cr))
+			return &cr
+		}
+
+		// the update of a needs an approval, the one of b is applied
+		a.Employeescnt = 500
+		b.Description = "changed"
+		resp, err := api.BatchUpdate(ctx, &BatchUpdateCompaniesRequest{Companies: []*Company{a, b}})
+		assert.NoError(err)
+		assert.Equal([]codes.Code{codes.OK, codes.OK}, statusCodes(resp))
+		cr := changeRequest(resp.Statuses[0])
+		assert.Equal(ChangeKind_CompanyUpdate, cr.Kind)
+		assert.Equal(a.Id, cr.CompanyId)
+		assert.Empty(resp.Statuses[1].Details)
+		got, err := api.Get(ctx, &GetCompanyRequest{Id: a.Id})
+		assert.NoError(err)
+		assert.Equal(int32(1), got.Company.Employeescnt)
+		got, err = api.Get(ctx, &GetCompanyRequest{Id: b.Id})
+		assert.NoError(err)
+		assert.Equal("changed", got.Company.Description)
+
+		// a can't be changed while its change is pending
+		a.Employeescnt = 1
+		a.Description = "changed"
+		b.Description = "changed again"
+		_, err = api.BatchUpdate(ctx, &BatchUpdateCompaniesRequest{Atomic: true, Companies: []*Company{b, a}})
+		assert.Equal(codes.FailedPrecondition, status.Code(err))
+		assert.Contains(status.Convert(err).Message(), "item 1:")
+		got, err = api.Get(ctx, &GetCompanyRequest{Id: b.Id})
+		assert.NoError(err)
+		assert.Equal("changed", got.Company.Description)
+
+		// the deletions need an approval
+		resp, err = api.BatchDelete(ctx, &BatchDeleteCompaniesRequest{Ids: []string{a.Id, b.Id}})
+		assert.NoError(err)
+		assert.Equal([]codes.Code{codes.FailedPrecondition, codes.OK}, statusCodes(resp))
+		cr = changeRequest(resp.Statuses[1])
+		assert.Equal(ChangeKind_CompanyDeletion, cr.Kind)
+		assert.Equal(b.Id, cr.CompanyId)
+		_, err = api.Get(ctx, &GetCompanyRequest{Id: b.Id})
+		assert.NoError(err)
+
+		list, err := api.ListChangeRequests(ctx, &ListChangeRequestsRequest{Status: ChangeRequestStatus_Pending})
+		assert.NoError(err)
+		assert.Len(list.ChangeRequests, 2)
+	})
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"context"
+	"net/mail"
+	"regexp"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/ptypes/empty"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/fancar/tmp_xm/internal/api/helpers"
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+// e164Regexp matches the phone numbers in the E.164 format.
+var e164Regexp = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+
+// CreateContact creates the given contact of the company.
+func (a *CompanyAPI) CreateContact(ctx context.Context, req *CreateContactRequest) (*Contact, error) {
+	log.Debug("api/CreateContact request:", req)
+
+	companyID, err := a.validateSubresource(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	item := convertContact(req.Contact)
+	item.ID, err = uuid.NewV4()
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, "new uuid error: %s", err)
+	}
+	item.CompanyID = companyID
+
+	if err := a.repo.CreateCompanyContact(ctx, item); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	a.sendSubresourceEvent(ctx, companyID)
+
+	return contactFromStorage(*item), nil
+}
+
+// GetContact returns the contact of the company.
+func (a *CompanyAPI) GetContact(ctx context.Context, req *GetContactRequest) (*Contact, error) {
+	log.Debug("api/GetContact request:", req)
+
+	companyID, err := a.validateSubresource(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	id := uuid.FromStringOrNil(req.Id)
+
+	item, err := a.repo.GetCompanyContact(ctx, companyID, id)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+	return contactFromStorage(item), nil
+}
+
+// UpdateContact updates the given contact of the company.
+func (a *CompanyAPI) UpdateContact(ctx context.Context, req *UpdateContactRequest) (*Contact, error) {
+	log.Debug("api/UpdateContact request:", req)
+
+	companyID, err := a.validateSubresource(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	item := convertContact(req.Contact)
+	item.ID = uuid.FromStringOrNil(req.Contact.Id)
+	item.CompanyID = companyID
+
+	if err := a.repo.UpdateCompanyContact(ctx, item); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	a.sendSubresourceEvent(ctx, companyID)
+
+	return contactFromStorage(*item), nil
+}
+
+// DeleteContact deletes the contact of the company.
+func (a *CompanyAPI) DeleteContact(ctx context.Context, req *DeleteContactRequest) (*empty.Empty, error) {
+	log.Debug("api/DeleteContact request:", req)
+
+	companyID, err := a.validateSubresource(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	id := uuid.FromStringOrNil(req.Id)
+
+	if err := a.repo.DeleteCompanyContact(ctx, companyID, id); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	a.sendSubresourceEvent(ctx, companyID)
+
+	return &empty.Empty{}, nil
+}
+
+// ListContacts returns the contacts of the company.
+func (a *CompanyAPI) ListContacts(ctx context.Context, req *ListContactsRequest) (*ListContactsResponse, error) {
+	log.Debug("api/ListContacts request:", req)
+
+	companyID, err := a.validateSubresource(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := a.repo.GetCompany(ctx, companyID); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+	list, err := a.repo.GetCompanyContacts(ctx, companyID)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	resp := &ListContactsResponse{Contacts: make([]*Contact, 0, len(list))}
+	for _, item := range list {
+		resp.Contacts = append(resp.Contacts, contactFromStorage(item))
+	}
+	return resp, nil
+}
+
+// convertContact converts the given validated contact, without its IDs.
+func convertContact(in *Contact) *storage.CompanyContact {
+	return &storage.CompanyContact{
+		Name:  in.Name,
+		Role:  in.Role,
+		Email: in.Email,
+		Phone: in.Phone,
+	}
+}
+
+// email checks that the string is an e-mail address.
+func email() check {
+	return func(_ protoreflect.FieldDescriptor, v protoreflect.Value) string {
+		addr, err := mail.ParseAddress(v.String())
+		if err != nil || addr.Address != v.String() || len(v.String()) > 254 {
+			return "must be a valid e-mail address"
+		}
+		return ""
+	}
+}
+
+// phone checks that the string is a phone number in the E.164 format.
+func phone() check {
+	return func(_ protoreflect.FieldDescriptor, v protoreflect.Value) string {
+		if !e164Regexp.MatchString(v.String()) {
+			return "must be in the E.164 format, e.g. +35725123456"
+		}
+		return ""
+	}
+}
+
+func contactFromStorage(c storage.CompanyContact) *Contact {
+	return &Contact{
+		Id:    c.ID.String(),
+		Name:  c.Name,
+		Role:  c.Role,
+		Email: c.Email,
+		Phone: c.Phone,
+	}
+}
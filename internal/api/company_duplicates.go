@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/fancar/tmp_xm/internal/api/auth"
+	"github.com/fancar/tmp_xm/internal/api/helpers"
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+const (
+	defaultDuplicatesLimit = 100
+	maxDuplicatesLimit     = 1000
+
+	// duplicateViolationType is the type of the precondition violations
+	// returned for the duplicate candidates.
+	duplicateViolationType = "DUPLICATE"
+)
+
+// FindDuplicates returns the pairs of companies which may be duplicates.
+func (a *CompanyAPI) FindDuplicates(ctx context.Context, req *FindDuplicatesRequest) (*FindDuplicatesResponse, error) {
+	log.Debug("api/FindDuplicates request:", req)
+
+	if err := a.validator.Validate(ctx, auth.ValidateIsAdmin()); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+	limit := defaultDuplicatesLimit
+	if req.Limit > 0 {
+		limit = int(req.Limit)
+	}
+
+	pairs, err := a.repo.FindAllCompanyDuplicates(ctx, limit)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	resp := &FindDuplicatesResponse{Pairs: make([]*DuplicatePair, 0, len(pairs))}
+	for _, p := range pairs {
+		resp.Pairs = append(resp.Pairs, &DuplicatePair{
+			First:      companyFromStorage(p.First),
+			Second:     companyFromStorage(p.Second),
+			Similarity: p.Similarity,
+		})
+	}
+	return resp, nil
+}
+
+// checkDuplicates returns a FailedPrecondition error, with the candidates
+// in its details, if the given company may be a duplicate of an existing
+// one in repo. A company with the same ID or name is left to the storage,
+// which returns AlreadyExists.
+func checkDuplicates(ctx context.Context, repo storage.Repository, c *storage.Company) error {
+	candidates, err := repo.FindCompanyDuplicates(ctx, c.Name)
+	if err != nil {
+		return helpers.ErrToRPCError(err)
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	violations := make([]*errdetails.PreconditionFailure_Violation, 0, len(candidates))
+	for _, d := range candidates {
+		if d.ID == c.ID || d.Name == c.Name {
+			return nil
+		}
+		violations = append(violations, &errdetails.PreconditionFailure_Violation{
+			Type:        duplicateViolationType,
+			Subject:     d.ID.String(),
+			Description: fmt.Sprintf("%s (similarity %.2f)", d.Name, d.Similarity),
+		})
+	}
+
+	s, err := status.New(codes.FailedPrecondition,
+		"the company may be a duplicate of existing companies, set 'force' to create it anyway").
+		WithDetails(&errdetails.PreconditionFailure{Violations: violations})
+	if err != nil {
+		return grpc.Errorf(codes.Internal, "status details error: %s", err)
+	}
+	return s.Err()
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+func TestCompanyDuplicates(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+
+	validator := &TestValidator{returnSubject: "user"}
+	api := NewCompanyAPI(validator, storage.NewMemoryRepository(), nil, 0)
+
+	newCompany := func(name string) *Company {
+		return &Company{
+			Id:           uuid.Must(uuid.NewV4()).String(),
+			Name:         name,
+			Employeescnt: 1,
+			Type:         CompanyType_Corporations,
+		}
+	}
+
+	first := newCompany("Acme Ltd")
+	_, err := api.Create(ctx, &CreateCompanyRequest{Company: first})
+	assert.NoError(err)
+
+	t.Run("Create duplicate", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := api.Create(ctx, &CreateCompanyRequest{Company: newCompany("ACME, Inc.")})
+		s := status.Convert(err)
+		assert.Equal(codes.FailedPrecondition, s.Code())
+		assert.Len(s.Details(), 1)
+		pf, ok := s.Details()[0].(*errdetails.PreconditionFailure)
+		assert.True(ok)
+		assert.Len(pf.Violations, 1)
+		assert.Equal("DUPLICATE", pf.Violations[0].Type)
+		assert.Equal(first.Id, pf.Violations[0].Subject)
+	})
+
+	t.Run("Create same name", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := api.Create(ctx, &CreateCompanyRequest{Company: newCompany("Acme Ltd")})
+		assert.Equal(codes.AlreadyExists, status.Code(err))
+	})
+
+	t.Run("Create forced", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := api.Create(ctx, &CreateCompanyRequest{Company: newCompany("ACME, Inc."), Force: true})
+		assert.NoError(err)
+	})
+
+	t.Run("FindDuplicates", func(t *testing.T) {
+		assert := require.New(t)
+
+		resp, err := api.FindDuplicates(ctx, &FindDuplicatesRequest{})
+		assert.NoError(err)
+		assert.Len(resp.Pairs, 1)
+		assert.Equal(1.0, resp.Pairs[0].Similarity)
+		assert.Len(validator.validatorFuncs, 1)
+
+		_, err = api.FindDuplicates(ctx, &FindDuplicatesRequest{Limit: 1001})
+		assert.Equal(codes.InvalidArgument, status.Code(err))
+	})
+}
@@ -0,0 +1,200 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/fancar/tmp_xm/internal/api/auth"
+	"github.com/fancar/tmp_xm/internal/api/helpers"
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+// exportFlushRows defines every how many rows the HTTP export is flushed to
+// the client.
+const exportFlushRows = 100
+
+// ExportCompanies streams the companies matching the filters of the request.
+func (a *CompanyAPI) ExportCompanies(req *ExportCompaniesRequest, stream CompanyService_ExportCompaniesServer) error {
+	return a.exportCompanies(stream.Context(), req, func(c *Company) error {
+		return stream.Send(&ExportCompaniesResponse{Company: c})
+	})
+}
+
+// exportCompanies calls fn for every company matching the filters of the
+// request. The storage is read as fn goes, the companies are not collected
+// in memory.
+func (a *CompanyAPI) exportCompanies(ctx context.Context, req *ExportCompaniesRequest, fn func(*Company) error) error {
+	if err := a.validator.Validate(ctx, auth.ValidateActiveUser()); err != nil {
+		return grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	if err := validate(req); err != nil {
+		return err
+	}
+
+	selector, _ := parseLabelSelector(req.LabelSelector)
+	attributes, err := attributeFilters(ctx, a.repo, uint32(req.Type), req.Attributes)
+	if err != nil {
+		return err
+	}
+	filters := storage.CompanyFilters{
+		Type:       uint32(req.Type),
+		NamePrefix: req.NamePrefix,
+		Attributes: attributes,
+		// the selector is validated by the rules
+		Labels: selector,
+	}
+	if req.Registered != nil {
+		registered := req.Registered.Value
+		filters.Registered = &registered
+	}
+
+	var n int64
+	var sendErr error
+	err = a.repo.ForEachCompany(ctx, filters, func(c storage.Company) error {
+		if sendErr = fn(companyFromStorage(c)); sendErr != nil {
+			return sendErr
+		}
+		n++
+		return nil
+	})
+	if sendErr != nil {
+		return sendErr
+	}
+	if err != nil {
+		return helpers.ErrToRPCError(err)
+	}
+
+	log.WithField("count", n).Info("api/ExportCompanies: export finished")
+	return nil
+}
+
+// exportHandler serves GET /api/Companies:export, it writes the companies
+// matching the query parameters as a CSV, an Excel CSV or a JSON Lines file.
+// The JWT is read from the Authorization or the Grpc-Metadata-Authorization
+// header.
+func (a *CompanyAPI) exportHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	format := q.Get("format")
+	if format == "" {
+		format = FormatCSV
+	}
+	req := &ExportCompaniesRequest{
+		NamePrefix:    q.Get("name_prefix"),
+		Attributes:    q["attribute"],
+		LabelSelector: q.Get("label_selector"),
+	}
+
+	if v := q.Get("type"); v != "" {
+		t, err := parseCompanyType(v)
+		if err != nil {
+			writeHTTPError(w, grpc.Errorf(codes.InvalidArgument, "bad value: %s", err))
+			return
+		}
+		req.Type = t
+	}
+	if v := q.Get("registered"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			writeHTTPError(w, grpc.Errorf(codes.InvalidArgument, "bad value: invalid registered: %s", v))
+			return
+		}
+		req.Registered = wrapperspb.Bool(b)
+	}
+
+	var contentType, ext string
+	switch format {
+	case FormatCSV, FormatExcelCSV:
+		contentType, ext = "text/csv; charset=utf-8", "csv"
+	case FormatJSONL:
+		contentType, ext = "application/x-ndjson", "jsonl"
+	default:
+		writeHTTPError(w, grpc.Errorf(codes.InvalidArgument, "bad value: unknown format %s, expected csv, excel or jsonl", format))
+		return
+	}
+
+	ctx := httpAuthContext(r)
+
+	cw, err := NewCompanyWriter(w, format)
+	if err != nil {
+		writeHTTPError(w, grpc.Errorf(codes.InvalidArgument, "bad value: %s", err))
+		return
+	}
+	flusher, _ := w.(http.Flusher)
+
+	// the headers are sent with the first row, the errors which happen
+	// before are returned with their status code
+	started := false
+	var rows int
+	err = a.exportCompanies(ctx, req, func(c *Company) error {
+		if !started {
+			w.Header().Set("Content-Type", contentType)
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="companies.%s"`, ext))
+			started = true
+		}
+		if err := cw.Write(c); err != nil {
+			return err
+		}
+		rows++
+		if rows%exportFlushRows == 0 {
+			if err := cw.Flush(); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		return nil
+	})
+	if err != nil && !started {
+		writeHTTPError(w, err)
+		return
+	}
+	if err != nil {
+		// the status is sent already, abort the response so that the
+		// client does not take the truncated file as complete
+		log.WithError(err).Error("api/ExportCompanies: export aborted")
+		panic(http.ErrAbortHandler)
+	}
+
+	if !started {
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="companies.%s"`, ext))
+	}
+	if err := cw.Flush(); err != nil {
+		log.WithError(err).Error("api/ExportCompanies: write response error")
+	}
+}
+
+// companyFromStorage converts the storage company to its api object.
+func companyFromStorage(d storage.Company) *Company {
+	c := &Company{
+		Id:           d.ID.String(),
+		Name:         d.Name,
+		Description:  d.Description,
+		Employeescnt: d.EmployeesCnt,
+		Registered:   d.Registered,
+		Type:         CompanyType(d.Type),
+		Status:       CompanyStatus(d.Status),
+
+		Jurisdiction:       d.Jurisdiction,
+		RegistrationNumber: d.RegistrationNumber,
+		VatId:              d.VATID,
+		Lei:                d.LEI,
+
+		Attributes: attributesFromStorage(d.Attributes),
+		Labels:     labelsFromStorage(d.Labels),
+	}
+	if d.ParentID.Valid {
+		c.ParentId = d.ParentID.UUID.String()
+	}
+	return c
+}
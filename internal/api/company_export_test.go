@@ -0,0 +1,184 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+// testExportStream implements CompanyService_ExportCompaniesServer.
+type testExportStream struct {
+	grpc.ServerStream
+	companies []*Company
+}
+
+func (s *testExportStream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *testExportStream) Send(resp *ExportCompaniesResponse) error {
+	s.companies = append(s.companies, resp.Company)
+	return nil
+}
+
+func TestExportCompanies(t *testing.T) {
+	ctx := context.Background()
+	storage.HashIterations = 1
+
+	repo := storage.NewMemoryRepository()
+	api := NewCompanyAPI(&TestValidator{returnSubject: "user"}, repo, nil, 0)
+
+	for i, name := range []string{"export_b", "export_a", "other"} {
+		c := &Company{
+			Id:           uuid.Must(uuid.NewV4()).String(),
+			Name:         name,
+			Employeescnt: 1,
+			Registered:   i == 0,
+			Type:         CompanyType_Corporations,
+		}
+		_, err := api.Create(ctx, &CreateCompanyRequest{Company: c})
+		require.NoError(t, err)
+	}
+
+	names := func(companies []*Company) []string {
+		var out []string
+		for _, c := range companies {
+			out = append(out, c.Name)
+		}
+		return out
+	}
+
+	t.Run("gRPC", func(t *testing.T) {
+		assert := require.New(t)
+
+		stream := &testExportStream{}
+		assert.NoError(api.ExportCompanies(&ExportCompaniesRequest{}, stream))
+		assert.Equal([]string{"export_a", "export_b", "other"}, names(stream.companies))
+
+		stream = &testExportStream{}
+		assert.NoError(api.ExportCompanies(&ExportCompaniesRequest{
+			NamePrefix: "export_",
+			Registered: wrapperspb.Bool(false),
+		}, stream))
+		assert.Equal([]string{"export_a"}, names(stream.companies))
+	})
+
+	t.Run("HTTP", func(t *testing.T) {
+		assert := require.New(t)
+
+		w := httptest.NewRecorder()
+		api.exportHandler(w, httptest.NewRequest("GET", "/api/Companies:export?format=jsonl&name_prefix=export_&type=Corporations", nil))
+		assert.Equal(http.StatusOK, w.Code)
+		assert.Equal("application/x-ndjson", w.Header().Get("Content-Type"))
+
+		r, err := NewCompanyReader(w.Body, FormatJSONL)
+		assert.NoError(err)
+		var companies []*Company
+		for _, rec := range readCompanyRecords(t, r) {
+			assert.NoError(rec.Err)
+			companies = append(companies, rec.Company)
+		}
+		assert.Equal([]string{"export_a", "export_b"}, names(companies))
+
+		w = httptest.NewRecorder()
+		api.exportHandler(w, httptest.NewRequest("GET", "/api/Companies:export?name_prefix=none", nil))
+		assert.Equal(http.StatusOK, w.Code)
+		assert.Equal(`attachment; filename="companies.csv"`, w.Header().Get("Content-Disposition"))
+		assert.Equal(strings.Join(companyCSVHeader, ",")+"\n", w.Body.String())
+
+		w = httptest.NewRecorder()
+		api.exportHandler(w, httptest.NewRequest("GET", "/api/Companies:export?name_prefix=none&format=excel", nil))
+		assert.Equal(http.StatusOK, w.Code)
+		assert.Equal("text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Equal(`attachment; filename="companies.csv"`, w.Header().Get("Content-Disposition"))
+		assert.Equal("\ufeff"+strings.Join(companyCSVHeader, ",")+"\n", w.Body.String())
+
+		w = httptest.NewRecorder()
+		api.exportHandler(w, httptest.NewRequest("GET", "/api/Companies:export?format=xml", nil))
+		assert.Equal(http.StatusBadRequest, w.Code)
+		assert.Contains(w.Body.String(), "unknown format xml")
+	})
+
+	t.Run("Reimport", func(t *testing.T) {
+		for _, format := range []string{FormatCSV, FormatExcelCSV, FormatJSONL} {
+			t.Run(format, func(t *testing.T) {
+				assert := require.New(t)
+
+				newAPI := func() *CompanyAPI {
+					api := NewCompanyAPI(&TestValidator{returnSubject: "user"}, storage.NewMemoryRepository(), nil, 0)
+					for _, d := range []*AttributeDefinition{
+						{CompanyType: CompanyType_Corporations, Name: "tier", Kind: AttributeKind_EnumAttribute, EnumValues: []string{"gold", "silver"}},
+						{CompanyType: CompanyType_Corporations, Name: "seats", Kind: AttributeKind_IntAttribute},
+					} {
+						_, err := api.CreateAttributeDefinition(ctx, &CreateAttributeDefinitionRequest{Definition: d})
+						assert.NoError(err)
+					}
+					return api
+				}
+				from, to := newAPI(), newAPI()
+
+				attributes, err := structpb.NewStruct(map[string]interface{}{"tier": "gold", "seats": 10})
+				assert.NoError(err)
+				parent := &Company{
+					Id:           uuid.Must(uuid.NewV4()).String(),
+					Name:         "Reimport A",
+					Employeescnt: 1,
+					Type:         CompanyType_Corporations,
+				}
+				child := &Company{
+					Id:                 uuid.Must(uuid.NewV4()).String(),
+					Name:               "Reimport B",
+					Description:        "multi\nline, \"quoted\"",
+					Employeescnt:       10,
+					Registered:         true,
+					Type:               CompanyType_Corporations,
+					ParentId:           parent.Id,
+					Status:             CompanyStatus_PendingVerification,
+					Jurisdiction:       "CY",
+					RegistrationNumber: "HE123456",
+					VatId:              "CY10259033P",
+					Lei:                "5493001KJTIIGC8Y1R12",
+					Attributes:         attributes,
+					Labels:             map[string]string{"env": "prod", "vip": ""},
+				}
+				for _, c := range []*Company{parent, child} {
+					_, err := from.Create(ctx, &CreateCompanyRequest{Company: c})
+					assert.NoError(err)
+				}
+
+				w := httptest.NewRecorder()
+				from.exportHandler(w, httptest.NewRequest("GET", "/api/Companies:export?name_prefix=Reimport&format="+format, nil))
+				assert.Equal(http.StatusOK, w.Code)
+
+				r, err := NewCompanyReader(w.Body, format)
+				assert.NoError(err)
+				stream := &testImportStream{}
+				for _, rec := range readCompanyRecords(t, r) {
+					assert.NoError(rec.Err)
+					stream.reqs = append(stream.reqs, &ImportCompaniesRequest{Company: rec.Company})
+				}
+				assert.NoError(to.ImportCompanies(stream))
+				assert.Equal(int64(2), stream.resp.Imported)
+
+				for _, c := range []*Company{parent, child} {
+					want, err := from.Get(ctx, &GetCompanyRequest{Id: c.Id})
+					assert.NoError(err)
+					got, err := to.Get(ctx, &GetCompanyRequest{Id: c.Id})
+					assert.NoError(err)
+					assert.True(proto.Equal(want.Company, got.Company), "%v != %v", want.Company, got.Company)
+				}
+			})
+		}
+	})
+}
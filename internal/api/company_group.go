@@ -0,0 +1,144 @@
+package api
+
+import (
+	"context"
+
+	"github.com/gofrs/uuid"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/fancar/tmp_xm/internal/api/auth"
+	"github.com/fancar/tmp_xm/internal/api/helpers"
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+// GetAncestors returns the ancestors of the company, the nearest first.
+func (a *CompanyAPI) GetAncestors(ctx context.Context, req *GetAncestorsRequest) (*GetAncestorsResponse, error) {
+	log.Debug("api/GetAncestors request:", req)
+
+	id, err := a.validateGroupRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := a.repo.GetCompanyAncestors(ctx, id)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	resp := &GetAncestorsResponse{Companies: make([]*Company, 0, len(list))}
+	for _, c := range list {
+		resp.Companies = append(resp.Companies, companyFromStorage(c))
+	}
+	return resp, nil
+}
+
+// GetDescendants returns the descendants of the company.
+func (a *CompanyAPI) GetDescendants(ctx context.Context, req *GetDescendantsRequest) (*GetDescendantsResponse, error) {
+	log.Debug("api/GetDescendants request:", req)
+
+	id, err := a.validateGroupRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := a.repo.GetCompanyDescendants(ctx, id)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	resp := &GetDescendantsResponse{Descendants: make([]*Descendant, 0, len(list))}
+	for _, n := range list {
+		resp.Descendants = append(resp.Descendants, &Descendant{
+			Company: companyFromStorage(n.Company),
+			Depth:   int32(n.Depth),
+		})
+	}
+	return resp, nil
+}
+
+// GetGroupTree returns the tree of the group of the company, from its
+// top-level parent.
+func (a *CompanyAPI) GetGroupTree(ctx context.Context, req *GetGroupTreeRequest) (*GetGroupTreeResponse, error) {
+	log.Debug("api/GetGroupTree request:", req)
+
+	id, err := a.validateGroupRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var root storage.Company
+	var descendants []storage.CompanyNode
+	err = a.repo.Transaction(ctx, func(tx storage.Repository) error {
+		ancestors, err := tx.GetCompanyAncestors(ctx, id)
+		if err != nil {
+			return err
+		}
+		if len(ancestors) > 0 {
+			root = ancestors[len(ancestors)-1]
+		} else if root, err = tx.GetCompany(ctx, id); err != nil {
+			return err
+		}
+
+		descendants, err = tx.GetCompanyDescendants(ctx, root.ID)
+		return err
+	})
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	return &GetGroupTreeResponse{Root: groupTree(root, descendants)}, nil
+}
+
+// groupTree returns the tree of the given root and descendants, ordered by
+// depth and name, with the total employees of every subtree.
+func groupTree(root storage.Company, descendants []storage.CompanyNode) *GroupNode {
+	nodes := map[uuid.UUID]*GroupNode{
+		root.ID: {Company: companyFromStorage(root)},
+	}
+	for _, d := range descendants {
+		parent, ok := nodes[d.ParentID.UUID]
+		if !ok {
+			continue
+		}
+		n := &GroupNode{Company: companyFromStorage(d.Company)}
+		parent.Children = append(parent.Children, n)
+		nodes[d.ID] = n
+	}
+
+	var total func(n *GroupNode) int64
+	total = func(n *GroupNode) int64 {
+		n.TotalEmployees = int64(n.Company.Employeescnt)
+		for _, c := range n.Children {
+			n.TotalEmployees += total(c)
+		}
+		return n.TotalEmployees
+	}
+	total(nodes[root.ID])
+	return nodes[root.ID]
+}
+
+// groupRequest is a request on the group of a company.
+type groupRequest interface {
+	proto.Message
+	GetId() string
+}
+
+// validateGroupRequest authenticates and validates the request on the
+// group of the company, which must exist, and returns the company ID.
+func (a *CompanyAPI) validateGroupRequest(ctx context.Context, req groupRequest) (uuid.UUID, error) {
+	if err := a.validator.Validate(ctx, auth.ValidateActiveUser()); err != nil {
+		return uuid.Nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+	if err := validate(req); err != nil {
+		return uuid.Nil, err
+	}
+
+	id := uuid.FromStringOrNil(req.GetId())
+	if _, err := a.repo.GetCompany(ctx, id); err != nil {
+		return uuid.Nil, helpers.ErrToRPCError(err)
+	}
+	return id, nil
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+func TestCompanyGroup(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+
+	api := NewCompanyAPI(&TestValidator{returnSubject: "user"}, storage.NewMemoryRepository(), nil, 0)
+
+	newCompany := func(name string, employees int32, parent *Company) *Company {
+		c := &Company{
+			Id:           uuid.Must(uuid.NewV4()).String(),
+			Name:         name,
+			Employeescnt: employees,
+			Type:         CompanyType_Corporations,
+		}
+		if parent != nil {
+			c.ParentId = parent.Id
+		}
+		_, err := api.Create(ctx, &CreateCompanyRequest{Company: c})
+		assert.NoError(err)
+		return c
+	}
+
+	holding := newCompany("Holding", 10, nil)
+	a := newCompany("Sub A", 20, holding)
+	b := newCompany("Sub B", 30, holding)
+	a1 := newCompany("Sub A1", 40, a)
+
+	t.Run("GetAncestors", func(t *testing.T) {
+		assert := require.New(t)
+
+		resp, err := api.GetAncestors(ctx, &GetAncestorsRequest{Id: a1.Id})
+		assert.NoError(err)
+		assert.Len(resp.Companies, 2)
+		assert.Equal(a.Id, resp.Companies[0].Id)
+		assert.Equal(holding.Id, resp.Companies[1].Id)
+	})
+
+	t.Run("GetDescendants", func(t *testing.T) {
+		assert := require.New(t)
+
+		resp, err := api.GetDescendants(ctx, &GetDescendantsRequest{Id: holding.Id})
+		assert.NoError(err)
+		assert.Len(resp.Descendants, 3)
+		assert.Equal(a.Id, resp.Descendants[0].Company.Id)
+		assert.Equal(b.Id, resp.Descendants[1].Company.Id)
+		assert.Equal(a1.Id, resp.Descendants[2].Company.Id)
+		assert.EqualValues(2, resp.Descendants[2].Depth)
+
+		_, err = api.GetDescendants(ctx, &GetDescendantsRequest{Id: uuid.Must(uuid.NewV4()).String()})
+		assert.Equal(codes.NotFound, status.Code(err))
+	})
+
+	t.Run("GetGroupTree", func(t *testing.T) {
+		assert := require.New(t)
+
+		resp, err := api.GetGroupTree(ctx, &GetGroupTreeRequest{Id: a1.Id})
+		assert.NoError(err)
+		assert.Equal(holding.Id, resp.Root.Company.Id)
+		assert.EqualValues(100, resp.Root.TotalEmployees)
+		assert.Len(resp.Root.Children, 2)
+		assert.Equal(a.Id, resp.Root.Children[0].Company.Id)
+		assert.EqualValues(60, resp.Root.Children[0].TotalEmployees)
+		assert.Len(resp.Root.Children[0].Children, 1)
+	})
+
+	t.Run("Cycle", func(t *testing.T) {
+		assert := require.New(t)
+
+		holding.ParentId = a1.Id
+		_, err := api.Update(ctx, &UpdateCompanyRequest{Company: holding})
+		assert.Equal(codes.InvalidArgument, status.Code(err))
+		holding.ParentId = ""
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := api.Delete(ctx, &DeleteCompanyRequest{Id: holding.Id})
+		assert.Equal(codes.FailedPrecondition, status.Code(err))
+
+		_, err = api.Delete(ctx, &DeleteCompanyRequest{Id: a.Id, Children: DeleteChildren_ReparentChildren})
+		assert.NoError(err)
+		resp, err := api.Get(ctx, &GetCompanyRequest{Id: a1.Id})
+		assert.NoError(err)
+		assert.Equal(holding.Id, resp.Company.ParentId)
+
+		_, err = api.Delete(ctx, &DeleteCompanyRequest{Id: holding.Id, Children: DeleteChildren_CascadeChildren})
+		assert.NoError(err)
+		for _, c := range []*Company{holding, b, a1} {
+			_, err = api.Get(ctx, &GetCompanyRequest{Id: c.Id})
+			assert.Equal(codes.NotFound, status.Code(err))
+		}
+	})
+}
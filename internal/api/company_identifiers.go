@@ -0,0 +1,68 @@
+package api
+
+import (
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/fancar/tmp_xm/internal/api/identifiers"
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+// convertCompanyIdentifiers sets the normalized identifiers of the given
+// company in out.
+func convertCompanyIdentifiers(in *Company, out *storage.Company) {
+	out.Jurisdiction = strings.ToUpper(strings.TrimSpace(in.Jurisdiction))
+	out.RegistrationNumber = identifiers.NormalizeRegistrationNumber(in.RegistrationNumber)
+	out.VATID = identifiers.NormalizeVATID(in.VatId)
+	out.LEI = identifiers.NormalizeLEI(in.Lei)
+}
+
+// vatID checks that the string is a valid VAT ID once normalized.
+func vatID() check {
+	return func(_ protoreflect.FieldDescriptor, v protoreflect.Value) string {
+		id := identifiers.NormalizeVATID(v.String())
+		if id == "" {
+			return ""
+		}
+		if err := identifiers.ValidateVATID(id); err != nil {
+			return err.Error()
+		}
+		return ""
+	}
+}
+
+// lei checks that the string is a valid LEI once normalized.
+func lei() check {
+	return func(_ protoreflect.FieldDescriptor, v protoreflect.Value) string {
+		id := identifiers.NormalizeLEI(v.String())
+		if id == "" {
+			return ""
+		}
+		if err := identifiers.ValidateLEI(id); err != nil {
+			return err.Error()
+		}
+		return ""
+	}
+}
+
+// checkRegistrationNumber checks the registration number of the company by
+// the rules of its jurisdiction, which is required with the number.
+func checkRegistrationNumber(m proto.Message, v *fieldViolations) {
+	c := m.(*Company)
+	number := identifiers.NormalizeRegistrationNumber(c.RegistrationNumber)
+	if number == "" {
+		return
+	}
+
+	jurisdiction := strings.ToUpper(strings.TrimSpace(c.Jurisdiction))
+	switch {
+	case jurisdiction == "":
+		v.add("jurisdiction", "is required with the registration number")
+	case isoCountries[jurisdiction]:
+		if err := identifiers.ValidateRegistrationNumber(jurisdiction, number); err != nil {
+			v.add("registration_number", "%s", err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+func TestCompanyIdentifiers(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+
+	api := NewCompanyAPI(&TestValidator{returnSubject: "user"}, storage.NewMemoryRepository(), nil, 0)
+
+	newCompany := func(name string) *Company {
+		return &Company{
+			Id:           uuid.Must(uuid.NewV4()).String(),
+			Name:         name,
+			Employeescnt: 1,
+			Type:         CompanyType_Corporations,
+		}
+	}
+
+	first := newCompany("Acme")
+	first.Jurisdiction = "cy"
+	first.RegistrationNumber = "ΗΕ 123456"
+	first.VatId = "cy-10259033p"
+	first.Lei = "2138 00D1EI4B9WTWWD28"
+	_, err := api.Create(ctx, &CreateCompanyRequest{Company: first})
+	assert.NoError(err)
+
+	t.Run("Normalized", func(t *testing.T) {
+		assert := require.New(t)
+
+		resp, err := api.Get(ctx, &GetCompanyRequest{Id: first.Id})
+		assert.NoError(err)
+		assert.Equal("CY", resp.Company.Jurisdiction)
+		assert.Equal("HE123456", resp.Company.RegistrationNumber)
+		assert.Equal("CY10259033P", resp.Company.VatId)
+		assert.Equal("213800D1EI4B9WTWWD28", resp.Company.Lei)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		assert := require.New(t)
+
+		c := newCompany("Invalid")
+		c.RegistrationNumber = "HE1"
+		c.VatId = "DE136695977"
+		c.Lei = "213800D1EI4B9WTWWD29"
+		_, err := api.Create(ctx, &CreateCompanyRequest{Company: c})
+		s := status.Convert(err)
+		assert.Equal(codes.InvalidArgument, s.Code())
+		assert.Len(s.Details(), 1)
+		br, ok := s.Details()[0].(*errdetails.BadRequest)
+		assert.True(ok)
+
+		var fields []string
+		for _, v := range br.FieldViolations {
+			fields = append(fields, v.Field)
+		}
+		assert.Equal([]string{"Company.vat_id", "Company.lei", "Company.jurisdiction"}, fields)
+
+		update := proto.Clone(first).(*Company)
+		update.RegistrationNumber = "123"
+		_, err = api.Update(ctx, &UpdateCompanyRequest{Company: update})
+		s = status.Convert(err)
+		assert.Equal(codes.InvalidArgument, s.Code())
+		br, ok = s.Details()[0].(*errdetails.BadRequest)
+		assert.True(ok)
+		assert.Len(br.FieldViolations, 1)
+		assert.Equal("Company.registration_number", br.FieldViolations[0].Field)
+	})
+
+	t.Run("Duplicate", func(t *testing.T) {
+		assert := require.New(t)
+
+		c := newCompany("Other")
+		c.Lei = first.Lei
+		_, err := api.Create(ctx, &CreateCompanyRequest{Company: c})
+		assert.Equal(codes.AlreadyExists, status.Code(err))
+
+		c.Lei = ""
+		c.Jurisdiction = "CY"
+		c.RegistrationNumber = "HE123456"
+		_, err = api.Create(ctx, &CreateCompanyRequest{Company: c})
+		assert.Equal(codes.AlreadyExists, status.Code(err))
+
+		// the registration numbers are unique per jurisdiction
+		c.Jurisdiction = "GB"
+		_, err = api.Create(ctx, &CreateCompanyRequest{Company: c})
+		assert.NoError(err)
+	})
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"context"
+	"io"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/fancar/tmp_xm/internal/api/auth"
+	"github.com/fancar/tmp_xm/internal/api/helpers"
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+const (
+	defaultImportBatchSize = 100
+	maxImportBatchSize     = 1000
+)
+
+// importRow holds a received row of an import.
+type importRow struct {
+	row  int64
+	id   string
+	item *storage.Company
+	err  error
+}
+
+// ImportCompanies creates the companies streamed by the client.
+func (a *CompanyAPI) ImportCompanies(stream CompanyService_ImportCompaniesServer) error {
+	ctx := stream.Context()
+
+	if err := a.validator.Validate(ctx, auth.ValidateActiveUser()); err != nil {
+		return grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+	user, err := a.validator.GetUser(ctx)
+	if err != nil {
+		return grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	resp := &ImportCompaniesResponse{}
+	mode := ImportMode_BATCH
+	batchSize := defaultImportBatchSize
+	force := false
+	var batch []importRow
+
+	for seq := int64(1); ; seq++ {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if seq == 1 {
+			if err := validate(req); err != nil {
+				return err
+			}
+			mode = req.Mode
+			force = req.Force
+			if req.BatchSize > 0 {
+				batchSize = int(req.BatchSize)
+			}
+		}
+
+		row := importRow{row: req.Row}
+		if row.row == 0 {
+			row.row = seq
+		}
+		row.id = req.Company.GetId()
+		row.item, row.err = a.convertNewCompany(ctx, a.repo, req.Company)
+		resp.Total++
+
+		if mode == ImportMode_BEST_EFFORT {
+			a.importRow(ctx, resp, user.Username, row, force)
+			continue
+		}
+
+		batch = append(batch, row)
+		if len(batch) == batchSize {
+			a.importBatch(ctx, resp, user.Username, batch, force)
+			batch = nil
+		}
+	}
+	if len(batch) != 0 {
+		a.importBatch(ctx, resp, user.Username, batch, force)
+	}
+
+	resp.Failed = int64(len(resp.Errors))
+	log.WithFields(log.Fields{
+		"mode":     mode,
+		"total":    resp.Total,
+		"imported": resp.Imported,
+		"failed":   resp.Failed,
+	}).Info("api/ImportCompanies: import finished")
+
+	return stream.SendAndClose(resp)
+}
+
+// importRow creates the company of the given row on its own, without force
+// it fails if the company may be a duplicate (see applyCreate).
+func (a *CompanyAPI) importRow(ctx context.Context, resp *ImportCompaniesResponse, username string, row importRow, force bool) {
+	if row.err != nil {
+		resp.Errors = append(resp.Errors, importRowError(row,
+			invalidArgument("check your body", row.err)))
+		return
+	}
+
+	err := a.repo.Transaction(ctx, func(tx storage.Repository) error {
+		return applyCreate(ctx, tx, username, row.item, force)
+	})
+	if err != nil {
+		resp.Errors = append(resp.Errors, importRowError(row, helpers.ErrToRPCError(err)))
+		return
+	}
+
+	resp.Imported++
+	sendEvent(ctx, a.companyEvent(ctx, row.item, "created"), row.id, "created")
+}
+
+// importBatch creates the companies of the given rows in a transaction. An
+// invalid or failing row rolls back the whole batch.
+func (a *CompanyAPI) importBatch(ctx context.Context, resp *ImportCompaniesResponse, username string, rows []importRow, force bool) {
+	errs := make([]error, len(rows))
+	failed := false
+
+	for i, row := range rows {
+		if row.err != nil {
+			errs[i] = invalidArgument("check your body", row.err)
+			failed = true
+		}
+	}
+
+	if !failed {
+		err := a.repo.Transaction(ctx, func(tx storage.Repository) error {
+			for i, row := range rows {
+				if err := applyCreate(ctx, tx, username, row.item, force); err != nil {
+					errs[i] = helpers.ErrToRPCError(err)
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			failed = true
+		}
+		if err != nil && !hasError(errs) {
+			// the commit failed
+			for i := range errs {
+				errs[i] = helpers.ErrToRPCError(err)
+			}
+		}
+	}
+
+	for i, row := range rows {
+		switch {
+		case errs[i] != nil:
+			resp.Errors = append(resp.Errors, importRowError(row, errs[i]))
+		case failed:
+			resp.Errors = append(resp.Errors, importRowError(row,
+				grpc.Errorf(codes.Aborted, "rolled back with its batch")))
+		default:
+			resp.Imported++
+			sendEvent(ctx, a.companyEvent(ctx, row.item, "created"), row.id, "created")
+		}
+	}
+}
+
+func importRowError(row importRow, err error) *ImportRowError {
+	s := status.Convert(err)
+	return &ImportRowError{
+		Row:     row.row,
+		Id:      row.id,
+		Code:    int32(s.Code()),
+		Message: s.Message(),
+	}
+}
+
+func hasError(errs []error) bool {
+	for _, err := range errs {
+		if err != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+// testImportStream implements CompanyService_ImportCompaniesServer.
+type testImportStream struct {
+	grpc.ServerStream
+	reqs []*ImportCompaniesRequest
+	resp *ImportCompaniesResponse
+}
+
+func (s *testImportStream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *testImportStream) Recv() (*ImportCompaniesRequest, error) {
+	if len(s.reqs) == 0 {
+		return nil, io.EOF
+	}
+	req := s.reqs[0]
+	s.reqs = s.reqs[1:]
+	return req, nil
+}
+
+func (s *testImportStream) SendAndClose(resp *ImportCompaniesResponse) error {
+	s.resp = resp
+	return nil
+}
+
+func TestImportCompanies(t *testing.T) {
+	storage.HashIterations = 1
+
+	company := func(name string) *Company {
+		return &Company{
+			Id:           uuid.Must(uuid.NewV4()).String(),
+			Name:         name,
+			Employeescnt: 1,
+			Type:         CompanyType_Corporations,
+		}
+	}
+	invalid := company("invalid")
+	invalid.Employeescnt = 0
+
+	rows := []*Company{
+		company("import_1"),
+		company("import_2"),
+		company("import_1"), // duplicate name
+		company("import_3"),
+		invalid,
+		company("import_4"),
+	}
+
+	tests := []struct {
+		Name      string
+		Mode      ImportMode
+		BatchSize int32
+		Imported  int64
+		Codes     map[int64]codes.Code
+	}{
+		{
+			Name:      "batches",
+			BatchSize: 2,
+			Imported:  2,
+			Codes: map[int64]codes.Code{
+				3: codes.AlreadyExists,
+				4: codes.Aborted,
+				5: codes.InvalidArgument,
+				6: codes.Aborted,
+			},
+		},
+		{
+			Name:     "single batch",
+			Imported: 0,
+			Codes: map[int64]codes.Code{
+				1: codes.Aborted,
+				2: codes.Aborted,
+				3: codes.Aborted,
+				4: codes.Aborted,
+				5: codes.InvalidArgument,
+				6: codes.Aborted,
+			},
+		},
+		{
+			Name:     "best effort",
+			Mode:     ImportMode_BEST_EFFORT,
+			Imported: 4,
+			Codes: map[int64]codes.Code{
+				3: codes.AlreadyExists,
+				5: codes.InvalidArgument,
+			},
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			repo := storage.NewMemoryRepository()
+			api := NewCompanyAPI(&TestValidator{returnSubject: "user"}, repo, nil, 0)
+
+			stream := &testImportStream{}
+			for i, c := range rows {
+				req := &ImportCompaniesRequest{Company: c}
+				if i == 0 {
+					req.Mode = tst.Mode
+					req.BatchSize = tst.BatchSize
+				}
+				stream.reqs = append(stream.reqs, req)
+			}
+
+			assert.NoError(api.ImportCompanies(stream))
+			assert.Equal(int64(len(rows)), stream.resp.Total)
+			assert.Equal(tst.Imported, stream.resp.Imported)
+			assert.Equal(int64(len(tst.Codes)), stream.resp.Failed)
+
+			failed := make(map[int64]codes.Code)
+			for _, e := range stream.resp.Errors {
+				failed[e.Row] = codes.Code(e.Code)
+			}
+			assert.Equal(tst.Codes, failed)
+
+			for i, c := range rows {
+				_, err := repo.GetCompany(context.Background(), uuid.FromStringOrNil(c.Id))
+				if _, ok := tst.Codes[int64(i+1)]; ok {
+					assert.Equal(storage.ErrDoesNotExist, err)
+				} else {
+					assert.NoError(err)
+				}
+			}
+		})
+	}
+
+	t.Run("duplicates", func(t *testing.T) {
+		assert := require.New(t)
+
+		api := NewCompanyAPI(&TestValidator{returnSubject: "user"}, storage.NewMemoryRepository(), nil, 0)
+		_, err := api.Create(context.Background(), &CreateCompanyRequest{Company: company("Acme Ltd")})
+		assert.NoError(err)
+
+		for _, mode := range []ImportMode{ImportMode_BATCH, ImportMode_BEST_EFFORT} {
+			stream := &testImportStream{reqs: []*ImportCompaniesRequest{{Mode: mode, Company: company("ACME LTD.")}}}
+			assert.NoError(api.ImportCompanies(stream))
+			assert.Equal(int64(0), stream.resp.Imported)
+			assert.Len(stream.resp.Errors, 1)
+			assert.Equal(int32(codes.FailedPrecondition), stream.resp.Errors[0].Code)
+		}
+
+		stream := &testImportStream{reqs: []*ImportCompaniesRequest{{Force: true, Company: company("ACME LTD.")}}}
+		assert.NoError(api.ImportCompanies(stream))
+		assert.Equal(int64(1), stream.resp.Imported)
+	})
+
+	t.Run("invalid batch size", func(t *testing.T) {
+		api := NewCompanyAPI(&TestValidator{returnSubject: "user"}, storage.NewMemoryRepository(), nil, 0)
+		stream := &testImportStream{reqs: []*ImportCompaniesRequest{{BatchSize: maxImportBatchSize + 1}}}
+		require.Equal(t, codes.InvalidArgument, grpc.Code(api.ImportCompanies(stream)))
+	})
+}
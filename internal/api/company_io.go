@@ -0,0 +1,426 @@
+package api
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/jsonpb"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Company file formats.
+const (
+	FormatCSV = "csv"
+	// FormatExcelCSV is the CSV format opened safely by the spreadsheets:
+	// the file starts with a UTF-8 BOM and the cells which would be taken
+	// as formulas are prefixed with a quote.
+	FormatExcelCSV = "excel"
+	FormatJSONL    = "jsonl"
+)
+
+// utf8BOM starts the files of FormatExcelCSV, it is skipped in the CSV
+// files saved by the spreadsheets.
+const utf8BOM = "\ufeff"
+
+// excelEscapedPrefixes are the first characters of the cells escaped by
+// FormatExcelCSV: those of the formulas and the escaping quote itself.
+const excelEscapedPrefixes = "=+-@\t\r'"
+
+// companyCSVHeader holds the columns of the Company CSV files. The
+// attributes are a JSON object and the labels a comma separated list of
+// key=value pairs.
+var companyCSVHeader = []string{
+	"id", "name", "description", "employeescnt", "registered", "type", "parent_id", "status",
+	"jurisdiction", "registration_number", "vat_id", "lei", "attributes", "labels",
+}
+
+// FormatFromFilename returns the Company file format for the extension of
+// the given file name.
+func FormatFromFilename(name string) (string, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv":
+		return FormatCSV, nil
+	case ".jsonl", ".ndjson":
+		return FormatJSONL, nil
+	default:
+		return "", fmt.Errorf("unknown format of %s, expected .csv or .jsonl", name)
+	}
+}
+
+// CompanyRecord is a Company read from a file.
+type CompanyRecord struct {
+	// Row is the line number of the record in the file.
+	Row     int64
+	Company *Company
+	// Err is set if the record is malformed.
+	Err error
+}
+
+// CompanyReader reads the Companies from a CSV or a JSON Lines file. The CSV
+// file must start with a header naming the columns of companyCSVHeader, in
+// any order, after an optional BOM.
+type CompanyReader struct {
+	format  string
+	csv     *csv.Reader
+	columns map[string]int
+	lines   *bufio.Scanner
+	line    int64
+}
+
+// NewCompanyReader creates a new CompanyReader for the given format.
+func NewCompanyReader(r io.Reader, format string) (*CompanyReader, error) {
+	cr := &CompanyReader{format: format}
+
+	switch format {
+	case FormatCSV, FormatExcelCSV:
+		br := bufio.NewReader(r)
+		if b, err := br.Peek(len(utf8BOM)); err == nil && string(b) == utf8BOM {
+			if _, err := br.Discard(len(utf8BOM)); err != nil {
+				return nil, fmt.Errorf("read csv header error: %w", err)
+			}
+		}
+
+		cr.csv = csv.NewReader(br)
+		cr.csv.FieldsPerRecord = -1
+		cr.csv.TrimLeadingSpace = true
+
+		header, err := cr.csv.Read()
+		if err == io.EOF {
+			return nil, fmt.Errorf("the csv header is missing")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read csv header error: %w", err)
+		}
+
+		cr.columns = make(map[string]int, len(header))
+		for i, name := range header {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if !isCompanyCSVColumn(name) {
+				return nil, fmt.Errorf("unknown csv column: %s", name)
+			}
+			cr.columns[name] = i
+		}
+	case FormatJSONL:
+		cr.lines = bufio.NewScanner(r)
+		// allow the max. description size with the JSON escaping
+		cr.lines.Buffer(make([]byte, 64*1024), 1024*1024)
+	default:
+		return nil, fmt.Errorf("unknown format: %s", format)
+	}
+
+	return cr, nil
+}
+
+// Read returns the next Company. The error of a malformed record is set in
+// the record, so that the caller can report it and go on. Read returns
+// io.EOF at the end of the file.
+func (r *CompanyReader) Read() (CompanyRecord, error) {
+	if r.format == FormatJSONL {
+		return r.readJSONL()
+	}
+	return r.readCSV()
+}
+
+func (r *CompanyReader) readCSV() (CompanyRecord, error) {
+	fields, err := r.csv.Read()
+	if err == io.EOF {
+		return CompanyRecord{}, io.EOF
+	}
+	line, _ := r.csv.FieldPos(0)
+	rec := CompanyRecord{Row: int64(line)}
+	if err != nil {
+		if _, ok := err.(*csv.ParseError); ok {
+			rec.Err = err
+			return rec, nil
+		}
+		return rec, err
+	}
+
+	get := func(column string) string {
+		i, ok := r.columns[column]
+		if !ok || i >= len(fields) {
+			return ""
+		}
+		v := strings.TrimSpace(fields[i])
+		if r.format == FormatExcelCSV && v != "" && v[0] == '\'' {
+			v = v[1:]
+		}
+		return v
+	}
+
+	c := &Company{
+		Id:                 get("id"),
+		Name:               get("name"),
+		Description:        get("description"),
+		ParentId:           get("parent_id"),
+		Jurisdiction:       get("jurisdiction"),
+		RegistrationNumber: get("registration_number"),
+		VatId:              get("vat_id"),
+		Lei:                get("lei"),
+	}
+
+	if v := get("employeescnt"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			rec.Err = fmt.Errorf("invalid employeescnt: %s", v)
+			return rec, nil
+		}
+		c.Employeescnt = int32(n)
+	}
+
+	if v := get("registered"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			rec.Err = fmt.Errorf("invalid registered: %s", v)
+			return rec, nil
+		}
+		c.Registered = b
+	}
+
+	if v := get("type"); v != "" {
+		t, err := parseCompanyType(v)
+		if err != nil {
+			rec.Err = err
+			return rec, nil
+		}
+		c.Type = t
+	}
+
+	if v := get("status"); v != "" {
+		st, err := parseCompanyStatus(v)
+		if err != nil {
+			rec.Err = err
+			return rec, nil
+		}
+		c.Status = st
+	}
+
+	if v := get("attributes"); v != "" {
+		var attributes structpb.Struct
+		if err := protojson.Unmarshal([]byte(v), &attributes); err != nil {
+			rec.Err = fmt.Errorf("invalid attributes: %s", v)
+			return rec, nil
+		}
+		c.Attributes = &attributes
+	}
+
+	if v := get("labels"); v != "" {
+		labels, err := parseCSVLabels(v)
+		if err != nil {
+			rec.Err = err
+			return rec, nil
+		}
+		c.Labels = labels
+	}
+
+	rec.Company = c
+	return rec, nil
+}
+
+func (r *CompanyReader) readJSONL() (CompanyRecord, error) {
+	for r.lines.Scan() {
+		r.line++
+		line := strings.TrimSpace(r.lines.Text())
+		if line == "" {
+			continue
+		}
+
+		rec := CompanyRecord{Row: r.line}
+		var c Company
+		if err := jsonpb.UnmarshalString(line, &c); err != nil {
+			rec.Err = fmt.Errorf("invalid json: %s", err)
+			return rec, nil
+		}
+		rec.Company = &c
+		return rec, nil
+	}
+	if err := r.lines.Err(); err != nil {
+		return CompanyRecord{}, err
+	}
+	return CompanyRecord{}, io.EOF
+}
+
+// parseCompanyType parses the CompanyType by its name or number.
+func parseCompanyType(v string) (CompanyType, error) {
+	if n, ok := CompanyType_value[v]; ok {
+		return CompanyType(n), nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid type: %s", v)
+	}
+	if _, ok := CompanyType_name[int32(n)]; !ok {
+		return 0, fmt.Errorf("invalid type: %s", v)
+	}
+	return CompanyType(n), nil
+}
+
+// parseCompanyStatus parses the CompanyStatus by its name or number.
+func parseCompanyStatus(v string) (CompanyStatus, error) {
+	if n, ok := CompanyStatus_value[v]; ok {
+		return CompanyStatus(n), nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid status: %s", v)
+	}
+	if _, ok := CompanyStatus_name[int32(n)]; !ok {
+		return 0, fmt.Errorf("invalid status: %s", v)
+	}
+	return CompanyStatus(n), nil
+}
+
+// parseCSVLabels parses the labels of a CSV column, key=value pairs
+// separated by commas.
+func parseCSVLabels(v string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(v, ",") {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid labels: %s", v)
+		}
+		labels[kv[0]] = kv[1]
+	}
+	return labels, nil
+}
+
+// formatCSVLabels formats the labels for a CSV column, sorted by key.
+func formatCSVLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+labels[k])
+	}
+	return strings.Join(pairs, ",")
+}
+
+func isCompanyCSVColumn(name string) bool {
+	for _, c := range companyCSVHeader {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// CompanyWriter writes the Companies to a CSV, an Excel CSV or a JSON Lines
+// file, in the formats read by CompanyReader. The output is buffered, Flush must be
+// called at the end.
+type CompanyWriter struct {
+	format string
+	w      *bufio.Writer
+	csv    *csv.Writer
+	json   jsonpb.Marshaler
+	header bool
+}
+
+// NewCompanyWriter creates a new CompanyWriter for the given format.
+func NewCompanyWriter(w io.Writer, format string) (*CompanyWriter, error) {
+	cw := &CompanyWriter{
+		format: format,
+		w:      bufio.NewWriter(w),
+		json:   jsonpb.Marshaler{EmitDefaults: true},
+	}
+
+	switch format {
+	case FormatCSV, FormatExcelCSV:
+		cw.csv = csv.NewWriter(cw.w)
+	case FormatJSONL:
+	default:
+		return nil, fmt.Errorf("unknown format: %s", format)
+	}
+	return cw, nil
+}
+
+// Write writes the given Company.
+func (w *CompanyWriter) Write(c *Company) error {
+	if w.format == FormatJSONL {
+		if err := w.json.Marshal(w.w, c); err != nil {
+			return err
+		}
+		return w.w.WriteByte('\n')
+	}
+
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+
+	var attributes string
+	if len(c.Attributes.GetFields()) != 0 {
+		b, err := json.Marshal(c.Attributes.AsMap())
+		if err != nil {
+			return fmt.Errorf("marshal attributes error: %w", err)
+		}
+		attributes = string(b)
+	}
+
+	record := []string{
+		c.Id,
+		c.Name,
+		c.Description,
+		strconv.FormatInt(int64(c.Employeescnt), 10),
+		strconv.FormatBool(c.Registered),
+		c.Type.String(),
+		c.ParentId,
+		c.Status.String(),
+		c.Jurisdiction,
+		c.RegistrationNumber,
+		c.VatId,
+		c.Lei,
+		attributes,
+		formatCSVLabels(c.Labels),
+	}
+	if w.format == FormatExcelCSV {
+		for i, v := range record {
+			if v != "" && strings.IndexByte(excelEscapedPrefixes, v[0]) >= 0 {
+				record[i] = "'" + v
+			}
+		}
+	}
+	return w.csv.Write(record)
+}
+
+// writeHeader writes the CSV header, once, after the BOM of the Excel CSV.
+func (w *CompanyWriter) writeHeader() error {
+	if w.header {
+		return nil
+	}
+	if w.format == FormatExcelCSV {
+		if _, err := w.w.WriteString(utf8BOM); err != nil {
+			return err
+		}
+	}
+	if err := w.csv.Write(companyCSVHeader); err != nil {
+		return err
+	}
+	w.header = true
+	return nil
+}
+
+// Flush writes the buffered data to the underlying writer.
+func (w *CompanyWriter) Flush() error {
+	if w.format != FormatJSONL {
+		// an empty export still has the header
+		if err := w.writeHeader(); err != nil {
+			return err
+		}
+		w.csv.Flush()
+		if err := w.csv.Error(); err != nil {
+			return err
+		}
+	}
+	return w.w.Flush()
+}
@@ -0,0 +1,243 @@
+package api
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func readCompanyRecords(t *testing.T, r *CompanyReader) []CompanyRecord {
+	var out []CompanyRecord
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return out
+		}
+		require.NoError(t, err)
+		out = append(out, rec)
+	}
+}
+
+func TestCompanyReader(t *testing.T) {
+	t.Run("CSV", func(t *testing.T) {
+		assert := require.New(t)
+
+		r, err := NewCompanyReader(strings.NewReader(`id,name,employeescnt,type,registered,description
+6235fee7-d12b-4a1b-b35d-c87838b8a4a1,acme,10,NonProfit,true,"multi
+line"
+6235fee7-d12b-4a1b-b35d-c87838b8a4a2,beta,5,3,,
+6235fee7-d12b-4a1b-b35d-c87838b8a4a3,gamma,x,1,,
+6235fee7-d12b-4a1b-b35d-c87838b8a4a4,delta,1,Unknown,,
+`), FormatCSV)
+		assert.NoError(err)
+
+		recs := readCompanyRecords(t, r)
+		assert.Len(recs, 4)
+
+		assert.NoError(recs[0].Err)
+		assert.Equal(int64(2), recs[0].Row)
+		assert.Equal(&Company{
+			Id:           "6235fee7-d12b-4a1b-b35d-c87838b8a4a1",
+			Name:         "acme",
+			Description:  "multi\nline",
+			Employeescnt: 10,
+			Registered:   true,
+			Type:         CompanyType_NonProfit,
+		}, recs[0].Company)
+
+		assert.NoError(recs[1].Err)
+		assert.Equal(int64(4), recs[1].Row)
+		assert.Equal(CompanyType_Cooperative, recs[1].Company.Type)
+
+		assert.EqualError(recs[2].Err, "invalid employeescnt: x")
+		assert.Equal(int64(5), recs[2].Row)
+		assert.EqualError(recs[3].Err, "invalid type: Unknown")
+
+		_, err = NewCompanyReader(strings.NewReader("id,name,size\n"), FormatCSV)
+		assert.EqualError(err, "unknown csv column: size")
+	})
+
+	t.Run("CSV all columns", func(t *testing.T) {
+		assert := require.New(t)
+
+		r, err := NewCompanyReader(strings.NewReader(`name,type,parent_id,status,jurisdiction,registration_number,vat_id,lei,attributes,labels
+acme,Corporations,6235fee7-d12b-4a1b-b35d-c87838b8a4a1,Active,CY,HE123456,CY10259033P,5493001KJTIIGC8Y1R12,"{""tier"": ""gold"", ""seats"": 10}","env=prod, tier="
+beta,1,,8,,,,,,
+gamma,1,,Dissolved,,,,,"{""tier"":",
+delta,1,,,,,,,,tier
+`), FormatCSV)
+		assert.NoError(err)
+
+		recs := readCompanyRecords(t, r)
+		assert.Len(recs, 4)
+
+		assert.NoError(recs[0].Err)
+		attributes, err := structpb.NewStruct(map[string]interface{}{"tier": "gold", "seats": 10})
+		assert.NoError(err)
+		assert.True(proto.Equal(&Company{
+			Name:               "acme",
+			Type:               CompanyType_Corporations,
+			ParentId:           "6235fee7-d12b-4a1b-b35d-c87838b8a4a1",
+			Status:             CompanyStatus_Active,
+			Jurisdiction:       "CY",
+			RegistrationNumber: "HE123456",
+			VatId:              "CY10259033P",
+			Lei:                "5493001KJTIIGC8Y1R12",
+			Attributes:         attributes,
+			Labels:             map[string]string{"env": "prod", "tier": ""},
+		}, recs[0].Company), "%v", recs[0].Company)
+
+		assert.EqualError(recs[1].Err, "invalid status: 8")
+		assert.EqualError(recs[2].Err, `invalid attributes: {"tier":`)
+		assert.EqualError(recs[3].Err, "invalid labels: tier")
+	})
+
+	t.Run("JSONL", func(t *testing.T) {
+		assert := require.New(t)
+
+		r, err := NewCompanyReader(strings.NewReader(`{"id": "6235fee7-d12b-4a1b-b35d-c87838b8a4a1", "name": "acme", "employeescnt": 10, "type": "NonProfit"}
+
+{"name": "beta", "type": 4, "registered": true}
+{"name": "gamma",
+`), FormatJSONL)
+		assert.NoError(err)
+
+		recs := readCompanyRecords(t, r)
+		assert.Len(recs, 3)
+
+		assert.NoError(recs[0].Err)
+		assert.Equal(int64(1), recs[0].Row)
+		assert.Equal("acme", recs[0].Company.Name)
+		assert.Equal(CompanyType_NonProfit, recs[0].Company.Type)
+
+		assert.NoError(recs[1].Err)
+		assert.Equal(int64(3), recs[1].Row)
+		assert.Equal(CompanyType_SoleProprietorship, recs[1].Company.Type)
+		assert.True(recs[1].Company.Registered)
+
+		assert.Error(recs[2].Err)
+		assert.Equal(int64(4), recs[2].Row)
+	})
+
+	t.Run("Format", func(t *testing.T) {
+		assert := require.New(t)
+
+		f, err := FormatFromFilename("companies.CSV")
+		assert.NoError(err)
+		assert.Equal(FormatCSV, f)
+
+		f, err = FormatFromFilename("/tmp/companies.jsonl")
+		assert.NoError(err)
+		assert.Equal(FormatJSONL, f)
+
+		_, err = FormatFromFilename("companies.xlsx")
+		assert.Error(err)
+	})
+}
+
+func TestCompanyWriter(t *testing.T) {
+	companies := []*Company{
+		{
+			Id:           "6235fee7-d12b-4a1b-b35d-c87838b8a4a1",
+			Name:         "acme",
+			Description:  "multi\nline, \"quoted\"",
+			Employeescnt: 10,
+			Registered:   true,
+			Type:         CompanyType_NonProfit,
+		},
+		{
+			Id:           "6235fee7-d12b-4a1b-b35d-c87838b8a4a2",
+			Name:         "beta",
+			Employeescnt: 5,
+			Type:         CompanyType_Cooperative,
+		},
+		{
+			Id:                 "6235fee7-d12b-4a1b-b35d-c87838b8a4a3",
+			Name:               "gamma",
+			Employeescnt:       1,
+			Type:               CompanyType_Corporations,
+			ParentId:           "6235fee7-d12b-4a1b-b35d-c87838b8a4a1",
+			Status:             CompanyStatus_Suspended,
+			Jurisdiction:       "CY",
+			RegistrationNumber: "HE123456",
+			VatId:              "CY10259033P",
+			Lei:                "5493001KJTIIGC8Y1R12",
+			Attributes: &structpb.Struct{Fields: map[string]*structpb.Value{
+				"tier":    structpb.NewStringValue("gold, \"first\""),
+				"seats":   structpb.NewNumberValue(10),
+				"founded": structpb.NewStringValue("2001-02-03"),
+			}},
+			Labels: map[string]string{"env": "prod", "region": "eu-west-1", "vip": ""},
+		},
+		{
+			Id:           "6235fee7-d12b-4a1b-b35d-c87838b8a4a4",
+			Name:         "=HYPERLINK(\"http://evil\")",
+			Description:  "'quoted",
+			Employeescnt: 1,
+			Type:         CompanyType_Corporations,
+			Lei:          "@SUM(A1)",
+			Labels:       map[string]string{"-a": "+b"},
+		},
+	}
+
+	for _, format := range []string{FormatCSV, FormatExcelCSV, FormatJSONL} {
+		t.Run(format, func(t *testing.T) {
+			assert := require.New(t)
+
+			var b strings.Builder
+			w, err := NewCompanyWriter(&b, format)
+			assert.NoError(err)
+			for _, c := range companies {
+				assert.NoError(w.Write(c))
+			}
+			assert.NoError(w.Flush())
+
+			// the output is read back by the import
+			r, err := NewCompanyReader(strings.NewReader(b.String()), format)
+			assert.NoError(err)
+			recs := readCompanyRecords(t, r)
+			assert.Len(recs, len(companies))
+			for i, rec := range recs {
+				assert.NoError(rec.Err)
+				// the JSON Lines have the empty labels as {}
+				assert.True(proto.Equal(companies[i], rec.Company), "%v != %v", companies[i], rec.Company)
+			}
+		})
+	}
+
+	t.Run("Excel", func(t *testing.T) {
+		assert := require.New(t)
+
+		var b strings.Builder
+		w, err := NewCompanyWriter(&b, FormatExcelCSV)
+		assert.NoError(err)
+		assert.NoError(w.Write(companies[3]))
+		assert.NoError(w.Flush())
+
+		lines := strings.Split(b.String(), "\n")
+		assert.Equal("\ufeffid,name,", lines[0][:11])
+		assert.Equal(`6235fee7-d12b-4a1b-b35d-c87838b8a4a4,"'=HYPERLINK(""http://evil"")",''quoted,1,false,Corporations,,UnknownStatus,,,,'@SUM(A1),,'-a=+b`, lines[1])
+
+		// the plain CSV keeps the cells, it skips the BOM
+		r, err := NewCompanyReader(strings.NewReader(b.String()), FormatCSV)
+		assert.NoError(err)
+		recs := readCompanyRecords(t, r)
+		assert.Len(recs, 1)
+		assert.Equal("'=HYPERLINK(\"http://evil\")", recs[0].Company.Name)
+	})
+
+	t.Run("empty CSV", func(t *testing.T) {
+		assert := require.New(t)
+
+		var b strings.Builder
+		w, err := NewCompanyWriter(&b, FormatCSV)
+		assert.NoError(err)
+		assert.NoError(w.Flush())
+		assert.Equal("id,name,description,employeescnt,registered,type,parent_id,status,"+
+			"jurisdiction,registration_number,vat_id,lei,attributes,labels\n", b.String())
+	})
+}
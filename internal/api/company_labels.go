@@ -0,0 +1,388 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/fancar/tmp_xm/internal/api/auth"
+	"github.com/fancar/tmp_xm/internal/api/helpers"
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+const (
+	maxCompanyLabels         = 64
+	labelSelectorMaxLength   = 1000
+	labelKeyValueDescription = "must be at most 63 letters, digits, '-', '_', '.' and '/', starting and ending with a letter or a digit"
+)
+
+var (
+	// labelKeyPattern matches the keys of the labels, they are used as
+	// JSON paths in double quotes.
+	labelKeyPattern = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_./]{0,61}[A-Za-z0-9])?$`)
+
+	// labelValuePattern matches the values of the labels, they may be
+	// empty.
+	labelValuePattern = regexp.MustCompile(`^([A-Za-z0-9]([-A-Za-z0-9_./]{0,61}[A-Za-z0-9])?)?$`)
+)
+
+// labelsChangedEvent is the payload of the labels_changed event: the added
+// or changed labels and the keys of the removed ones.
+type labelsChangedEvent struct {
+	Added   map[string]string
+	Removed []string
+	Company *companyEvent
+}
+
+// AddLabels adds the labels to the companies in a transaction.
+func (a *CompanyAPI) AddLabels(ctx context.Context, req *AddLabelsRequest) (*LabelsResponse, error) {
+	log.Debug("api/AddLabels request:", req)
+
+	if err := a.validator.Validate(ctx, auth.ValidateActiveUser()); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	return a.changeLabels(ctx, req.CompanyIds, func(tx storage.Repository, c storage.Company) (storage.CompanyLabels, error) {
+		labels, err := tx.AddCompanyLabels(ctx, c.ID, req.Labels)
+		if err != nil {
+			return nil, err
+		}
+		if len(labels) > maxCompanyLabels {
+			return nil, grpc.Errorf(codes.FailedPrecondition, "the company %s would have more than %d labels", c.ID, maxCompanyLabels)
+		}
+		return labels, nil
+	})
+}
+
+// RemoveLabels removes the labels of the given keys from the companies in a
+// transaction.
+func (a *CompanyAPI) RemoveLabels(ctx context.Context, req *RemoveLabelsRequest) (*LabelsResponse, error) {
+	log.Debug("api/RemoveLabels request:", req)
+
+	if err := a.validator.Validate(ctx, auth.ValidateActiveUser()); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	return a.changeLabels(ctx, req.CompanyIds, func(tx storage.Repository, c storage.Company) (storage.CompanyLabels, error) {
+		return tx.RemoveCompanyLabels(ctx, c.ID, req.Keys)
+	})
+}
+
+// changeLabels changes the labels of the given companies with fn in a
+// transaction, then publishes the labels_changed event of the companies
+// which labels changed.
+func (a *CompanyAPI) changeLabels(ctx context.Context, ids []string, fn func(storage.Repository, storage.Company) (storage.CompanyLabels, error)) (*LabelsResponse, error) {
+	user, err := a.validator.GetUser(ctx)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	resp := &LabelsResponse{Companies: make([]*CompanyLabels, 0, len(ids))}
+	var events []labelsChangedEvent
+	var items []storage.Company
+
+	err = a.repo.Transaction(ctx, func(tx storage.Repository) error {
+		for _, s := range ids {
+			c, err := tx.GetCompany(ctx, uuid.FromStringOrNil(s))
+			if err != nil {
+				return err
+			}
+			labels, err := fn(tx, c)
+			if err != nil {
+				return err
+			}
+			resp.Companies = append(resp.Companies, &CompanyLabels{CompanyId: s, Labels: labels})
+
+			ev := diffLabels(c.Labels, labels)
+			if len(ev.Added) == 0 && len(ev.Removed) == 0 {
+				continue
+			}
+			changed := c
+			changed.Labels = labels
+			if err := recordFieldChanges(ctx, tx, user.Username, c, changed); err != nil {
+				return err
+			}
+			c = changed
+			events = append(events, ev)
+			items = append(items, c)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	for i := range items {
+		events[i].Company = a.companyEvent(ctx, &items[i], "labels_changed")
+		sendLabelsChangedEvent(ctx, items[i].ID.String(), events[i])
+	}
+	return resp, nil
+}
+
+// diffLabels returns the labels added or changed from old to new and the
+// keys of the removed ones, sorted.
+func diffLabels(old, new storage.CompanyLabels) labelsChangedEvent {
+	ev := labelsChangedEvent{Added: map[string]string{}, Removed: []string{}}
+	for k, v := range new {
+		if ov, ok := old[k]; !ok || ov != v {
+			ev.Added[k] = v
+		}
+	}
+	for k := range old {
+		if _, ok := new[k]; !ok {
+			ev.Removed = append(ev.Removed, k)
+		}
+	}
+	sort.Strings(ev.Removed)
+	return ev
+}
+
+// sendLabelsChangedEvent publishes the labels_changed event of the given
+// company.
+func sendLabelsChangedEvent(ctx context.Context, id string, ev labelsChangedEvent) {
+	b, err := json.Marshal(ev)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"company_id": id,
+			"event":      "labels_changed",
+		}).Error("unable to marshal data")
+		return
+	}
+	publishEvent(ctx, id, "labels_changed", b)
+}
+
+// CountCompaniesByLabel returns the number of companies per label.
+func (a *CompanyAPI) CountCompaniesByLabel(ctx context.Context, req *CountCompaniesByLabelRequest) (*CountCompaniesByLabelResponse, error) {
+	log.Debug("api/CountCompaniesByLabel request:", req)
+
+	if err := a.validator.Validate(ctx, auth.ValidateActiveUser()); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	// the selector is validated by the rules
+	selector, _ := parseLabelSelector(req.LabelSelector)
+	filters := storage.CompanyFilters{
+		Type:   uint32(req.Type),
+		Labels: selector,
+	}
+	counts, err := a.repo.CountCompanyLabels(ctx, filters, req.Key)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	resp := &CountCompaniesByLabelResponse{Counts: make([]*LabelCount, 0, len(counts))}
+	for _, c := range counts {
+		resp.Counts = append(resp.Counts, &LabelCount{Key: c.Key, Value: c.Value, Count: c.Count})
+	}
+	return resp, nil
+}
+
+// parseLabelSelector parses a selector like "env=prod,tier in (gold,silver)",
+// see CountCompaniesByLabelRequest for the syntax. The empty selector
+// matches all the companies.
+func parseLabelSelector(s string) (storage.LabelSelector, error) {
+	var selector storage.LabelSelector
+	rest := strings.TrimSpace(s)
+	for rest != "" {
+		r, tail, err := parseLabelRequirement(rest)
+		if err != nil {
+			return nil, err
+		}
+		selector = append(selector, r)
+
+		rest = strings.TrimSpace(tail)
+		if rest == "" {
+			break
+		}
+		if rest[0] != ',' {
+			return nil, fmt.Errorf("expected a comma before %q", rest)
+		}
+		rest = strings.TrimSpace(rest[1:])
+		if rest == "" {
+			return nil, fmt.Errorf("expected a requirement after the last comma")
+		}
+	}
+	return selector, nil
+}
+
+// parseLabelRequirement parses the requirement at the beginning of s, it
+// returns the rest of s.
+func parseLabelRequirement(s string) (storage.LabelRequirement, string, error) {
+	var r storage.LabelRequirement
+	if strings.HasPrefix(s, "!") {
+		r.Key, s = cutLabelToken(strings.TrimSpace(s[1:]))
+		r.Operator = storage.LabelNotExists
+		return r, s, checkLabelKey(r.Key)
+	}
+
+	r.Key, s = cutLabelToken(s)
+	if err := checkLabelKey(r.Key); err != nil {
+		return r, s, err
+	}
+	s = strings.TrimSpace(s)
+
+	var value string
+	switch {
+	case s == "" || s[0] == ',':
+		r.Operator = storage.LabelExists
+		return r, s, nil
+	case strings.HasPrefix(s, "=="):
+		r.Operator = storage.LabelEquals
+		value, s = cutLabelToken(strings.TrimSpace(s[2:]))
+	case strings.HasPrefix(s, "="):
+		r.Operator = storage.LabelEquals
+		value, s = cutLabelToken(strings.TrimSpace(s[1:]))
+	case strings.HasPrefix(s, "!="):
+		r.Operator = storage.LabelNotEquals
+		value, s = cutLabelToken(strings.TrimSpace(s[2:]))
+	case strings.HasPrefix(s, storage.LabelNotIn):
+		r.Operator = storage.LabelNotIn
+		values, tail, err := parseLabelValues(s[len(storage.LabelNotIn):])
+		r.Values = values
+		return r, tail, err
+	case strings.HasPrefix(s, storage.LabelIn):
+		r.Operator = storage.LabelIn
+		values, tail, err := parseLabelValues(s[len(storage.LabelIn):])
+		r.Values = values
+		return r, tail, err
+	default:
+		return r, s, fmt.Errorf("expected an operator after %s", r.Key)
+	}
+
+	r.Values = []string{value}
+	return r, s, checkLabelValue(value)
+}
+
+// parseLabelValues parses the "(v1,v2)" list of values at the beginning of
+// s, it returns the rest of s.
+func parseLabelValues(s string) ([]string, string, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "(") {
+		return nil, s, fmt.Errorf("expected a ( before %q", s)
+	}
+	end := strings.Index(s, ")")
+	if end < 0 {
+		return nil, s, fmt.Errorf("expected a ) after %q", s)
+	}
+
+	var values []string
+	for _, v := range strings.Split(s[1:end], ",") {
+		v = strings.TrimSpace(v)
+		if err := checkLabelValue(v); err != nil {
+			return nil, s, err
+		}
+		values = append(values, v)
+	}
+	return values, s[end+1:], nil
+}
+
+// cutLabelToken returns the key or value at the beginning of s and the
+// rest of s.
+func cutLabelToken(s string) (string, string) {
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./", r))
+	})
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], s[i:]
+}
+
+func checkLabelKey(key string) error {
+	if !labelKeyPattern.MatchString(key) {
+		return fmt.Errorf("the key %q %s", key, labelKeyValueDescription)
+	}
+	return nil
+}
+
+func checkLabelValue(value string) error {
+	if !labelValuePattern.MatchString(value) {
+		return fmt.Errorf("the value %q %s", value, labelKeyValueDescription)
+	}
+	return nil
+}
+
+// labelsFromStorage returns the labels of the API, nil if there are none.
+func labelsFromStorage(labels storage.CompanyLabels) map[string]string {
+	if len(labels) == 0 {
+		return nil
+	}
+	return labels
+}
+
+// labelMap checks the number of labels of a map and their keys and
+// values.
+func labelMap() check {
+	return func(_ protoreflect.FieldDescriptor, v protoreflect.Value) string {
+		m := v.Map()
+		if m.Len() > maxCompanyLabels {
+			return fmt.Sprintf("must have at most %d labels", maxCompanyLabels)
+		}
+
+		// the first violation is reported, in the order of the keys
+		labels := make(map[string]string, m.Len())
+		var keys []string
+		m.Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+			labels[k.String()] = v.String()
+			keys = append(keys, k.String())
+			return true
+		})
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := checkLabelKey(k); err != nil {
+				return err.Error()
+			}
+			if err := checkLabelValue(labels[k]); err != nil {
+				return err.Error()
+			}
+		}
+		return ""
+	}
+}
+
+// labelKey checks the key of a label, or the items of a list of keys.
+func labelKey() check {
+	return func(fd protoreflect.FieldDescriptor, v protoreflect.Value) string {
+		if !fd.IsList() {
+			if err := checkLabelKey(v.String()); err != nil {
+				return err.Error()
+			}
+			return ""
+		}
+		list := v.List()
+		for i := 0; i < list.Len(); i++ {
+			if err := checkLabelKey(list.Get(i).String()); err != nil {
+				return fmt.Sprintf("item %d: %s", i, err)
+			}
+		}
+		return ""
+	}
+}
+
+// labelSelectorSyntax checks the syntax of a label selector.
+func labelSelectorSyntax() check {
+	return func(_ protoreflect.FieldDescriptor, v protoreflect.Value) string {
+		if _, err := parseLabelSelector(v.String()); err != nil {
+			return "must be a label selector: " + err.Error()
+		}
+		return ""
+	}
+}
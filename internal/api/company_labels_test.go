@@ -0,0 +1,159 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+func TestCompanyLabels(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+
+	api := NewCompanyAPI(&TestValidator{returnSubject: "user"}, storage.NewMemoryRepository(), nil, 0)
+
+	newCompany := func(name string, labels map[string]string) *Company {
+		c := &Company{
+			Id:           uuid.Must(uuid.NewV4()).String(),
+			Name:         name,
+			Employeescnt: 1,
+			Type:         CompanyType_Corporations,
+			Labels:       labels,
+		}
+		_, err := api.Create(ctx, &CreateCompanyRequest{Company: c})
+		assert.NoError(err)
+		return c
+	}
+	gold := newCompany("Gold", map[string]string{"env": "prod", "tier": "gold"})
+	silver := newCompany("Silver", map[string]string{"env": "prod", "tier": "silver"})
+	test := newCompany("Test", map[string]string{"env": "test"})
+
+	t.Run("Selector", func(t *testing.T) {
+		assert := require.New(t)
+
+		selector, err := parseLabelSelector(" env = prod, tier in (gold, silver),tier notin (bronze),team,!owner,x!=y,a==b")
+		assert.NoError(err)
+		assert.Equal(storage.LabelSelector{
+			{Key: "env", Operator: storage.LabelEquals, Values: []string{"prod"}},
+			{Key: "tier", Operator: storage.LabelIn, Values: []string{"gold", "silver"}},
+			{Key: "tier", Operator: storage.LabelNotIn, Values: []string{"bronze"}},
+			{Key: "team", Operator: storage.LabelExists},
+			{Key: "owner", Operator: storage.LabelNotExists},
+			{Key: "x", Operator: storage.LabelNotEquals, Values: []string{"y"}},
+			{Key: "a", Operator: storage.LabelEquals, Values: []string{"b"}},
+		}, selector)
+
+		selector, err = parseLabelSelector("")
+		assert.NoError(err)
+		assert.Empty(selector)
+
+		for _, s := range []string{"env=prod,", "env prod", "tier in gold", "tier in (gold", "-env", "env=a b", "env=p\"", "env>1"} {
+			_, err := parseLabelSelector(s)
+			assert.Error(err, s)
+		}
+	})
+
+	t.Run("Filters", func(t *testing.T) {
+		assert := require.New(t)
+
+		export := func(selector string) []string {
+			var names []string
+			assert.NoError(api.exportCompanies(ctx, &ExportCompaniesRequest{LabelSelector: selector}, func(c *Company) error {
+				names = append(names, c.Name)
+				return nil
+			}))
+			return names
+		}
+		assert.Equal([]string{"Gold", "Silver"}, export("env=prod"))
+		assert.Equal([]string{"Silver", "Test"}, export("tier!=gold"))
+		assert.Equal([]string{"Gold"}, export("env=prod,tier notin (silver)"))
+		assert.Equal([]string{"Test"}, export("!tier"))
+
+		err := api.exportCompanies(ctx, &ExportCompaniesRequest{LabelSelector: "env in prod"}, nil)
+		assert.Equal([]string{"label_selector"}, violatedFields(t, err))
+
+		resp, err := api.SearchCompanies(ctx, &SearchCompaniesRequest{Query: "l", LabelSelector: "tier in (silver,bronze)"})
+		assert.NoError(err)
+		assert.Len(resp.Results, 1)
+		assert.Equal("Silver", resp.Results[0].Company.Name)
+	})
+
+	t.Run("AddRemove", func(t *testing.T) {
+		assert := require.New(t)
+
+		resp, err := api.AddLabels(ctx, &AddLabelsRequest{
+			CompanyIds: []string{gold.Id, test.Id},
+			Labels:     map[string]string{"team": "core", "env": "staging"},
+		})
+		assert.NoError(err)
+		assert.Len(resp.Companies, 2)
+		assert.Equal(gold.Id, resp.Companies[0].CompanyId)
+		assert.Equal(map[string]string{"env": "staging", "tier": "gold", "team": "core"}, resp.Companies[0].Labels)
+
+		c, err := api.Get(ctx, &GetCompanyRequest{Id: test.Id})
+		assert.NoError(err)
+		assert.Equal(map[string]string{"env": "staging", "team": "core"}, c.Company.Labels)
+
+		// the updates keep the labels
+		test.Labels = nil
+		test.Description = "updated"
+		_, err = api.Update(ctx, &UpdateCompanyRequest{Company: test})
+		assert.NoError(err)
+
+		resp, err = api.RemoveLabels(ctx, &RemoveLabelsRequest{
+			CompanyIds: []string{test.Id},
+			Keys:       []string{"team", "missing"},
+		})
+		assert.NoError(err)
+		assert.Equal(map[string]string{"env": "staging"}, resp.Companies[0].Labels)
+
+		// all the companies are changed or none
+		_, err = api.AddLabels(ctx, &AddLabelsRequest{
+			CompanyIds: []string{silver.Id, uuid.Must(uuid.NewV4()).String()},
+			Labels:     map[string]string{"team": "core"},
+		})
+		assert.Equal(codes.NotFound, status.Code(err))
+		c, err = api.Get(ctx, &GetCompanyRequest{Id: silver.Id})
+		assert.NoError(err)
+		assert.NotContains(c.Company.Labels, "team")
+
+		_, err = api.AddLabels(ctx, &AddLabelsRequest{
+			CompanyIds: []string{silver.Id, silver.Id, "bad"},
+			Labels:     map[string]string{"-bad": "x"},
+		})
+		assert.Equal([]string{"company_ids", "labels"}, violatedFields(t, err))
+
+		_, err = api.Create(ctx, &CreateCompanyRequest{Company: &Company{
+			Id:           uuid.Must(uuid.NewV4()).String(),
+			Name:         "Bad",
+			Employeescnt: 1,
+			Type:         CompanyType_Corporations,
+			Labels:       map[string]string{"env": "a b"},
+		}})
+		assert.Equal([]string{"Company.labels"}, violatedFields(t, err))
+	})
+
+	t.Run("Count", func(t *testing.T) {
+		assert := require.New(t)
+
+		resp, err := api.CountCompaniesByLabel(ctx, &CountCompaniesByLabelRequest{Key: "env"})
+		assert.NoError(err)
+		assert.Equal([]*LabelCount{
+			{Key: "env", Value: "staging", Count: 2},
+			{Key: "env", Value: "prod", Count: 1},
+		}, resp.Counts)
+
+		resp, err = api.CountCompaniesByLabel(ctx, &CountCompaniesByLabelRequest{LabelSelector: "tier"})
+		assert.NoError(err)
+		assert.Len(resp.Counts, 5)
+
+		_, err = api.CountCompaniesByLabel(ctx, &CountCompaniesByLabelRequest{Key: "bad key"})
+		assert.Equal([]string{"key"}, violatedFields(t, err))
+	})
+}
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gofrs/uuid"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/fancar/tmp_xm/internal/api/auth"
+	"github.com/fancar/tmp_xm/internal/api/helpers"
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+// mergedEvent is the payload of the merged event.
+type mergedEvent struct {
+	SourceID uuid.UUID
+	TargetID uuid.UUID
+	Company  *companyEvent
+}
+
+// MergeCompanies merges the source company into the target one.
+func (a *CompanyAPI) MergeCompanies(ctx context.Context, req *MergeCompaniesRequest) (*MergeCompaniesResponse, error) {
+	log.Debug("api/MergeCompanies request:", req)
+
+	if err := a.validator.Validate(ctx, auth.ValidateActiveUser()); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+	user, err := a.validator.GetUser(ctx)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+	sourceID := uuid.FromStringOrNil(req.SourceId)
+	targetID := uuid.FromStringOrNil(req.TargetId)
+
+	// the source is deleted, like a delete the merge may need an approval
+	if approval.delete {
+		var cr *storage.ChangeRequest
+		var target storage.Company
+		err = a.repo.Transaction(ctx, func(tx storage.Repository) error {
+			source, err := tx.GetCompany(ctx, sourceID)
+			if err != nil {
+				return err
+			}
+			target, err = tx.GetCompany(ctx, targetID)
+			if err != nil {
+				return err
+			}
+			if err := checkNoPendingChange(ctx, tx, targetID); err != nil {
+				return err
+			}
+			if _, err := mergeCompanyFields(target, source, req.Fields); err != nil {
+				return grpc.Errorf(codes.InvalidArgument, "%s", err)
+			}
+			cr, err = a.requestChange(ctx, tx, user, sourceID, ChangeKind_CompanyMerge, req)
+			return err
+		})
+		if err != nil {
+			return nil, helpers.ErrToRPCError(err)
+		}
+
+		changeRequested(ctx, cr)
+		return &MergeCompaniesResponse{Company: companyFromStorage(target)}, nil
+	}
+
+	var merged storage.Company
+	err = a.repo.Transaction(ctx, func(tx storage.Repository) error {
+		for _, id := range []uuid.UUID{sourceID, targetID} {
+			if err := checkNoPendingChange(ctx, tx, id); err != nil {
+				return err
+			}
+		}
+		var err error
+		merged, err = applyMerge(ctx, tx, user.Username, req)
+		return err
+	})
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	sendMergedEvent(ctx, sourceID, a.companyEvent(ctx, &merged, "merged"))
+
+	return &MergeCompaniesResponse{Company: companyFromStorage(merged)}, nil
+}
+
+// applyMerge merges the source company into the target one as requested
+// by the given user and returns the merged target. It must be called in a
+// transaction.
+func applyMerge(ctx context.Context, tx storage.Repository, username string, req *MergeCompaniesRequest) (storage.Company, error) {
+	sourceID := uuid.FromStringOrNil(req.SourceId)
+
+	source, err := tx.GetCompany(ctx, sourceID)
+	if err != nil {
+		return storage.Company{}, err
+	}
+	target, err := tx.GetCompany(ctx, uuid.FromStringOrNil(req.TargetId))
+	if err != nil {
+		return storage.Company{}, err
+	}
+
+	merged, err := mergeCompanyFields(target, source, req.Fields)
+	if err != nil {
+		return merged, grpc.Errorf(codes.InvalidArgument, "%s", err)
+	}
+	if err := tx.MergeCompany(ctx, sourceID, &merged); err != nil {
+		return merged, err
+	}
+	return merged, recordFieldChanges(ctx, tx, username, target, merged)
+}
+
+// checkMergeIDs checks that the company is not merged into itself.
+func checkMergeIDs(m proto.Message, v *fieldViolations) {
+	req := m.(*MergeCompaniesRequest)
+	id := uuid.FromStringOrNil(req.SourceId)
+	if id != uuid.Nil && id == uuid.FromStringOrNil(req.TargetId) {
+		v.add("target_id", "a company can't be merged into itself")
+	}
+}
+
+// mergeCompanyFields returns the target with the fields resolved by the
+// given strategies.
+func mergeCompanyFields(target, source storage.Company, fields map[string]MergeStrategy) (storage.Company, error) {
+	merged := target
+	for field, strategy := range fields {
+		if _, ok := MergeStrategy_name[int32(strategy)]; !ok {
+			return merged, fmt.Errorf("unknown strategy %d of field %s", strategy, field)
+		}
+		take := strategy == MergeStrategy_TakeSource
+
+		switch field {
+		case "name":
+			if take || (strategy == MergeStrategy_NonEmpty && merged.Name == "") {
+				merged.Name = source.Name
+			}
+		case "description":
+			if take || (strategy == MergeStrategy_NonEmpty && merged.Description == "") {
+				merged.Description = source.Description
+			}
+		case "employeescnt":
+			if take || (strategy == MergeStrategy_NonEmpty && merged.EmployeesCnt == 0) {
+				merged.EmployeesCnt = source.EmployeesCnt
+			}
+		case "registered":
+			if take || (strategy == MergeStrategy_NonEmpty && !merged.Registered) {
+				merged.Registered = source.Registered
+			}
+		case "type":
+			// the attributes are defined per type, they go with it
+			if take || (strategy == MergeStrategy_NonEmpty && merged.Type == 0) {
+				merged.Type = source.Type
+				merged.Attributes = source.Attributes
+			}
+		case "attributes":
+			// resolved once the type is
+			continue
+		case "registration_number":
+			// the number goes with its jurisdiction
+			if take || (strategy == MergeStrategy_NonEmpty && merged.RegistrationNumber == "") {
+				merged.Jurisdiction = source.Jurisdiction
+				merged.RegistrationNumber = source.RegistrationNumber
+			}
+		case "vat_id":
+			if take || (strategy == MergeStrategy_NonEmpty && merged.VATID == "") {
+				merged.VATID = source.VATID
+			}
+		case "lei":
+			if take || (strategy == MergeStrategy_NonEmpty && merged.LEI == "") {
+				merged.LEI = source.LEI
+			}
+		default:
+			return merged, fmt.Errorf("unknown field %s", field)
+		}
+	}
+
+	if strategy, ok := fields["attributes"]; ok && strategy != MergeStrategy_KeepTarget {
+		if merged.Type != source.Type {
+			return merged, fmt.Errorf("the attributes of a company of another type can't be merged")
+		}
+		if strategy == MergeStrategy_TakeSource {
+			merged.Attributes = source.Attributes
+		} else {
+			attributes := make(storage.CompanyAttributes, len(merged.Attributes)+len(source.Attributes))
+			for k, v := range source.Attributes {
+				attributes[k] = v
+			}
+			for k, v := range merged.Attributes {
+				attributes[k] = v
+			}
+			merged.Attributes = attributes
+		}
+	}
+	return merged, nil
+}
+
+// sendMergedEvent publishes the merged event of the given companies, keyed
+// by the ID of the target.
+func sendMergedEvent(ctx context.Context, sourceID uuid.UUID, target *companyEvent) {
+	b, err := json.Marshal(mergedEvent{
+		SourceID: sourceID,
+		TargetID: target.ID,
+		Company:  target,
+	})
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"company_id": target.ID,
+			"event":      "merged",
+		}).Error("unable to marshal data")
+		return
+	}
+	publishEvent(ctx, target.ID.String(), "merged", b)
+}
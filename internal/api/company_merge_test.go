@@ -0,0 +1,180 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+func TestMergeCompanies(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+
+	api := NewCompanyAPI(&TestValidator{returnSubject: "user"}, storage.NewMemoryRepository(), nil, 0)
+
+	source := &Company{
+		Id:           uuid.Must(uuid.NewV4()).String(),
+		Name:         "Acme",
+		Description:  "rockets",
+		Employeescnt: 10,
+		Registered:   true,
+		Type:         CompanyType_Corporations,
+	}
+	target := &Company{
+		Id:           uuid.Must(uuid.NewV4()).String(),
+		Name:         "Acme Inc",
+		Employeescnt: 20,
+		Type:         CompanyType_NonProfit,
+	}
+	for _, c := range []*Company{source, target} {
+		_, err := api.Create(ctx, &CreateCompanyRequest{Company: c, Force: true})
+		assert.NoError(err)
+	}
+
+	t.Run("Errors", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := api.MergeCompanies(ctx, &MergeCompaniesRequest{SourceId: source.Id, TargetId: source.Id})
+		assert.Equal(codes.InvalidArgument, status.Code(err))
+
+		_, err = api.MergeCompanies(ctx, &MergeCompaniesRequest{SourceId: source.Id, TargetId: target.Id,
+			Fields: map[string]MergeStrategy{"unknown": MergeStrategy_TakeSource}})
+		assert.Equal(codes.InvalidArgument, status.Code(err))
+
+		_, err = api.MergeCompanies(ctx, &MergeCompaniesRequest{SourceId: source.Id, TargetId: uuid.Must(uuid.NewV4()).String()})
+		assert.Equal(codes.NotFound, status.Code(err))
+	})
+
+	t.Run("Merge", func(t *testing.T) {
+		assert := require.New(t)
+
+		resp, err := api.MergeCompanies(ctx, &MergeCompaniesRequest{
+			SourceId: source.Id,
+			TargetId: target.Id,
+			Fields: map[string]MergeStrategy{
+				"name":         MergeStrategy_TakeSource,
+				"description":  MergeStrategy_NonEmpty,
+				"employeescnt": MergeStrategy_NonEmpty,
+				"registered":   MergeStrategy_NonEmpty,
+			},
+		})
+		assert.NoError(err)
+		assert.Equal(target.Id, resp.Company.Id)
+		assert.Equal("Acme", resp.Company.Name)
+		assert.Equal("rockets", resp.Company.Description)
+		assert.EqualValues(20, resp.Company.Employeescnt)
+		assert.True(resp.Company.Registered)
+		assert.Equal(CompanyType_NonProfit, resp.Company.Type)
+	})
+
+	t.Run("Get redirect", func(t *testing.T) {
+		assert := require.New(t)
+
+		resp, err := api.Get(ctx, &GetCompanyRequest{Id: source.Id})
+		assert.NoError(err)
+		assert.Equal(target.Id, resp.Company.Id)
+		assert.Equal(target.Id, resp.MergedInto)
+
+		resp, err = api.Get(ctx, &GetCompanyRequest{Id: target.Id})
+		assert.NoError(err)
+		assert.Equal("", resp.MergedInto)
+	})
+
+	t.Run("Approval", func(t *testing.T) {
+		assert := require.New(t)
+
+		defer func(p approvalPolicy) { approval = p }(approval)
+		approval = approvalPolicy{delete: true, employeesThreshold: 100, ttl: time.Hour}
+
+		alice := storage.User{ID: 2, Username: "alice"}
+		bob := storage.User{ID: 3, Username: "bob", IsApprover: true}
+		validator := &TestValidator{returnSubject: "user", returnUser: alice}
+		api := NewCompanyAPI(validator, storage.NewMemoryRepository(), nil, 0)
+
+		source, target := &Company{
+			Id:           uuid.Must(uuid.NewV4()).String(),
+			Name:         "Old Co",
+			Description:  "old",
+			Employeescnt: 10,
+			Type:         CompanyType_Corporations,
+		}, &Company{
+			Id:           uuid.Must(uuid.NewV4()).String(),
+			Name:         "New Co",
+			Employeescnt: 10,
+			Type:         CompanyType_Corporations,
+		}
+		for _, c := range []*Company{source, target} {
+			_, err := api.Create(ctx, &CreateCompanyRequest{Company: c, Force: true})
+			assert.NoError(err)
+		}
+		_, err := api.TransitionCompany(ctx, &TransitionCompanyRequest{Id: source.Id, Status: CompanyStatus_PendingVerification, Reason: "documents received"})
+		assert.NoError(err)
+		req := &MergeCompaniesRequest{
+			SourceId: source.Id,
+			TargetId: target.Id,
+			Fields:   map[string]MergeStrategy{"description": MergeStrategy_TakeSource},
+		}
+
+		// the pending change of the target blocks the merge
+		target.Employeescnt = 500
+		_, err = api.Update(ctx, &UpdateCompanyRequest{Company: target})
+		assert.NoError(err)
+		_, err = api.MergeCompanies(ctx, req)
+		assert.Equal(codes.FailedPrecondition, status.Code(err))
+		list, err := api.ListChangeRequests(ctx, &ListChangeRequestsRequest{Status: ChangeRequestStatus_Pending, CompanyId: target.Id})
+		assert.NoError(err)
+		validator.returnUser = bob
+		_, err = api.RejectChangeRequest(ctx, &DecideChangeRequestRequest{Id: list.ChangeRequests[0].Id})
+		assert.NoError(err)
+		validator.returnUser = alice
+
+		// the source is deleted, the merge needs an approval
+		resp, err := api.MergeCompanies(ctx, req)
+		assert.NoError(err)
+		assert.Empty(resp.Company.Description)
+		_, err = api.Get(ctx, &GetCompanyRequest{Id: source.Id})
+		assert.NoError(err)
+		list, err = api.ListChangeRequests(ctx, &ListChangeRequestsRequest{Status: ChangeRequestStatus_Pending, CompanyId: source.Id})
+		assert.NoError(err)
+		assert.Len(list.ChangeRequests, 1)
+		cr := list.ChangeRequests[0]
+		assert.Equal(ChangeKind_CompanyMerge, cr.Kind)
+		assert.Equal(target.Id, cr.Merge.TargetId)
+
+		// the pending merge blocks the other merges of the source
+		_, err = api.MergeCompanies(ctx, req)
+		assert.Equal(codes.FailedPrecondition, status.Code(err))
+
+		validator.returnUser = bob
+		_, err = api.ApproveChangeRequest(ctx, &DecideChangeRequestRequest{Id: cr.Id})
+		assert.NoError(err)
+		got, err := api.Get(ctx, &GetCompanyRequest{Id: source.Id})
+		assert.NoError(err)
+		assert.Equal(target.Id, got.MergedInto)
+		assert.Equal("old", got.Company.Description)
+
+		// the history of the source is kept
+		timeline, err := api.GetCompanyTimeline(ctx, &GetCompanyTimelineRequest{CompanyId: target.Id})
+		assert.NoError(err)
+		var kinds []TimelineEntryKind
+		for _, e := range timeline.Entries {
+			kinds = append(kinds, e.Kind)
+		}
+		// the initial statuses of both companies, the transition of the
+		// source and the merged description
+		assert.Equal([]TimelineEntryKind{
+			TimelineEntryKind_StatusChangeEntry,
+			TimelineEntryKind_StatusChangeEntry,
+			TimelineEntryKind_StatusChangeEntry,
+			TimelineEntryKind_FieldChangeEntry,
+		}, kinds)
+		assert.Equal("alice", timeline.Entries[3].FieldChange.Username)
+	})
+}
@@ -0,0 +1,202 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/ptypes/empty"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/fancar/tmp_xm/internal/api/helpers"
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+// CreateNote creates the given note of the company, written by the
+// authenticated user.
+func (a *CompanyAPI) CreateNote(ctx context.Context, req *CreateNoteRequest) (*Note, error) {
+	log.Debug("api/CreateNote request:", req)
+
+	companyID, err := a.validateSubresource(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	user, err := a.validator.GetUser(ctx)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	item := storage.CompanyNote{
+		CompanyID: companyID,
+		Author:    user.Username,
+		Body:      req.Note.Body,
+		Pinned:    req.Note.Pinned,
+	}
+	item.ID, err = uuid.NewV4()
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, "new uuid error: %s", err)
+	}
+
+	err = a.repo.Transaction(ctx, func(tx storage.Repository) error {
+		return tx.CreateCompanyNote(ctx, &item)
+	})
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+	return noteFromStorage(item), nil
+}
+
+// GetNote returns the note of the company.
+func (a *CompanyAPI) GetNote(ctx context.Context, req *GetNoteRequest) (*Note, error) {
+	log.Debug("api/GetNote request:", req)
+
+	companyID, err := a.validateSubresource(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	id := uuid.FromStringOrNil(req.Id)
+
+	item, err := a.repo.GetCompanyNote(ctx, companyID, id)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+	return noteFromStorage(item), nil
+}
+
+// UpdateNote updates the body and the pinned flag of the note of the
+// company, its previous version is kept.
+func (a *CompanyAPI) UpdateNote(ctx context.Context, req *UpdateNoteRequest) (*Note, error) {
+	log.Debug("api/UpdateNote request:", req)
+
+	companyID, err := a.validateSubresource(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	user, err := a.validator.GetUser(ctx)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	item := storage.CompanyNote{
+		ID:        uuid.FromStringOrNil(req.Note.Id),
+		CompanyID: companyID,
+		Body:      req.Note.Body,
+		Pinned:    req.Note.Pinned,
+	}
+	err = a.repo.Transaction(ctx, func(tx storage.Repository) error {
+		if err := checkNoteAuthor(ctx, tx, user, companyID, item.ID); err != nil {
+			return err
+		}
+		return tx.UpdateCompanyNote(ctx, &item, user.Username)
+	})
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+	return noteFromStorage(item), nil
+}
+
+// DeleteNote deletes the note of the company with its history.
+func (a *CompanyAPI) DeleteNote(ctx context.Context, req *DeleteNoteRequest) (*empty.Empty, error) {
+	log.Debug("api/DeleteNote request:", req)
+
+	companyID, err := a.validateSubresource(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	user, err := a.validator.GetUser(ctx)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+	id := uuid.FromStringOrNil(req.Id)
+
+	err = a.repo.Transaction(ctx, func(tx storage.Repository) error {
+		if err := checkNoteAuthor(ctx, tx, user, companyID, id); err != nil {
+			return err
+		}
+		return tx.DeleteCompanyNote(ctx, companyID, id)
+	})
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+	return &empty.Empty{}, nil
+}
+
+// ListNotes returns the notes of the company, the pinned ones first.
+func (a *CompanyAPI) ListNotes(ctx context.Context, req *ListNotesRequest) (*ListNotesResponse, error) {
+	log.Debug("api/ListNotes request:", req)
+
+	companyID, err := a.validateSubresource(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := a.repo.GetCompany(ctx, companyID); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+	list, err := a.repo.GetCompanyNotes(ctx, companyID)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	resp := &ListNotesResponse{Notes: make([]*Note, 0, len(list))}
+	for _, item := range list {
+		resp.Notes = append(resp.Notes, noteFromStorage(item))
+	}
+	return resp, nil
+}
+
+// GetNoteHistory returns the versions of the note of the company, the
+// oldest first.
+func (a *CompanyAPI) GetNoteHistory(ctx context.Context, req *GetNoteHistoryRequest) (*GetNoteHistoryResponse, error) {
+	log.Debug("api/GetNoteHistory request:", req)
+
+	companyID, err := a.validateSubresource(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	id := uuid.FromStringOrNil(req.Id)
+
+	list, err := a.repo.GetCompanyNoteVersions(ctx, companyID, id)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	resp := &GetNoteHistoryResponse{Versions: make([]*NoteVersion, 0, len(list))}
+	for _, v := range list {
+		resp.Versions = append(resp.Versions, &NoteVersion{
+			Version:   v.Version,
+			Body:      v.Body,
+			Pinned:    v.Pinned,
+			Username:  v.Username,
+			CreatedAt: v.CreatedAt.UTC().Format(time.RFC3339),
+		})
+	}
+	return resp, nil
+}
+
+// checkNoteAuthor checks that the note exists and that the user may change
+// it: only its author and the admins can.
+func checkNoteAuthor(ctx context.Context, tx storage.Repository, user storage.User, companyID, id uuid.UUID) error {
+	n, err := tx.GetCompanyNote(ctx, companyID, id)
+	if err != nil {
+		return err
+	}
+	if n.Author != user.Username && !user.IsAdmin {
+		return grpc.Errorf(codes.PermissionDenied, "only the author of the note or an admin can change it")
+	}
+	return nil
+}
+
+func noteFromStorage(n storage.CompanyNote) *Note {
+	return &Note{
+		Id:        n.ID.String(),
+		Body:      n.Body,
+		Pinned:    n.Pinned,
+		Author:    n.Author,
+		Version:   n.Version,
+		CreatedAt: n.CreatedAt.UTC().Format(time.RFC3339),
+		UpdatedAt: n.UpdatedAt.UTC().Format(time.RFC3339),
+	}
+}
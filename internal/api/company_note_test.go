@@ -0,0 +1,128 @@
+package api
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+func TestCompanyNotes(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+
+	validator := &TestValidator{returnSubject: "user", returnUser: storage.User{ID: 2, Username: "alice"}}
+	api := NewCompanyAPI(validator, storage.NewMemoryRepository(), nil, 0)
+	as := func(user storage.User) func() {
+		validator.returnUser = user
+		return func() { validator.returnUser = storage.User{ID: 2, Username: "alice"} }
+	}
+
+	company := &Company{
+		Id:           uuid.Must(uuid.NewV4()).String(),
+		Name:         "Noted",
+		Employeescnt: 1,
+		Type:         CompanyType_Corporations,
+	}
+	_, err := api.Create(ctx, &CreateCompanyRequest{Company: company})
+	assert.NoError(err)
+
+	var first, second *Note
+
+	t.Run("Create", func(t *testing.T) {
+		assert := require.New(t)
+
+		n, err := api.CreateNote(ctx, &CreateNoteRequest{CompanyId: company.Id, Note: &Note{Body: "Prefers **email**", Author: "mallory", Version: 7}})
+		assert.NoError(err)
+		assert.Equal("alice", n.Author)
+		assert.Equal(int32(1), n.Version)
+		assert.Equal(n.CreatedAt, n.UpdatedAt)
+		first = n
+
+		defer as(storage.User{ID: 3, Username: "bob"})()
+		second, err = api.CreateNote(ctx, &CreateNoteRequest{CompanyId: company.Id, Note: &Note{Body: "Renewal in May", Pinned: true}})
+		assert.NoError(err)
+		assert.Equal("bob", second.Author)
+
+		_, err = api.CreateNote(ctx, &CreateNoteRequest{CompanyId: company.Id, Note: &Note{Body: strings.Repeat("a", 10001)}})
+		assert.Equal([]string{"note.body"}, violatedFields(t, err))
+		_, err = api.CreateNote(ctx, &CreateNoteRequest{CompanyId: "bad", Note: &Note{}})
+		assert.Equal([]string{"company_id", "note.body"}, violatedFields(t, err))
+		_, err = api.CreateNote(ctx, &CreateNoteRequest{CompanyId: uuid.Must(uuid.NewV4()).String(), Note: &Note{Body: "?"}})
+		assert.Equal(codes.NotFound, status.Code(err))
+	})
+
+	t.Run("GetList", func(t *testing.T) {
+		assert := require.New(t)
+
+		n, err := api.GetNote(ctx, &GetNoteRequest{CompanyId: company.Id, Id: first.Id})
+		assert.NoError(err)
+		assert.Equal("Prefers **email**", n.Body)
+
+		resp, err := api.ListNotes(ctx, &ListNotesRequest{CompanyId: company.Id})
+		assert.NoError(err)
+		assert.Len(resp.Notes, 2)
+		assert.Equal(second.Id, resp.Notes[0].Id)
+
+		_, err = api.ListNotes(ctx, &ListNotesRequest{CompanyId: uuid.Must(uuid.NewV4()).String()})
+		assert.Equal(codes.NotFound, status.Code(err))
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		assert := require.New(t)
+
+		// only the author and the admins can change a note
+		_, err := api.UpdateNote(ctx, &UpdateNoteRequest{CompanyId: company.Id, Note: &Note{Id: second.Id, Body: "Renewal in June"}})
+		assert.Equal(codes.PermissionDenied, status.Code(err))
+
+		n, err := api.UpdateNote(ctx, &UpdateNoteRequest{CompanyId: company.Id, Note: &Note{Id: first.Id, Body: "Prefers **phone**", Pinned: true}})
+		assert.NoError(err)
+		assert.Equal("alice", n.Author)
+		assert.Equal(int32(2), n.Version)
+		assert.True(n.Pinned)
+
+		restore := as(storage.User{ID: 1, Username: "admin", IsAdmin: true})
+		n, err = api.UpdateNote(ctx, &UpdateNoteRequest{CompanyId: company.Id, Note: &Note{Id: first.Id, Body: "Prefers **phone**, not before 9"}})
+		restore()
+		assert.NoError(err)
+		assert.Equal("alice", n.Author)
+		assert.Equal(int32(3), n.Version)
+
+		resp, err := api.GetNoteHistory(ctx, &GetNoteHistoryRequest{CompanyId: company.Id, Id: first.Id})
+		assert.NoError(err)
+		assert.Len(resp.Versions, 3)
+		assert.Equal("Prefers **email**", resp.Versions[0].Body)
+		assert.Equal("alice", resp.Versions[1].Username)
+		assert.True(resp.Versions[1].Pinned)
+		assert.Equal("admin", resp.Versions[2].Username)
+		assert.False(resp.Versions[2].Pinned)
+
+		_, err = api.UpdateNote(ctx, &UpdateNoteRequest{CompanyId: company.Id, Note: &Note{Id: uuid.Must(uuid.NewV4()).String(), Body: "?"}})
+		assert.Equal(codes.NotFound, status.Code(err))
+		_, err = api.UpdateNote(ctx, &UpdateNoteRequest{CompanyId: company.Id, Note: &Note{Body: "?"}})
+		assert.Equal([]string{"note.id"}, violatedFields(t, err))
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := api.DeleteNote(ctx, &DeleteNoteRequest{CompanyId: company.Id, Id: second.Id})
+		assert.Equal(codes.PermissionDenied, status.Code(err))
+
+		defer as(storage.User{ID: 3, Username: "bob"})()
+		_, err = api.DeleteNote(ctx, &DeleteNoteRequest{CompanyId: company.Id, Id: second.Id})
+		assert.NoError(err)
+		_, err = api.GetNote(ctx, &GetNoteRequest{CompanyId: company.Id, Id: second.Id})
+		assert.Equal(codes.NotFound, status.Code(err))
+		_, err = api.GetNoteHistory(ctx, &GetNoteHistoryRequest{CompanyId: company.Id, Id: second.Id})
+		assert.Equal(codes.NotFound, status.Code(err))
+		_, err = api.DeleteNote(ctx, &DeleteNoteRequest{CompanyId: company.Id, Id: second.Id})
+		assert.Equal(codes.NotFound, status.Code(err))
+	})
+}
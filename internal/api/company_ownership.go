@@ -0,0 +1,255 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/ptypes/empty"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/fancar/tmp_xm/internal/api/helpers"
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+// dateLayout is the format of the effective dates of the stakes.
+const dateLayout = "2006-01-02"
+
+// CreateOwnership creates the given stake in the company.
+func (a *CompanyAPI) CreateOwnership(ctx context.Context, req *CreateOwnershipRequest) (*Ownership, error) {
+	log.Debug("api/CreateOwnership request:", req)
+
+	companyID, err := a.validateSubresource(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	item := convertOwnership(companyID, req.Ownership)
+	item.ID, err = uuid.NewV4()
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, "new uuid error: %s", err)
+	}
+
+	err = a.repo.Transaction(ctx, func(tx storage.Repository) error {
+		return tx.CreateOwnership(ctx, item)
+	})
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+	return ownershipFromStorage(*item), nil
+}
+
+// GetOwnership returns the stake in the company.
+func (a *CompanyAPI) GetOwnership(ctx context.Context, req *GetOwnershipRequest) (*Ownership, error) {
+	log.Debug("api/GetOwnership request:", req)
+
+	companyID, err := a.validateSubresource(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	id := uuid.FromStringOrNil(req.Id)
+
+	item, err := a.repo.GetOwnership(ctx, companyID, id)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+	return ownershipFromStorage(item), nil
+}
+
+// UpdateOwnership updates the given stake in the company.
+func (a *CompanyAPI) UpdateOwnership(ctx context.Context, req *UpdateOwnershipRequest) (*Ownership, error) {
+	log.Debug("api/UpdateOwnership request:", req)
+
+	companyID, err := a.validateSubresource(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	item := convertOwnership(companyID, req.Ownership)
+	item.ID = uuid.FromStringOrNil(req.Ownership.Id)
+
+	err = a.repo.Transaction(ctx, func(tx storage.Repository) error {
+		return tx.UpdateOwnership(ctx, item)
+	})
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+	return ownershipFromStorage(*item), nil
+}
+
+// DeleteOwnership deletes the stake in the company.
+func (a *CompanyAPI) DeleteOwnership(ctx context.Context, req *DeleteOwnershipRequest) (*empty.Empty, error) {
+	log.Debug("api/DeleteOwnership request:", req)
+
+	companyID, err := a.validateSubresource(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	id := uuid.FromStringOrNil(req.Id)
+
+	if err := a.repo.DeleteOwnership(ctx, companyID, id); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+	return &empty.Empty{}, nil
+}
+
+// ListOwnerships returns the direct stakes in the company.
+func (a *CompanyAPI) ListOwnerships(ctx context.Context, req *ListOwnershipsRequest) (*ListOwnershipsResponse, error) {
+	log.Debug("api/ListOwnerships request:", req)
+
+	companyID, err := a.validateSubresource(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := a.repo.GetCompany(ctx, companyID); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+	list, err := a.repo.GetCompanyOwnerships(ctx, companyID)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	resp := &ListOwnershipsResponse{Ownerships: make([]*Ownership, 0, len(list))}
+	for _, item := range list {
+		resp.Ownerships = append(resp.Ownerships, ownershipFromStorage(item))
+	}
+	return resp, nil
+}
+
+// GetUltimateBeneficialOwners returns the persons owning the company
+// directly or indirectly, at least the threshold, at the given date.
+func (a *CompanyAPI) GetUltimateBeneficialOwners(ctx context.Context, req *GetUltimateBeneficialOwnersRequest) (*GetUltimateBeneficialOwnersResponse, error) {
+	log.Debug("api/GetUltimateBeneficialOwners request:", req)
+
+	companyID, err := a.validateSubresource(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	threshold := req.Threshold
+	if threshold == 0 {
+		threshold = uboThreshold
+	}
+
+	at := time.Now()
+	if req.Date != "" {
+		at, _ = time.Parse(dateLayout, req.Date)
+	}
+
+	if _, err := a.repo.GetCompany(ctx, companyID); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+	stakes, err := a.repo.GetOwnershipGraph(ctx, companyID)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	owners := storage.UltimateBeneficialOwners(stakes, companyID, at, threshold)
+	resp := &GetUltimateBeneficialOwnersResponse{Owners: make([]*BeneficialOwner, 0, len(owners))}
+	for _, o := range owners {
+		p, err := a.repo.GetPerson(ctx, o.PersonID)
+		if err != nil {
+			return nil, helpers.ErrToRPCError(err)
+		}
+
+		bo := &BeneficialOwner{
+			Person:     personFromStorage(p),
+			Percentage: o.Percentage,
+			Paths:      make([]*OwnershipPath, 0, len(o.Paths)),
+		}
+		for _, path := range o.Paths {
+			ids := make([]string, 0, len(path.CompanyIDs))
+			for _, id := range path.CompanyIDs {
+				ids = append(ids, id.String())
+			}
+			bo.Paths = append(bo.Paths, &OwnershipPath{CompanyIds: ids, Percentage: path.Percentage})
+		}
+		resp.Owners = append(resp.Owners, bo)
+	}
+	return resp, nil
+}
+
+// convertOwnership converts the given validated stake in the given company,
+// without its ID.
+func convertOwnership(companyID uuid.UUID, in *Ownership) *storage.Ownership {
+	out := storage.Ownership{
+		CompanyID:  companyID,
+		Percentage: in.Percentage,
+	}
+	if in.OwnerCompanyId != "" {
+		out.OwnerCompanyID = uuid.NullUUID{UUID: uuid.FromStringOrNil(in.OwnerCompanyId), Valid: true}
+	}
+	if in.OwnerPersonId != "" {
+		out.OwnerPersonID = uuid.NullUUID{UUID: uuid.FromStringOrNil(in.OwnerPersonId), Valid: true}
+	}
+	out.ValidFrom, _ = time.Parse(dateLayout, in.ValidFrom)
+	if in.ValidTo != "" {
+		to, _ := time.Parse(dateLayout, in.ValidTo)
+		out.ValidTo = sql.NullTime{Time: to, Valid: true}
+	}
+	return &out
+}
+
+// percentage checks that the stake is in (0, 100].
+func percentage() check {
+	return func(_ protoreflect.FieldDescriptor, v protoreflect.Value) string {
+		if !(v.Float() > 0 && v.Float() <= 100) {
+			return "must be in (0, 100]"
+		}
+		return ""
+	}
+}
+
+// checkOwnership checks that the stake has exactly one owner and that it
+// ends after it starts.
+func checkOwnership(m proto.Message, v *fieldViolations) {
+	o := m.(*Ownership)
+	if (o.OwnerCompanyId == "") == (o.OwnerPersonId == "") {
+		v.add("owner_company_id", "either the owner_company_id or the owner_person_id must be set")
+	}
+
+	from, err := time.Parse(dateLayout, o.ValidFrom)
+	if err != nil || o.ValidTo == "" {
+		return
+	}
+	if to, err := time.Parse(dateLayout, o.ValidTo); err == nil && !to.After(from) {
+		v.add("valid_to", "must be after valid_from")
+	}
+}
+
+// checkSelfOwnership checks that the company of the request does not own
+// itself.
+func checkSelfOwnership(m proto.Message, v *fieldViolations) {
+	req := m.(interface {
+		GetCompanyId() string
+		GetOwnership() *Ownership
+	})
+	owner := uuid.FromStringOrNil(req.GetOwnership().GetOwnerCompanyId())
+	if owner != uuid.Nil && owner == uuid.FromStringOrNil(req.GetCompanyId()) {
+		v.add("ownership.owner_company_id", "a company can't own itself")
+	}
+}
+
+func ownershipFromStorage(o storage.Ownership) *Ownership {
+	out := Ownership{
+		Id:         o.ID.String(),
+		Percentage: o.Percentage,
+		ValidFrom:  o.ValidFrom.UTC().Format(dateLayout),
+	}
+	if o.OwnerCompanyID.Valid {
+		out.OwnerCompanyId = o.OwnerCompanyID.UUID.String()
+	}
+	if o.OwnerPersonID.Valid {
+		out.OwnerPersonId = o.OwnerPersonID.UUID.String()
+	}
+	if o.ValidTo.Valid {
+		out.ValidTo = o.ValidTo.Time.UTC().Format(dateLayout)
+	}
+	return &out
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+func TestCompanyOwnership(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+
+	repo := storage.NewMemoryRepository()
+	api := NewCompanyAPI(&TestValidator{returnSubject: "user"}, repo, nil, 0)
+
+	create := func(name string) string {
+		id := uuid.Must(uuid.NewV4()).String()
+		_, err := api.Create(ctx, &CreateCompanyRequest{Company: &Company{
+			Id:           id,
+			Name:         name,
+			Employeescnt: 1,
+			Type:         CompanyType_Corporations,
+		}})
+		assert.NoError(err)
+		return id
+	}
+	operating := create("Operating")
+	holding := create("Holding")
+
+	alice, err := api.CreatePerson(ctx, &CreatePersonRequest{Person: &Person{Name: "Alice", Country: "cy"}})
+	assert.NoError(err)
+	assert.Equal("CY", alice.Country)
+	bob, err := api.CreatePerson(ctx, &CreatePersonRequest{Person: &Person{Name: "Bob"}})
+	assert.NoError(err)
+
+	stakes := []struct {
+		company string
+		stake   *Ownership
+	}{
+		{operating, &Ownership{OwnerCompanyId: holding, Percentage: 80, ValidFrom: "2020-01-01"}},
+		{operating, &Ownership{OwnerPersonId: bob.Id, Percentage: 20, ValidFrom: "2020-01-01"}},
+		{holding, &Ownership{OwnerPersonId: alice.Id, Percentage: 40, ValidFrom: "2020-01-01"}},
+		{holding, &Ownership{OwnerPersonId: bob.Id, Percentage: 60, ValidFrom: "2020-01-01", ValidTo: "2021-01-01"}},
+	}
+	for _, s := range stakes {
+		o, err := api.CreateOwnership(ctx, &CreateOwnershipRequest{CompanyId: s.company, Ownership: s.stake})
+		assert.NoError(err)
+		assert.NotEmpty(o.Id)
+		s.stake.Id = o.Id
+	}
+
+	t.Run("Validation", func(t *testing.T) {
+		assert := require.New(t)
+
+		tests := []*Ownership{
+			{Percentage: 10, ValidFrom: "2020-01-01"},
+			{OwnerCompanyId: holding, OwnerPersonId: bob.Id, Percentage: 10, ValidFrom: "2020-01-01"},
+			{OwnerCompanyId: operating, Percentage: 10, ValidFrom: "2020-01-01"},
+			{OwnerPersonId: bob.Id, Percentage: 0, ValidFrom: "2020-01-01"},
+			{OwnerPersonId: bob.Id, Percentage: 101, ValidFrom: "2020-01-01"},
+			{OwnerPersonId: bob.Id, Percentage: 10, ValidFrom: "01/01/2020"},
+			{OwnerPersonId: bob.Id, Percentage: 10, ValidFrom: "2020-01-01", ValidTo: "2020-01-01"},
+		}
+		for _, o := range tests {
+			_, err := api.CreateOwnership(ctx, &CreateOwnershipRequest{CompanyId: operating, Ownership: o})
+			assert.Equal(codes.InvalidArgument, status.Code(err), o)
+		}
+
+		// the stakes already sum up to 100%
+		_, err := api.CreateOwnership(ctx, &CreateOwnershipRequest{CompanyId: operating, Ownership: &Ownership{
+			OwnerPersonId: alice.Id,
+			Percentage:    1,
+			ValidFrom:     "2022-01-01",
+		}})
+		assert.Equal(codes.FailedPrecondition, status.Code(err))
+
+		_, err = api.DeletePerson(ctx, &DeletePersonRequest{Id: alice.Id})
+		assert.Equal(codes.FailedPrecondition, status.Code(err))
+	})
+
+	t.Run("GetUltimateBeneficialOwners", func(t *testing.T) {
+		assert := require.New(t)
+
+		// alice 80% x 40% = 32%, bob 20% + 80% x 60% = 68%
+		resp, err := api.GetUltimateBeneficialOwners(ctx, &GetUltimateBeneficialOwnersRequest{CompanyId: operating, Date: "2020-06-01"})
+		assert.NoError(err)
+		assert.Len(resp.Owners, 2)
+		assert.Equal(bob.Id, resp.Owners[0].Person.Id)
+		assert.InDelta(68, resp.Owners[0].Percentage, 1e-9)
+		assert.Len(resp.Owners[0].Paths, 2)
+		assert.Equal([]string{operating, holding}, resp.Owners[0].Paths[0].CompanyIds)
+		assert.Equal("Alice", resp.Owners[1].Person.Name)
+		assert.InDelta(32, resp.Owners[1].Percentage, 1e-9)
+
+		// bob's stake in the holding ended, his direct stake is below the
+		// default threshold
+		resp, err = api.GetUltimateBeneficialOwners(ctx, &GetUltimateBeneficialOwnersRequest{CompanyId: operating, Date: "2021-06-01"})
+		assert.NoError(err)
+		assert.Len(resp.Owners, 1)
+		assert.Equal(alice.Id, resp.Owners[0].Person.Id)
+
+		resp, err = api.GetUltimateBeneficialOwners(ctx, &GetUltimateBeneficialOwnersRequest{CompanyId: operating, Date: "2021-06-01", Threshold: 10})
+		assert.NoError(err)
+		assert.Len(resp.Owners, 2)
+
+		_, err = api.GetUltimateBeneficialOwners(ctx, &GetUltimateBeneficialOwnersRequest{CompanyId: operating, Threshold: 120})
+		assert.Equal(codes.InvalidArgument, status.Code(err))
+		_, err = api.GetUltimateBeneficialOwners(ctx, &GetUltimateBeneficialOwnersRequest{CompanyId: uuid.Must(uuid.NewV4()).String()})
+		assert.Equal(codes.NotFound, status.Code(err))
+	})
+
+	t.Run("Update and delete", func(t *testing.T) {
+		assert := require.New(t)
+
+		s := stakes[0].stake
+		s.Percentage = 70
+		o, err := api.UpdateOwnership(ctx, &UpdateOwnershipRequest{CompanyId: operating, Ownership: s})
+		assert.NoError(err)
+		assert.Equal(70.0, o.Percentage)
+		assert.Equal("2020-01-01", o.ValidFrom)
+
+		resp, err := api.ListOwnerships(ctx, &ListOwnershipsRequest{CompanyId: operating})
+		assert.NoError(err)
+		assert.Len(resp.Ownerships, 2)
+
+		_, err = api.DeleteOwnership(ctx, &DeleteOwnershipRequest{CompanyId: operating, Id: s.Id})
+		assert.NoError(err)
+		_, err = api.GetOwnership(ctx, &GetOwnershipRequest{CompanyId: operating, Id: s.Id})
+		assert.Equal(codes.NotFound, status.Code(err))
+	})
+}
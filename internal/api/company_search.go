@@ -0,0 +1,64 @@
+package api
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/fancar/tmp_xm/internal/api/auth"
+	"github.com/fancar/tmp_xm/internal/api/helpers"
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+const (
+	defaultSearchLimit  = 20
+	maxSearchLimit      = 100
+	maxSearchQueryChars = 200
+)
+
+// SearchCompanies returns the companies best matching the query.
+func (a *CompanyAPI) SearchCompanies(ctx context.Context, req *SearchCompaniesRequest) (*SearchCompaniesResponse, error) {
+	log.Debug("api/SearchCompanies request:", req)
+
+	if err := a.validator.Validate(ctx, auth.ValidateActiveUser()); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	limit := defaultSearchLimit
+	if req.Limit > 0 {
+		limit = int(req.Limit)
+	}
+
+	selector, _ := parseLabelSelector(req.LabelSelector)
+	attributes, err := attributeFilters(ctx, a.repo, uint32(req.Type), req.Attributes)
+	if err != nil {
+		return nil, err
+	}
+	filters := storage.CompanyFilters{
+		Type:       uint32(req.Type),
+		Attributes: attributes,
+		// the selector is validated by the rules
+		Labels: selector,
+	}
+
+	results, err := a.repo.SearchCompanies(ctx, req.Query, filters, limit)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	resp := &SearchCompaniesResponse{Results: make([]*CompanySearchResult, 0, len(results))}
+	for _, r := range results {
+		resp.Results = append(resp.Results, &CompanySearchResult{
+			Company: companyFromStorage(r.Company),
+			Rank:    r.Rank,
+			Snippet: r.Snippet,
+		})
+	}
+	return resp, nil
+}
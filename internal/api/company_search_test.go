@@ -0,0 +1,49 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+func TestSearchCompanies(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+	storage.HashIterations = 1
+
+	api := NewCompanyAPI(&TestValidator{returnSubject: "user"}, storage.NewMemoryRepository(), nil, 0)
+	for _, c := range []*Company{
+		{Name: "Acme", Description: "rockets"},
+		{Name: "Big Corp", Description: "acme rockets supplier"},
+		{Name: "Other"},
+	} {
+		c.Id = uuid.Must(uuid.NewV4()).String()
+		c.Employeescnt = 1
+		c.Type = CompanyType_Corporations
+		_, err := api.Create(ctx, &CreateCompanyRequest{Company: c})
+		assert.NoError(err)
+	}
+
+	resp, err := api.SearchCompanies(ctx, &SearchCompaniesRequest{Query: "acme"})
+	assert.NoError(err)
+	assert.Len(resp.Results, 2)
+	assert.Equal("Acme", resp.Results[0].Company.Name)
+	assert.Equal("Big Corp", resp.Results[1].Company.Name)
+	assert.Equal("<b>acme</b> rockets supplier", resp.Results[1].Snippet)
+	assert.Greater(resp.Results[0].Rank, resp.Results[1].Rank)
+
+	resp, err = api.SearchCompanies(ctx, &SearchCompaniesRequest{Query: "acme", Limit: 1})
+	assert.NoError(err)
+	assert.Len(resp.Results, 1)
+
+	_, err = api.SearchCompanies(ctx, &SearchCompaniesRequest{})
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+	_, err = api.SearchCompanies(ctx, &SearchCompaniesRequest{Query: "acme", Limit: 101})
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/gofrs/uuid"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/fancar/tmp_xm/internal/api/auth"
+	"github.com/fancar/tmp_xm/internal/api/helpers"
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+// statusReasonMaxLength is the max. length of the reason of a status
+// change.
+const statusReasonMaxLength = 500
+
+// statusTransitions holds the statuses a company can be moved to from each
+// status, Dissolved is final.
+var statusTransitions = map[CompanyStatus][]CompanyStatus{
+	CompanyStatus_Draft:               {CompanyStatus_PendingVerification},
+	CompanyStatus_PendingVerification: {CompanyStatus_Active, CompanyStatus_Draft},
+	CompanyStatus_Active:              {CompanyStatus_Suspended, CompanyStatus_InLiquidation},
+	CompanyStatus_Suspended:           {CompanyStatus_Active, CompanyStatus_InLiquidation},
+	CompanyStatus_InLiquidation:       {CompanyStatus_Dissolved},
+}
+
+// statusChangedEvent is the payload of the status_changed event, the
+// statuses are the values of CompanyStatus.
+type statusChangedEvent struct {
+	FromStatus uint32
+	ToStatus   uint32
+	Reason     string
+	Username   string
+	Company    *companyEvent
+}
+
+// canTransition returns true if a company can be moved from one status to
+// the other.
+func canTransition(from, to CompanyStatus) bool {
+	for _, s := range statusTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// initialStatus returns the status of the given new company: Active if it
+// is registered and Draft otherwise, unless it is set.
+func initialStatus(c *Company) CompanyStatus {
+	if c.Status != CompanyStatus_UnknownStatus {
+		return c.Status
+	}
+	if c.Registered {
+		return CompanyStatus_Active
+	}
+	return CompanyStatus_Draft
+}
+
+// checkInitialStatus checks the status of the given new company, it starts
+// in Draft or PendingVerification, or Active if it is registered. The other
+// statuses are reached by the transitions only.
+func checkInitialStatus(in *Company, v *fieldViolations) {
+	switch in.Status {
+	case CompanyStatus_UnknownStatus, CompanyStatus_Draft, CompanyStatus_PendingVerification:
+	case CompanyStatus_Active:
+		if !in.Registered {
+			v.add("status", "an unregistered company can't be created Active")
+		}
+	default:
+		v.add("status", "a company can't be created %s, it starts Draft or PendingVerification", in.Status)
+	}
+}
+
+// TransitionCompany moves the company to the given status.
+func (a *CompanyAPI) TransitionCompany(ctx context.Context, req *TransitionCompanyRequest) (*Company, error) {
+	log.Debug("api/TransitionCompany request:", req)
+
+	if err := a.validator.Validate(ctx, auth.ValidateActiveUser()); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+	user, err := a.validator.GetUser(ctx)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+	id := uuid.FromStringOrNil(req.Id)
+
+	ch := storage.CompanyStatusChange{
+		CompanyID: id,
+		ToStatus:  uint32(req.Status),
+		Reason:    req.Reason,
+		Username:  user.Username,
+	}
+	ch.ID, err = uuid.NewV4()
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, "new uuid error: %s", err)
+	}
+
+	var item storage.Company
+	err = a.repo.Transaction(ctx, func(tx storage.Repository) error {
+		c, err := tx.GetCompany(ctx, id)
+		if err != nil {
+			return err
+		}
+		from := CompanyStatus(c.Status)
+		if !canTransition(from, req.Status) {
+			return grpc.Errorf(codes.FailedPrecondition, "a company can't be moved from %s to %s", from, req.Status)
+		}
+
+		ch.FromStatus = c.Status
+		if err := tx.TransitionCompanyStatus(ctx, &ch); err != nil {
+			return err
+		}
+		item, err = tx.GetCompany(ctx, id)
+		return err
+	})
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	sendStatusChangedEvent(ctx, a.companyEvent(ctx, &item, "status_changed"), ch)
+
+	return companyFromStorage(item), nil
+}
+
+// GetStatusHistory returns the status changes of the company.
+func (a *CompanyAPI) GetStatusHistory(ctx context.Context, req *GetStatusHistoryRequest) (*GetStatusHistoryResponse, error) {
+	log.Debug("api/GetStatusHistory request:", req)
+
+	if err := a.validator.Validate(ctx, auth.ValidateActiveUser()); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+	id := uuid.FromStringOrNil(req.Id)
+
+	if _, err := a.repo.GetCompany(ctx, id); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+	list, err := a.repo.GetCompanyStatusHistory(ctx, id)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	resp := &GetStatusHistoryResponse{Changes: make([]*StatusChange, 0, len(list))}
+	for _, ch := range list {
+		resp.Changes = append(resp.Changes, statusChangeFromStorage(ch))
+	}
+	return resp, nil
+}
+
+func statusChangeFromStorage(ch storage.CompanyStatusChange) *StatusChange {
+	return &StatusChange{
+		FromStatus: CompanyStatus(ch.FromStatus),
+		ToStatus:   CompanyStatus(ch.ToStatus),
+		Reason:     ch.Reason,
+		Username:   ch.Username,
+		CreatedAt:  ch.CreatedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+// sendStatusChangedEvent publishes the status_changed event of the given
+// company.
+func sendStatusChangedEvent(ctx context.Context, item *companyEvent, ch storage.CompanyStatusChange) {
+	b, err := json.Marshal(statusChangedEvent{
+		FromStatus: ch.FromStatus,
+		ToStatus:   ch.ToStatus,
+		Reason:     ch.Reason,
+		Username:   ch.Username,
+		Company:    item,
+	})
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"company_id": ch.CompanyID,
+			"event":      "status_changed",
+		}).Error("unable to marshal data")
+		return
+	}
+	publishEvent(ctx, ch.CompanyID.String(), "status_changed", b)
+}
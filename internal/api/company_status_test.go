@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+func TestCompanyStatus(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+
+	validator := &TestValidator{returnSubject: "user", returnUser: storage.User{ID: 2, Username: "alice"}}
+	api := NewCompanyAPI(validator, storage.NewMemoryRepository(), nil, 0)
+
+	create := func(name string, registered bool) *Company {
+		c := &Company{
+			Id:           uuid.Must(uuid.NewV4()).String(),
+			Name:         name,
+			Employeescnt: 1,
+			Registered:   registered,
+			Type:         CompanyType_Corporations,
+		}
+		_, err := api.Create(ctx, &CreateCompanyRequest{Company: c})
+		assert.NoError(err)
+		return c
+	}
+	getStatus := func(id string) CompanyStatus {
+		resp, err := api.Get(ctx, &GetCompanyRequest{Id: id})
+		assert.NoError(err)
+		return resp.Company.Status
+	}
+
+	t.Run("Initial status", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.Equal(CompanyStatus_Draft, getStatus(create("Draft Co", false).Id))
+		assert.Equal(CompanyStatus_Active, getStatus(create("Active Co", true).Id))
+
+		explicit := &Company{
+			Id:           uuid.Must(uuid.NewV4()).String(),
+			Name:         "Explicit Co",
+			Employeescnt: 1,
+			Type:         CompanyType_Corporations,
+			Status:       CompanyStatus_PendingVerification,
+		}
+		_, err := api.Create(ctx, &CreateCompanyRequest{Company: explicit})
+		assert.NoError(err)
+		assert.Equal(CompanyStatus_PendingVerification, getStatus(explicit.Id))
+
+		// the initial status is recorded
+		history, err := api.GetStatusHistory(ctx, &GetStatusHistoryRequest{Id: explicit.Id})
+		assert.NoError(err)
+		assert.Len(history.Changes, 1)
+		assert.Equal(CompanyStatus_UnknownStatus, history.Changes[0].FromStatus)
+		assert.Equal(CompanyStatus_PendingVerification, history.Changes[0].ToStatus)
+		assert.Equal("alice", history.Changes[0].Username)
+
+		// the other statuses are reached by the transitions only
+		for _, c := range []*Company{
+			{Name: "Dissolved Co", Status: CompanyStatus_Dissolved},
+			{Name: "Suspended Co", Status: CompanyStatus_Suspended, Registered: true},
+			{Name: "Unregistered Co", Status: CompanyStatus_Active},
+		} {
+			c.Id = uuid.Must(uuid.NewV4()).String()
+			c.Employeescnt = 1
+			c.Type = CompanyType_Corporations
+			_, err := api.Create(ctx, &CreateCompanyRequest{Company: c})
+			assert.Equal(codes.InvalidArgument, status.Code(err), c.Name)
+			_, err = api.Get(ctx, &GetCompanyRequest{Id: c.Id})
+			assert.Equal(codes.NotFound, status.Code(err), c.Name)
+		}
+
+		// the updates keep the status
+		c := create("Kept Co", false)
+		c.Status = CompanyStatus_Active
+		_, err = api.Update(ctx, &UpdateCompanyRequest{Company: c})
+		assert.NoError(err)
+		assert.Equal(CompanyStatus_Draft, getStatus(c.Id))
+	})
+
+	t.Run("Transitions", func(t *testing.T) {
+		assert := require.New(t)
+
+		c := create("Lifecycle Co", false)
+		for _, s := range []CompanyStatus{
+			CompanyStatus_PendingVerification,
+			CompanyStatus_Active,
+			CompanyStatus_Suspended,
+			CompanyStatus_Active,
+			CompanyStatus_InLiquidation,
+			CompanyStatus_Dissolved,
+		} {
+			resp, err := api.TransitionCompany(ctx, &TransitionCompanyRequest{Id: c.Id, Status: s, Reason: "step to " + s.String()})
+			assert.NoError(err)
+			assert.Equal(s, resp.Status)
+		}
+
+		// Dissolved is final
+		_, err := api.TransitionCompany(ctx, &TransitionCompanyRequest{Id: c.Id, Status: CompanyStatus_Active, Reason: "revive"})
+		assert.Equal(codes.FailedPrecondition, status.Code(err))
+
+		history, err := api.GetStatusHistory(ctx, &GetStatusHistoryRequest{Id: c.Id})
+		assert.NoError(err)
+		assert.Len(history.Changes, 7)
+		assert.Equal(CompanyStatus_Draft, history.Changes[0].ToStatus)
+		assert.Equal(CompanyStatus_Draft, history.Changes[1].FromStatus)
+		assert.Equal(CompanyStatus_PendingVerification, history.Changes[1].ToStatus)
+		assert.Equal("step to PendingVerification", history.Changes[1].Reason)
+		assert.Equal("alice", history.Changes[1].Username)
+		assert.NotEmpty(history.Changes[1].CreatedAt)
+		assert.Equal(CompanyStatus_Dissolved, history.Changes[6].ToStatus)
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		assert := require.New(t)
+
+		c := create("Invalid Co", false)
+		tests := []struct {
+			req  *TransitionCompanyRequest
+			code codes.Code
+		}{
+			{&TransitionCompanyRequest{Id: c.Id, Status: CompanyStatus_PendingVerification}, codes.InvalidArgument},
+			{&TransitionCompanyRequest{Id: c.Id, Reason: "no status"}, codes.InvalidArgument},
+			{&TransitionCompanyRequest{Id: c.Id, Status: 42, Reason: "bad status"}, codes.InvalidArgument},
+			{&TransitionCompanyRequest{Id: "bad", Status: CompanyStatus_PendingVerification, Reason: "bad id"}, codes.InvalidArgument},
+			{&TransitionCompanyRequest{Id: c.Id, Status: CompanyStatus_Active, Reason: "not verified"}, codes.FailedPrecondition},
+			{&TransitionCompanyRequest{Id: c.Id, Status: CompanyStatus_Draft, Reason: "same status"}, codes.FailedPrecondition},
+			{&TransitionCompanyRequest{Id: uuid.Must(uuid.NewV4()).String(), Status: CompanyStatus_PendingVerification, Reason: "missing"}, codes.NotFound},
+		}
+		for _, tst := range tests {
+			_, err := api.TransitionCompany(ctx, tst.req)
+			assert.Equal(tst.code, status.Code(err), tst.req.Reason)
+		}
+
+		_, err := api.Create(ctx, &CreateCompanyRequest{Company: &Company{
+			Id:           uuid.Must(uuid.NewV4()).String(),
+			Name:         "Bad Status",
+			Employeescnt: 1,
+			Type:         CompanyType_Corporations,
+			Status:       42,
+		}})
+		assert.Equal(codes.InvalidArgument, status.Code(err))
+	})
+}
@@ -11,6 +11,9 @@ import (
 
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 
 	"github.com/fancar/tmp_xm/internal/kafka"
 	"github.com/fancar/tmp_xm/internal/storage"
@@ -40,7 +43,7 @@ func (ts *CompanyAPITestSuite) SetupSuite() {
 	assert.NoError(test.KafkaConsumer(conf))
 
 	validator := &TestValidator{returnSubject: "user"}
-	ts.api = NewCompanyAPI(validator)
+	ts.api = NewCompanyAPI(validator, storage.Repo(), nil, 0)
 }
 
 func (ts *CompanyAPITestSuite) TestCompany() {
@@ -58,6 +61,7 @@ func (ts *CompanyAPITestSuite) TestCompany() {
 			Employeescnt: 1,
 			Registered:   false,
 			Type:         CompanyType(1),
+			Status:       CompanyStatus_Draft,
 		},
 		{
 			Id:           "98a75f8f-beb7-4abe-8971-bac6ab34affa",
@@ -66,6 +70,7 @@ func (ts *CompanyAPITestSuite) TestCompany() {
 			Employeescnt: 99999,
 			Registered:   false,
 			Type:         CompanyType(3),
+			Status:       CompanyStatus_Draft,
 		},
 	}
 
@@ -125,7 +130,7 @@ func (ts *CompanyAPITestSuite) TestCompany() {
 
 			var recieved Company
 			assert.NoError(json.Unmarshal(msg.Value, &recieved))
-			assert.Equal(c, &recieved)
+			assert.True(proto.Equal(c, &recieved), "got %v", &recieved)
 
 		}
 
@@ -164,7 +169,7 @@ func (ts *CompanyAPITestSuite) TestCompany() {
 
 			var recieved Company
 			assert.NoError(json.Unmarshal(msg.Value, &recieved))
-			assert.Equal(c, &recieved)
+			assert.True(proto.Equal(c, &recieved), "got %v", &recieved)
 
 			r := GetCompanyRequest{
 				Id: c.Id,
@@ -172,7 +177,7 @@ func (ts *CompanyAPITestSuite) TestCompany() {
 
 			getResp, err := ts.api.Get(context.Background(), &r)
 			assert.Nil(err)
-			assert.Equal(getResp.Company, c)
+			assert.True(proto.Equal(getResp.Company, c), "got %v", getResp.Company)
 			// fmt.Println("got:", getResp.Company)
 			// fmt.Println("changed:", &c)
 		})
@@ -199,3 +204,56 @@ func (ts *CompanyAPITestSuite) TestCompany() {
 		})
 	})
 }
+
+func TestCompanyAPIInMemory(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+
+	storage.HashIterations = 1
+	repo := storage.NewMemoryRepository()
+	api := NewCompanyAPI(&TestValidator{returnSubject: "user"}, repo, nil, 0)
+
+	c := &Company{
+		Id:           "6235fee7-d12b-4a1b-b35d-c87838b8a4a4",
+		Name:         "test_name_1",
+		Description:  "some description",
+		Employeescnt: 1,
+		Registered:   true,
+		Type:         CompanyType_Corporations,
+	}
+
+	_, err := api.Create(ctx, &CreateCompanyRequest{Company: c})
+	assert.NoError(err)
+
+	_, err = api.Create(ctx, &CreateCompanyRequest{Company: c})
+	assert.Equal(codes.AlreadyExists, status.Code(err))
+
+	// the status of a registered company defaults to Active
+	c.Status = CompanyStatus_Active
+
+	getResp, err := api.Get(ctx, &GetCompanyRequest{Id: c.Id})
+	assert.NoError(err)
+	assert.True(proto.Equal(c, getResp.Company), "got %v", getResp.Company)
+
+	c.Name = "name_changed"
+	c.Type = CompanyType_NonProfit
+	_, err = api.Update(ctx, &UpdateCompanyRequest{Company: c})
+	assert.NoError(err)
+
+	getResp, err = api.Get(ctx, &GetCompanyRequest{Id: c.Id})
+	assert.NoError(err)
+	assert.True(proto.Equal(c, getResp.Company), "got %v", getResp.Company)
+
+	_, err = api.Delete(ctx, &DeleteCompanyRequest{Id: c.Id})
+	assert.NoError(err)
+
+	_, err = api.Get(ctx, &GetCompanyRequest{Id: c.Id})
+	assert.Equal(codes.NotFound, status.Code(err))
+
+	loginResp, err := api.Login(ctx, &LoginRequest{User: "admin", Password: "admin"})
+	assert.NoError(err)
+	assert.NotEmpty(loginResp.Jwt)
+
+	_, err = api.Login(ctx, &LoginRequest{User: "admin", Password: "wrong"})
+	assert.Equal(codes.Unauthenticated, status.Code(err))
+}
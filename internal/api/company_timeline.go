@@ -0,0 +1,257 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/fancar/tmp_xm/internal/api/helpers"
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+const (
+	defaultTimelinePageSize = 50
+	maxTimelinePageSize     = 500
+)
+
+// GetCompanyTimeline returns the notes, the field changes and the status
+// changes of the company merged in one feed sorted by time. The pages are
+// keyed by the last entry returned, so the entries added meanwhile do not
+// shift them.
+func (a *CompanyAPI) GetCompanyTimeline(ctx context.Context, req *GetCompanyTimelineRequest) (*GetCompanyTimelineResponse, error) {
+	log.Debug("api/GetCompanyTimeline request:", req)
+
+	companyID, err := a.validateSubresource(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := a.repo.GetCompany(ctx, companyID); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	size := int(req.PageSize)
+	if size == 0 {
+		size = defaultTimelinePageSize
+	}
+	// one more entry tells if there is a next page
+	q := storage.CompanyTimelineQuery{
+		CompanyID:   companyID,
+		NewestFirst: req.NewestFirst,
+		Limit:       size + 1,
+	}
+	if req.PageToken != "" {
+		// the token is validated by the rules
+		t, id, _ := parseTimelinePageToken(req.PageToken)
+		q.After = &storage.TimelinePosition{CreatedAt: t, ID: id}
+	}
+	entries, err := a.repo.GetCompanyTimeline(ctx, q)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	resp := &GetCompanyTimelineResponse{}
+	if len(entries) > size {
+		entries = entries[:size]
+		last := entries[size-1]
+		resp.NextPageToken = timelinePageToken(last.CreatedAt, last.ID)
+	}
+
+	resp.Entries = make([]*TimelineEntry, 0, len(entries))
+	for _, e := range entries {
+		resp.Entries = append(resp.Entries, timelineEntryFromStorage(e))
+	}
+	return resp, nil
+}
+
+func timelineEntryFromStorage(e storage.CompanyTimelineEntry) *TimelineEntry {
+	out := &TimelineEntry{Time: e.CreatedAt.UTC().Format(time.RFC3339)}
+	switch {
+	case e.Note != nil:
+		out.Kind = TimelineEntryKind_NoteEntry
+		out.Note = noteFromStorage(*e.Note)
+	case e.FieldChange != nil:
+		out.Kind = TimelineEntryKind_FieldChangeEntry
+		out.FieldChange = &FieldChange{
+			Field:     e.FieldChange.Field,
+			OldValue:  e.FieldChange.OldValue,
+			NewValue:  e.FieldChange.NewValue,
+			Username:  e.FieldChange.Username,
+			CreatedAt: e.FieldChange.CreatedAt.UTC().Format(time.RFC3339),
+		}
+	case e.StatusChange != nil:
+		out.Kind = TimelineEntryKind_StatusChangeEntry
+		out.StatusChange = statusChangeFromStorage(*e.StatusChange)
+	}
+	return out
+}
+
+// timelinePageToken returns the token of the page following the entry of
+// the given time and ID.
+func timelinePageToken(t time.Time, id uuid.UUID) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d.%s", t.UnixNano(), id)))
+}
+
+// parseTimelinePageToken returns the time and the ID of the entry of the
+// given page token.
+func parseTimelinePageToken(token string) (time.Time, uuid.UUID, error) {
+	errBadToken := errors.New("bad page token")
+
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return time.Time{}, uuid.Nil, errBadToken
+	}
+	parts := strings.SplitN(string(b), ".", 2)
+	if len(parts) != 2 {
+		return time.Time{}, uuid.Nil, errBadToken
+	}
+	ns, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, uuid.Nil, errBadToken
+	}
+	id, err := uuid.FromString(parts[1])
+	if err != nil {
+		return time.Time{}, uuid.Nil, errBadToken
+	}
+	return time.Unix(0, ns), id, nil
+}
+
+// timelinePageTokenSyntax checks that the string is a page token of the
+// timeline.
+func timelinePageTokenSyntax() check {
+	return func(_ protoreflect.FieldDescriptor, v protoreflect.Value) string {
+		if _, _, err := parseTimelinePageToken(v.String()); err != nil {
+			return "must be the next_page_token of a previous response"
+		}
+		return ""
+	}
+}
+
+// updateCompany updates the company and records the changes of its fields
+// made by the given user. It must be called in a transaction.
+func updateCompany(ctx context.Context, tx storage.Repository, username string, item *storage.Company) error {
+	old, err := tx.GetCompany(ctx, item.ID)
+	if err != nil {
+		return err
+	}
+	if err := tx.UpdateCompany(ctx, item); err != nil {
+		return err
+	}
+	return recordFieldChanges(ctx, tx, username, old, *item)
+}
+
+// recordFieldChanges records the fields changed from old to new by the
+// given user, they are named like in the API. It must be called in a
+// transaction.
+func recordFieldChanges(ctx context.Context, tx storage.Repository, username string, old, new storage.Company) error {
+	var changes []storage.CompanyFieldChange
+	add := func(field, oldValue, newValue string) error {
+		if oldValue == newValue {
+			return nil
+		}
+		id, err := uuid.NewV4()
+		if err != nil {
+			return grpc.Errorf(codes.Internal, "new uuid error: %s", err)
+		}
+		changes = append(changes, storage.CompanyFieldChange{
+			ID:        id,
+			CompanyID: new.ID,
+			Field:     field,
+			OldValue:  oldValue,
+			NewValue:  newValue,
+			Username:  username,
+		})
+		return nil
+	}
+
+	nullUUID := func(id uuid.NullUUID) string {
+		if !id.Valid {
+			return ""
+		}
+		return id.UUID.String()
+	}
+	fields := []struct {
+		name     string
+		old, new string
+	}{
+		{"name", old.Name, new.Name},
+		{"description", old.Description, new.Description},
+		{"employeescnt", strconv.Itoa(int(old.EmployeesCnt)), strconv.Itoa(int(new.EmployeesCnt))},
+		{"registered", strconv.FormatBool(old.Registered), strconv.FormatBool(new.Registered)},
+		{"type", CompanyType(old.Type).String(), CompanyType(new.Type).String()},
+		{"parent_id", nullUUID(old.ParentID), nullUUID(new.ParentID)},
+		{"jurisdiction", old.Jurisdiction, new.Jurisdiction},
+		{"registration_number", old.RegistrationNumber, new.RegistrationNumber},
+		{"vat_id", old.VATID, new.VATID},
+		{"lei", old.LEI, new.LEI},
+	}
+	for _, f := range fields {
+		if err := add(f.name, f.old, f.new); err != nil {
+			return err
+		}
+	}
+
+	names := make(map[string]bool, len(old.Attributes)+len(new.Attributes))
+	for name := range old.Attributes {
+		names[name] = true
+	}
+	for name := range new.Attributes {
+		names[name] = true
+	}
+	for _, name := range sortedKeys(names) {
+		if err := add("attributes."+name, attributeString(old.Attributes[name]), attributeString(new.Attributes[name])); err != nil {
+			return err
+		}
+	}
+	keys := make(map[string]bool, len(old.Labels)+len(new.Labels))
+	for key := range old.Labels {
+		keys[key] = true
+	}
+	for key := range new.Labels {
+		keys[key] = true
+	}
+	for _, key := range sortedKeys(keys) {
+		if err := add("labels."+key, old.Labels[key], new.Labels[key]); err != nil {
+			return err
+		}
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+	return tx.CreateCompanyFieldChanges(ctx, changes)
+}
+
+// sortedKeys returns the keys of the set, sorted.
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// attributeString formats the value of a custom attribute, "" if it is not
+// set.
+func attributeString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+func TestCompanyTimeline(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+
+	validator := &TestValidator{returnSubject: "user", returnUser: storage.User{ID: 2, Username: "alice"}}
+	api := NewCompanyAPI(validator, storage.NewMemoryRepository(), nil, 0)
+
+	company := &Company{
+		Id:           uuid.Must(uuid.NewV4()).String(),
+		Name:         "Timeline",
+		Employeescnt: 1,
+		Type:         CompanyType_Corporations,
+	}
+	_, err := api.Create(ctx, &CreateCompanyRequest{Company: company})
+	assert.NoError(err)
+
+	// a note, the name and the employee count, a status and a label
+	_, err = api.CreateNote(ctx, &CreateNoteRequest{CompanyId: company.Id, Note: &Note{Body: "First call"}})
+	assert.NoError(err)
+	company.Name = "Timeline Co"
+	company.Employeescnt = 20
+	_, err = api.Update(ctx, &UpdateCompanyRequest{Company: company})
+	assert.NoError(err)
+	_, err = api.TransitionCompany(ctx, &TransitionCompanyRequest{Id: company.Id, Status: CompanyStatus_PendingVerification, Reason: "documents received"})
+	assert.NoError(err)
+	_, err = api.AddLabels(ctx, &AddLabelsRequest{CompanyIds: []string{company.Id}, Labels: map[string]string{"tier": "gold"}})
+	assert.NoError(err)
+	// nothing changed
+	_, err = api.Update(ctx, &UpdateCompanyRequest{Company: company})
+	assert.NoError(err)
+
+	t.Run("Entries", func(t *testing.T) {
+		assert := require.New(t)
+
+		resp, err := api.GetCompanyTimeline(ctx, &GetCompanyTimelineRequest{CompanyId: company.Id})
+		assert.NoError(err)
+		assert.Empty(resp.NextPageToken)
+		assert.Len(resp.Entries, 6)
+
+		// the initial status
+		assert.Equal(TimelineEntryKind_StatusChangeEntry, resp.Entries[0].Kind)
+		assert.Equal(CompanyStatus_UnknownStatus, resp.Entries[0].StatusChange.FromStatus)
+		assert.Equal(CompanyStatus_Draft, resp.Entries[0].StatusChange.ToStatus)
+
+		assert.Equal(TimelineEntryKind_NoteEntry, resp.Entries[1].Kind)
+		assert.Equal("First call", resp.Entries[1].Note.Body)
+		assert.Equal(resp.Entries[1].Note.CreatedAt, resp.Entries[1].Time)
+
+		var fields []string
+		for _, e := range resp.Entries[2:4] {
+			assert.Equal(TimelineEntryKind_FieldChangeEntry, e.Kind)
+			assert.Equal("alice", e.FieldChange.Username)
+			fields = append(fields, e.FieldChange.Field)
+		}
+		assert.ElementsMatch([]string{"name", "employeescnt"}, fields)
+
+		assert.Equal(TimelineEntryKind_StatusChangeEntry, resp.Entries[4].Kind)
+		assert.Equal(CompanyStatus_PendingVerification, resp.Entries[4].StatusChange.ToStatus)
+
+		assert.Equal(TimelineEntryKind_FieldChangeEntry, resp.Entries[5].Kind)
+		assert.Equal(&FieldChange{
+			Field:     "labels.tier",
+			NewValue:  "gold",
+			Username:  "alice",
+			CreatedAt: resp.Entries[5].Time,
+		}, resp.Entries[5].FieldChange)
+	})
+
+	t.Run("Pages", func(t *testing.T) {
+		assert := require.New(t)
+
+		all, err := api.GetCompanyTimeline(ctx, &GetCompanyTimelineRequest{CompanyId: company.Id})
+		assert.NoError(err)
+
+		for _, newestFirst := range []bool{false, true} {
+			var entries []*TimelineEntry
+			req := &GetCompanyTimelineRequest{CompanyId: company.Id, PageSize: 2, NewestFirst: newestFirst}
+			for pages := 1; ; pages++ {
+				resp, err := api.GetCompanyTimeline(ctx, req)
+				assert.NoError(err)
+				entries = append(entries, resp.Entries...)
+				if resp.NextPageToken == "" {
+					assert.Equal(3, pages)
+					break
+				}
+				req.PageToken = resp.NextPageToken
+			}
+
+			assert.Len(entries, len(all.Entries))
+			for i, e := range entries {
+				want := all.Entries[i]
+				if newestFirst {
+					want = all.Entries[len(all.Entries)-1-i]
+				}
+				assert.Equal(want, e)
+			}
+		}
+
+		// the pages are kept when the first entries are deleted
+		first, err := api.GetCompanyTimeline(ctx, &GetCompanyTimelineRequest{CompanyId: company.Id, PageSize: 2})
+		assert.NoError(err)
+		_, err = api.DeleteNote(ctx, &DeleteNoteRequest{CompanyId: company.Id, Id: first.Entries[1].Note.Id})
+		assert.NoError(err)
+		resp, err := api.GetCompanyTimeline(ctx, &GetCompanyTimelineRequest{CompanyId: company.Id, PageSize: 1, PageToken: first.NextPageToken})
+		assert.NoError(err)
+		assert.Equal(all.Entries[2], resp.Entries[0])
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := api.GetCompanyTimeline(ctx, &GetCompanyTimelineRequest{CompanyId: company.Id, PageSize: maxTimelinePageSize + 1, PageToken: "bad"})
+		assert.Equal([]string{"page_size", "page_token"}, violatedFields(t, err))
+		_, err = api.GetCompanyTimeline(ctx, &GetCompanyTimelineRequest{CompanyId: company.Id, PageSize: -1})
+		assert.Equal([]string{"page_size"}, violatedFields(t, err))
+		_, err = api.GetCompanyTimeline(ctx, &GetCompanyTimelineRequest{CompanyId: uuid.Must(uuid.NewV4()).String()})
+		assert.Equal(codes.NotFound, status.Code(err))
+	})
+
+	t.Run("Merge", func(t *testing.T) {
+		assert := require.New(t)
+
+		source := &Company{
+			Id:           uuid.Must(uuid.NewV4()).String(),
+			Name:         "Timeline Old",
+			Description:  "Old",
+			Employeescnt: 5,
+			Type:         CompanyType_Corporations,
+		}
+		_, err := api.Create(ctx, &CreateCompanyRequest{Company: source})
+		assert.NoError(err)
+		_, err = api.CreateNote(ctx, &CreateNoteRequest{CompanyId: source.Id, Note: &Note{Body: "Moved"}})
+		assert.NoError(err)
+
+		_, err = api.MergeCompanies(ctx, &MergeCompaniesRequest{
+			SourceId: source.Id,
+			TargetId: company.Id,
+			Fields:   map[string]MergeStrategy{"description": MergeStrategy_TakeSource},
+		})
+		assert.NoError(err)
+
+		resp, err := api.GetCompanyTimeline(ctx, &GetCompanyTimelineRequest{CompanyId: company.Id, NewestFirst: true, PageSize: 2})
+		assert.NoError(err)
+		assert.Equal(TimelineEntryKind_FieldChangeEntry, resp.Entries[0].Kind)
+		assert.Equal("description", resp.Entries[0].FieldChange.Field)
+		assert.Equal("Old", resp.Entries[0].FieldChange.NewValue)
+		assert.Equal(TimelineEntryKind_NoteEntry, resp.Entries[1].Kind)
+		assert.Equal("Moved", resp.Entries[1].Note.Body)
+	})
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/fancar/tmp_xm/internal/kafka"
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+const (
+	healthCheckTimeout  = 2 * time.Second
+	healthCheckInterval = 10 * time.Second
+)
+
+// Health statuses.
+const (
+	HealthStatusOK      = "ok"
+	HealthStatusError   = "error"
+	HealthStatusSkipped = "skipped"
+)
+
+// errCheckSkipped is returned by the checks of the dependencies which are
+// not configured.
+var errCheckSkipped = errors.New("skipped")
+
+// healthCheck defines a readiness check of a single dependency.
+type healthCheck struct {
+	name  string
+	check func(context.Context) error
+}
+
+var readinessChecks = []healthCheck{
+	{name: "database", check: checkSQL(storage.Ping)},
+	{name: "migrations", check: checkSQL(storage.CheckSchemaVersion)},
+	{name: "kafka", check: checkKafka},
+}
+
+// HealthReport is returned by the health endpoints.
+type HealthReport struct {
+	Status string                       `json:"status"`
+	Checks map[string]HealthCheckResult `json:"checks,omitempty"`
+}
+
+// HealthCheckResult holds the result of a single readiness check.
+type HealthCheckResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// checkSQL skips the given check when the SQL database is not in use (e.g.
+// with the in-memory storage).
+func checkSQL(check func(context.Context) error) func(context.Context) error {
+	return func(ctx context.Context) error {
+		if storage.DB() == nil {
+			return errCheckSkipped
+		}
+		return check(ctx)
+	}
+}
+
+func checkKafka(ctx context.Context) error {
+	if !kafka.Enabled() {
+		return errCheckSkipped
+	}
+	return kafka.Ping(ctx)
+}
+
+// runReadinessChecks runs all the readiness checks concurrently.
+func runReadinessChecks(ctx context.Context) HealthReport {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	report := HealthReport{
+		Status: HealthStatusOK,
+		Checks: make(map[string]HealthCheckResult, len(readinessChecks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, hc := range readinessChecks {
+		wg.Add(1)
+		go func(hc healthCheck) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := hc.check(ctx)
+			res := HealthCheckResult{
+				Status:   HealthStatusOK,
+				Duration: time.Since(start).String(),
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			switch {
+			case err == errCheckSkipped:
+				res.Status = HealthStatusSkipped
+			case err != nil:
+				res.Status = HealthStatusError
+				res.Error = err.Error()
+				report.Status = HealthStatusError
+			}
+			report.Checks[hc.name] = res
+		}(hc)
+	}
+	wg.Wait()
+
+	return report
+}
+
+// healthzHandler reports the liveness of the process.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealthReport(w, HealthReport{Status: HealthStatusOK})
+}
+
+// readyzHandler reports the readiness of the service with the details per
+// dependency.
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealthReport(w, runReadinessChecks(r.Context()))
+}
+
+func writeHealthReport(w http.ResponseWriter, report HealthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status != HealthStatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.WithError(err).Error("api/health: encode report error")
+	}
+}
+
+// registerHealthServer registers the standard grpc.health.v1 service and
+// keeps its serving status in sync with the readiness checks until the
+// context is cancelled.
+func registerHealthServer(ctx context.Context, grpcServer *grpc.Server) {
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, hs)
+
+	services := []string{"", "api.CompanyService"}
+	update := func() {
+		status := healthpb.HealthCheckResponse_SERVING
+		report := runReadinessChecks(ctx)
+		if report.Status != HealthStatusOK {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+			log.WithField("checks", report.Checks).Warning("api/health: service is not ready")
+		}
+		for _, s := range services {
+			hs.SetServingStatus(s, status)
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(healthCheckInterval)
+		defer ticker.Stop()
+
+		update()
+		for {
+			select {
+			case <-ctx.Done():
+				hs.Shutdown()
+				return
+			case <-ticker.C:
+				update()
+			}
+		}
+	}()
+}
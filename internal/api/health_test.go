@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthEndpoints(t *testing.T) {
+	checks := readinessChecks
+	defer func() {
+		readinessChecks = checks
+	}()
+
+	ok := func(context.Context) error { return nil }
+	skipped := func(context.Context) error { return errCheckSkipped }
+	failing := func(context.Context) error { return errors.New("connection refused") }
+
+	tests := []struct {
+		Name           string
+		Checks         []healthCheck
+		ExpectedCode   int
+		ExpectedReport HealthReport
+	}{
+		{
+			Name:         "all ok",
+			Checks:       []healthCheck{{"postgresql", ok}, {"kafka", skipped}},
+			ExpectedCode: http.StatusOK,
+			ExpectedReport: HealthReport{
+				Status: HealthStatusOK,
+				Checks: map[string]HealthCheckResult{
+					"postgresql": {Status: HealthStatusOK},
+					"kafka":      {Status: HealthStatusSkipped},
+				},
+			},
+		},
+		{
+			Name:         "dependency down",
+			Checks:       []healthCheck{{"postgresql", failing}, {"migrations", ok}},
+			ExpectedCode: http.StatusServiceUnavailable,
+			ExpectedReport: HealthReport{
+				Status: HealthStatusError,
+				Checks: map[string]HealthCheckResult{
+					"postgresql": {Status: HealthStatusError, Error: "connection refused"},
+					"migrations": {Status: HealthStatusOK},
+				},
+			},
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+			readinessChecks = tst.Checks
+
+			rec := httptest.NewRecorder()
+			readyzHandler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			assert.Equal(tst.ExpectedCode, rec.Code)
+
+			var report HealthReport
+			assert.NoError(json.Unmarshal(rec.Body.Bytes(), &report))
+			for name, res := range report.Checks {
+				assert.NotEmpty(res.Duration)
+				res.Duration = ""
+				report.Checks[name] = res
+			}
+			assert.Equal(tst.ExpectedReport, report)
+		})
+	}
+
+	t.Run("liveness does not depend on the checks", func(t *testing.T) {
+		assert := require.New(t)
+		readinessChecks = []healthCheck{{"postgresql", failing}}
+
+		rec := httptest.NewRecorder()
+		healthzHandler(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		assert.Equal(http.StatusOK, rec.Code)
+		assert.JSONEq(`{"status":"ok"}`, rec.Body.String())
+	})
+}
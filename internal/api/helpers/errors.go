@@ -1,6 +1,7 @@
 package helpers
 
 import (
+	"context"
 	"reflect"
 
 	"github.com/pkg/errors"
@@ -15,6 +16,9 @@ var errToCode = map[error]codes.Code{
 	storage.ErrAlreadyExists:                   codes.AlreadyExists,
 	storage.ErrDoesNotExist:                    codes.NotFound,
 	storage.ErrUsedByOtherObjects:              codes.FailedPrecondition,
+	storage.ErrQueryCanceled:                   codes.DeadlineExceeded,
+	context.DeadlineExceeded:                   codes.DeadlineExceeded,
+	context.Canceled:                           codes.Canceled,
 	storage.ErrApplicationInvalidName:          codes.InvalidArgument,
 	storage.ErrNodeInvalidName:                 codes.InvalidArgument,
 	storage.ErrNodeMaxRXDelay:                  codes.InvalidArgument,
@@ -31,6 +35,10 @@ var errToCode = map[error]codes.Code{
 	storage.ErrOrganizationMaxGatewayCount:     codes.FailedPrecondition,
 	storage.ErrNetworkServerInvalidName:        codes.InvalidArgument,
 	storage.ErrAPIKeyInvalidName:               codes.InvalidArgument,
+	storage.ErrCompanyParentCycle:              codes.InvalidArgument,
+	storage.ErrCompanyStatusChanged:            codes.Aborted,
+	storage.ErrOwnershipExceeded:               codes.FailedPrecondition,
+	storage.ErrChangeRequestDecided:            codes.FailedPrecondition,
 }
 
 // ErrToRPCError converts the given error into a gRPC error.
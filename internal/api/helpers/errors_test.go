@@ -0,0 +1,36 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+func TestErrToRPCError(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Err      error
+		Expected codes.Code
+	}{
+		{"does not exist", storage.ErrDoesNotExist, codes.NotFound},
+		{"wrapped already exists", pkgerrors.Wrap(storage.ErrAlreadyExists, "insert error"), codes.AlreadyExists},
+		{"query canceled", storage.ErrQueryCanceled, codes.DeadlineExceeded},
+		{"deadline exceeded", pkgerrors.Wrap(context.DeadlineExceeded, "select error"), codes.DeadlineExceeded},
+		{"canceled", context.Canceled, codes.Canceled},
+		{"grpc error", status.Error(codes.PermissionDenied, "denied"), codes.PermissionDenied},
+		{"unknown", errors.New("boom"), codes.Unknown},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			require.Equal(t, tst.Expected, status.Code(ErrToRPCError(tst.Err)))
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errorBody is the JSON body of the HTTP errors, of the JSON gateway and of
+// the plain HTTP handlers. The field violations of the BadRequest details
+// are listed in fieldViolations, all the details are in details.
+type errorBody struct {
+	Error           string               `json:"error"`
+	Code            codes.Code           `json:"code"`
+	Status          string               `json:"status"`
+	Message         string               `json:"message"`
+	FieldViolations []fieldViolationBody `json:"fieldViolations"`
+	Details         []json.RawMessage    `json:"details"`
+}
+
+// fieldViolationBody is a field violation of errorBody.
+type fieldViolationBody struct {
+	Field       string `json:"field"`
+	Description string `json:"description"`
+}
+
+// newErrorBody returns the body of the given gRPC error.
+func newErrorBody(err error) errorBody {
+	s := status.Convert(err)
+	body := errorBody{
+		Error:           s.Message(),
+		Code:            s.Code(),
+		Status:          code.Code(s.Code()).String(),
+		Message:         s.Message(),
+		FieldViolations: []fieldViolationBody{},
+		Details:         []json.RawMessage{},
+	}
+
+	for _, d := range s.Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok {
+			for _, fv := range br.FieldViolations {
+				body.FieldViolations = append(body.FieldViolations, fieldViolationBody{
+					Field:       fv.Field,
+					Description: fv.Description,
+				})
+			}
+		}
+	}
+
+	var m jsonpb.Marshaler
+	for _, d := range s.Proto().Details {
+		b, err := m.MarshalToString(d)
+		if err != nil {
+			log.WithError(err).WithField("type", d.TypeUrl).Error("api: marshal error details error")
+			continue
+		}
+		body.Details = append(body.Details, json.RawMessage(b))
+	}
+
+	return body
+}
+
+// writeHTTPError writes the given gRPC error with its HTTP status.
+func writeHTTPError(w http.ResponseWriter, err error) {
+	body := newErrorBody(err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(runtime.HTTPStatusFromCode(body.Code))
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.WithError(err).Error("api: write error body error")
+	}
+}
+
+// httpError is the error handler of the JSON gateway, it forwards the
+// headers of the gRPC response and writes the error as writeHTTPError does.
+func httpError(ctx context.Context, _ *runtime.ServeMux, _ runtime.Marshaler, w http.ResponseWriter, _ *http.Request, err error) {
+	if md, ok := runtime.ServerMetadataFromContext(ctx); ok {
+		for k, vs := range md.HeaderMD {
+			if h, ok := outgoingHeaderMatcher(k); ok {
+				for _, v := range vs {
+					w.Header().Add(h, v)
+				}
+			}
+		}
+	}
+	w.Header().Del("Trailer")
+
+	writeHTTPError(w, err)
+}
@@ -0,0 +1,276 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"github.com/fancar/tmp_xm/internal/api/auth"
+	"github.com/fancar/tmp_xm/internal/api/helpers"
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+const (
+	// idempotencyKeyMetadata is the gRPC metadata key of the idempotency
+	// key, the JSON gateway maps the Idempotency-Key header to it.
+	idempotencyKeyMetadata = "idempotency-key"
+	// idempotencyReplayedMetadata is set in the header of the replayed
+	// responses.
+	idempotencyReplayedMetadata = "idempotency-replayed"
+
+	idempotencyKeyMaxLength = 255
+
+	// idempotencyPurgeInterval defines how often the expired keys are
+	// deleted.
+	idempotencyPurgeInterval = 10 * time.Minute
+)
+
+var errNotProtoMessage = errors.New("not a protobuf message")
+
+// idempotentMethods holds the methods which honour the idempotency keys.
+var idempotentMethods = map[string]bool{
+	"/api.CompanyService/Create": true,
+	"/api.CompanyService/Update": true,
+	"/api.CompanyService/Delete": true,
+}
+
+// idempotencyInterceptor returns an interceptor running the idempotent
+// methods once per idempotency key of the user. The response of a
+// succeeded request and its header are stored for the given TTL and
+// replayed to the retries of the user with the same key and payload, a
+// retry with another payload gets an Aborted error. The failed requests
+// are not stored, they may be retried.
+func idempotencyInterceptor(validator auth.Validator, repo storage.IdempotencyRepository, ttl time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if ttl <= 0 || !idempotentMethods[info.FullMethod] {
+			return handler(ctx, req)
+		}
+
+		key := idempotencyKeyFromContext(ctx)
+		if key == "" {
+			return handler(ctx, req)
+		}
+		if len(key) > idempotencyKeyMaxLength {
+			return nil, grpc.Errorf(codes.InvalidArgument, "the idempotency key must be at most %d characters long", idempotencyKeyMaxLength)
+		}
+
+		// the stored responses are only replayed to authenticated users
+		if err := validator.Validate(ctx, auth.ValidateActiveUser()); err != nil {
+			return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+		}
+		user, err := validator.GetUser(ctx)
+		if err != nil {
+			return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+		}
+
+		hash, err := requestHash(info.FullMethod, req)
+		if err != nil {
+			return nil, grpc.Errorf(codes.Internal, "hash request error: %s", err)
+		}
+
+		k := storage.IdempotencyKey{
+			Username:    user.Username,
+			Key:         key,
+			ExpiresAt:   time.Now().Add(ttl),
+			Method:      info.FullMethod,
+			RequestHash: hash,
+		}
+		err = repo.CreateIdempotencyKey(ctx, &k)
+		if err == storage.ErrAlreadyExists {
+			return replayResponse(ctx, repo, k)
+		}
+		if err != nil {
+			return nil, helpers.ErrToRPCError(err)
+		}
+
+		stream := &headerRecordingStream{ServerTransportStream: grpc.ServerTransportStreamFromContext(ctx)}
+		resp, err := handler(grpc.NewContextWithServerTransportStream(ctx, stream), req)
+		if err != nil {
+			// the caller may be gone, don't leave the key in progress
+			delCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if dErr := repo.DeleteIdempotencyKey(delCtx, k.Username, key); dErr != nil {
+				log.WithError(dErr).WithField("idempotency_key", key).Error("api: delete idempotency key error")
+			}
+			return nil, err
+		}
+
+		k.Response, err = marshalResponse(resp)
+		if err == nil {
+			k.ResponseHeader, err = json.Marshal(stream.header)
+		}
+		if err == nil {
+			err = repo.CompleteIdempotencyKey(ctx, &k)
+		}
+		if err != nil {
+			// the request succeeded, a retry will get the conflict error
+			// until the key expires
+			log.WithError(err).WithField("idempotency_key", key).Error("api: store idempotent response error")
+		}
+		return resp, nil
+	}
+}
+
+// replayResponse returns the stored response of the given key with its
+// header, or an Aborted error if the stored request differs or is in
+// progress.
+func replayResponse(ctx context.Context, repo storage.IdempotencyRepository, k storage.IdempotencyKey) (interface{}, error) {
+	stored, err := repo.GetIdempotencyKey(ctx, k.Username, k.Key)
+	if err == storage.ErrDoesNotExist {
+		// the first request failed or expired meanwhile
+		return nil, grpc.Errorf(codes.Aborted, "the request with the same idempotency key was not completed, retry it")
+	}
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	if stored.Method != k.Method || stored.RequestHash != k.RequestHash {
+		return nil, grpc.Errorf(codes.Aborted, "the idempotency key was used by a different request")
+	}
+	if !stored.Completed {
+		return nil, grpc.Errorf(codes.Aborted, "the request with the same idempotency key is in progress")
+	}
+
+	var a anypb.Any
+	if err := proto.Unmarshal(stored.Response, &a); err != nil {
+		return nil, grpc.Errorf(codes.Internal, "unmarshal stored response error: %s", err)
+	}
+	resp, err := a.UnmarshalNew()
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, "unmarshal stored response error: %s", err)
+	}
+
+	// e.g. the change-request-id of a change waiting for an approval
+	var header metadata.MD
+	if len(stored.ResponseHeader) != 0 {
+		if err := json.Unmarshal(stored.ResponseHeader, &header); err != nil {
+			return nil, grpc.Errorf(codes.Internal, "unmarshal stored response header error: %s", err)
+		}
+	}
+	header = metadata.Join(header, metadata.Pairs(idempotencyReplayedMetadata, "true"))
+	if err := grpc.SetHeader(ctx, header); err != nil {
+		log.WithError(err).Debug("api: set idempotency header error")
+	}
+	log.WithFields(log.Fields{
+		"idempotency_key": k.Key,
+		"username":        k.Username,
+		"method":          k.Method,
+	}).Info("api: idempotent response replayed")
+	return resp, nil
+}
+
+// headerRecordingStream records the header metadata set by a handler, so
+// that it can be stored with the response. The calls are passed to the
+// wrapped stream, if any.
+type headerRecordingStream struct {
+	grpc.ServerTransportStream
+	header metadata.MD
+}
+
+// SetHeader records the metadata and sets it in the wrapped stream.
+func (s *headerRecordingStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	if s.ServerTransportStream == nil {
+		return nil
+	}
+	return s.ServerTransportStream.SetHeader(md)
+}
+
+// SendHeader records the metadata and sends it with the wrapped stream.
+func (s *headerRecordingStream) SendHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	if s.ServerTransportStream == nil {
+		return nil
+	}
+	return s.ServerTransportStream.SendHeader(md)
+}
+
+// SetTrailer sets the trailer in the wrapped stream, it is not recorded.
+func (s *headerRecordingStream) SetTrailer(md metadata.MD) error {
+	if s.ServerTransportStream == nil {
+		return nil
+	}
+	return s.ServerTransportStream.SetTrailer(md)
+}
+
+// Method returns the method of the wrapped stream.
+func (s *headerRecordingStream) Method() string {
+	if s.ServerTransportStream == nil {
+		return ""
+	}
+	return s.ServerTransportStream.Method()
+}
+
+// idempotencyKeyFromContext returns the idempotency key of the incoming
+// request, if any.
+func idempotencyKeyFromContext(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if v := md.Get(idempotencyKeyMetadata); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// requestHash returns the hex encoded SHA-256 hash of the method and the
+// request.
+func requestHash(method string, req interface{}) (string, error) {
+	m, ok := req.(proto.Message)
+	if !ok {
+		return "", errNotProtoMessage
+	}
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write(b)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// marshalResponse marshals the response with its type, so that it can be
+// unmarshaled without knowing it.
+func marshalResponse(resp interface{}) ([]byte, error) {
+	m, ok := resp.(proto.Message)
+	if !ok {
+		return nil, errNotProtoMessage
+	}
+	a, err := anypb.New(m)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(a)
+}
+
+// purgeIdempotencyKeys deletes the expired idempotency keys until the
+// context is canceled.
+func purgeIdempotencyKeys(ctx context.Context, repo storage.IdempotencyRepository) {
+	ticker := time.NewTicker(idempotencyPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := repo.DeleteExpiredIdempotencyKeys(ctx); err != nil {
+				log.WithError(err).Error("api: delete expired idempotency keys error")
+			}
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package api
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+func TestIdempotencyInterceptor(t *testing.T) {
+	repo := storage.NewMemoryRepository()
+	validator := &TestValidator{returnSubject: "user", returnUser: storage.User{ID: 2, Username: "alice"}}
+	interceptor := idempotencyInterceptor(validator, repo, time.Hour)
+	info := &grpc.UnaryServerInfo{FullMethod: "/api.CompanyService/Delete"}
+
+	calls := 0
+	var handlerErr error
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		calls++
+		if handlerErr != nil {
+			return nil, handlerErr
+		}
+		return &empty.Empty{}, nil
+	}
+	withKey := func(key string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs(idempotencyKeyMetadata, key))
+	}
+	req := &DeleteCompanyRequest{Id: "6235fee7-d12b-4a1b-b35d-c87838b8a4a1"}
+
+	t.Run("replay", func(t *testing.T) {
+		assert := require.New(t)
+		calls = 0
+
+		resp, err := interceptor(withKey("key-1"), req, info, handler)
+		assert.NoError(err)
+		assert.IsType(&empty.Empty{}, resp)
+
+		// an identical retry gets the stored response
+		resp, err = interceptor(withKey("key-1"), &DeleteCompanyRequest{Id: req.Id}, info, handler)
+		assert.NoError(err)
+		assert.IsType(&empty.Empty{}, resp)
+		assert.Equal(1, calls)
+
+		// a different payload with the same key is a conflict
+		_, err = interceptor(withKey("key-1"), &DeleteCompanyRequest{Id: "other"}, info, handler)
+		assert.Equal(codes.Aborted, status.Code(err))
+		_, err = interceptor(withKey("key-1"), req, &grpc.UnaryServerInfo{FullMethod: "/api.CompanyService/Update"}, handler)
+		assert.Equal(codes.Aborted, status.Code(err))
+		assert.Equal(1, calls)
+	})
+
+	t.Run("failed request", func(t *testing.T) {
+		assert := require.New(t)
+		calls = 0
+
+		// the failed requests are not stored and may be retried
+		handlerErr = grpc.Errorf(codes.Unavailable, "unavailable")
+		_, err := interceptor(withKey("key-2"), req, info, handler)
+		assert.Equal(codes.Unavailable, status.Code(err))
+
+		handlerErr = nil
+		_, err = interceptor(withKey("key-2"), req, info, handler)
+		assert.NoError(err)
+		assert.Equal(2, calls)
+	})
+
+	t.Run("in progress", func(t *testing.T) {
+		assert := require.New(t)
+
+		hash, err := requestHash(info.FullMethod, req)
+		assert.NoError(err)
+		assert.NoError(repo.CreateIdempotencyKey(context.Background(), &storage.IdempotencyKey{
+			Username:    "alice",
+			Key:         "key-3",
+			ExpiresAt:   time.Now().Add(time.Hour),
+			Method:      info.FullMethod,
+			RequestHash: hash,
+		}))
+
+		_, err = interceptor(withKey("key-3"), req, info, handler)
+		assert.Equal(codes.Aborted, status.Code(err))
+		assert.Contains(err.Error(), "in progress")
+	})
+
+	t.Run("users", func(t *testing.T) {
+		assert := require.New(t)
+		calls = 0
+
+		_, err := interceptor(withKey("key-5"), req, info, handler)
+		assert.NoError(err)
+
+		// the same key of another user is another request
+		validator.returnUser = storage.User{ID: 3, Username: "bob"}
+		defer func() { validator.returnUser = storage.User{ID: 2, Username: "alice"} }()
+		_, err = interceptor(withKey("key-5"), &DeleteCompanyRequest{Id: "other"}, info, handler)
+		assert.NoError(err)
+		assert.Equal(2, calls)
+	})
+
+	t.Run("header", func(t *testing.T) {
+		assert := require.New(t)
+		calls = 0
+
+		// e.g. a change waiting for an approval
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			calls++
+			if err := grpc.SetHeader(ctx, metadata.Pairs(changeRequestIDMetadata, "cr-1")); err != nil {
+				return nil, err
+			}
+			return &empty.Empty{}, nil
+		}
+		withStream := func(key string) (context.Context, *testServerTransportStream) {
+			s := &testServerTransportStream{}
+			return grpc.NewContextWithServerTransportStream(withKey(key), s), s
+		}
+
+		ctx, stream := withStream("key-6")
+		_, err := interceptor(ctx, req, info, handler)
+		assert.NoError(err)
+		assert.Equal([]string{"cr-1"}, stream.header.Get(changeRequestIDMetadata))
+
+		ctx, stream = withStream("key-6")
+		_, err = interceptor(ctx, req, info, handler)
+		assert.NoError(err)
+		assert.Equal(1, calls)
+		assert.Equal([]string{"cr-1"}, stream.header.Get(changeRequestIDMetadata))
+		assert.Equal([]string{"true"}, stream.header.Get(idempotencyReplayedMetadata))
+	})
+
+	t.Run("without key", func(t *testing.T) {
+		assert := require.New(t)
+		calls = 0
+
+		for i := 0; i < 2; i++ {
+			_, err := interceptor(context.Background(), req, info, handler)
+			assert.NoError(err)
+		}
+		_, err := interceptor(withKey("key-4"), req, &grpc.UnaryServerInfo{FullMethod: "/api.CompanyService/Get"}, handler)
+		assert.NoError(err)
+		_, err = interceptor(withKey("key-4"), req, &grpc.UnaryServerInfo{FullMethod: "/api.CompanyService/Get"}, handler)
+		assert.NoError(err)
+		assert.Equal(4, calls)
+
+		_, err = interceptor(withKey(strings.Repeat("k", 256)), req, info, handler)
+		assert.Equal(codes.InvalidArgument, status.Code(err))
+	})
+}
+
+// testServerTransportStream records the header set by the handlers.
+type testServerTransportStream struct {
+	header metadata.MD
+}
+
+func (s *testServerTransportStream) Method() string { return "" }
+
+func (s *testServerTransportStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *testServerTransportStream) SendHeader(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+func (s *testServerTransportStream) SetTrailer(md metadata.MD) error { return nil }
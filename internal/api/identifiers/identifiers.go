@@ -0,0 +1,144 @@
+// Package identifiers validates the identifiers of the companies: the
+// registration numbers and the VAT IDs by the rules of their country, and
+// the Legal Entity Identifiers.
+package identifiers
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Kind defines the kind of the identifiers validated per country.
+type Kind int
+
+// Identifier kinds.
+const (
+	RegistrationNumber Kind = iota
+	VATID
+)
+
+func (k Kind) String() string {
+	return [...]string{"RegistrationNumber", "VATID"}[k]
+}
+
+// Validator validates a normalized identifier, the returned error explains
+// the rule which is broken.
+type Validator func(value string) error
+
+// Registry holds the validators per kind and country. The countries are
+// ISO 3166-1 alpha-2 codes, except for the VAT IDs which are keyed by their
+// prefix (EL for Greece).
+type Registry struct {
+	mu         sync.RWMutex
+	validators map[Kind]map[string]Validator
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{validators: make(map[Kind]map[string]Validator)}
+}
+
+// Register sets the validator of the given kind and country, it replaces
+// the registered one.
+func (r *Registry) Register(kind Kind, country string, v Validator) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.validators[kind] == nil {
+		r.validators[kind] = make(map[string]Validator)
+	}
+	r.validators[kind][strings.ToUpper(country)] = v
+}
+
+// Lookup returns the validator of the given kind and country.
+func (r *Registry) Lookup(kind Kind, country string) (Validator, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	v, ok := r.validators[kind][strings.ToUpper(country)]
+	return v, ok
+}
+
+// defaultRegistry holds the built-in validators, see Register.
+var defaultRegistry = NewRegistry()
+
+// Register sets the validator of the given kind and country in the default
+// registry, it replaces the built-in one.
+func Register(kind Kind, country string, v Validator) {
+	defaultRegistry.Register(kind, country, v)
+}
+
+var (
+	separators            = strings.NewReplacer(" ", "", "-", "", ".", "", "/", "")
+	registrationNumberRe  = regexp.MustCompile(`^[0-9A-Z]+$`)
+	vatIDRe               = regexp.MustCompile(`^[A-Z]{2}[0-9A-Z+*]{2,13}$`)
+	leiRe                 = regexp.MustCompile(`^[0-9A-Z]{18}[0-9]{2}$`)
+	registrationMaxLength = 50
+)
+
+// NormalizeVATID returns the given VAT ID in upper case without the spaces,
+// hyphens, dots and slashes.
+func NormalizeVATID(id string) string {
+	return strings.ToUpper(separators.Replace(strings.TrimSpace(id)))
+}
+
+// NormalizeLEI returns the given LEI in upper case without the spaces.
+func NormalizeLEI(lei string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(lei), ""))
+}
+
+// ValidateRegistrationNumber validates the given normalized registration
+// number by the rules of the given country, the numbers of the countries
+// without rules must only be made of letters and digits.
+func ValidateRegistrationNumber(country, number string) error {
+	if v, ok := defaultRegistry.Lookup(RegistrationNumber, country); ok {
+		return v(number)
+	}
+	if len(number) > registrationMaxLength || !registrationNumberRe.MatchString(number) {
+		return fmt.Errorf("must be at most %d letters and digits", registrationMaxLength)
+	}
+	return nil
+}
+
+// ValidateVATID validates the given normalized VAT ID by the rules of the
+// country of its prefix, the IDs of the countries without rules are only
+// checked for the prefix and the length.
+func ValidateVATID(id string) error {
+	if !vatIDRe.MatchString(id) {
+		return fmt.Errorf("must be a country prefix followed by 2 to 13 letters and digits")
+	}
+	if v, ok := defaultRegistry.Lookup(VATID, id[:2]); ok {
+		return v(id[2:])
+	}
+	return nil
+}
+
+// ValidateLEI validates the given normalized Legal Entity Identifier: 18
+// letters and digits followed by 2 check digits (ISO 17442).
+func ValidateLEI(lei string) error {
+	if !leiRe.MatchString(lei) {
+		return fmt.Errorf("must be 18 letters and digits followed by 2 check digits")
+	}
+	if mod97(lei) != 1 {
+		return fmt.Errorf("invalid check digits")
+	}
+	return nil
+}
+
+// mod97 returns the remainder of the division by 97 of the number made of
+// the given digits and letters, the letters being 10 (A) to 35 (Z), as ISO
+// 7064 MOD 97-10 does.
+func mod97(s string) int {
+	r := 0
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			r = (r*10 + int(c-'0')) % 97
+		case c >= 'A' && c <= 'Z':
+			r = (r*100 + int(c-'A') + 10) % 97
+		}
+	}
+	return r
+}
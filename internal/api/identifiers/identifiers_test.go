@@ -0,0 +1,141 @@
+package identifiers
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateLEI(t *testing.T) {
+	tests := []struct {
+		lei   string
+		valid bool
+	}{
+		{"213800D1EI4B9WTWWD28", true},
+		{"5493001KJTIIGC8Y1R12", true},
+		{"213800D1EI4B9WTWWD29", false},
+		{"213800D1EI4B9WTWWD2", false},
+		{"213800D1EI4B9WTWWDX8", false},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.lei, func(t *testing.T) {
+			require.Equal(t, tst.valid, ValidateLEI(tst.lei) == nil)
+		})
+	}
+
+	require.Equal(t, "213800D1EI4B9WTWWD28", NormalizeLEI(" 2138 00d1ei4b9wtwwd28 "))
+}
+
+func TestValidateVATID(t *testing.T) {
+	tests := []struct {
+		id    string
+		valid bool
+	}{
+		{"ATU13585627", true},
+		{"ATU13585628", false},
+		{"BE0403019261", true},
+		{"BE0403019262", false},
+		{"BE2403019261", false},
+		{"CY10259033P", true},
+		{"CY10259033Q", false},
+		{"CY12000000A", false},
+		{"DE136695976", true},
+		{"DE136695977", false},
+		{"DE13669597", false},
+		{"DK13585628", true},
+		{"DK13585629", false},
+		{"EL094259216", true},
+		{"EL094259217", false},
+		{"ESA13585625", true},
+		{"ESA13585626", false},
+		{"ES54362315K", true},
+		{"ES54362315Z", false},
+		{"ESX1234567L", true},
+		{"FI20774740", true},
+		{"FI20774741", false},
+		{"FR40303265045", true},
+		{"FR41303265045", false},
+		{"FRK7399859412", true},
+		{"HR33392005961", true},
+		{"HR33392005962", false},
+		{"HU12892312", true},
+		{"HU12892313", false},
+		{"IE6388047V", true},
+		{"IT00743110157", true},
+		{"IT00743110158", false},
+		{"LU15027442", true},
+		{"LU15027443", false},
+		{"NL004495445B01", true},
+		{"NL004495446B01", false},
+		{"PL8567346215", true},
+		{"PL8567346216", false},
+		{"PT501964843", true},
+		{"PT501964844", false},
+		{"SE123456789701", true},
+		{"SE123456789801", false},
+		{"SI50223054", true},
+		{"SI50223055", false},
+		{"SK2022749619", true},
+		{"SK2022749618", false},
+		// format only
+		{"BG175074752", true},
+		{"BG17507475", false},
+		// no rules for the country
+		{"CHE123456789", true},
+		{"1234567", false},
+		{"DE", false},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.id, func(t *testing.T) {
+			require.Equal(t, tst.valid, ValidateVATID(tst.id) == nil)
+		})
+	}
+
+	require.Equal(t, "DE136695976", NormalizeVATID(" de 136.695-976"))
+}
+
+func TestValidateRegistrationNumber(t *testing.T) {
+	tests := []struct {
+		country string
+		number  string
+		valid   bool
+	}{
+		{"CY", "HE123456", true},
+		{"CY", "HE1", true},
+		{"CY", "HE1234567", false},
+		{"CY", "123456", false},
+		{"GB", "01234567", true},
+		{"GB", "SC123456", true},
+		{"GB", "S1234567", false},
+		{"US", "ABC123", true},
+		{"US", "ABC_123", false},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.country+" "+tst.number, func(t *testing.T) {
+			require.Equal(t, tst.valid, ValidateRegistrationNumber(tst.country, tst.number) == nil)
+		})
+	}
+
+	require.Equal(t, "HE123456", NormalizeRegistrationNumber("ηε 123456"))
+	require.Equal(t, "HE123456", NormalizeRegistrationNumber(" he-123 456"))
+}
+
+func TestRegistry(t *testing.T) {
+	assert := require.New(t)
+
+	r := NewRegistry()
+	_, ok := r.Lookup(VATID, "DE")
+	assert.False(ok)
+
+	r.Register(VATID, "de", func(string) error { return fmt.Errorf("rejected") })
+	v, ok := r.Lookup(VATID, "DE")
+	assert.True(ok)
+	assert.EqualError(v("136695976"), "rejected")
+
+	_, ok = r.Lookup(RegistrationNumber, "DE")
+	assert.False(ok)
+}
@@ -0,0 +1,37 @@
+package identifiers
+
+import (
+	"regexp"
+	"strings"
+)
+
+// registrationRules holds the rules of the registration numbers by country.
+var registrationRules = map[string]rule{
+	// the companies of the Cyprus Registrar of Companies: HE (limited
+	// companies) followed by the number
+	"CY": {regexp.MustCompile(`^HE[0-9]{1,6}$`), "HE followed by up to 6 digits", nil},
+	// the Companies House numbers: 8 digits, or a 2 letters prefix (SC,
+	// NI, OC...) followed by 6 digits
+	"GB": {regexp.MustCompile(`^([0-9]{8}|[A-Z]{2}[0-9]{6})$`), "8 digits, or 2 letters followed by 6 digits", nil},
+}
+
+func init() {
+	for country, r := range registrationRules {
+		Register(RegistrationNumber, country, r.validator())
+	}
+}
+
+// greekHE is the Greek spelling of the HE prefix of the Cyprus
+// registration numbers.
+const greekHE = "ΗΕ"
+
+// NormalizeRegistrationNumber returns the given number in upper case
+// without the spaces, hyphens, dots and slashes, the Greek HE prefix is
+// spelled in Latin letters.
+func NormalizeRegistrationNumber(number string) string {
+	number = strings.ToUpper(separators.Replace(strings.TrimSpace(number)))
+	if strings.HasPrefix(number, greekHE) {
+		number = "HE" + strings.TrimPrefix(number, greekHE)
+	}
+	return number
+}
@@ -0,0 +1,248 @@
+package identifiers
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// rule is a format and an optional check of the digits.
+type rule struct {
+	format      *regexp.Regexp
+	description string
+	check       func(string) bool
+}
+
+// validator returns the validator of the rule.
+func (r rule) validator() Validator {
+	return func(value string) error {
+		if !r.format.MatchString(value) {
+			return fmt.Errorf("must be %s", r.description)
+		}
+		if r.check != nil && !r.check(value) {
+			return fmt.Errorf("invalid check digits")
+		}
+		return nil
+	}
+}
+
+// vatRules holds the rules of the VAT IDs of the EU member states (and of
+// Northern Ireland) by prefix, the prefix is not part of the checked value.
+// The check digits are verified for the major member states, the format
+// only for the others.
+var vatRules = map[string]rule{
+	"AT": {regexp.MustCompile(`^U[0-9]{8}$`), "U followed by 8 digits", checkAT},
+	"BE": {regexp.MustCompile(`^[01][0-9]{9}$`), "10 digits starting with 0 or 1", checkBE},
+	"BG": {regexp.MustCompile(`^[0-9]{9,10}$`), "9 or 10 digits", nil},
+	"CY": {regexp.MustCompile(`^[0-9]{8}[A-Z]$`), "8 digits followed by a check letter", checkCY},
+	"CZ": {regexp.MustCompile(`^[0-9]{8,10}$`), "8 to 10 digits", nil},
+	"DE": {regexp.MustCompile(`^[0-9]{9}$`), "9 digits", checkMod1110},
+	"DK": {regexp.MustCompile(`^[0-9]{8}$`), "8 digits", checkDK},
+	"EE": {regexp.MustCompile(`^[0-9]{9}$`), "9 digits", nil},
+	"EL": {regexp.MustCompile(`^[0-9]{9}$`), "9 digits", checkEL},
+	"ES": {regexp.MustCompile(`^[0-9A-Z][0-9]{7}[0-9A-Z]$`), "9 characters, digits with a letter first or last", checkES},
+	"FI": {regexp.MustCompile(`^[0-9]{8}$`), "8 digits", checkFI},
+	"FR": {regexp.MustCompile(`^[0-9A-Z]{2}[0-9]{9}$`), "2 key characters followed by the 9 digits of the SIREN", checkFR},
+	"HR": {regexp.MustCompile(`^[0-9]{11}$`), "11 digits", checkMod1110},
+	"HU": {regexp.MustCompile(`^[0-9]{8}$`), "8 digits", checkHU},
+	"IE": {regexp.MustCompile(`^[0-9][0-9A-Z+*][0-9]{5}[A-Z]{1,2}$`), "7 characters followed by 1 or 2 letters", nil},
+	"IT": {regexp.MustCompile(`^[0-9]{11}$`), "11 digits", luhn},
+	"LT": {regexp.MustCompile(`^([0-9]{9}|[0-9]{12})$`), "9 or 12 digits", nil},
+	"LU": {regexp.MustCompile(`^[0-9]{8}$`), "8 digits", checkLU},
+	"LV": {regexp.MustCompile(`^[0-9]{11}$`), "11 digits", nil},
+	"MT": {regexp.MustCompile(`^[0-9]{8}$`), "8 digits", nil},
+	"NL": {regexp.MustCompile(`^[0-9]{9}B[0-9]{2}$`), "9 digits, B and 2 digits", checkNL},
+	"PL": {regexp.MustCompile(`^[0-9]{10}$`), "10 digits", checkPL},
+	"PT": {regexp.MustCompile(`^[0-9]{9}$`), "9 digits", checkPT},
+	"RO": {regexp.MustCompile(`^[0-9]{2,10}$`), "2 to 10 digits", nil},
+	"SE": {regexp.MustCompile(`^[0-9]{10}01$`), "10 digits followed by 01", checkSE},
+	"SI": {regexp.MustCompile(`^[0-9]{8}$`), "8 digits", checkSI},
+	"SK": {regexp.MustCompile(`^[0-9]{10}$`), "10 digits", checkSK},
+	"XI": {regexp.MustCompile(`^([0-9]{9}|[0-9]{12}|(GD|HA)[0-9]{3})$`), "9 or 12 digits, or GD or HA followed by 3 digits", nil},
+}
+
+func init() {
+	for prefix, r := range vatRules {
+		Register(VATID, prefix, r.validator())
+	}
+}
+
+// digit returns the value of the i-th digit of s.
+func digit(s string, i int) int {
+	return int(s[i] - '0')
+}
+
+// weightedSum returns the sum of the first digits of s multiplied by the
+// given weights.
+func weightedSum(s string, weights ...int) int {
+	sum := 0
+	for i, w := range weights {
+		sum += digit(s, i) * w
+	}
+	return sum
+}
+
+// luhn verifies the Luhn check digit, the last digit of s.
+func luhn(s string) bool {
+	sum := 0
+	for i := len(s) - 1; i >= 0; i-- {
+		d := digit(s, i)
+		if (len(s)-i)%2 == 0 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// checkMod1110 verifies the ISO 7064 MOD 11,10 check digit, the last digit
+// of s.
+func checkMod1110(s string) bool {
+	product := 10
+	for i := 0; i < len(s)-1; i++ {
+		sum := (digit(s, i) + product) % 10
+		if sum == 0 {
+			sum = 10
+		}
+		product = (2 * sum) % 11
+	}
+	return (11-product)%10 == digit(s, len(s)-1)
+}
+
+func checkAT(s string) bool {
+	sum := 0
+	for i := 1; i < 8; i++ {
+		d := digit(s, i)
+		if i%2 == 0 {
+			d *= 2
+			d = d/10 + d%10
+		}
+		sum += d
+	}
+	return (10-(sum+4)%10)%10 == digit(s, 8)
+}
+
+func checkBE(s string) bool {
+	n, _ := strconv.Atoi(s[:8])
+	check, _ := strconv.Atoi(s[8:])
+	return 97-n%97 == check
+}
+
+func checkCY(s string) bool {
+	if s[:2] == "12" {
+		return false
+	}
+	odd := [...]int{1, 0, 5, 7, 9, 13, 15, 17, 19, 21}
+	sum := 0
+	for i := 0; i < 8; i++ {
+		if i%2 == 0 {
+			sum += odd[digit(s, i)]
+		} else {
+			sum += digit(s, i)
+		}
+	}
+	return byte('A'+sum%26) == s[8]
+}
+
+func checkDK(s string) bool {
+	return weightedSum(s, 2, 7, 6, 5, 4, 3, 2, 1)%11 == 0
+}
+
+func checkEL(s string) bool {
+	return weightedSum(s, 256, 128, 64, 32, 16, 8, 4, 2)%11%10 == digit(s, 8)
+}
+
+// checkES verifies the check character of the NIF (DNI and NIE) of the
+// persons and of the CIF of the legal entities.
+func checkES(s string) bool {
+	const dniLetters = "TRWAGMYFPDXBNJZSQVHLCKE"
+	switch {
+	case s[0] >= '0' && s[0] <= '9':
+		n, err := strconv.Atoi(s[:8])
+		return err == nil && dniLetters[n%23] == s[8]
+	case s[0] == 'X' || s[0] == 'Y' || s[0] == 'Z':
+		n, err := strconv.Atoi(string('0'+s[0]-'X') + s[1:8])
+		return err == nil && dniLetters[n%23] == s[8]
+	}
+
+	sum := 0
+	for i := 1; i < 8; i++ {
+		d := digit(s, i)
+		if i%2 == 1 {
+			d *= 2
+			d = d/10 + d%10
+		}
+		sum += d
+	}
+	c := (10 - sum%10) % 10
+	return s[8] == byte('0'+c) || s[8] == "JABCDEFGHI"[c]
+}
+
+func checkFI(s string) bool {
+	c := 11 - weightedSum(s, 7, 9, 10, 5, 8, 4, 2)%11
+	if c == 11 {
+		c = 0
+	}
+	return c != 10 && c == digit(s, 7)
+}
+
+// checkFR verifies the numeric key of the VAT ID, the alphanumeric keys are
+// not checked.
+func checkFR(s string) bool {
+	key, err := strconv.Atoi(s[:2])
+	if err != nil {
+		return true
+	}
+	siren, _ := strconv.Atoi(s[2:])
+	return key == (12+3*(siren%97))%97
+}
+
+func checkHU(s string) bool {
+	return (10-weightedSum(s, 9, 7, 3, 1, 9, 7, 3)%10)%10 == digit(s, 7)
+}
+
+func checkLU(s string) bool {
+	n, _ := strconv.Atoi(s[:6])
+	check, _ := strconv.Atoi(s[6:])
+	return n%89 == check
+}
+
+// checkNL verifies the check digit of the legal entities or the MOD 97-10
+// check of the sole proprietors.
+func checkNL(s string) bool {
+	sum := weightedSum(s, 9, 8, 7, 6, 5, 4, 3, 2)
+	return sum%11 == digit(s, 8) || mod97("NL"+s) == 1
+}
+
+func checkPL(s string) bool {
+	c := weightedSum(s, 6, 5, 7, 2, 3, 4, 5, 6, 7) % 11
+	return c != 10 && c == digit(s, 9)
+}
+
+func checkPT(s string) bool {
+	c := 11 - weightedSum(s, 9, 8, 7, 6, 5, 4, 3, 2)%11
+	if c > 9 {
+		c = 0
+	}
+	return c == digit(s, 8)
+}
+
+func checkSE(s string) bool {
+	return luhn(s[:10])
+}
+
+func checkSI(s string) bool {
+	c := 11 - weightedSum(s, 8, 7, 6, 5, 4, 3, 2)%11
+	if c == 10 {
+		c = 0
+	}
+	return c != 11 && c == digit(s, 7)
+}
+
+func checkSK(s string) bool {
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n%11 == 0
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/ptypes/empty"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/fancar/tmp_xm/internal/api/auth"
+	"github.com/fancar/tmp_xm/internal/api/helpers"
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+// CreatePerson creates the given natural person.
+func (a *CompanyAPI) CreatePerson(ctx context.Context, req *CreatePersonRequest) (*Person, error) {
+	log.Debug("api/CreatePerson request:", req)
+
+	if err := a.validator.Validate(ctx, auth.ValidateActiveUser()); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	item := convertPerson(req.Person)
+	var err error
+	item.ID, err = uuid.NewV4()
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, "new uuid error: %s", err)
+	}
+
+	if err := a.repo.CreatePerson(ctx, item); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+	return personFromStorage(*item), nil
+}
+
+// GetPerson returns the person for the given ID.
+func (a *CompanyAPI) GetPerson(ctx context.Context, req *GetPersonRequest) (*Person, error) {
+	log.Debug("api/GetPerson request:", req)
+
+	if err := a.validator.Validate(ctx, auth.ValidateActiveUser()); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+	id := uuid.FromStringOrNil(req.Id)
+
+	item, err := a.repo.GetPerson(ctx, id)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+	return personFromStorage(item), nil
+}
+
+// UpdatePerson updates the given person.
+func (a *CompanyAPI) UpdatePerson(ctx context.Context, req *UpdatePersonRequest) (*Person, error) {
+	log.Debug("api/UpdatePerson request:", req)
+
+	if err := a.validator.Validate(ctx, auth.ValidateActiveUser()); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	item := convertPerson(req.Person)
+	item.ID = uuid.FromStringOrNil(req.Person.Id)
+
+	if err := a.repo.UpdatePerson(ctx, item); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+	return personFromStorage(*item), nil
+}
+
+// DeletePerson deletes the person for the given ID.
+func (a *CompanyAPI) DeletePerson(ctx context.Context, req *DeletePersonRequest) (*empty.Empty, error) {
+	log.Debug("api/DeletePerson request:", req)
+
+	if err := a.validator.Validate(ctx, auth.ValidateActiveUser()); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+	id := uuid.FromStringOrNil(req.Id)
+
+	if err := a.repo.DeletePerson(ctx, id); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+	return &empty.Empty{}, nil
+}
+
+// convertPerson converts the given validated person, without its ID.
+func convertPerson(in *Person) *storage.Person {
+	return &storage.Person{
+		Name:    in.Name,
+		Country: strings.ToUpper(strings.TrimSpace(in.Country)),
+	}
+}
+
+func personFromStorage(p storage.Person) *Person {
+	return &Person{
+		Id:      p.ID.String(),
+		Name:    p.Name,
+		Country: p.Country,
+	}
+}
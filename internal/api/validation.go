@@ -0,0 +1,319 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofrs/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// fieldViolations collects the invalid fields of a request, invalidArgument
+// returns them in the BadRequest details of the error.
+type fieldViolations []*errdetails.BadRequest_FieldViolation
+
+// add records the violation of the given field.
+func (v *fieldViolations) add(field, format string, args ...interface{}) {
+	*v = append(*v, &errdetails.BadRequest_FieldViolation{
+		Field:       field,
+		Description: fmt.Sprintf(format, args...),
+	})
+}
+
+// err returns the violations as an error, nil if there is none.
+func (v fieldViolations) err() error {
+	if len(v) == 0 {
+		return nil
+	}
+	return v
+}
+
+func (v fieldViolations) Error() string {
+	msgs := make([]string, 0, len(v))
+	for _, fv := range v {
+		msgs = append(msgs, fmt.Sprintf("'%s' %s", fv.Field, fv.Description))
+	}
+	return strings.Join(msgs, ", ")
+}
+
+// prefixed returns the given validation error with the fields of its
+// violations prefixed, the other errors as is.
+func prefixed(prefix string, err error) error {
+	v, ok := err.(fieldViolations)
+	if !ok {
+		return err
+	}
+	out := make(fieldViolations, 0, len(v))
+	for _, fv := range v {
+		out.add(prefix+fv.Field, "%s", fv.Description)
+	}
+	return out
+}
+
+// invalidArgument returns the InvalidArgument error of the given validation
+// error, prefixed by msg, with the field violations in its details. The gRPC
+// errors, e.g. of the storage, are returned as is.
+func invalidArgument(msg string, err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	v, ok := err.(fieldViolations)
+	if !ok {
+		return grpc.Errorf(codes.InvalidArgument, "%s: %s", msg, err)
+	}
+
+	s, sErr := status.New(codes.InvalidArgument, fmt.Sprintf("%s: %s", msg, v)).
+		WithDetails(&errdetails.BadRequest{FieldViolations: v})
+	if sErr != nil {
+		return grpc.Errorf(codes.Internal, "status details error: %s", sErr)
+	}
+	return s.Err()
+}
+
+// check validates the value of a set field, it returns the description of
+// the violation, "" if the value is valid.
+type check func(fd protoreflect.FieldDescriptor, v protoreflect.Value) string
+
+// messageCheck validates the fields of a message together, the fields of
+// the violations are relative to the message.
+type messageCheck func(m proto.Message, v *fieldViolations)
+
+// fieldRule holds the checks of a field. Its path may go through nested
+// messages (e.g. "address.id"), the rule is skipped when one of them is not
+// set.
+type fieldRule struct {
+	path     string
+	required bool
+	checks   []check
+}
+
+// required returns the rule of a field which must be set (not empty, not
+// zero) and pass the given checks.
+func required(path string, checks ...check) fieldRule {
+	return fieldRule{path: path, required: true, checks: checks}
+}
+
+// optional returns the rule of a field which must pass the given checks
+// when it is set.
+func optional(path string, checks ...check) fieldRule {
+	return fieldRule{path: path, checks: checks}
+}
+
+// messageRules holds the rules of a message.
+type messageRules struct {
+	fields []fieldRule
+	checks []messageCheck
+}
+
+// validationRules holds the rules of the messages by name, see
+// validation_rules.go.
+var validationRules = make(map[protoreflect.FullName]messageRules)
+
+// declare sets the rules of the given message. It panics on the paths which
+// are not fields of the message.
+func declare(m proto.Message, fields []fieldRule, checks ...messageCheck) {
+	md := m.ProtoReflect().Descriptor()
+	for _, r := range fields {
+		if _, err := fieldDescriptor(md, r.path); err != nil {
+			panic(fmt.Sprintf("api: rule of %s: %s", md.FullName(), err))
+		}
+	}
+	validationRules[md.FullName()] = messageRules{fields: fields, checks: checks}
+}
+
+// fieldDescriptor returns the descriptor of the field at the given path.
+func fieldDescriptor(md protoreflect.MessageDescriptor, path string) (protoreflect.FieldDescriptor, error) {
+	names := strings.Split(path, ".")
+	for i, name := range names {
+		fd := md.Fields().ByName(protoreflect.Name(name))
+		if fd == nil {
+			return nil, fmt.Errorf("unknown field %s", path)
+		}
+		if i == len(names)-1 {
+			return fd, nil
+		}
+		if fd.Message() == nil || fd.IsList() || fd.IsMap() {
+			return nil, fmt.Errorf("%s is not a message", name)
+		}
+		md = fd.Message()
+	}
+	return nil, fmt.Errorf("empty path")
+}
+
+// validate validates the given request by the declared rules, all the
+// violations are returned in an InvalidArgument error.
+func validate(req proto.Message) error {
+	var v fieldViolations
+	validateMessage(req.ProtoReflect(), "", &v)
+	if len(v) == 0 {
+		return nil
+	}
+	return invalidArgument("invalid request", v)
+}
+
+// validateMessage adds the violations of the given message and of its
+// nested messages, their fields prefixed by prefix. The items of the lists
+// are not validated, the handlers validate them one by one (e.g. the
+// batches).
+func validateMessage(m protoreflect.Message, prefix string, v *fieldViolations) {
+	if !m.IsValid() {
+		return
+	}
+
+	rules := validationRules[m.Descriptor().FullName()]
+	for _, r := range rules.fields {
+		parent, fd, ok := lookupField(m, r.path)
+		if !ok {
+			continue
+		}
+		if !parent.Has(fd) {
+			if r.required {
+				v.add(prefix+r.path, "is required")
+			}
+			continue
+		}
+		for _, c := range r.checks {
+			if desc := c(fd, parent.Get(fd)); desc != "" {
+				v.add(prefix+r.path, "%s", desc)
+				break
+			}
+		}
+	}
+
+	for _, c := range rules.checks {
+		var cv fieldViolations
+		c(m.Interface(), &cv)
+		for _, fv := range cv {
+			v.add(prefix+fv.Field, "%s", fv.Description)
+		}
+	}
+
+	fields := m.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if fd.Message() != nil && !fd.IsList() && !fd.IsMap() && m.Has(fd) {
+			validateMessage(m.Get(fd).Message(), prefix+string(fd.Name())+".", v)
+		}
+	}
+}
+
+// lookupField returns the field at the given path and the message holding
+// it, false if one of the nested messages of the path is not set.
+func lookupField(m protoreflect.Message, path string) (protoreflect.Message, protoreflect.FieldDescriptor, bool) {
+	names := strings.Split(path, ".")
+	for _, name := range names[:len(names)-1] {
+		fd := m.Descriptor().Fields().ByName(protoreflect.Name(name))
+		if !m.Has(fd) {
+			return nil, nil, false
+		}
+		m = m.Get(fd).Message()
+	}
+	return m, m.Descriptor().Fields().ByName(protoreflect.Name(names[len(names)-1])), true
+}
+
+// maxLength checks that the string is at most max characters long.
+func maxLength(max int) check {
+	return func(_ protoreflect.FieldDescriptor, v protoreflect.Value) string {
+		if utf8.RuneCountInString(v.String()) > max {
+			return fmt.Sprintf("must be at most %d characters long", max)
+		}
+		return ""
+	}
+}
+
+// isUUID checks that the string is a UUID.
+func isUUID() check {
+	return func(_ protoreflect.FieldDescriptor, v protoreflect.Value) string {
+		if _, err := uuid.FromString(v.String()); err != nil {
+			return "must be a UUID"
+		}
+		return ""
+	}
+}
+
+// uuidItems checks that the items of the list are distinct UUIDs.
+func uuidItems() check {
+	return func(_ protoreflect.FieldDescriptor, v protoreflect.Value) string {
+		list := v.List()
+		seen := make(map[uuid.UUID]bool, list.Len())
+		for i := 0; i < list.Len(); i++ {
+			id, err := uuid.FromString(list.Get(i).String())
+			if err != nil {
+				return fmt.Sprintf("item %d must be a UUID", i)
+			}
+			if seen[id] {
+				return fmt.Sprintf("item %d is a duplicate", i)
+			}
+			seen[id] = true
+		}
+		return ""
+	}
+}
+
+// definedEnum checks that the enum value is defined.
+func definedEnum() check {
+	return func(fd protoreflect.FieldDescriptor, v protoreflect.Value) string {
+		if fd.Enum().Values().ByNumber(v.Enum()) == nil {
+			return fmt.Sprintf("unknown %s %d", fd.Enum().Name(), v.Enum())
+		}
+		return ""
+	}
+}
+
+// between checks that the number is in [min, max].
+func between(min, max float64) check {
+	return func(fd protoreflect.FieldDescriptor, v protoreflect.Value) string {
+		var n float64
+		switch fd.Kind() {
+		case protoreflect.FloatKind, protoreflect.DoubleKind:
+			n = v.Float()
+		case protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+			n = float64(v.Uint())
+		default:
+			n = float64(v.Int())
+		}
+		// NaN is not in the range
+		if !(n >= min && n <= max) {
+			return fmt.Sprintf("must be between %v and %v", min, max)
+		}
+		return ""
+	}
+}
+
+// maxItems checks that the list has at most max items.
+func maxItems(max int) check {
+	return func(_ protoreflect.FieldDescriptor, v protoreflect.Value) string {
+		if v.List().Len() > max {
+			return fmt.Sprintf("must have at most %d items", max)
+		}
+		return ""
+	}
+}
+
+// country checks that the string is an ISO 3166-1 alpha-2 country code, in
+// any case.
+func country() check {
+	return func(_ protoreflect.FieldDescriptor, v protoreflect.Value) string {
+		if !isoCountries[strings.ToUpper(strings.TrimSpace(v.String()))] {
+			return "must be an ISO 3166-1 alpha-2 country code"
+		}
+		return ""
+	}
+}
+
+// date checks that the string is a date in the YYYY-MM-DD format.
+func date() check {
+	return func(_ protoreflect.FieldDescriptor, v protoreflect.Value) string {
+		if _, err := time.Parse(dateLayout, v.String()); err != nil {
+			return "must be in the YYYY-MM-DD format"
+		}
+		return ""
+	}
+}
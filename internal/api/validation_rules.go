@@ -0,0 +1,315 @@
+package api
+
+import "math"
+
+// The rules of the request messages and of their nested messages, the
+// handlers validate the requests with validate before using them.
+func init() {
+	// the lengths are the sizes of the storage columns
+	declare(&Company{}, []fieldRule{
+		required("id", isUUID()),
+		required("name", maxLength(15)),
+		optional("description", maxLength(3000)),
+		required("employeescnt", between(1, math.MaxInt32)),
+		required("type", definedEnum()),
+		optional("status", definedEnum()),
+		optional("parent_id", isUUID()),
+		optional("jurisdiction", country()),
+		optional("vat_id", vatID()),
+		optional("lei", lei()),
+		optional("labels", labelMap()),
+	}, checkRegistrationNumber)
+
+	declare(&Address{}, []fieldRule{
+		required("type", definedEnum()),
+		required("country", country()),
+		optional("region", maxLength(100)),
+		required("city", maxLength(100)),
+		optional("postal_code", maxLength(20)),
+		required("line1", maxLength(200)),
+		optional("line2", maxLength(200)),
+	})
+
+	declare(&Contact{}, []fieldRule{
+		required("name", maxLength(100)),
+		optional("role", maxLength(100)),
+		optional("email", email()),
+		optional("phone", phone()),
+	})
+
+	declare(&Note{}, []fieldRule{
+		required("body", maxLength(10000)),
+	})
+
+	declare(&Person{}, []fieldRule{
+		required("name", maxLength(100)),
+		optional("country", country()),
+	})
+
+	declare(&Ownership{}, []fieldRule{
+		optional("owner_company_id", isUUID()),
+		optional("owner_person_id", isUUID()),
+		required("percentage", percentage()),
+		required("valid_from", date()),
+		optional("valid_to", date()),
+	}, checkOwnership)
+
+	declare(&LoginRequest{}, []fieldRule{
+		required("user"),
+		required("password"),
+	})
+
+	declare(&GetCompanyRequest{}, []fieldRule{
+		required("id", isUUID()),
+	})
+	declare(&CreateCompanyRequest{}, []fieldRule{
+		required("Company"),
+	})
+	declare(&UpdateCompanyRequest{}, []fieldRule{
+		required("Company"),
+	})
+	declare(&DeleteCompanyRequest{}, []fieldRule{
+		required("id", isUUID()),
+		optional("children", definedEnum()),
+	})
+
+	// the companies of the rows are validated one by one
+	declare(&ImportCompaniesRequest{}, []fieldRule{
+		optional("mode", definedEnum()),
+		optional("batch_size", between(0, maxImportBatchSize)),
+	})
+	declare(&ExportCompaniesRequest{}, []fieldRule{
+		optional("type", definedEnum()),
+		optional("attributes", attributeFilterSyntax()),
+		optional("label_selector", maxLength(labelSelectorMaxLength), labelSelectorSyntax()),
+	})
+
+	// the items are validated one by one
+	declare(&BatchCreateCompaniesRequest{}, []fieldRule{
+		required("companies", maxItems(maxBatchSize)),
+	})
+	declare(&BatchUpdateCompaniesRequest{}, []fieldRule{
+		required("companies", maxItems(maxBatchSize)),
+	})
+	declare(&BatchDeleteCompaniesRequest{}, []fieldRule{
+		required("ids", maxItems(maxBatchSize)),
+		optional("children", definedEnum()),
+	})
+
+	declare(&SearchCompaniesRequest{}, []fieldRule{
+		required("query", maxLength(maxSearchQueryChars)),
+		optional("limit", between(0, maxSearchLimit)),
+		optional("type", definedEnum()),
+		optional("attributes", attributeFilterSyntax()),
+		optional("label_selector", maxLength(labelSelectorMaxLength), labelSelectorSyntax()),
+	})
+	declare(&FindDuplicatesRequest{}, []fieldRule{
+		optional("limit", between(0, maxDuplicatesLimit)),
+	})
+	declare(&MergeCompaniesRequest{}, []fieldRule{
+		required("source_id", isUUID()),
+		required("target_id", isUUID()),
+	}, checkMergeIDs)
+
+	declare(&CreateAddressRequest{}, []fieldRule{
+		required("company_id", isUUID()),
+		required("address"),
+	})
+	declare(&GetAddressRequest{}, []fieldRule{
+		required("company_id", isUUID()),
+		required("id", isUUID()),
+	})
+	declare(&UpdateAddressRequest{}, []fieldRule{
+		required("company_id", isUUID()),
+		required("address"),
+		required("address.id", isUUID()),
+	})
+	declare(&DeleteAddressRequest{}, []fieldRule{
+		required("company_id", isUUID()),
+		required("id", isUUID()),
+	})
+	declare(&ListAddressesRequest{}, []fieldRule{
+		required("company_id", isUUID()),
+	})
+
+	declare(&CreateContactRequest{}, []fieldRule{
+		required("company_id", isUUID()),
+		required("contact"),
+	})
+	declare(&GetContactRequest{}, []fieldRule{
+		required("company_id", isUUID()),
+		required("id", isUUID()),
+	})
+	declare(&UpdateContactRequest{}, []fieldRule{
+		required("company_id", isUUID()),
+		required("contact"),
+		required("contact.id", isUUID()),
+	})
+	declare(&DeleteContactRequest{}, []fieldRule{
+		required("company_id", isUUID()),
+		required("id", isUUID()),
+	})
+	declare(&ListContactsRequest{}, []fieldRule{
+		required("company_id", isUUID()),
+	})
+
+	declare(&AttachmentInfo{}, []fieldRule{
+		required("company_id", isUUID()),
+		required("filename", maxLength(255), attachmentFilename()),
+		optional("sha256", sha256Hex()),
+	})
+	declare(&UploadAttachmentRequest{}, []fieldRule{
+		required("info"),
+	})
+	declare(&DownloadAttachmentRequest{}, []fieldRule{
+		required("company_id", isUUID()),
+		required("id", isUUID()),
+	})
+	declare(&GetAttachmentRequest{}, []fieldRule{
+		required("company_id", isUUID()),
+		required("id", isUUID()),
+	})
+	declare(&ListAttachmentsRequest{}, []fieldRule{
+		required("company_id", isUUID()),
+	})
+	declare(&DeleteAttachmentRequest{}, []fieldRule{
+		required("company_id", isUUID()),
+		required("id", isUUID()),
+	})
+
+	declare(&CreateNoteRequest{}, []fieldRule{
+		required("company_id", isUUID()),
+		required("note"),
+	})
+	declare(&GetNoteRequest{}, []fieldRule{
+		required("company_id", isUUID()),
+		required("id", isUUID()),
+	})
+	declare(&UpdateNoteRequest{}, []fieldRule{
+		required("company_id", isUUID()),
+		required("note"),
+		required("note.id", isUUID()),
+	})
+	declare(&DeleteNoteRequest{}, []fieldRule{
+		required("company_id", isUUID()),
+		required("id", isUUID()),
+	})
+	declare(&ListNotesRequest{}, []fieldRule{
+		required("company_id", isUUID()),
+	})
+	declare(&GetNoteHistoryRequest{}, []fieldRule{
+		required("company_id", isUUID()),
+		required("id", isUUID()),
+	})
+	declare(&GetCompanyTimelineRequest{}, []fieldRule{
+		required("company_id", isUUID()),
+		optional("page_size", between(1, maxTimelinePageSize)),
+		optional("page_token", timelinePageTokenSyntax()),
+	})
+
+	declare(&GetAncestorsRequest{}, []fieldRule{
+		required("id", isUUID()),
+	})
+	declare(&GetDescendantsRequest{}, []fieldRule{
+		required("id", isUUID()),
+	})
+	declare(&GetGroupTreeRequest{}, []fieldRule{
+		required("id", isUUID()),
+	})
+
+	declare(&CreatePersonRequest{}, []fieldRule{
+		required("person"),
+	})
+	declare(&GetPersonRequest{}, []fieldRule{
+		required("id", isUUID()),
+	})
+	declare(&UpdatePersonRequest{}, []fieldRule{
+		required("person"),
+		required("person.id", isUUID()),
+	})
+	declare(&DeletePersonRequest{}, []fieldRule{
+		required("id", isUUID()),
+	})
+
+	declare(&CreateOwnershipRequest{}, []fieldRule{
+		required("company_id", isUUID()),
+		required("ownership"),
+	}, checkSelfOwnership)
+	declare(&GetOwnershipRequest{}, []fieldRule{
+		required("company_id", isUUID()),
+		required("id", isUUID()),
+	})
+	declare(&UpdateOwnershipRequest{}, []fieldRule{
+		required("company_id", isUUID()),
+		required("ownership"),
+		required("ownership.id", isUUID()),
+	}, checkSelfOwnership)
+	declare(&DeleteOwnershipRequest{}, []fieldRule{
+		required("company_id", isUUID()),
+		required("id", isUUID()),
+	})
+	declare(&ListOwnershipsRequest{}, []fieldRule{
+		required("company_id", isUUID()),
+	})
+	declare(&GetUltimateBeneficialOwnersRequest{}, []fieldRule{
+		required("company_id", isUUID()),
+		optional("threshold", between(0, 100)),
+		optional("date", date()),
+	})
+
+	declare(&TransitionCompanyRequest{}, []fieldRule{
+		required("id", isUUID()),
+		required("status", definedEnum()),
+		required("reason", maxLength(statusReasonMaxLength)),
+	})
+	declare(&GetStatusHistoryRequest{}, []fieldRule{
+		required("id", isUUID()),
+	})
+
+	declare(&ListChangeRequestsRequest{}, []fieldRule{
+		optional("status", definedEnum()),
+		optional("company_id", isUUID()),
+	})
+	declare(&GetChangeRequestRequest{}, []fieldRule{
+		required("id", isUUID()),
+	})
+	declare(&DecideChangeRequestRequest{}, []fieldRule{
+		required("id", isUUID()),
+		optional("comment", maxLength(changeCommentMaxLength)),
+	})
+
+	declare(&AttributeDefinition{}, []fieldRule{
+		required("company_type", definedEnum()),
+		required("name", attributeName()),
+		required("kind", definedEnum()),
+		optional("enum_values", maxItems(maxAttributeEnumValues)),
+		optional("description", maxLength(500)),
+	}, checkEnumValues)
+	declare(&CreateAttributeDefinitionRequest{}, []fieldRule{
+		required("definition"),
+	})
+	declare(&ListAttributeDefinitionsRequest{}, []fieldRule{
+		optional("company_type", definedEnum()),
+	})
+	declare(&UpdateAttributeDefinitionRequest{}, []fieldRule{
+		required("definition"),
+	})
+	declare(&DeleteAttributeDefinitionRequest{}, []fieldRule{
+		required("company_type", definedEnum()),
+		required("name", attributeName()),
+	})
+
+	declare(&AddLabelsRequest{}, []fieldRule{
+		required("company_ids", maxItems(maxBatchSize), uuidItems()),
+		required("labels", labelMap()),
+	})
+	declare(&RemoveLabelsRequest{}, []fieldRule{
+		required("company_ids", maxItems(maxBatchSize), uuidItems()),
+		required("keys", maxItems(maxCompanyLabels), labelKey()),
+	})
+	declare(&CountCompaniesByLabelRequest{}, []fieldRule{
+		optional("key", labelKey()),
+		optional("label_selector", maxLength(labelSelectorMaxLength), labelSelectorSyntax()),
+		optional("type", definedEnum()),
+	})
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/fancar/tmp_xm/internal/storage"
+)
+
+// violatedFields returns the fields of the BadRequest violations of the
+// given error.
+func violatedFields(t *testing.T, err error) []string {
+	s := status.Convert(err)
+	require.Equal(t, codes.InvalidArgument, s.Code(), s.Message())
+	require.Len(t, s.Details(), 1)
+	br, ok := s.Details()[0].(*errdetails.BadRequest)
+	require.True(t, ok)
+
+	var fields []string
+	for _, fv := range br.FieldViolations {
+		fields = append(fields, fv.Field)
+	}
+	return fields
+}
+
+func TestValidate(t *testing.T) {
+	id := uuid.Must(uuid.NewV4()).String()
+	company := &Company{
+		Id:           id,
+		Name:         "Acme",
+		Employeescnt: 10,
+		Type:         CompanyType_Corporations,
+	}
+
+	tests := []struct {
+		name   string
+		req    proto.Message
+		fields []string
+	}{
+		{"valid company", &CreateCompanyRequest{Company: company}, nil},
+		{"no company", &CreateCompanyRequest{}, []string{"Company"}},
+		{
+			"invalid company",
+			&UpdateCompanyRequest{Company: &Company{
+				Id:           "bad",
+				Name:         strings.Repeat("n", 16),
+				Description:  strings.Repeat("d", 3001),
+				Employeescnt: -1,
+				Type:         42,
+				ParentId:     "bad",
+			}},
+			[]string{"Company.id", "Company.name", "Company.description", "Company.employeescnt", "Company.type", "Company.parent_id"},
+		},
+		{"empty company", &UpdateCompanyRequest{Company: &Company{}},
+			[]string{"Company.id", "Company.name", "Company.employeescnt", "Company.type"}},
+		{"max lengths", &CreateCompanyRequest{Company: &Company{
+			Id:           id,
+			Name:         strings.Repeat("é", 15),
+			Description:  strings.Repeat("é", 3000),
+			Employeescnt: 1,
+			Type:         CompanyType_NonProfit,
+		}}, nil},
+		{"address", &UpdateAddressRequest{CompanyId: id, Address: &Address{Type: AddressType_RegisteredAddress, Country: "xx"}},
+			[]string{"address.id", "address.country", "address.city", "address.line1"}},
+		{"no address", &UpdateAddressRequest{CompanyId: "bad"}, []string{"company_id", "address"}},
+		{"contact", &CreateContactRequest{CompanyId: id, Contact: &Contact{Name: "Jo", Email: "jo", Phone: "123"}},
+			[]string{"contact.email", "contact.phone"}},
+		{"self ownership", &CreateOwnershipRequest{CompanyId: id, Ownership: &Ownership{
+			OwnerCompanyId: strings.ToUpper(id),
+			Percentage:     100.5,
+			ValidFrom:      "2020-01-01",
+			ValidTo:        "2019-01-01",
+		}}, []string{"ownership.owner_company_id", "ownership.percentage", "ownership.valid_to"}},
+		{"no owner", &UpdateOwnershipRequest{CompanyId: id, Ownership: &Ownership{Id: id, Percentage: 50, ValidFrom: "2020-1-1"}},
+			[]string{"ownership.valid_from", "ownership.owner_company_id"}},
+		{"threshold", &GetUltimateBeneficialOwnersRequest{CompanyId: id, Threshold: math.NaN(), Date: "now"},
+			[]string{"threshold", "date"}},
+		{"merge", &MergeCompaniesRequest{SourceId: id, TargetId: id}, []string{"target_id"}},
+		{"search", &SearchCompaniesRequest{Query: strings.Repeat("q", maxSearchQueryChars+1), Limit: -1},
+			[]string{"query", "limit"}},
+		{"batch", &BatchDeleteCompaniesRequest{Ids: make([]string, maxBatchSize+1)}, []string{"ids"}},
+		{"transition", &TransitionCompanyRequest{Id: id, Status: 42}, []string{"status", "reason"}},
+		{"no rules", &GetCompanyRequest{Id: id}, nil},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			err := validate(tst.req)
+			if tst.fields == nil {
+				require.NoError(t, err)
+				return
+			}
+			require.Equal(t, tst.fields, violatedFields(t, err))
+		})
+	}
+}
+
+func TestValidateCompanyRequests(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+
+	api := NewCompanyAPI(&TestValidator{returnSubject: "user"}, storage.NewMemoryRepository(), nil, 0)
+
+	// the length limits of the storage are reported with the other
+	// violations
+	_, err := api.Create(ctx, &CreateCompanyRequest{Company: &Company{
+		Id:          uuid.Must(uuid.NewV4()).String(),
+		Name:        "a name longer than 15 characters",
+		Description: strings.Repeat("d", 3001),
+		Type:        CompanyType_Corporations,
+	}})
+	assert.Equal([]string{"Company.name", "Company.description", "Company.employeescnt"}, violatedFields(t, err))
+
+	// the items of the batches are validated one by one
+	resp, err := api.BatchCreate(ctx, &BatchCreateCompaniesRequest{Companies: []*Company{nil, {Id: "bad"}}})
+	assert.NoError(err)
+	assert.Equal(int32(codes.InvalidArgument), resp.Statuses[0].Code)
+	assert.Equal(int32(codes.InvalidArgument), resp.Statuses[1].Code)
+	assert.Len(resp.Statuses[1].Details, 1)
+}
+
+func TestHTTPError(t *testing.T) {
+	assert := require.New(t)
+
+	var v fieldViolations
+	v.add("Company.name", "is required")
+	v.add("Company.type", "unknown CompanyType %d", 42)
+
+	ctx := runtime.NewServerMetadataContext(context.Background(), runtime.ServerMetadata{
+		HeaderMD: metadata.Pairs(changeRequestIDMetadata, "id"),
+	})
+	w := httptest.NewRecorder()
+	httpError(ctx, nil, nil, w, nil, invalidArgument("invalid request", v))
+
+	assert.Equal(http.StatusBadRequest, w.Code)
+	assert.Equal("application/json", w.Header().Get("Content-Type"))
+	assert.Equal("id", w.Header().Get("Change-Request-Id"))
+
+	var body map[string]interface{}
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(float64(codes.InvalidArgument), body["code"])
+	assert.Equal("INVALID_ARGUMENT", body["status"])
+	assert.Equal("invalid request: 'Company.name' is required, 'Company.type' unknown CompanyType 42", body["message"])
+	assert.Equal([]interface{}{
+		map[string]interface{}{"field": "Company.name", "description": "is required"},
+		map[string]interface{}{"field": "Company.type", "description": "unknown CompanyType 42"},
+	}, body["fieldViolations"])
+	details := body["details"].([]interface{})
+	assert.Len(details, 1)
+	assert.Equal("type.googleapis.com/google.rpc.BadRequest", details[0].(map[string]interface{})["@type"])
+
+	// the errors without details have the same body
+	w = httptest.NewRecorder()
+	writeHTTPError(w, status.Error(codes.NotFound, "object does not exist"))
+	assert.Equal(http.StatusNotFound, w.Code)
+	assert.JSONEq(`{"error": "object does not exist", "code": 5, "status": "NOT_FOUND", "message": "object does not exist",
+		"fieldViolations": [], "details": []}`, w.Body.String())
+}
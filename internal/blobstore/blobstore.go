@@ -0,0 +1,74 @@
+// Package blobstore keeps the contents of the files attached to the
+// companies, on the local filesystem or in an S3 compatible object store.
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/fancar/tmp_xm/internal/config"
+)
+
+// Backends.
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+// ErrNotFound is returned when the blob does not exist.
+var ErrNotFound = errors.New("blob does not exist")
+
+// Store keeps the blobs by key. The keys are slash separated paths, e.g.
+// attachments/<id>.
+type Store interface {
+	// Put stores the content read from r under the given key, replacing
+	// the existing blob. Nothing is stored when reading r fails.
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Get returns the content of the given blob, ErrNotFound if it does
+	// not exist. The caller must close it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete deletes the given blob, it is not an error if it does not
+	// exist.
+	Delete(ctx context.Context, key string) error
+}
+
+// New returns the store of the configured backend.
+func New(conf config.Config) (Store, error) {
+	c := conf.BlobStore
+	switch c.Backend {
+	case BackendLocal, "":
+		if c.Dir == "" {
+			return nil, fmt.Errorf("blob_store.dir must be set")
+		}
+		return NewLocal(c.Dir), nil
+	case BackendS3:
+		return NewS3(S3Config{
+			Endpoint:        c.S3.Endpoint,
+			Region:          c.S3.Region,
+			Bucket:          c.S3.Bucket,
+			Prefix:          c.S3.Prefix,
+			AccessKeyID:     c.S3.AccessKeyID,
+			SecretAccessKey: c.S3.SecretAccessKey,
+			PathStyle:       c.S3.PathStyle,
+		})
+	default:
+		return nil, fmt.Errorf("unknown blob store backend: %s", c.Backend)
+	}
+}
+
+// validateKey rejects the keys which could escape the directory of the
+// local store or which are not portable.
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.HasSuffix(key, "/") {
+		return fmt.Errorf("invalid blob key: %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." || strings.ContainsAny(part, "\\\x00") {
+			return fmt.Errorf("invalid blob key: %q", key)
+		}
+	}
+	return nil
+}
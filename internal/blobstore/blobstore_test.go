@@ -0,0 +1,242 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testStore runs the tests every store must pass.
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	t.Run("PutGetDelete", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(s.Put(ctx, "attachments/a", strings.NewReader("first")))
+		assert.NoError(s.Put(ctx, "attachments/a", strings.NewReader("second")))
+		assert.Equal("second", get(t, s, "attachments/a"))
+
+		assert.NoError(s.Delete(ctx, "attachments/a"))
+		_, err := s.Get(ctx, "attachments/a")
+		assert.Equal(ErrNotFound, err)
+		assert.NoError(s.Delete(ctx, "attachments/a"))
+	})
+
+	t.Run("Large", func(t *testing.T) {
+		assert := require.New(t)
+
+		// larger than the part size of the S3 uploader
+		content := bytes.Repeat([]byte("0123456789abcdef"), 11<<16)
+		assert.NoError(s.Put(ctx, "attachments/large", bytes.NewReader(content)))
+		assert.Equal(string(content), get(t, s, "attachments/large"))
+		assert.NoError(s.Delete(ctx, "attachments/large"))
+	})
+
+	t.Run("FailedPut", func(t *testing.T) {
+		assert := require.New(t)
+
+		// the error comes after the first part of the S3 uploader
+		errRead := errors.New("read error")
+		r := io.MultiReader(bytes.NewReader(make([]byte, 6<<20)), &errReader{err: errRead})
+		assert.Error(s.Put(ctx, "attachments/failed", r))
+		_, err := s.Get(ctx, "attachments/failed")
+		assert.Equal(ErrNotFound, err)
+	})
+
+	t.Run("InvalidKey", func(t *testing.T) {
+		assert := require.New(t)
+
+		for _, key := range []string{"", "/a", "a/", "a//b", "../a", "a/../b", "a/./b", "a\\b"} {
+			assert.Error(s.Put(ctx, key, strings.NewReader("x")), key)
+			_, err := s.Get(ctx, key)
+			assert.Error(err, key)
+			assert.Error(s.Delete(ctx, key), key)
+		}
+	})
+}
+
+func get(t *testing.T, s Store, key string) string {
+	rc, err := s.Get(context.Background(), key)
+	require.NoError(t, err)
+	defer rc.Close()
+	b, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	return string(b)
+}
+
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+func TestLocal(t *testing.T) {
+	dir := t.TempDir()
+	testStore(t, NewLocal(dir+"/blobs"))
+
+	// the failed puts leave no temporary files
+	entries, err := os.ReadDir(dir + "/blobs/attachments")
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestS3(t *testing.T) {
+	fake := newFakeS3("xm")
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	s, err := NewS3(S3Config{
+		Endpoint:        server.URL,
+		Bucket:          "xm",
+		Prefix:          "test/",
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+		PathStyle:       true,
+	})
+	require.NoError(t, err)
+	testStore(t, s)
+
+	require.Empty(t, fake.objects)
+	require.Empty(t, fake.uploads, "the failed multipart uploads are aborted")
+
+	_, err = NewS3(S3Config{})
+	require.Error(t, err)
+}
+
+// fakeS3 is a minimal S3 server for the tests, it supports the path style
+// requests of the objects of a bucket and the multipart uploads.
+type fakeS3 struct {
+	bucket string
+
+	mu      sync.Mutex
+	objects map[string][]byte
+	uploads map[string]map[int][]byte
+	nextID  int
+}
+
+func newFakeS3(bucket string) *fakeS3 {
+	return &fakeS3{
+		bucket:  bucket,
+		objects: make(map[string][]byte),
+		uploads: make(map[string]map[int][]byte),
+	}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	prefix := "/" + f.bucket + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		s3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, prefix)
+	query := r.URL.Query()
+	uploadID := query.Get("uploadId")
+
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		f.nextID++
+		id := strconv.Itoa(f.nextID)
+		f.uploads[id] = make(map[int][]byte)
+		writeXML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string
+			Key      string
+			UploadID string `xml:"UploadId"`
+		}{Bucket: f.bucket, Key: key, UploadID: id})
+	case r.Method == http.MethodPut && uploadID != "":
+		parts, ok := f.uploads[uploadID]
+		if !ok {
+			s3Error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		n, _ := strconv.Atoi(query.Get("partNumber"))
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			s3Error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		parts[n] = b
+		w.Header().Set("ETag", fmt.Sprintf(`"%d"`, n))
+	case r.Method == http.MethodPost && uploadID != "":
+		parts, ok := f.uploads[uploadID]
+		if !ok {
+			s3Error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		var numbers []int
+		for n := range parts {
+			numbers = append(numbers, n)
+		}
+		sort.Ints(numbers)
+		var content []byte
+		for _, n := range numbers {
+			content = append(content, parts[n]...)
+		}
+		f.objects[key] = content
+		delete(f.uploads, uploadID)
+		writeXML(w, struct {
+			XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+			Bucket  string
+			Key     string
+			ETag    string
+		}{Bucket: f.bucket, Key: key, ETag: `"complete"`})
+	case r.Method == http.MethodDelete && uploadID != "":
+		delete(f.uploads, uploadID)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			s3Error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		f.objects[key] = b
+		w.Header().Set("ETag", `"object"`)
+	case r.Method == http.MethodGet:
+		b, ok := f.objects[key]
+		if !ok {
+			s3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+		w.Write(b)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func writeXML(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(v)
+}
+
+func s3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: code, Message: code})
+}
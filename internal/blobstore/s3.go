@@ -0,0 +1,149 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3Config configures an S3 store.
+type S3Config struct {
+	// Endpoint is the URL of an S3 compatible server (e.g. MinIO), empty
+	// for AWS.
+	Endpoint string
+	// Region defaults to us-east-1.
+	Region string
+	Bucket string
+	// Prefix is prepended to the keys, e.g. "xm/".
+	Prefix string
+	// AccessKeyID and SecretAccessKey are the static credentials, the
+	// default AWS credential chain is used when they are empty.
+	AccessKeyID     string
+	SecretAccessKey string
+	// PathStyle addresses the buckets by path instead of by sub-domain,
+	// most S3 compatible servers require it.
+	PathStyle bool
+}
+
+// S3 keeps the blobs as the objects of a bucket.
+type S3 struct {
+	client   *s3.Client
+	uploader *manager.Uploader
+	bucket   string
+	prefix   string
+}
+
+// NewS3 returns a store keeping the blobs in the given bucket.
+func NewS3(conf S3Config) (*S3, error) {
+	if conf.Bucket == "" {
+		return nil, fmt.Errorf("blob_store.s3.bucket must be set")
+	}
+	region := conf.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	opts := []func(*awsconfig.LoadOptions) error{awsconfig.WithRegion(region)}
+	if conf.AccessKeyID != "" {
+		opts = append(opts, awsconfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(conf.AccessKeyID, conf.SecretAccessKey, ""),
+		))
+	}
+	awsConf, err := awsconfig.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("load aws config error: %w", err)
+	}
+
+	client := s3.NewFromConfig(awsConf, func(o *s3.Options) {
+		o.UsePathStyle = conf.PathStyle
+		if conf.Endpoint != "" {
+			o.EndpointResolver = s3.EndpointResolverFromURL(conf.Endpoint)
+		}
+	})
+	return &S3{
+		client:   client,
+		uploader: manager.NewUploader(client),
+		bucket:   conf.Bucket,
+		prefix:   conf.Prefix,
+	}, nil
+}
+
+func (s *S3) key(key string) (*string, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+	return aws.String(s.prefix + key), nil
+}
+
+// Put uploads the content, in parts if it is larger than the part size of
+// the uploader. A failed multipart upload is aborted.
+func (s *S3) Put(ctx context.Context, key string, r io.Reader) error {
+	k, err := s.key(key)
+	if err != nil {
+		return err
+	}
+	_, err = s.uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    k,
+		Body:   r,
+	})
+	if err != nil {
+		return fmt.Errorf("upload object error: %w", err)
+	}
+	return nil
+}
+
+// Get downloads the object of the blob.
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	k, err := s.key(key)
+	if err != nil {
+		return nil, err
+	}
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    k,
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("get object error: %w", err)
+	}
+	return out.Body, nil
+}
+
+// Delete deletes the object of the blob, S3 does not report the missing
+// objects.
+func (s *S3) Delete(ctx context.Context, key string) error {
+	k, err := s.key(key)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    k,
+	})
+	if err != nil && !isNotFound(err) {
+		return fmt.Errorf("delete object error: %w", err)
+	}
+	return nil
+}
+
+func isNotFound(err error) bool {
+	var re *awshttp.ResponseError
+	if errors.As(err, &re) && re.HTTPStatusCode() == http.StatusNotFound {
+		return true
+	}
+	var nsk *types.NoSuchKey
+	return errors.As(err, &nsk)
+}
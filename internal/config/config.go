@@ -1,7 +1,7 @@
 package config
 
 import (
-// "time"
+	"time"
 )
 
 // Version defines the version.
@@ -13,7 +13,8 @@ var (
 // Config defines the configuration.
 type Config struct {
 	General struct {
-		LogLevel int `mapstructure:"log_level"`
+		LogLevel        int           `mapstructure:"log_level"`
+		ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
 	}
 
 	ExternalAPI struct {
@@ -22,13 +23,56 @@ type Config struct {
 		TLSKey          string `mapstructure:"tls_key"`
 		JWTSecret       string `mapstructure:"jwt_secret"`
 		CORSAllowOrigin string `mapstructure:"cors_allow_origin"`
+		// IdempotencyTTL is how long the responses of the requests sent with
+		// an idempotency key are kept, 0 disables the idempotency keys.
+		IdempotencyTTL time.Duration `mapstructure:"idempotency_ttl"`
+		// UBOThreshold is the default min. stake (in percent) of the
+		// ultimate beneficial owners.
+		UBOThreshold float64 `mapstructure:"ubo_threshold"`
+
+		// Approval defines the changes which must be approved by a second
+		// user before they are applied.
+		Approval struct {
+			// Delete requires an approval for the deletes of the companies.
+			Delete bool `mapstructure:"delete"`
+			// TypeChange requires an approval for the changes of the type.
+			TypeChange bool `mapstructure:"type_change"`
+			// EmployeesThreshold requires an approval for the changes of the
+			// employee count larger than it, 0 disables it.
+			EmployeesThreshold int32 `mapstructure:"employees_threshold"`
+			// TTL is how long the change requests can be decided.
+			TTL time.Duration `mapstructure:"ttl"`
+		} `mapstructure:"approval"`
+
+		// MaxAttachmentSize is the max. size (in bytes) of the files attached
+		// to the companies.
+		MaxAttachmentSize int64 `mapstructure:"max_attachment_size"`
 	} `mapstructure:"external_api"`
 
+	BlobStore struct {
+		Backend string `mapstructure:"backend"` // local | s3
+		Dir     string `mapstructure:"dir"`
+		S3      struct {
+			Endpoint        string `mapstructure:"endpoint"`
+			Region          string `mapstructure:"region"`
+			Bucket          string `mapstructure:"bucket"`
+			Prefix          string `mapstructure:"prefix"`
+			AccessKeyID     string `mapstructure:"access_key_id"`
+			SecretAccessKey string `mapstructure:"secret_access_key"`
+			PathStyle       bool   `mapstructure:"path_style"`
+		} `mapstructure:"s3"`
+	} `mapstructure:"blob_store"`
+
+	Storage struct {
+		Backend string `mapstructure:"backend"` // postgres | memory
+	} `mapstructure:"storage"`
+
 	PostgreSQL struct {
 		Automigrate        bool
-		DSN                string `mapstructure:"dsn"`
-		MaxOpenConnections int    `mapstructure:"max_open_connections"`
-		MaxIdleConnections int    `mapstructure:"max_idle_connections"`
+		DSN                string        `mapstructure:"dsn"`
+		MaxOpenConnections int           `mapstructure:"max_open_connections"`
+		MaxIdleConnections int           `mapstructure:"max_idle_connections"`
+		StatementTimeout   time.Duration `mapstructure:"statement_timeout"`
 	} `mapstructure:"postgre"`
 
 	Kafka struct {
@@ -45,6 +89,16 @@ type Config struct {
 		Reader           KafkaReaderConfig            `mapstructure:"reader"`
 		Writers          map[string]KafkaWriterConfig `mapstructure:"writers"` // writer per event name
 	}
+
+	Tracing struct {
+		Enabled     bool    `mapstructure:"enabled"`
+		Exporter    string  `mapstructure:"exporter"` // otlp | stdout | file
+		Endpoint    string  `mapstructure:"endpoint"`
+		Insecure    bool    `mapstructure:"insecure"`
+		File        string  `mapstructure:"file"`
+		ServiceName string  `mapstructure:"service_name"`
+		SampleRatio float64 `mapstructure:"sample_ratio"`
+	} `mapstructure:"tracing"`
 }
 
 // KafkaReaderConfig consumer cfg
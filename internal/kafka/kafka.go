@@ -15,12 +15,20 @@ import (
 	"github.com/segmentio/kafka-go/sasl/plain"
 	"github.com/segmentio/kafka-go/sasl/scram"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
 	wg               *sync.WaitGroup
 	writer           *kafka.Writer // according to the documentation the Writer is thread safe
+	dialer           *kafka.Dialer
+	brokers          []string
 	eventKeyTemplate *template.Template
+	tracer           = otel.Tracer("github.com/fancar/tmp_xm/internal/kafka")
 )
 
 // Setup configures the kafka producer
@@ -87,6 +95,8 @@ func Setup(ctx context.Context, waitgroup *sync.WaitGroup, cfg config.Config) er
 	}
 
 	writer = kafka.NewWriter(wc)
+	dialer = wc.Dialer
+	brokers = conf.Brokers
 
 	log.WithFields(log.Fields{
 		"brokers":   conf.Brokers,
@@ -97,10 +107,33 @@ func Setup(ctx context.Context, waitgroup *sync.WaitGroup, cfg config.Config) er
 	return nil
 }
 
-// PublishMessage publishes the byte array recieved
+// Go runs f, which publishes messages, in a new goroutine. The goroutine
+// is added to the wait group before Go returns, so Close waits for it even
+// if it has not started yet.
+func Go(f func()) {
+	if wg == nil {
+		go f()
+		return
+	}
+
+	w := wg
+	w.Add(1)
+	go func() {
+		defer w.Done()
+		f()
+	}()
+}
+
+// PublishMessage publishes the byte array recieved, it is meant to be
+// called by a function run with Go.
 func PublishMessage(ctx context.Context, company, event string, b []byte) error {
-	wg.Add(1)
-	defer wg.Done()
+	if writer == nil {
+		log.WithFields(log.Fields{
+			"company": company,
+			"event":   event,
+		}).Debug("kafka: not configured, message skipped")
+		return nil
+	}
 
 	keyBuf := bytes.NewBuffer(nil)
 
@@ -121,6 +154,21 @@ func PublishMessage(ctx context.Context, company, event string, b []byte) error
 		kmsg.Key = key
 	}
 
+	ctx, span := tracer.Start(ctx, writer.Topic+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKey.String("kafka"),
+			semconv.MessagingDestinationNameKey.String(writer.Topic),
+			semconv.MessagingOperationPublish,
+			attribute.String("company", company),
+			attribute.String("event", event),
+		),
+	)
+	defer span.End()
+
+	// pass the trace context to the consumers
+	otel.GetTextMapPropagator().Inject(ctx, headerCarrier{&kmsg})
+
 	log.WithFields(log.Fields{
 		"key":         string(key),
 		"value_bytes": len(b),
@@ -129,5 +177,92 @@ func PublishMessage(ctx context.Context, company, event string, b []byte) error
 		"event":       event,
 	}).Info("kafka: message publishing ...")
 
-	return writer.WriteMessages(context.Background(), kmsg)
+	if err := writer.WriteMessages(context.Background(), kmsg); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	return nil
+}
+
+// Close waits for the functions run with Go, flushes the buffered
+// messages and closes the writer.
+func Close(ctx context.Context) error {
+	if writer == nil {
+		return nil
+	}
+
+	w := wg
+	done := make(chan struct{})
+	go func() {
+		w.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return fmt.Errorf("wait for publishing messages error: %w", ctx.Err())
+	}
+
+	log.Info("kafka: flushing messages and closing the writer ...")
+	return writer.Close()
+}
+
+// Enabled returns true if the producer has been configured.
+func Enabled() bool {
+	return writer != nil
+}
+
+// Ping verifies that at least one of the configured brokers is reachable.
+func Ping(ctx context.Context) error {
+	if writer == nil {
+		return fmt.Errorf("kafka: not configured")
+	}
+
+	var err error
+	for _, b := range brokers {
+		var conn *kafka.Conn
+		conn, err = dialer.DialContext(ctx, "tcp", b)
+		if err == nil {
+			return conn.Close()
+		}
+	}
+	return fmt.Errorf("no broker reachable: %w", err)
+}
+
+// headerCarrier adapts the kafka message headers to the
+// propagation.TextMapCarrier interface.
+type headerCarrier struct {
+	msg *kafka.Message
+}
+
+// Get returns the value of the header with the given key.
+func (c headerCarrier) Get(key string) string {
+	for _, h := range c.msg.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// Set sets the header, replacing the existing one with the same key.
+func (c headerCarrier) Set(key, value string) {
+	for i, h := range c.msg.Headers {
+		if h.Key == key {
+			c.msg.Headers[i].Value = []byte(value)
+			return
+		}
+	}
+	c.msg.Headers = append(c.msg.Headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+// Keys returns the keys of all the headers.
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.msg.Headers))
+	for _, h := range c.msg.Headers {
+		keys = append(keys, h.Key)
+	}
+	return keys
 }
@@ -0,0 +1,99 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestHeaderCarrier(t *testing.T) {
+	assert := require.New(t)
+
+	traceID, err := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	assert.NoError(err)
+	spanID, err := trace.SpanIDFromHex("00f067aa0ba902b7")
+	assert.NoError(err)
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+
+	msg := kafka.Message{
+		Headers: []kafka.Header{{Key: "event", Value: []byte("created")}},
+	}
+	prop := propagation.TraceContext{}
+	prop.Inject(ctx, headerCarrier{&msg})
+
+	assert.Equal("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", headerCarrier{&msg}.Get("traceparent"))
+	assert.ElementsMatch([]string{"event", "traceparent"}, headerCarrier{&msg}.Keys())
+
+	t.Run("Set replaces the existing header", func(t *testing.T) {
+		assert := require.New(t)
+
+		headerCarrier{&msg}.Set("event", "updated")
+		assert.Len(msg.Headers, 2)
+		assert.Equal("updated", headerCarrier{&msg}.Get("event"))
+	})
+
+	t.Run("Extract", func(t *testing.T) {
+		assert := require.New(t)
+
+		extracted := trace.SpanContextFromContext(prop.Extract(context.Background(), headerCarrier{&msg}))
+		assert.Equal(traceID, extracted.TraceID())
+		assert.Equal(spanID, extracted.SpanID())
+		assert.True(extracted.IsRemote())
+	})
+}
+
+func TestClose(t *testing.T) {
+	assert := require.New(t)
+
+	wg = &sync.WaitGroup{}
+	writer = &kafka.Writer{Addr: kafka.TCP("127.0.0.1:1"), Topic: "companies", Async: true}
+	defer func() { wg, writer = nil, nil }()
+
+	// an event in flight when the shutdown starts: its goroutine may not
+	// have started yet
+	release := make(chan struct{})
+	published := false
+	Go(func() {
+		<-release
+		published = true
+	})
+
+	closed := make(chan error)
+	go func() {
+		closed <- Close(context.Background())
+	}()
+
+	select {
+	case <-closed:
+		t.Fatal("Close returned before the event was published")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	assert.NoError(<-closed)
+	assert.True(published)
+
+	t.Run("Timeout", func(t *testing.T) {
+		assert := require.New(t)
+
+		writer = &kafka.Writer{Addr: kafka.TCP("127.0.0.1:1"), Topic: "companies", Async: true}
+		release := make(chan struct{})
+		defer close(release)
+		Go(func() { <-release })
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(Close(ctx), context.DeadlineExceeded)
+	})
+}
@@ -0,0 +1,235 @@
+package storage
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+)
+
+// The kinds of the custom attributes, they are the values of the
+// AttributeKind enum of the API.
+const (
+	AttributeString uint32 = 1
+	AttributeInt    uint32 = 2
+	AttributeBool   uint32 = 3
+	AttributeDate   uint32 = 4
+	AttributeEnum   uint32 = 5
+)
+
+// AttributeDefinition defines a custom attribute of the companies of a
+// type. The name is unique per company type.
+type AttributeDefinition struct {
+	CompanyType uint32    `db:"company_type"`
+	Name        string    `db:"name"`
+	CreatedAt   time.Time `db:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at"`
+	Kind        uint32    `db:"kind"`
+	Required    bool      `db:"required"`
+
+	// EnumValues holds the allowed values of the enum attributes.
+	EnumValues  StringList `db:"enum_values"`
+	Description string     `db:"description"`
+}
+
+// StringList is a list of strings stored as a JSON array.
+type StringList []string
+
+// Value implements driver.Valuer.
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal([]string(l))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan implements sql.Scanner.
+func (l *StringList) Scan(src interface{}) error {
+	return scanJSON(src, (*[]string)(l))
+}
+
+// CompanyAttributes holds the values of the custom attributes of a company
+// by name, stored as a JSON object. The values are strings, float64 numbers
+// and booleans, like the ones decoded by encoding/json.
+type CompanyAttributes map[string]interface{}
+
+// Value implements driver.Valuer.
+func (a CompanyAttributes) Value() (driver.Value, error) {
+	if a == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(map[string]interface{}(a))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan implements sql.Scanner.
+func (a *CompanyAttributes) Scan(src interface{}) error {
+	*a = nil
+	return scanJSON(src, (*map[string]interface{})(a))
+}
+
+// clone returns a copy of the attributes, nil if there are none.
+func (a CompanyAttributes) clone() CompanyAttributes {
+	if len(a) == 0 {
+		return nil
+	}
+	out := make(CompanyAttributes, len(a))
+	for k, v := range a {
+		out[k] = v
+	}
+	return out
+}
+
+// scanJSON decodes the JSON text or bytes of a column into v.
+func scanJSON(src interface{}, v interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(src, v)
+	case string:
+		return json.Unmarshal([]byte(src), v)
+	default:
+		return fmt.Errorf("storage: can't scan %T as JSON", src)
+	}
+}
+
+// CreateAttributeDefinition creates the given attribute definition,
+// ErrAlreadyExists is returned if the company type has an attribute with
+// the same name.
+func CreateAttributeDefinition(ctx context.Context, db sqlx.ExecerContext, d *AttributeDefinition) error {
+	d.CreatedAt = time.Now()
+	d.UpdatedAt = d.CreatedAt
+
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO attribute_definition (
+			company_type,
+			name,
+			created_at,
+			updated_at,
+			kind,
+			required,
+			enum_values,
+			description
+		) values ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		d.CompanyType,
+		d.Name,
+		d.CreatedAt,
+		d.UpdatedAt,
+		d.Kind,
+		d.Required,
+		d.EnumValues,
+		d.Description,
+	)
+	if err != nil {
+		return handlePSQLError(Insert, err, "insert attribute definition error")
+	}
+
+	log.WithFields(log.Fields{
+		"company_type": d.CompanyType,
+		"name":         d.Name,
+	}).Info("attribute definition created")
+	return nil
+}
+
+// GetAttributeDefinition returns the attribute definition of the given
+// company type and name.
+func GetAttributeDefinition(ctx context.Context, db sqlx.QueryerContext, companyType uint32, name string) (AttributeDefinition, error) {
+	var d AttributeDefinition
+	err := sqlx.GetContext(ctx, db, &d, "SELECT * FROM attribute_definition WHERE company_type = $1 AND name = $2",
+		companyType, name)
+	if err != nil {
+		return d, handlePSQLError(Select, err, "select attribute definition error")
+	}
+	return d, nil
+}
+
+// GetAttributeDefinitions returns the attribute definitions of the given
+// company type, of all the types if it is 0, ordered by type and name.
+func GetAttributeDefinitions(ctx context.Context, db sqlx.QueryerContext, companyType uint32) ([]AttributeDefinition, error) {
+	query := "SELECT * FROM attribute_definition"
+	var args []interface{}
+	if companyType != 0 {
+		query += " WHERE company_type = $1"
+		args = append(args, companyType)
+	}
+	query += " ORDER BY company_type, name"
+
+	var list []AttributeDefinition
+	if err := sqlx.SelectContext(ctx, db, &list, query, args...); err != nil {
+		return nil, handlePSQLError(Select, err, "select attribute definitions error")
+	}
+	return list, nil
+}
+
+// UpdateAttributeDefinition updates the required flag, the enum values and
+// the description of the given attribute definition, the kind can't be
+// changed.
+func UpdateAttributeDefinition(ctx context.Context, db sqlx.QueryerContext, d *AttributeDefinition) error {
+	err := sqlx.GetContext(ctx, db, d, `
+		UPDATE attribute_definition
+		SET
+			updated_at = $3,
+			required = $4,
+			enum_values = $5,
+			description = $6
+		WHERE
+			company_type = $1 AND name = $2
+		RETURNING *`,
+		d.CompanyType,
+		d.Name,
+		time.Now(),
+		d.Required,
+		d.EnumValues,
+		d.Description,
+	)
+	if err != nil {
+		return handlePSQLError(Update, err, "update attribute definition error")
+	}
+	return nil
+}
+
+// DeleteAttributeDefinition deletes the given attribute definition and the
+// values of the attribute from the companies of the type.
+func DeleteAttributeDefinition(ctx context.Context, db sqlx.ExtContext, companyType uint32, name string) error {
+	res, err := db.ExecContext(ctx, "DELETE FROM attribute_definition WHERE company_type = $1 AND name = $2",
+		companyType, name)
+	if err != nil {
+		return handlePSQLError(Delete, err, "delete attribute definition error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("can't get rows affected %v", err)
+	}
+	if ra == 0 {
+		return ErrDoesNotExist
+	}
+
+	query := "UPDATE company SET attributes = attributes - $2 WHERE type = $1 AND attributes ? $2"
+	arg := name
+	if db.DriverName() != DriverPostgres {
+		query = "UPDATE company SET attributes = json_remove(attributes, $2) WHERE type = $1 AND json_type(attributes, $2) IS NOT NULL"
+		arg = jsonPath(name)
+	}
+	if _, err := db.ExecContext(ctx, query, companyType, arg); err != nil {
+		return handlePSQLError(Update, err, "delete attribute values error")
+	}
+	return nil
+}
+
+// jsonPath returns the SQLite JSON path of the given attribute, the names
+// are validated by the API and need no quoting.
+func jsonPath(name string) string {
+	return "$." + name
+}
@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+)
+
+// The statuses of the change requests, they are the values of the
+// ChangeRequestStatus enum of the API.
+const (
+	ChangeRequestPending  uint32 = 1
+	ChangeRequestApproved uint32 = 2
+	ChangeRequestRejected uint32 = 3
+	ChangeRequestExpired  uint32 = 4
+)
+
+// ChangeRequest is a change of a company waiting for the approval of a
+// second user, the kinds are the values of the ChangeKind enum of the API.
+type ChangeRequest struct {
+	ID        uuid.UUID    `db:"id"`
+	CompanyID uuid.UUID    `db:"company_id"`
+	CreatedAt time.Time    `db:"created_at"`
+	UpdatedAt time.Time    `db:"updated_at"`
+	ExpiresAt time.Time    `db:"expires_at"`
+	DecidedAt sql.NullTime `db:"decided_at"`
+	Kind      uint32       `db:"kind"`
+	Status    uint32       `db:"status"`
+
+	// Payload is the requested change, as the JSON of the API request.
+	Payload string `db:"payload"`
+
+	// RequestedBy and DecidedBy are the usernames of the requester and of
+	// the approver.
+	RequestedBy string `db:"requested_by"`
+	DecidedBy   string `db:"decided_by"`
+	Comment     string `db:"comment"`
+}
+
+// ChangeRequestFilters defines the filters of GetChangeRequests, the zero
+// values match all the requests.
+type ChangeRequestFilters struct {
+	Status    uint32
+	CompanyID uuid.NullUUID
+}
+
+// CreateChangeRequest creates the given pending change request,
+// ErrAlreadyExists is returned if the company has a pending request,
+// ErrDoesNotExist if the company does not exist. The company is not a
+// foreign key, the decided requests outlive it.
+func CreateChangeRequest(ctx context.Context, db sqlx.ExecerContext, cr *ChangeRequest) error {
+	cr.CreatedAt = time.Now()
+	cr.UpdatedAt = cr.CreatedAt
+	cr.ExpiresAt = cr.ExpiresAt.UTC()
+	cr.Status = ChangeRequestPending
+
+	res, err := db.ExecContext(ctx, `
+		INSERT INTO change_request (
+			id,
+			company_id,
+			created_at,
+			updated_at,
+			expires_at,
+			decided_at,
+			kind,
+			status,
+			payload,
+			requested_by,
+			decided_by,
+			comment
+		)
+		SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12
+		WHERE EXISTS (SELECT 1 FROM company WHERE id = $2)`,
+		cr.ID,
+		cr.CompanyID,
+		cr.CreatedAt,
+		cr.UpdatedAt,
+		cr.ExpiresAt,
+		cr.DecidedAt,
+		cr.Kind,
+		cr.Status,
+		cr.Payload,
+		cr.RequestedBy,
+		cr.DecidedBy,
+		cr.Comment,
+	)
+	if err != nil {
+		return handlePSQLError(Insert, err, "insert change request error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("can't get rows affected %v", err)
+	}
+	if ra == 0 {
+		return ErrDoesNotExist
+	}
+	return nil
+}
+
+// GetChangeRequest returns the change request for the given ID.
+func GetChangeRequest(ctx context.Context, db sqlx.QueryerContext, id uuid.UUID) (ChangeRequest, error) {
+	var cr ChangeRequest
+	err := sqlx.GetContext(ctx, db, &cr, "SELECT * FROM change_request WHERE id = $1", id)
+	if err != nil {
+		return cr, handlePSQLError(Select, err, "select change request error")
+	}
+	return cr, nil
+}
+
+// GetPendingChangeRequest returns the pending change request of the given
+// company, ErrDoesNotExist if it has none.
+func GetPendingChangeRequest(ctx context.Context, db sqlx.QueryerContext, companyID uuid.UUID) (ChangeRequest, error) {
+	var cr ChangeRequest
+	err := sqlx.GetContext(ctx, db, &cr, "SELECT * FROM change_request WHERE company_id = $1 AND status = $2",
+		companyID, ChangeRequestPending)
+	if err != nil {
+		return cr, handlePSQLError(Select, err, "select change request error")
+	}
+	return cr, nil
+}
+
+// GetChangeRequests returns the change requests matching the given filters,
+// the newest first.
+func GetChangeRequests(ctx context.Context, db sqlx.QueryerContext, filters ChangeRequestFilters) ([]ChangeRequest, error) {
+	var where []string
+	var args []interface{}
+	if filters.Status != 0 {
+		args = append(args, filters.Status)
+		where = append(where, fmt.Sprintf("status = $%d", len(args)))
+	}
+	if filters.CompanyID.Valid {
+		args = append(args, filters.CompanyID.UUID)
+		where = append(where, fmt.Sprintf("company_id = $%d", len(args)))
+	}
+
+	query := "SELECT * FROM change_request"
+	if len(where) != 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY created_at DESC, id"
+
+	var list []ChangeRequest
+	if err := sqlx.SelectContext(ctx, db, &list, query, args...); err != nil {
+		return nil, handlePSQLError(Select, err, "select change requests error")
+	}
+	return list, nil
+}
+
+// DecideChangeRequest sets the status, the approver and the comment of the
+// given pending change request, ErrChangeRequestDecided is returned if it
+// is not pending anymore.
+func DecideChangeRequest(ctx context.Context, db sqlx.ExtContext, cr *ChangeRequest) error {
+	now := time.Now()
+
+	res, err := db.ExecContext(ctx, `
+		UPDATE change_request
+		SET
+			updated_at = $3,
+			decided_at = $3,
+			status = $4,
+			decided_by = $5,
+			comment = $6
+		WHERE
+			id = $1 AND status = $2`,
+		cr.ID,
+		ChangeRequestPending,
+		now,
+		cr.Status,
+		cr.DecidedBy,
+		cr.Comment,
+	)
+	if err != nil {
+		return handlePSQLError(Update, err, "update change request error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("can't get rows affected %v", err)
+	}
+	if ra == 0 {
+		if _, err := GetChangeRequest(ctx, db, cr.ID); err != nil {
+			return err
+		}
+		return ErrChangeRequestDecided
+	}
+
+	cr.UpdatedAt = now
+	cr.DecidedAt = sql.NullTime{Time: now, Valid: true}
+	return nil
+}
+
+// ExpireChangeRequests moves the pending change requests expired at the
+// given time to the expired status and returns them.
+func ExpireChangeRequests(ctx context.Context, db sqlx.QueryerContext, at time.Time) ([]ChangeRequest, error) {
+	var list []ChangeRequest
+	err := sqlx.SelectContext(ctx, db, &list, `
+		UPDATE change_request
+		SET
+			updated_at = $1,
+			decided_at = $1,
+			status = $2
+		WHERE
+			status = $3 AND expires_at <= $4
+		RETURNING *`,
+		time.Now(),
+		ChangeRequestExpired,
+		ChangeRequestPending,
+		at.UTC(),
+	)
+	if err != nil {
+		return nil, handlePSQLError(Update, err, "expire change requests error")
+	}
+
+	if len(list) > 0 {
+		log.WithField("count", len(list)).Info("storage: change requests expired")
+	}
+	return list, nil
+}
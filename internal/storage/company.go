@@ -2,8 +2,12 @@ package storage
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gofrs/uuid"
 	"github.com/jmoiron/sqlx"
@@ -22,32 +26,83 @@ type Company struct {
 	EmployeesCnt int32     `db:"employees_cnt"`
 	Registered   bool      `db:"registered"`
 	Type         uint32    `db:"type"`
+
+	// Status is the lifecycle status, see the API. It is set on create and
+	// changed by TransitionCompanyStatus only.
+	Status uint32 `db:"status"`
+
+	// ParentID is the ID of the parent company, if the company is a
+	// subsidiary.
+	ParentID uuid.NullUUID `db:"parent_id"`
+
+	// Jurisdiction is the ISO 3166-1 alpha-2 code of the country of
+	// registration. The registration number is unique per jurisdiction,
+	// the LEI is unique, they are empty if unknown.
+	Jurisdiction       string `db:"jurisdiction"`
+	RegistrationNumber string `db:"registration_number"`
+	VATID              string `db:"vat_id"`
+	LEI                string `db:"lei"`
+
+	// Attributes holds the values of the custom attributes defined for
+	// the type of the company, see AttributeDefinition.
+	Attributes CompanyAttributes `db:"attributes"`
+
+	// Labels holds the key/value labels of the company. They are set on
+	// create and changed by AddCompanyLabels and RemoveCompanyLabels only.
+	Labels CompanyLabels `db:"labels"`
+
+	// NormalizedName is set from the name on create and update, see
+	// NormalizeCompanyName.
+	NormalizedName string `db:"normalized_name" json:"-"`
 }
 
 // CreateCompany creates the given Company in db.
-func CreateCompany(ctx context.Context, db sqlx.Execer, c *Company) error {
+func CreateCompany(ctx context.Context, db sqlx.ExecerContext, c *Company) error {
+	if c.ParentID.Valid && c.ParentID.UUID == c.ID {
+		return ErrCompanyParentCycle
+	}
+
 	now := time.Now()
+	c.NormalizedName = NormalizeCompanyName(c.Name)
 
-	_, err := db.Exec(`
+	_, err := db.ExecContext(ctx, `
 		INSERT INTO company (
 			created_at,
 			updated_at,
 			id,
 			name,
+			normalized_name,
 			description,
 			employees_cnt,
 			registered,
-			type
-		) values ($1, $2, $3, $4, $5, $6, $7, $8)
+			type,
+			parent_id,
+			status,
+			jurisdiction,
+			registration_number,
+			vat_id,
+			lei,
+			attributes,
+			labels
+		) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
 		`,
 		now,
 		now,
 		c.ID,
 		c.Name,
+		c.NormalizedName,
 		c.Description,
 		c.EmployeesCnt,
 		c.Registered,
 		c.Type,
+		c.ParentID,
+		c.Status,
+		c.Jurisdiction,
+		c.RegistrationNumber,
+		c.VATID,
+		c.LEI,
+		c.Attributes,
+		c.Labels,
 	)
 	if err != nil {
 		return handlePSQLError(Insert, err, "insert error")
@@ -59,43 +114,57 @@ func CreateCompany(ctx context.Context, db sqlx.Execer, c *Company) error {
 	return nil
 }
 
-// UpdateCompany updates the given company by its ID.
-func UpdateCompany(ctx context.Context, db sqlx.Ext, c *Company) error {
-	res, err := db.Exec(`
+// UpdateCompany updates the given company by its ID. The status and the
+// labels are not updated, c.Status and c.Labels are set to the stored ones.
+func UpdateCompany(ctx context.Context, db sqlx.ExtContext, c *Company) error {
+	if err := checkCompanyParent(ctx, db, c); err != nil {
+		return err
+	}
+	c.NormalizedName = NormalizeCompanyName(c.Name)
+
+	err := db.QueryRowxContext(ctx, `
 		UPDATE company
 		SET
 			updated_at = $2,
 			name = $3,
-			description = $4,
-			employees_cnt = $5,
-			registered = $6,
-			type = $7	
+			normalized_name = $4,
+			description = $5,
+			employees_cnt = $6,
+			registered = $7,
+			type = $8,
+			parent_id = $9,
+			jurisdiction = $10,
+			registration_number = $11,
+			vat_id = $12,
+			lei = $13,
+			attributes = $14
 		WHERE
-			id = $1`,
+			id = $1
+		RETURNING status, labels`,
 		c.ID,
 		time.Now(),
 		c.Name,
+		c.NormalizedName,
 		c.Description,
 		c.EmployeesCnt,
 		c.Registered,
 		c.Type,
-	)
+		c.ParentID,
+		c.Jurisdiction,
+		c.RegistrationNumber,
+		c.VATID,
+		c.LEI,
+		c.Attributes,
+	).Scan(&c.Status, &c.Labels)
 	if err != nil {
 		return handlePSQLError(Update, err, "can't update")
 	}
-	ra, err := res.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("can't get rows affected %v", err)
-	}
-	if ra == 0 {
-		return ErrDoesNotExist
-	}
 	return nil
 }
 
 // DeleteCompany deletes a company that matches the given ID.
-func DeleteCompany(ctx context.Context, db sqlx.Ext, id uuid.UUID) error {
-	res, err := db.Exec("DELETE FROM company WHERE id = $1", id)
+func DeleteCompany(ctx context.Context, db sqlx.ExtContext, id uuid.UUID) error {
+	res, err := db.ExecContext(ctx, "DELETE FROM company WHERE id = $1", id)
 	if err != nil {
 		return handlePSQLError(Delete, err, "can't delete")
 	}
@@ -110,12 +179,186 @@ func DeleteCompany(ctx context.Context, db sqlx.Ext, id uuid.UUID) error {
 }
 
 // GetCompany gets a company that matches the given ID.
-func GetCompany(ctx context.Context, db sqlx.Ext, id uuid.UUID) (Company, error) {
+func GetCompany(ctx context.Context, db sqlx.ExtContext, id uuid.UUID) (Company, error) {
 	var result Company
 
-	err := sqlx.Get(db, &result, "SELECT * FROM company WHERE id = $1", id)
+	err := sqlx.GetContext(ctx, db, &result, "SELECT * FROM company WHERE id = $1", id)
 	if err != nil {
 		return result, handlePSQLError(Select, err, "can't select Company")
 	}
 	return result, nil
 }
+
+// CompanyFilters filters the companies.
+type CompanyFilters struct {
+	// Type matches the companies of the given type, 0 matches all.
+	Type uint32
+	// Registered matches the companies by their registered flag, nil
+	// matches all.
+	Registered *bool
+	// NamePrefix matches the companies which names start with it.
+	NamePrefix string
+	// Attributes matches the companies having all the given values of
+	// their custom attributes, see CompanyAttributes for the value types.
+	Attributes CompanyAttributes
+	// Labels matches the companies which labels match the selector.
+	Labels LabelSelector
+}
+
+// Match returns true if the given company matches the filters.
+func (f CompanyFilters) Match(c Company) bool {
+	if f.Type != 0 && c.Type != f.Type {
+		return false
+	}
+	if f.Registered != nil && c.Registered != *f.Registered {
+		return false
+	}
+	for k, v := range f.Attributes {
+		if value, ok := c.Attributes[k]; !ok || value != v {
+			return false
+		}
+	}
+	if !f.Labels.Match(c.Labels) {
+		return false
+	}
+	return strings.HasPrefix(c.Name, f.NamePrefix)
+}
+
+// where returns the WHERE clause of the filters and its arguments.
+func (f CompanyFilters) where(driverName string) (string, []interface{}) {
+	conds, args := f.conditions(driverName, nil)
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+// conditions returns the conditions of the filters, their arguments are
+// appended to the given ones.
+func (f CompanyFilters) conditions(driverName string, args []interface{}) ([]string, []interface{}) {
+	var conds []string
+
+	if f.Type != 0 {
+		args = append(args, f.Type)
+		conds = append(conds, fmt.Sprintf("type = $%d", len(args)))
+	}
+	if f.Registered != nil {
+		args = append(args, *f.Registered)
+		conds = append(conds, fmt.Sprintf("registered = $%d", len(args)))
+	}
+	if f.NamePrefix != "" {
+		// substr instead of LIKE, the prefix needs no escaping and the
+		// comparison is case-sensitive with every driver
+		args = append(args, f.NamePrefix, utf8.RuneCountInString(f.NamePrefix))
+		conds = append(conds, fmt.Sprintf("substr(name, 1, $%d) = $%d", len(args), len(args)-1))
+	}
+	if len(f.Attributes) != 0 {
+		if driverName == DriverPostgres {
+			// the containment is served by the GIN index
+			v, _ := f.Attributes.Value()
+			args = append(args, v)
+			conds = append(conds, fmt.Sprintf("attributes @> $%d::jsonb", len(args)))
+		} else {
+			names := make([]string, 0, len(f.Attributes))
+			for k := range f.Attributes {
+				names = append(names, k)
+			}
+			sort.Strings(names)
+			for _, k := range names {
+				args = append(args, jsonPath(k), f.Attributes[k])
+				conds = append(conds, fmt.Sprintf("json_extract(attributes, $%d) = $%d", len(args)-1, len(args)))
+			}
+		}
+	}
+	labels, args := f.Labels.conditions(driverName, args)
+	return append(conds, labels...), args
+}
+
+// companyFetchSize defines the number of rows fetched at once from the
+// PostgreSQL cursor by ForEachCompany.
+const companyFetchSize = 500
+
+// ForEachCompany calls fn for every company matching the filters, ordered
+// by name. PostgreSQL is read through a server-side cursor in a read-only
+// transaction, so that the memory usage does not depend on the number of
+// companies. Iteration stops at the first error returned by fn.
+func ForEachCompany(ctx context.Context, db sqlx.ExtContext, filters CompanyFilters, fn func(Company) error) error {
+	where, args := filters.where(db.DriverName())
+	query := "SELECT * FROM company " + where + " ORDER BY name"
+
+	if db.DriverName() != DriverPostgres {
+		return forEachCompanyRow(ctx, db, query, args, fn)
+	}
+
+	d, ok := db.(*DBLogger)
+	if !ok {
+		// already in a transaction
+		return forEachCompanyFetch(ctx, db, query, args, fn)
+	}
+
+	tx, err := d.BeginTxx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("storage: can't begin the transaction %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := forEachCompanyFetch(ctx, tx, query, args, fn); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// forEachCompanyFetch reads the companies through a cursor, it must be
+// called in a transaction.
+func forEachCompanyFetch(ctx context.Context, db sqlx.ExtContext, query string, args []interface{}, fn func(Company) error) (err error) {
+	if _, err := db.ExecContext(ctx, "DECLARE company_cursor NO SCROLL CURSOR FOR "+query, args...); err != nil {
+		return handlePSQLError(Select, err, "declare cursor error")
+	}
+	// the cursor is closed on the errors too, so that it can be declared
+	// again in the same transaction; the request may be canceled already
+	defer func() {
+		if _, cErr := db.ExecContext(context.Background(), "CLOSE company_cursor"); cErr != nil && err == nil {
+			err = handlePSQLError(Select, cErr, "close cursor error")
+		}
+	}()
+
+	for {
+		var batch []Company
+		err := sqlx.SelectContext(ctx, db, &batch, fmt.Sprintf("FETCH FORWARD %d FROM company_cursor", companyFetchSize))
+		if err != nil {
+			return handlePSQLError(Select, err, "fetch error")
+		}
+
+		for _, c := range batch {
+			if err := fn(c); err != nil {
+				return err
+			}
+		}
+		if len(batch) < companyFetchSize {
+			return nil
+		}
+	}
+}
+
+// forEachCompanyRow reads the companies row by row from the result set.
+func forEachCompanyRow(ctx context.Context, db sqlx.QueryerContext, query string, args []interface{}, fn func(Company) error) error {
+	rows, err := db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return handlePSQLError(Select, err, "select error")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c Company
+		if err := rows.StructScan(&c); err != nil {
+			return handlePSQLError(Scan, err, "scan error")
+		}
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return handlePSQLError(Select, err, "select error")
+	}
+	return nil
+}
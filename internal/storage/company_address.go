@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// CompanyAddress is a postal address of a company.
+type CompanyAddress struct {
+	ID        uuid.UUID `db:"id"`
+	CompanyID uuid.UUID `db:"company_id"`
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+	// Type is registered, billing or operational, see the API.
+	Type uint32 `db:"type"`
+	// Country is the ISO 3166-1 alpha-2 code of the country.
+	Country    string `db:"country"`
+	Region     string `db:"region"`
+	City       string `db:"city"`
+	PostalCode string `db:"postal_code"`
+	Line1      string `db:"line1"`
+	Line2      string `db:"line2"`
+}
+
+// CreateCompanyAddress creates the given address, ErrDoesNotExist is
+// returned if its company does not exist.
+func CreateCompanyAddress(ctx context.Context, db sqlx.ExecerContext, a *CompanyAddress) error {
+	a.CreatedAt = time.Now()
+	a.UpdatedAt = a.CreatedAt
+
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO company_address (
+			id,
+			company_id,
+			created_at,
+			updated_at,
+			type,
+			country,
+			region,
+			city,
+			postal_code,
+			line1,
+			line2
+		) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		a.ID,
+		a.CompanyID,
+		a.CreatedAt,
+		a.UpdatedAt,
+		a.Type,
+		a.Country,
+		a.Region,
+		a.City,
+		a.PostalCode,
+		a.Line1,
+		a.Line2,
+	)
+	if err != nil {
+		return handlePSQLError(Insert, err, "insert address error")
+	}
+	return nil
+}
+
+// GetCompanyAddress returns the address of the given company.
+func GetCompanyAddress(ctx context.Context, db sqlx.QueryerContext, companyID, id uuid.UUID) (CompanyAddress, error) {
+	var a CompanyAddress
+	err := sqlx.GetContext(ctx, db, &a, "SELECT * FROM company_address WHERE id = $1 AND company_id = $2", id, companyID)
+	if err != nil {
+		return a, handlePSQLError(Select, err, "select address error")
+	}
+	return a, nil
+}
+
+// GetCompanyAddresses returns the addresses of the given company, in their
+// creation order.
+func GetCompanyAddresses(ctx context.Context, db sqlx.QueryerContext, companyID uuid.UUID) ([]CompanyAddress, error) {
+	var list []CompanyAddress
+	err := sqlx.SelectContext(ctx, db, &list, "SELECT * FROM company_address WHERE company_id = $1 ORDER BY created_at, id", companyID)
+	if err != nil {
+		return nil, handlePSQLError(Select, err, "select addresses error")
+	}
+	return list, nil
+}
+
+// UpdateCompanyAddress updates the given address by its ID and company ID.
+func UpdateCompanyAddress(ctx context.Context, db sqlx.ExecerContext, a *CompanyAddress) error {
+	a.UpdatedAt = time.Now()
+
+	res, err := db.ExecContext(ctx, `
+		UPDATE company_address
+		SET
+			updated_at = $3,
+			type = $4,
+			country = $5,
+			region = $6,
+			city = $7,
+			postal_code = $8,
+			line1 = $9,
+			line2 = $10
+		WHERE
+			id = $1 AND company_id = $2`,
+		a.ID,
+		a.CompanyID,
+		a.UpdatedAt,
+		a.Type,
+		a.Country,
+		a.Region,
+		a.City,
+		a.PostalCode,
+		a.Line1,
+		a.Line2,
+	)
+	if err != nil {
+		return handlePSQLError(Update, err, "update address error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("can't get rows affected %v", err)
+	}
+	if ra == 0 {
+		return ErrDoesNotExist
+	}
+	return nil
+}
+
+// DeleteCompanyAddress deletes the address of the given company.
+func DeleteCompanyAddress(ctx context.Context, db sqlx.ExecerContext, companyID, id uuid.UUID) error {
+	res, err := db.ExecContext(ctx, "DELETE FROM company_address WHERE id = $1 AND company_id = $2", id, companyID)
+	if err != nil {
+		return handlePSQLError(Delete, err, "delete address error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("can't get rows affected %v", err)
+	}
+	if ra == 0 {
+		return ErrDoesNotExist
+	}
+	return nil
+}
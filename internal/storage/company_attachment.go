@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// CompanyAttachment holds the metadata of a file attached to a company, its
+// content is kept by the blob store under BlobKey.
+type CompanyAttachment struct {
+	ID uuid.UUID `db:"id"`
+	// CompanyID is NULL once the attachment or its company is deleted, the
+	// orphan attachments are purged, see GetOrphanAttachments.
+	CompanyID   uuid.NullUUID `db:"company_id"`
+	CreatedAt   time.Time     `db:"created_at"`
+	Filename    string        `db:"filename"`
+	ContentType string        `db:"content_type"`
+	Size        int64         `db:"size"`
+	// SHA256 is the hex encoded SHA-256 checksum of the content.
+	SHA256     string `db:"sha256"`
+	BlobKey    string `db:"blob_key"`
+	UploadedBy string `db:"uploaded_by"`
+}
+
+// CreateCompanyAttachment creates the given attachment, ErrDoesNotExist is
+// returned if its company does not exist.
+func CreateCompanyAttachment(ctx context.Context, db sqlx.ExecerContext, a *CompanyAttachment) error {
+	a.CreatedAt = time.Now()
+
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO company_attachment (
+			id,
+			company_id,
+			created_at,
+			filename,
+			content_type,
+			size,
+			sha256,
+			blob_key,
+			uploaded_by
+		) values ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		a.ID,
+		a.CompanyID,
+		a.CreatedAt,
+		a.Filename,
+		a.ContentType,
+		a.Size,
+		a.SHA256,
+		a.BlobKey,
+		a.UploadedBy,
+	)
+	if err != nil {
+		return handlePSQLError(Insert, err, "insert attachment error")
+	}
+	return nil
+}
+
+// GetCompanyAttachment returns the attachment of the given company.
+func GetCompanyAttachment(ctx context.Context, db sqlx.QueryerContext, companyID, id uuid.UUID) (CompanyAttachment, error) {
+	var a CompanyAttachment
+	err := sqlx.GetContext(ctx, db, &a, "SELECT * FROM company_attachment WHERE id = $1 AND company_id = $2", id, companyID)
+	if err != nil {
+		return a, handlePSQLError(Select, err, "select attachment error")
+	}
+	return a, nil
+}
+
+// GetCompanyAttachments returns the attachments of the given company, in
+// their creation order.
+func GetCompanyAttachments(ctx context.Context, db sqlx.QueryerContext, companyID uuid.UUID) ([]CompanyAttachment, error) {
+	var list []CompanyAttachment
+	err := sqlx.SelectContext(ctx, db, &list, "SELECT * FROM company_attachment WHERE company_id = $1 ORDER BY created_at, id", companyID)
+	if err != nil {
+		return nil, handlePSQLError(Select, err, "select attachments error")
+	}
+	return list, nil
+}
+
+// DeleteCompanyAttachment removes the attachment from the given company.
+// The row is kept as an orphan until its content is deleted from the blob
+// store, see DeleteOrphanAttachment.
+func DeleteCompanyAttachment(ctx context.Context, db sqlx.ExecerContext, companyID, id uuid.UUID) error {
+	res, err := db.ExecContext(ctx, "UPDATE company_attachment SET company_id = NULL WHERE id = $1 AND company_id = $2", id, companyID)
+	if err != nil {
+		return handlePSQLError(Update, err, "delete attachment error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("can't get rows affected %v", err)
+	}
+	if ra == 0 {
+		return ErrDoesNotExist
+	}
+	return nil
+}
+
+// GetOrphanAttachments returns at most limit attachments of the deleted
+// companies and the deleted attachments, the oldest first.
+func GetOrphanAttachments(ctx context.Context, db sqlx.QueryerContext, limit int) ([]CompanyAttachment, error) {
+	var list []CompanyAttachment
+	err := sqlx.SelectContext(ctx, db, &list, "SELECT * FROM company_attachment WHERE company_id IS NULL ORDER BY created_at, id LIMIT $1", limit)
+	if err != nil {
+		return nil, handlePSQLError(Select, err, "select orphan attachments error")
+	}
+	return list, nil
+}
+
+// DeleteOrphanAttachment deletes the given orphan attachment, once its
+// content is deleted.
+func DeleteOrphanAttachment(ctx context.Context, db sqlx.ExecerContext, id uuid.UUID) error {
+	res, err := db.ExecContext(ctx, "DELETE FROM company_attachment WHERE id = $1 AND company_id IS NULL", id)
+	if err != nil {
+		return handlePSQLError(Delete, err, "delete orphan attachment error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("can't get rows affected %v", err)
+	}
+	if ra == 0 {
+		return ErrDoesNotExist
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// CompanyContact is a contact person of a company.
+type CompanyContact struct {
+	ID        uuid.UUID `db:"id"`
+	CompanyID uuid.UUID `db:"company_id"`
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+	Name      string    `db:"name"`
+	Role      string    `db:"role"`
+	Email     string    `db:"email"`
+	// Phone is in the E.164 format, e.g. +35725123456.
+	Phone string `db:"phone"`
+}
+
+// CreateCompanyContact creates the given contact, ErrDoesNotExist is
+// returned if its company does not exist.
+func CreateCompanyContact(ctx context.Context, db sqlx.ExecerContext, c *CompanyContact) error {
+	c.CreatedAt = time.Now()
+	c.UpdatedAt = c.CreatedAt
+
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO company_contact (
+			id,
+			company_id,
+			created_at,
+			updated_at,
+			name,
+			role,
+			email,
+			phone
+		) values ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		c.ID,
+		c.CompanyID,
+		c.CreatedAt,
+		c.UpdatedAt,
+		c.Name,
+		c.Role,
+		c.Email,
+		c.Phone,
+	)
+	if err != nil {
+		return handlePSQLError(Insert, err, "insert contact error")
+	}
+	return nil
+}
+
+// GetCompanyContact returns the contact of the given company.
+func GetCompanyContact(ctx context.Context, db sqlx.QueryerContext, companyID, id uuid.UUID) (CompanyContact, error) {
+	var c CompanyContact
+	err := sqlx.GetContext(ctx, db, &c, "SELECT * FROM company_contact WHERE id = $1 AND company_id = $2", id, companyID)
+	if err != nil {
+		return c, handlePSQLError(Select, err, "select contact error")
+	}
+	return c, nil
+}
+
+// GetCompanyContacts returns the contacts of the given company, in their
+// creation order.
+func GetCompanyContacts(ctx context.Context, db sqlx.QueryerContext, companyID uuid.UUID) ([]CompanyContact, error) {
+	var list []CompanyContact
+	err := sqlx.SelectContext(ctx, db, &list, "SELECT * FROM company_contact WHERE company_id = $1 ORDER BY created_at, id", companyID)
+	if err != nil {
+		return nil, handlePSQLError(Select, err, "select contacts error")
+	}
+	return list, nil
+}
+
+// UpdateCompanyContact updates the given contact by its ID and company ID.
+func UpdateCompanyContact(ctx context.Context, db sqlx.ExecerContext, c *CompanyContact) error {
+	c.UpdatedAt = time.Now()
+
+	res, err := db.ExecContext(ctx, `
+		UPDATE company_contact
+		SET
+			updated_at = $3,
+			name = $4,
+			role = $5,
+			email = $6,
+			phone = $7
+		WHERE
+			id = $1 AND company_id = $2`,
+		c.ID,
+		c.CompanyID,
+		c.UpdatedAt,
+		c.Name,
+		c.Role,
+		c.Email,
+		c.Phone,
+	)
+	if err != nil {
+		return handlePSQLError(Update, err, "update contact error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("can't get rows affected %v", err)
+	}
+	if ra == 0 {
+		return ErrDoesNotExist
+	}
+	return nil
+}
+
+// DeleteCompanyContact deletes the contact of the given company.
+func DeleteCompanyContact(ctx context.Context, db sqlx.ExecerContext, companyID, id uuid.UUID) error {
+	res, err := db.ExecContext(ctx, "DELETE FROM company_contact WHERE id = $1 AND company_id = $2", id, companyID)
+	if err != nil {
+		return handlePSQLError(Delete, err, "delete contact error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("can't get rows affected %v", err)
+	}
+	if ra == 0 {
+		return ErrDoesNotExist
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+)
+
+// DuplicateSimilarity is the min. trigram similarity of the normalized
+// names of two companies to be reported as duplicates.
+const DuplicateSimilarity = 0.6
+
+// maxDuplicateCandidates defines the max. number of candidates returned by
+// FindCompanyDuplicates.
+const maxDuplicateCandidates = 10
+
+// dataMigrationSchemaVersion is the schema version recording the data
+// migrations, e.g. the backfill of the normalized names.
+const dataMigrationSchemaVersion = 17
+
+// normalizedNamesDataMigration is the name of the data migration setting
+// the normalized names of the companies created before they were stored.
+const normalizedNamesDataMigration = "company_normalized_names"
+
+// backfillBatchSize defines the number of companies updated at once by
+// BackfillNormalizedNames.
+const backfillBatchSize = 500
+
+// legalFormSuffixes holds the legal forms ignored at the end of the names.
+var legalFormSuffixes = map[string]bool{
+	"ab": true, "ag": true, "as": true, "bv": true, "co": true, "company": true,
+	"corp": true, "corporation": true, "gmbh": true, "inc": true, "incorporated": true,
+	"kg": true, "limited": true, "llc": true, "llp": true, "lp": true, "ltd": true,
+	"nv": true, "oy": true, "plc": true, "pte": true, "pty": true, "sa": true,
+	"sarl": true, "sas": true, "spa": true, "srl": true,
+}
+
+// companyColumns holds the columns of the company table.
+var companyColumns = []string{
+	"id", "created_at", "updated_at", "name", "normalized_name",
+	"description", "employees_cnt", "registered", "type", "parent_id",
+	"status", "jurisdiction", "registration_number", "vat_id", "lei",
+	"attributes", "labels",
+}
+
+// CompanyDuplicate is a company which may be a duplicate of another one.
+type CompanyDuplicate struct {
+	Company
+	// Similarity of the normalized names, 1 if they are equal.
+	Similarity float64 `db:"similarity"`
+}
+
+// CompanyDuplicatePair holds two companies which may be duplicates.
+type CompanyDuplicatePair struct {
+	First      Company `db:"a"`
+	Second     Company `db:"b"`
+	Similarity float64 `db:"similarity"`
+}
+
+// NormalizeCompanyName returns the name used to detect the duplicates: in
+// lower case, without punctuation, spaces and trailing legal forms, e.g.
+// "ACME Ltd." and "Acme, LLC" are both "acme".
+func NormalizeCompanyName(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for len(words) > 1 && legalFormSuffixes[words[len(words)-1]] {
+		words = words[:len(words)-1]
+	}
+	return strings.Join(words, "")
+}
+
+// FindCompanyDuplicates returns the companies which may be duplicates of a
+// company with the given name, the most similar first. With PostgreSQL and
+// pg_trgm the normalized names are compared by trigram similarity,
+// otherwise they must be equal.
+func FindCompanyDuplicates(ctx context.Context, db sqlx.ExtContext, name string) ([]CompanyDuplicate, error) {
+	normalized := NormalizeCompanyName(name)
+	if normalized == "" {
+		return nil, nil
+	}
+
+	trgm, err := hasTrigramExtension(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []CompanyDuplicate
+	if trgm {
+		err = sqlx.SelectContext(ctx, db, &result, `
+			SELECT c.*, similarity(c.normalized_name, $1) AS similarity
+			FROM company c
+			WHERE
+				c.normalized_name = $1
+				OR (c.normalized_name % $1 AND similarity(c.normalized_name, $1) >= $2)
+			ORDER BY similarity DESC, c.name
+			LIMIT $3`,
+			normalized,
+			DuplicateSimilarity,
+			maxDuplicateCandidates,
+		)
+	} else {
+		err = sqlx.SelectContext(ctx, db, &result, `
+			SELECT c.*, 1 AS similarity
+			FROM company c
+			WHERE c.normalized_name = $1
+			ORDER BY c.name
+			LIMIT $2`,
+			normalized,
+			maxDuplicateCandidates,
+		)
+	}
+	if err != nil {
+		return nil, handlePSQLError(Select, err, "select duplicates error")
+	}
+	return result, nil
+}
+
+// FindAllCompanyDuplicates scans all the companies and returns the pairs
+// which may be duplicates, the most similar first, at most limit.
+func FindAllCompanyDuplicates(ctx context.Context, db sqlx.ExtContext, limit int) ([]CompanyDuplicatePair, error) {
+	trgm, err := hasTrigramExtension(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var columns []string
+	for _, alias := range []string{"a", "b"} {
+		for _, c := range companyColumns {
+			columns = append(columns, fmt.Sprintf(`%s.%s AS "%s.%s"`, alias, c, alias, c))
+		}
+	}
+
+	similarity := "1"
+	join := "a.normalized_name = b.normalized_name"
+	if trgm {
+		similarity = "similarity(a.normalized_name, b.normalized_name)"
+		join = fmt.Sprintf("a.normalized_name %% b.normalized_name AND %s >= %v", similarity, DuplicateSimilarity)
+	}
+
+	var result []CompanyDuplicatePair
+	err = sqlx.SelectContext(ctx, db, &result, fmt.Sprintf(`
+		SELECT %s, %s AS similarity
+		FROM company a
+		JOIN company b ON a.id < b.id AND %s
+		WHERE a.normalized_name <> ''
+		ORDER BY similarity DESC, a.name, b.name
+		LIMIT $1`,
+		strings.Join(columns, ", "),
+		similarity,
+		join,
+	), limit)
+	if err != nil {
+		return nil, handlePSQLError(Select, err, "select duplicates error")
+	}
+	return result, nil
+}
+
+// BackfillNormalizedNames sets the normalized names of the companies
+// created before they were stored. It runs once, its completion is recorded,
+// the companies whose names normalize to an empty string are not scanned
+// again. It must be called in a transaction.
+func BackfillNormalizedNames(ctx context.Context, db sqlx.ExtContext) error {
+	var done bool
+	err := sqlx.GetContext(ctx, db, &done, "SELECT exists(SELECT 1 FROM data_migration WHERE name = $1)", normalizedNamesDataMigration)
+	if err != nil {
+		return handlePSQLError(Select, err, "select data migration error")
+	}
+	if done {
+		return nil
+	}
+
+	var n int
+	var last uuid.UUID
+	for {
+		var rows []struct {
+			ID   uuid.UUID `db:"id"`
+			Name string    `db:"name"`
+		}
+		err := sqlx.SelectContext(ctx, db, &rows, "SELECT id, name FROM company WHERE normalized_name = '' AND id > $1 ORDER BY id LIMIT $2",
+			last,
+			backfillBatchSize,
+		)
+		if err != nil {
+			return handlePSQLError(Select, err, "select companies error")
+		}
+		if len(rows) == 0 {
+			break
+		}
+		last = rows[len(rows)-1].ID
+
+		// one statement per batch: SET normalized_name = CASE id WHEN ...
+		var cases, ids []string
+		var args []interface{}
+		for _, r := range rows {
+			normalized := NormalizeCompanyName(r.Name)
+			if normalized == "" {
+				continue
+			}
+			args = append(args, r.ID, normalized)
+			cases = append(cases, fmt.Sprintf("WHEN $%d THEN $%d", len(args)-1, len(args)))
+			ids = append(ids, fmt.Sprintf("$%d", len(args)-1))
+		}
+		if len(ids) != 0 {
+			_, err = db.ExecContext(ctx, "UPDATE company SET normalized_name = CASE id "+strings.Join(cases, " ")+" END WHERE id IN ("+strings.Join(ids, ", ")+")", args...)
+			if err != nil {
+				return handlePSQLError(Update, err, "update normalized names error")
+			}
+			n += len(ids)
+		}
+
+		if len(rows) < backfillBatchSize {
+			break
+		}
+	}
+
+	// concurrent instances may both run it
+	_, err = db.ExecContext(ctx, "INSERT INTO data_migration (name, completed_at) VALUES ($1, $2) ON CONFLICT (name) DO NOTHING",
+		normalizedNamesDataMigration,
+		time.Now().UTC(),
+	)
+	if err != nil {
+		return handlePSQLError(Insert, err, "insert data migration error")
+	}
+
+	log.WithField("count", n).Info("storage: company normalized names set")
+	return nil
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeCompanyName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"Acme", "acme"},
+		{"ACME Ltd.", "acme"},
+		{"Acme, LLC", "acme"},
+		{"Acme Co. Ltd", "acme"},
+		{"Big  Corp", "big"},
+		{"Ltd", "ltd"},
+		{"Müller GmbH", "müller"},
+		{"A.B.C. Holding", "abcholding"},
+		{"...", ""},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			assert.Equal(t, tst.expected, NormalizeCompanyName(tst.name))
+		})
+	}
+}
+
+func TestBackfillNormalizedNames(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+	d := newSQLiteDB(t)
+	r := NewSQLRepository(d)
+
+	// more than a batch, and a name normalized to an empty string
+	for i := 0; i < backfillBatchSize+2; i++ {
+		c := Company{ID: uuid.Must(uuid.NewV4()), Name: fmt.Sprintf("Co %d Ltd", i), EmployeesCnt: 1, Type: 1}
+		assert.NoError(r.CreateCompany(ctx, &c))
+	}
+	empty := Company{ID: uuid.Must(uuid.NewV4()), Name: "...", EmployeesCnt: 1, Type: 1}
+	assert.NoError(r.CreateCompany(ctx, &empty))
+	_, err := d.Exec("UPDATE company SET normalized_name = ''")
+	assert.NoError(err)
+
+	backfill := func() {
+		tx, err := d.Beginx()
+		assert.NoError(err)
+		assert.NoError(BackfillNormalizedNames(ctx, tx))
+		assert.NoError(tx.Commit())
+	}
+	countEmpty := func() int {
+		var n int
+		assert.NoError(d.Get(&n, "SELECT count(*) FROM company WHERE normalized_name = ''"))
+		return n
+	}
+
+	backfill()
+	assert.Equal(1, countEmpty())
+	c, err := r.GetCompany(ctx, empty.ID)
+	assert.NoError(err)
+	assert.Equal("", c.NormalizedName)
+	var names []string
+	assert.NoError(d.Select(&names, "SELECT normalized_name FROM company WHERE name = 'Co 7 Ltd'"))
+	assert.Equal([]string{"co7"}, names)
+
+	// it runs once
+	_, err = d.Exec("UPDATE company SET normalized_name = ''")
+	assert.NoError(err)
+	backfill()
+	assert.Equal(backfillBatchSize+3, countEmpty())
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// CompanyFieldChange is a change of a field of a company. The fields are
+// named and their values formatted by the API, the old or the new value is
+// empty when the field (e.g. a label) is added or removed.
+type CompanyFieldChange struct {
+	ID        uuid.UUID `db:"id"`
+	CompanyID uuid.UUID `db:"company_id"`
+	CreatedAt time.Time `db:"created_at"`
+	Field     string    `db:"field"`
+	OldValue  string    `db:"old_value"`
+	NewValue  string    `db:"new_value"`
+	// Username is the user who made the change.
+	Username string `db:"username"`
+}
+
+// CreateCompanyFieldChanges records the given changes, made at the same
+// time.
+func CreateCompanyFieldChanges(ctx context.Context, db sqlx.ExecerContext, changes []CompanyFieldChange) error {
+	now := time.Now()
+	for i := range changes {
+		ch := &changes[i]
+		ch.CreatedAt = now
+
+		_, err := db.ExecContext(ctx, `
+			INSERT INTO company_field_change (
+				id,
+				company_id,
+				created_at,
+				field,
+				old_value,
+				new_value,
+				username
+			) values ($1, $2, $3, $4, $5, $6, $7)`,
+			ch.ID,
+			ch.CompanyID,
+			ch.CreatedAt,
+			ch.Field,
+			ch.OldValue,
+			ch.NewValue,
+			ch.Username,
+		)
+		if err != nil {
+			return handlePSQLError(Insert, err, "insert field change error")
+		}
+	}
+	return nil
+}
+
+// GetCompanyFieldChanges returns the field changes of the given company,
+// the oldest first.
+func GetCompanyFieldChanges(ctx context.Context, db sqlx.QueryerContext, companyID uuid.UUID) ([]CompanyFieldChange, error) {
+	var list []CompanyFieldChange
+	err := sqlx.SelectContext(ctx, db, &list, "SELECT * FROM company_field_change WHERE company_id = $1 ORDER BY created_at, id", companyID)
+	if err != nil {
+		return nil, handlePSQLError(Select, err, "select field changes error")
+	}
+	return list, nil
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// maxGroupDepth defines the max. depth walked in a group of companies, it
+// bounds the recursive queries.
+const maxGroupDepth = 100
+
+// CompanyNode is a company of a group with its depth below the company the
+// group was fetched from.
+type CompanyNode struct {
+	Company
+	Depth int `db:"depth"`
+}
+
+// GetCompanyAncestors returns the parent of the given company, the parent of
+// its parent and so on, the nearest first.
+func GetCompanyAncestors(ctx context.Context, db sqlx.QueryerContext, id uuid.UUID) ([]Company, error) {
+	var list []Company
+	err := sqlx.SelectContext(ctx, db, &list, `
+		WITH RECURSIVE ancestors (id, parent_id, depth) AS (
+			SELECT id, parent_id, 0 FROM company WHERE id = $1
+			UNION ALL
+			SELECT c.id, c.parent_id, a.depth + 1
+			FROM company c
+			JOIN ancestors a ON c.id = a.parent_id
+			WHERE a.depth < $2
+		)
+		SELECT c.*
+		FROM company c
+		JOIN ancestors a ON a.id = c.id
+		WHERE a.depth > 0
+		ORDER BY a.depth`,
+		id,
+		maxGroupDepth,
+	)
+	if err != nil {
+		return nil, handlePSQLError(Select, err, "select ancestors error")
+	}
+	return list, nil
+}
+
+// GetCompanyDescendants returns the subsidiaries of the given company, their
+// subsidiaries and so on, by depth (1 for the children) and name.
+func GetCompanyDescendants(ctx context.Context, db sqlx.QueryerContext, id uuid.UUID) ([]CompanyNode, error) {
+	var list []CompanyNode
+	err := sqlx.SelectContext(ctx, db, &list, `
+		WITH RECURSIVE descendants (id, depth) AS (
+			SELECT id, 1 FROM company WHERE parent_id = $1
+			UNION ALL
+			SELECT c.id, d.depth + 1
+			FROM company c
+			JOIN descendants d ON c.parent_id = d.id
+			WHERE d.depth < $2
+		)
+		SELECT c.*, d.depth
+		FROM company c
+		JOIN descendants d ON d.id = c.id
+		ORDER BY d.depth, c.name`,
+		id,
+		maxGroupDepth,
+	)
+	if err != nil {
+		return nil, handlePSQLError(Select, err, "select descendants error")
+	}
+	return list, nil
+}
+
+// ReparentCompanyChildren moves the children of the given company to its
+// parent, they become top-level companies if it has none.
+func ReparentCompanyChildren(ctx context.Context, db sqlx.ExecerContext, id uuid.UUID) error {
+	_, err := db.ExecContext(ctx, `
+		UPDATE company
+		SET parent_id = (SELECT parent_id FROM company WHERE id = $1)
+		WHERE parent_id = $1`,
+		id,
+	)
+	if err != nil {
+		return handlePSQLError(Update, err, "update children error")
+	}
+	return nil
+}
+
+// checkCompanyParent returns ErrCompanyParentCycle if the parent of the
+// given company is the company itself or one of its descendants.
+func checkCompanyParent(ctx context.Context, db sqlx.QueryerContext, c *Company) error {
+	if !c.ParentID.Valid {
+		return nil
+	}
+	if c.ParentID.UUID == c.ID {
+		return ErrCompanyParentCycle
+	}
+
+	ancestors, err := GetCompanyAncestors(ctx, db, c.ParentID.UUID)
+	if err != nil {
+		return err
+	}
+	for _, a := range ancestors {
+		if a.ID == c.ID {
+			return ErrCompanyParentCycle
+		}
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package storage
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// The operators of the label selector requirements.
+const (
+	LabelEquals    = "="
+	LabelNotEquals = "!="
+	LabelIn        = "in"
+	LabelNotIn     = "notin"
+	LabelExists    = "exists"
+	LabelNotExists = "!"
+)
+
+// CompanyLabels holds the key/value labels of a company, stored as a JSON
+// object.
+type CompanyLabels map[string]string
+
+// Value implements driver.Valuer.
+func (l CompanyLabels) Value() (driver.Value, error) {
+	if l == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(map[string]string(l))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan implements sql.Scanner.
+func (l *CompanyLabels) Scan(src interface{}) error {
+	*l = nil
+	return scanJSON(src, (*map[string]string)(l))
+}
+
+// clone returns a copy of the labels, nil if there are none.
+func (l CompanyLabels) clone() CompanyLabels {
+	if len(l) == 0 {
+		return nil
+	}
+	out := make(CompanyLabels, len(l))
+	for k, v := range l {
+		out[k] = v
+	}
+	return out
+}
+
+// LabelRequirement is a requirement of a label selector, e.g. the key
+// "tier", the operator LabelIn and the values "gold" and "silver". The
+// values are the one of LabelEquals and LabelNotEquals, none for
+// LabelExists and LabelNotExists.
+type LabelRequirement struct {
+	Key      string
+	Operator string
+	Values   []string
+}
+
+// LabelSelector selects the companies matching all its requirements. Like
+// with Kubernetes, LabelNotEquals and LabelNotIn match the companies
+// without the label.
+type LabelSelector []LabelRequirement
+
+// Match returns true if the given labels match the selector.
+func (s LabelSelector) Match(labels CompanyLabels) bool {
+	for _, r := range s {
+		value, ok := labels[r.Key]
+		switch r.Operator {
+		case LabelEquals, LabelIn:
+			if !ok || !containsString(r.Values, value) {
+				return false
+			}
+		case LabelNotEquals, LabelNotIn:
+			if ok && containsString(r.Values, value) {
+				return false
+			}
+		case LabelExists:
+			if !ok {
+				return false
+			}
+		case LabelNotExists:
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// conditions returns the SQL conditions of the selector, their arguments
+// are appended to the given ones.
+func (s LabelSelector) conditions(driverName string, args []interface{}) ([]string, []interface{}) {
+	var conds []string
+	for _, r := range s {
+		// the value of the label, NULL if the company has none
+		if driverName == DriverPostgres {
+			args = append(args, r.Key)
+		} else {
+			args = append(args, labelPath(r.Key))
+		}
+		value := fmt.Sprintf("labels ->> $%d", len(args))
+		if driverName != DriverPostgres {
+			value = fmt.Sprintf("json_extract(labels, $%d)", len(args))
+		}
+
+		placeholders := make([]string, len(r.Values))
+		for i, v := range r.Values {
+			args = append(args, v)
+			placeholders[i] = fmt.Sprintf("$%d", len(args))
+		}
+		in := strings.Join(placeholders, ", ")
+
+		switch r.Operator {
+		case LabelEquals, LabelIn:
+			conds = append(conds, fmt.Sprintf("%s IN (%s)", value, in))
+		case LabelNotEquals, LabelNotIn:
+			conds = append(conds, fmt.Sprintf("(%s IS NULL OR %s NOT IN (%s))", value, value, in))
+		case LabelExists:
+			conds = append(conds, value+" IS NOT NULL")
+		case LabelNotExists:
+			conds = append(conds, value+" IS NULL")
+		}
+	}
+	return conds, args
+}
+
+// labelPath returns the SQLite JSON path of the given label key, the keys
+// are validated by the API and contain no quotes.
+func labelPath(key string) string {
+	return `$."` + key + `"`
+}
+
+// LabelCount is the number of companies having a label.
+type LabelCount struct {
+	Key   string `db:"key"`
+	Value string `db:"value"`
+	Count int64  `db:"count"`
+}
+
+// AddCompanyLabels adds the given labels to the company, replacing the
+// values of its labels with the same keys, and returns all its labels.
+func AddCompanyLabels(ctx context.Context, db sqlx.ExtContext, id uuid.UUID, labels CompanyLabels) (CompanyLabels, error) {
+	query := "UPDATE company SET labels = labels || $2::jsonb, updated_at = $3 WHERE id = $1 RETURNING labels"
+	if db.DriverName() != DriverPostgres {
+		query = "UPDATE company SET labels = json_patch(labels, $2), updated_at = $3 WHERE id = $1 RETURNING labels"
+	}
+
+	var result CompanyLabels
+	if err := sqlx.GetContext(ctx, db, &result, query, id, labels, time.Now()); err != nil {
+		return nil, handlePSQLError(Update, err, "add labels error")
+	}
+	return result, nil
+}
+
+// RemoveCompanyLabels removes the labels of the given keys from the
+// company and returns its remaining labels.
+func RemoveCompanyLabels(ctx context.Context, db sqlx.ExtContext, id uuid.UUID, keys []string) (CompanyLabels, error) {
+	query := "UPDATE company SET labels = labels - $3::text[], updated_at = $2 WHERE id = $1 RETURNING labels"
+	args := []interface{}{id, time.Now(), pq.Array(keys)}
+	if db.DriverName() != DriverPostgres {
+		args = args[:2]
+		paths := []string{"labels"}
+		for _, k := range keys {
+			args = append(args, labelPath(k))
+			paths = append(paths, fmt.Sprintf("$%d", len(args)))
+		}
+		query = "UPDATE company SET labels = json_remove(" + strings.Join(paths, ", ") + "), updated_at = $2 WHERE id = $1 RETURNING labels"
+	}
+
+	var result CompanyLabels
+	if err := sqlx.GetContext(ctx, db, &result, query, args...); err != nil {
+		return nil, handlePSQLError(Update, err, "remove labels error")
+	}
+	return result, nil
+}
+
+// CountCompanyLabels returns the number of companies matching the filters
+// per label, of the given key only if it is not empty, ordered by key and
+// by count, the largest first.
+func CountCompanyLabels(ctx context.Context, db sqlx.ExtContext, filters CompanyFilters, key string) ([]LabelCount, error) {
+	each := "jsonb_each_text"
+	if db.DriverName() != DriverPostgres {
+		each = "json_each"
+	}
+
+	where, args := filters.where(db.DriverName())
+	query := "SELECT l.key, l.value, count(*) AS count FROM (SELECT labels FROM company " + where + ") c, " +
+		each + "(c.labels) l"
+	if key != "" {
+		args = append(args, key)
+		query += fmt.Sprintf(" WHERE l.key = $%d", len(args))
+	}
+	query += " GROUP BY l.key, l.value ORDER BY l.key, count DESC, l.value"
+
+	var list []LabelCount
+	if err := sqlx.SelectContext(ctx, db, &list, query, args...); err != nil {
+		return nil, handlePSQLError(Select, err, "count labels error")
+	}
+	return list, nil
+}
+
+// countLabels counts the labels of the given companies like
+// CountCompanyLabels does.
+func countLabels(companies []Company, key string) []LabelCount {
+	counts := make(map[[2]string]int64)
+	for _, c := range companies {
+		for k, v := range c.Labels {
+			if key == "" || k == key {
+				counts[[2]string{k, v}]++
+			}
+		}
+	}
+
+	list := make([]LabelCount, 0, len(counts))
+	for kv, n := range counts {
+		list = append(list, LabelCount{Key: kv[0], Value: kv[1], Count: n})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Key != list[j].Key {
+			return list[i].Key < list[j].Key
+		}
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Value < list[j].Value
+	})
+	return list
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// MergeCompany merges the source company into the given target: the target
+// is updated, the records, the history and the subsidiaries of the source
+// are moved to the target, the source is deleted and a redirect from its ID
+// to the target is stored. ErrOwnershipExceeded is returned if the direct
+// stakes in the target would exceed 100%. It must be called in a
+// transaction.
+func MergeCompany(ctx context.Context, db sqlx.ExtContext, sourceID uuid.UUID, target *Company) error {
+	if _, err := GetCompany(ctx, db, target.ID); err != nil {
+		return err
+	}
+	if err := lockCompanyOwnerships(ctx, db, target.ID); err != nil {
+		return err
+	}
+
+	// a subsidiary of the source takes its place in the group
+	ancestors, err := GetCompanyAncestors(ctx, db, target.ID)
+	if err != nil {
+		return err
+	}
+	for _, a := range ancestors {
+		if a.ID == sourceID {
+			target.ParentID = a.ParentID
+		}
+	}
+
+	for _, query := range []string{
+		// the companies merged into the source before
+		"UPDATE company_redirect SET target_id = $2 WHERE target_id = $1",
+		"UPDATE company_address SET company_id = $2 WHERE company_id = $1",
+		"UPDATE company_contact SET company_id = $2 WHERE company_id = $1",
+		"UPDATE company_attachment SET company_id = $2 WHERE company_id = $1",
+		"UPDATE company_note SET company_id = $2 WHERE company_id = $1",
+		// the history of the source is kept in the one of the target
+		"UPDATE company_status_history SET company_id = $2 WHERE company_id = $1",
+		"UPDATE company_field_change SET company_id = $2 WHERE company_id = $1",
+		// the stakes between both companies would become self-ownership
+		"DELETE FROM ownership WHERE (company_id = $1 AND owner_company_id = $2) OR (company_id = $2 AND owner_company_id = $1)",
+		"UPDATE ownership SET company_id = $2 WHERE company_id = $1",
+		"UPDATE ownership SET owner_company_id = $2 WHERE owner_company_id = $1",
+		// the target may be one of them, it is updated below
+		"UPDATE company SET parent_id = $2 WHERE parent_id = $1",
+	} {
+		if _, err := db.ExecContext(ctx, query, sourceID, target.ID); err != nil {
+			return handlePSQLError(Update, err, "move records error")
+		}
+	}
+	// the stakes of the source are added to the ones of the target
+	stakes, err := GetCompanyOwnerships(ctx, db, target.ID)
+	if err != nil {
+		return err
+	}
+	if err := validateOwnershipTotals(stakes); err != nil {
+		return err
+	}
+
+	// the source goes first, the target may take its name
+	if err := DeleteCompany(ctx, db, sourceID); err != nil {
+		return err
+	}
+	if err := UpdateCompany(ctx, db, target); err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, "INSERT INTO company_redirect (id, created_at, target_id) VALUES ($1, $2, $3)",
+		sourceID,
+		time.Now(),
+		target.ID,
+	)
+	if err != nil {
+		return handlePSQLError(Insert, err, "insert redirect error")
+	}
+	return nil
+}
+
+// GetCompanyRedirect returns the ID of the company the given company was
+// merged into, ErrDoesNotExist if it was not merged.
+func GetCompanyRedirect(ctx context.Context, db sqlx.QueryerContext, id uuid.UUID) (uuid.UUID, error) {
+	var target uuid.UUID
+	err := sqlx.GetContext(ctx, db, &target, "SELECT target_id FROM company_redirect WHERE id = $1", id)
+	if err != nil {
+		return target, handlePSQLError(Select, err, "select redirect error")
+	}
+	return target, nil
+}
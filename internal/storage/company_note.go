@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// CompanyNote is a note about a company, its body is markdown.
+type CompanyNote struct {
+	ID        uuid.UUID `db:"id"`
+	CompanyID uuid.UUID `db:"company_id"`
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+	// Author is the username of the user who created the note.
+	Author string `db:"author"`
+	Body   string `db:"body"`
+	Pinned bool   `db:"pinned"`
+	// Version is the number of the current version, starting at 1, see
+	// CompanyNoteVersion.
+	Version int32 `db:"version"`
+}
+
+// CompanyNoteVersion is a version of a note, the first one is created with
+// the note and one more by every update.
+type CompanyNoteVersion struct {
+	NoteID    uuid.UUID `db:"note_id"`
+	Version   int32     `db:"version"`
+	CreatedAt time.Time `db:"created_at"`
+	// Username is the user who created or updated the note.
+	Username string `db:"username"`
+	Body     string `db:"body"`
+	Pinned   bool   `db:"pinned"`
+}
+
+// CreateCompanyNote creates the given note and its first version,
+// ErrDoesNotExist is returned if its company does not exist.
+func CreateCompanyNote(ctx context.Context, db sqlx.ExecerContext, n *CompanyNote) error {
+	n.CreatedAt = time.Now()
+	n.UpdatedAt = n.CreatedAt
+	n.Version = 1
+
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO company_note (
+			id,
+			company_id,
+			created_at,
+			updated_at,
+			author,
+			body,
+			pinned,
+			version
+		) values ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		n.ID,
+		n.CompanyID,
+		n.CreatedAt,
+		n.UpdatedAt,
+		n.Author,
+		n.Body,
+		n.Pinned,
+		n.Version,
+	)
+	if err != nil {
+		return handlePSQLError(Insert, err, "insert note error")
+	}
+	return createCompanyNoteVersion(ctx, db, n, n.Author)
+}
+
+func createCompanyNoteVersion(ctx context.Context, db sqlx.ExecerContext, n *CompanyNote, username string) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO company_note_version (
+			note_id,
+			version,
+			created_at,
+			username,
+			body,
+			pinned
+		) values ($1, $2, $3, $4, $5, $6)`,
+		n.ID,
+		n.Version,
+		n.UpdatedAt,
+		username,
+		n.Body,
+		n.Pinned,
+	)
+	if err != nil {
+		return handlePSQLError(Insert, err, "insert note version error")
+	}
+	return nil
+}
+
+// GetCompanyNote returns the note of the given company.
+func GetCompanyNote(ctx context.Context, db sqlx.QueryerContext, companyID, id uuid.UUID) (CompanyNote, error) {
+	var n CompanyNote
+	err := sqlx.GetContext(ctx, db, &n, "SELECT * FROM company_note WHERE id = $1 AND company_id = $2", id, companyID)
+	if err != nil {
+		return n, handlePSQLError(Select, err, "select note error")
+	}
+	return n, nil
+}
+
+// GetCompanyNotes returns the notes of the given company, the pinned ones
+// first, then in their creation order.
+func GetCompanyNotes(ctx context.Context, db sqlx.QueryerContext, companyID uuid.UUID) ([]CompanyNote, error) {
+	var list []CompanyNote
+	err := sqlx.SelectContext(ctx, db, &list, "SELECT * FROM company_note WHERE company_id = $1 ORDER BY pinned DESC, created_at, id", companyID)
+	if err != nil {
+		return nil, handlePSQLError(Select, err, "select notes error")
+	}
+	return list, nil
+}
+
+// UpdateCompanyNote updates the body and the pinned flag of the given note
+// and records its new version, made by the given user. The other fields are
+// set from the database. It must be called in a transaction.
+func UpdateCompanyNote(ctx context.Context, db sqlx.ExtContext, n *CompanyNote, username string) error {
+	err := sqlx.GetContext(ctx, db, n, `
+		UPDATE company_note
+		SET
+			updated_at = $3,
+			body = $4,
+			pinned = $5,
+			version = version + 1
+		WHERE
+			id = $1 AND company_id = $2
+		RETURNING *`,
+		n.ID,
+		n.CompanyID,
+		time.Now(),
+		n.Body,
+		n.Pinned,
+	)
+	if err != nil {
+		return handlePSQLError(Update, err, "update note error")
+	}
+	return createCompanyNoteVersion(ctx, db, n, username)
+}
+
+// DeleteCompanyNote deletes the note of the given company with its versions.
+func DeleteCompanyNote(ctx context.Context, db sqlx.ExecerContext, companyID, id uuid.UUID) error {
+	res, err := db.ExecContext(ctx, "DELETE FROM company_note WHERE id = $1 AND company_id = $2", id, companyID)
+	if err != nil {
+		return handlePSQLError(Delete, err, "delete note error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("can't get rows affected %v", err)
+	}
+	if ra == 0 {
+		return ErrDoesNotExist
+	}
+	return nil
+}
+
+// GetCompanyNoteVersions returns the versions of the note of the given
+// company, the oldest first. ErrDoesNotExist is returned if the note does
+// not exist.
+func GetCompanyNoteVersions(ctx context.Context, db sqlx.QueryerContext, companyID, noteID uuid.UUID) ([]CompanyNoteVersion, error) {
+	var list []CompanyNoteVersion
+	err := sqlx.SelectContext(ctx, db, &list, `
+		SELECT v.*
+		FROM company_note_version v
+		JOIN company_note n ON n.id = v.note_id
+		WHERE v.note_id = $1 AND n.company_id = $2
+		ORDER BY v.version`,
+		noteID,
+		companyID,
+	)
+	if err != nil {
+		return nil, handlePSQLError(Select, err, "select note versions error")
+	}
+	if len(list) == 0 {
+		return nil, ErrDoesNotExist
+	}
+	return list, nil
+}
@@ -0,0 +1,250 @@
+package storage
+
+import (
+	"context"
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Highlight markers of the search snippets.
+const (
+	SnippetStartSel = "<b>"
+	SnippetStopSel  = "</b>"
+)
+
+// Markers of the matches in the headlines of the full-text search, they are
+// replaced by the highlight markers once the text is escaped. They are
+// private use characters, removed from the descriptions beforehand.
+const (
+	headlineStartSel = "\ue000"
+	headlineStopSel  = "\ue001"
+)
+
+// headlineOptions are the options of ts_headline.
+const headlineOptions = `StartSel="` + headlineStartSel + `", StopSel="` + headlineStopSel + `", MaxFragments=2, MaxWords=20, MinWords=5`
+
+// snippetContext defines the number of characters kept around the match
+// in the snippets of the LIKE search.
+const snippetContext = 40
+
+// CompanySearchResult is a company found by SearchCompanies.
+type CompanySearchResult struct {
+	Company
+	// Rank orders the results, the higher the better.
+	Rank float64 `db:"rank"`
+	// Snippet is the HTML escaped part of the description matching the
+	// query, with the matches between SnippetStartSel and SnippetStopSel.
+	Snippet string `db:"snippet"`
+}
+
+// SearchCompanies returns the companies best matching the query, at most
+// limit. With PostgreSQL and pg_trgm the names are matched by trigram
+// similarity, tolerating typos, and the descriptions by full-text search.
+// Without pg_trgm, and with SQLite, the names and the descriptions are
+// matched case-insensitively by substring. Only the companies matching the
+// filters are returned.
+func SearchCompanies(ctx context.Context, db sqlx.ExtContext, query string, filters CompanyFilters, limit int) ([]CompanySearchResult, error) {
+	var results []CompanySearchResult
+
+	trgm, err := hasTrigramExtension(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	if trgm {
+		conds, args := filters.conditions(db.DriverName(), []interface{}{
+			query,
+			limit,
+			headlineStartSel + headlineStopSel,
+			headlineOptions,
+		})
+		err = sqlx.SelectContext(ctx, db, &results, `
+			SELECT
+				c.*,
+				greatest(similarity(c.name, $1), word_similarity($1, c.name)) * 2
+					+ ts_rank(to_tsvector('english', c.description), plainto_tsquery('english', $1)) AS rank,
+				CASE
+					WHEN to_tsvector('english', c.description) @@ plainto_tsquery('english', $1)
+					THEN ts_headline('english', translate(c.description, $3, ''), plainto_tsquery('english', $1), $4)
+					ELSE ''
+				END AS snippet
+			FROM company c
+			WHERE
+				(c.name % $1
+				OR $1 <% c.name
+				OR to_tsvector('english', c.description) @@ plainto_tsquery('english', $1))
+				`+andConditions(conds)+`
+			ORDER BY rank DESC, c.name
+			LIMIT $2`,
+			args...,
+		)
+		if err != nil {
+			return nil, handlePSQLError(Select, err, "search error")
+		}
+
+		// the description is user input, only the markers are HTML
+		for i := range results {
+			results[i].Snippet = highlightHeadline(results[i].Snippet)
+		}
+		return results, nil
+	}
+
+	pattern := "%" + escapeLike(strings.ToLower(query)) + "%"
+	conds, args := filters.conditions(db.DriverName(), []interface{}{
+		query,
+		escapeLike(strings.ToLower(query)) + "%",
+		pattern,
+		limit,
+	})
+	err = sqlx.SelectContext(ctx, db, &results, `
+		SELECT
+			c.*,
+			CASE
+				WHEN lower(c.name) = lower($1) THEN 3
+				WHEN lower(c.name) LIKE $2 ESCAPE '\' THEN 2
+				WHEN lower(c.name) LIKE $3 ESCAPE '\' THEN 1
+				ELSE 0.5
+			END AS rank,
+			'' AS snippet
+		FROM company c
+		WHERE
+			(lower(c.name) LIKE $3 ESCAPE '\'
+			OR lower(c.description) LIKE $3 ESCAPE '\')
+			`+andConditions(conds)+`
+		ORDER BY rank DESC, c.name
+		LIMIT $4`,
+		args...,
+	)
+	if err != nil {
+		return nil, handlePSQLError(Select, err, "search error")
+	}
+
+	for i := range results {
+		results[i].Snippet = highlightSnippet(results[i].Description, query)
+	}
+	return results, nil
+}
+
+// andConditions returns the given conditions joined and prefixed by AND,
+// to be appended to a WHERE clause.
+func andConditions(conds []string) string {
+	var b strings.Builder
+	for _, c := range conds {
+		b.WriteString(" AND ")
+		b.WriteString(c)
+	}
+	return b.String()
+}
+
+// hasTrigramExtension returns true if the database is PostgreSQL with the
+// pg_trgm extension.
+func hasTrigramExtension(ctx context.Context, db sqlx.ExtContext) (bool, error) {
+	if db.DriverName() != DriverPostgres {
+		return false, nil
+	}
+
+	var trgm bool
+	err := sqlx.GetContext(ctx, db, &trgm, "SELECT exists(SELECT 1 FROM pg_extension WHERE extname = 'pg_trgm')")
+	if err != nil {
+		return false, handlePSQLError(Select, err, "select extension error")
+	}
+	return trgm, nil
+}
+
+// likeSearchRank returns the rank of the LIKE search for the given company,
+// 0 if it does not match.
+func likeSearchRank(c Company, query string) float64 {
+	name := strings.ToLower(c.Name)
+	q := strings.ToLower(query)
+
+	switch {
+	case name == q:
+		return 3
+	case strings.HasPrefix(name, q):
+		return 2
+	case strings.Contains(name, q):
+		return 1
+	case strings.Contains(strings.ToLower(c.Description), q):
+		return 0.5
+	default:
+		return 0
+	}
+}
+
+// highlightHeadline returns the HTML escaped headline of the full-text
+// search with the markers of the matches replaced by the highlight markers.
+func highlightHeadline(headline string) string {
+	return strings.NewReplacer(
+		headlineStartSel, SnippetStartSel,
+		headlineStopSel, SnippetStopSel,
+	).Replace(html.EscapeString(headline))
+}
+
+// highlightSnippet returns the HTML escaped part of the text around the
+// first match of the query, highlighted, or an empty string if the text
+// does not match.
+func highlightSnippet(text, query string) string {
+	if query == "" {
+		return ""
+	}
+	i := strings.Index(strings.ToLower(text), strings.ToLower(query))
+	if i < 0 || len(strings.ToLower(text)) != len(text) {
+		// no match, or lowering changed the byte offsets
+		return ""
+	}
+	end := i + len(query)
+
+	start := i
+	for n := 0; start > 0 && n < snippetContext; n++ {
+		_, size := utf8.DecodeLastRuneInString(text[:start])
+		start -= size
+	}
+	// don't cut the first word
+	if r, _ := utf8.DecodeLastRuneInString(text[:start]); start > 0 && !unicode.IsSpace(r) {
+		for start < i {
+			r, size := utf8.DecodeRuneInString(text[start:])
+			start += size
+			if unicode.IsSpace(r) {
+				break
+			}
+		}
+	}
+
+	stop := end
+	for n := 0; stop < len(text) && n < snippetContext; n++ {
+		_, size := utf8.DecodeRuneInString(text[stop:])
+		stop += size
+	}
+	// don't cut the last word
+	for stop < len(text) {
+		r, size := utf8.DecodeRuneInString(text[stop:])
+		if unicode.IsSpace(r) {
+			break
+		}
+		stop += size
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("...")
+	}
+	b.WriteString(html.EscapeString(text[start:i]))
+	b.WriteString(SnippetStartSel)
+	b.WriteString(html.EscapeString(text[i:end]))
+	b.WriteString(SnippetStopSel)
+	b.WriteString(html.EscapeString(text[end:stop]))
+	if stop < len(text) {
+		b.WriteString("...")
+	}
+	return b.String()
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern, with '\' as the
+// escape character.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
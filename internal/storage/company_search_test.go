@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHighlightSnippet(t *testing.T) {
+	long := strings.Repeat("word ", 20)
+
+	tests := []struct {
+		Name     string
+		Text     string
+		Query    string
+		Expected string
+	}{
+		{
+			Name:     "whole text",
+			Text:     "Rockets by ACME inc.",
+			Query:    "acme",
+			Expected: "Rockets by <b>ACME</b> inc.",
+		},
+		{
+			Name:     "no match",
+			Text:     "Rockets",
+			Query:    "acme",
+			Expected: "",
+		},
+		{
+			Name:     "cut around the match",
+			Text:     long + "acme" + " " + long,
+			Query:    "acme",
+			Expected: "...word word word word word word word word <b>acme</b> word word word word word word word word...",
+		},
+		{
+			Name:     "cut in a word",
+			Text:     "xyz" + strings.Repeat("a", 40) + " acme",
+			Query:    "acme",
+			Expected: "...<b>acme</b>",
+		},
+		{
+			Name:     "escaped",
+			Text:     `<script>alert("acme")</script> & <b>`,
+			Query:    "acme",
+			Expected: `&lt;script&gt;alert(&#34;<b>acme</b>&#34;)&lt;/script&gt; &amp; &lt;b&gt;`,
+		},
+		{
+			Name:     "escaped query",
+			Text:     "R&D <lab>",
+			Query:    "<lab>",
+			Expected: "R&amp;D <b>&lt;lab&gt;</b>",
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			require.Equal(t, tst.Expected, highlightSnippet(tst.Text, tst.Query))
+		})
+	}
+}
+
+func TestHighlightHeadline(t *testing.T) {
+	headline := "<i>the</i> " + headlineStartSel + "acme" + headlineStopSel + " & co"
+	require.Equal(t, "&lt;i&gt;the&lt;/i&gt; <b>acme</b> &amp; co", highlightHeadline(headline))
+}
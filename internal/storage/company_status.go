@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// CompanyStatusChange is a transition of the lifecycle status of a
+// company, the statuses are the values of the CompanyStatus enum of the
+// API.
+type CompanyStatusChange struct {
+	ID         uuid.UUID `db:"id"`
+	CompanyID  uuid.UUID `db:"company_id"`
+	CreatedAt  time.Time `db:"created_at"`
+	FromStatus uint32    `db:"from_status"`
+	ToStatus   uint32    `db:"to_status"`
+	Reason     string    `db:"reason"`
+	// Username is the user who made the change.
+	Username string `db:"username"`
+}
+
+// TransitionCompanyStatus changes the status of the company from FromStatus
+// to ToStatus and records the change, ErrCompanyStatusChanged is returned if
+// the company is not in FromStatus anymore. It must be called in a
+// transaction.
+func TransitionCompanyStatus(ctx context.Context, db sqlx.ExtContext, ch *CompanyStatusChange) error {
+	ch.CreatedAt = time.Now()
+
+	res, err := db.ExecContext(ctx, `
+		UPDATE company
+		SET
+			status = $3,
+			updated_at = $4
+		WHERE
+			id = $1 AND status = $2`,
+		ch.CompanyID,
+		ch.FromStatus,
+		ch.ToStatus,
+		ch.CreatedAt,
+	)
+	if err != nil {
+		return handlePSQLError(Update, err, "update status error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("can't get rows affected %v", err)
+	}
+	if ra == 0 {
+		if _, err := GetCompany(ctx, db, ch.CompanyID); err != nil {
+			return err
+		}
+		return ErrCompanyStatusChanged
+	}
+
+	return insertCompanyStatusChange(ctx, db, ch)
+}
+
+// CreateCompanyStatusChange records the given status change without
+// changing the status of the company, the initial status of a new company
+// is recorded as a change from UnknownStatus.
+func CreateCompanyStatusChange(ctx context.Context, db sqlx.ExecerContext, ch *CompanyStatusChange) error {
+	ch.CreatedAt = time.Now()
+	return insertCompanyStatusChange(ctx, db, ch)
+}
+
+func insertCompanyStatusChange(ctx context.Context, db sqlx.ExecerContext, ch *CompanyStatusChange) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO company_status_history (
+			id,
+			company_id,
+			created_at,
+			from_status,
+			to_status,
+			reason,
+			username
+		) values ($1, $2, $3, $4, $5, $6, $7)`,
+		ch.ID,
+		ch.CompanyID,
+		ch.CreatedAt,
+		ch.FromStatus,
+		ch.ToStatus,
+		ch.Reason,
+		ch.Username,
+	)
+	if err != nil {
+		return handlePSQLError(Insert, err, "insert status change error")
+	}
+	return nil
+}
+
+// GetCompanyStatusHistory returns the status changes of the given company,
+// the oldest first.
+func GetCompanyStatusHistory(ctx context.Context, db sqlx.QueryerContext, companyID uuid.UUID) ([]CompanyStatusChange, error) {
+	var list []CompanyStatusChange
+	err := sqlx.SelectContext(ctx, db, &list, "SELECT * FROM company_status_history WHERE company_id = $1 ORDER BY created_at, id", companyID)
+	if err != nil {
+		return nil, handlePSQLError(Select, err, "select status history error")
+	}
+	return list, nil
+}
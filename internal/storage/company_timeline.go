@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// Kinds of the timeline entries.
+const (
+	TimelineNote         = "note"
+	TimelineFieldChange  = "field_change"
+	TimelineStatusChange = "status_change"
+)
+
+// CompanyTimelineEntry is an entry of the timeline of a company, one of
+// Note, FieldChange and StatusChange is set according to Kind.
+type CompanyTimelineEntry struct {
+	Kind         string
+	CreatedAt    time.Time
+	ID           uuid.UUID
+	Note         *CompanyNote
+	FieldChange  *CompanyFieldChange
+	StatusChange *CompanyStatusChange
+}
+
+// TimelinePosition is the position of an entry in the timeline, the entries
+// are sorted by time then ID.
+type TimelinePosition struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// CompanyTimelineQuery selects a page of the timeline of a company.
+type CompanyTimelineQuery struct {
+	CompanyID uuid.UUID
+	// After is the position of the last entry of the previous page, nil
+	// for the first page.
+	After *TimelinePosition
+	// NewestFirst reverses the order of the entries.
+	NewestFirst bool
+	Limit       int
+}
+
+// timelineRow is a row of the union of the timeline tables, the columns of
+// the other kinds are empty.
+type timelineRow struct {
+	Kind       string    `db:"kind"`
+	ID         uuid.UUID `db:"id"`
+	CreatedAt  time.Time `db:"created_at"`
+	UpdatedAt  time.Time `db:"updated_at"`
+	Username   string    `db:"username"`
+	Body       string    `db:"body"`
+	Pinned     bool      `db:"pinned"`
+	Version    int32     `db:"version"`
+	Field      string    `db:"field"`
+	OldValue   string    `db:"old_value"`
+	NewValue   string    `db:"new_value"`
+	FromStatus uint32    `db:"from_status"`
+	ToStatus   uint32    `db:"to_status"`
+	Reason     string    `db:"reason"`
+}
+
+// GetCompanyTimeline returns a page of the notes, the field changes and the
+// status changes of the company merged in one feed, sorted by time then ID,
+// the oldest first unless q.NewestFirst. The page starts after q.After.
+func GetCompanyTimeline(ctx context.Context, db sqlx.QueryerContext, q CompanyTimelineQuery) ([]CompanyTimelineEntry, error) {
+	// the position condition is repeated in every branch, so that it is
+	// served by the company_id, created_at indexes
+	after, order := "", "ASC"
+	if q.NewestFirst {
+		order = "DESC"
+	}
+	args := []interface{}{q.CompanyID, q.Limit}
+	if q.After != nil {
+		op := ">"
+		if q.NewestFirst {
+			op = "<"
+		}
+		after = " AND (created_at " + op + " $3 OR (created_at = $3 AND id " + op + " $4))"
+		args = append(args, q.After.CreatedAt, q.After.ID)
+	}
+
+	var rows []timelineRow
+	err := sqlx.SelectContext(ctx, db, &rows, `
+		SELECT
+			'`+TimelineNote+`' AS kind,
+			id,
+			created_at,
+			updated_at,
+			author AS username,
+			body,
+			pinned,
+			version,
+			'' AS field,
+			'' AS old_value,
+			'' AS new_value,
+			0 AS from_status,
+			0 AS to_status,
+			'' AS reason
+		FROM company_note
+		WHERE company_id = $1`+after+`
+		UNION ALL
+		SELECT
+			'`+TimelineFieldChange+`',
+			id,
+			created_at,
+			created_at,
+			username,
+			'',
+			false,
+			0,
+			field,
+			old_value,
+			new_value,
+			0,
+			0,
+			''
+		FROM company_field_change
+		WHERE company_id = $1`+after+`
+		UNION ALL
+		SELECT
+			'`+TimelineStatusChange+`',
+			id,
+			created_at,
+			created_at,
+			username,
+			'',
+			false,
+			0,
+			'',
+			'',
+			'',
+			from_status,
+			to_status,
+			reason
+		FROM company_status_history
+		WHERE company_id = $1`+after+`
+		ORDER BY created_at `+order+`, id `+order+`
+		LIMIT $2`,
+		args...,
+	)
+	if err != nil {
+		return nil, handlePSQLError(Select, err, "select timeline error")
+	}
+
+	entries := make([]CompanyTimelineEntry, 0, len(rows))
+	for _, r := range rows {
+		e := CompanyTimelineEntry{Kind: r.Kind, CreatedAt: r.CreatedAt, ID: r.ID}
+		switch r.Kind {
+		case TimelineNote:
+			e.Note = &CompanyNote{
+				ID:        r.ID,
+				CompanyID: q.CompanyID,
+				CreatedAt: r.CreatedAt,
+				UpdatedAt: r.UpdatedAt,
+				Author:    r.Username,
+				Body:      r.Body,
+				Pinned:    r.Pinned,
+				Version:   r.Version,
+			}
+		case TimelineFieldChange:
+			e.FieldChange = &CompanyFieldChange{
+				ID:        r.ID,
+				CompanyID: q.CompanyID,
+				CreatedAt: r.CreatedAt,
+				Field:     r.Field,
+				OldValue:  r.OldValue,
+				NewValue:  r.NewValue,
+				Username:  r.Username,
+			}
+		case TimelineStatusChange:
+			e.StatusChange = &CompanyStatusChange{
+				ID:         r.ID,
+				CompanyID:  q.CompanyID,
+				CreatedAt:  r.CreatedAt,
+				FromStatus: r.FromStatus,
+				ToStatus:   r.ToStatus,
+				Reason:     r.Reason,
+				Username:   r.Username,
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
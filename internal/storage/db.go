@@ -1,15 +1,23 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
 
-	// register postgresql driver
+	// register postgresql and sqlite drivers
 	_ "github.com/lib/pq"
 	log "github.com/sirupsen/logrus"
+	_ "modernc.org/sqlite"
 )
 
 // Errors.
@@ -19,9 +27,11 @@ var (
 	ErrTransactionRollback = fmt.Errorf("rollback")
 )
 
-// db holds the PostgreSQL connection pool.
+// db holds the SQL (PostgreSQL or SQLite) connection pool.
 var db *DBLogger
 
+var tracer = otel.Tracer("github.com/fancar/tmp_xm/internal/storage")
+
 // DBLogger is a DB wrapper which logs the executed sql queries and their
 // duration.
 type DBLogger struct {
@@ -30,39 +40,81 @@ type DBLogger struct {
 
 // Beginx returns a transaction with logging.
 func (db *DBLogger) Beginx() (*TxLogger, error) {
-	tx, err := db.DB.Beginx()
+	return db.BeginTxx(context.Background(), nil)
+}
+
+// BeginTxx returns a transaction with logging. The transaction is rolled
+// back when the given context is cancelled.
+func (db *DBLogger) BeginTxx(ctx context.Context, opts *sql.TxOptions) (*TxLogger, error) {
+	tx, err := db.DB.BeginTxx(ctx, opts)
 	return &TxLogger{tx}, err
 }
 
 // Query logs the queries executed by the Query method.
 func (db *DBLogger) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.QueryContext(context.Background(), query, args...)
+}
+
+// Queryx logs the queries executed by the Queryx method.
+func (db *DBLogger) Queryx(query string, args ...interface{}) (*sqlx.Rows, error) {
+	return db.QueryxContext(context.Background(), query, args...)
+}
+
+// QueryRowx logs the queries executed by the QueryRowx method.
+func (db *DBLogger) QueryRowx(query string, args ...interface{}) *sqlx.Row {
+	return db.QueryRowxContext(context.Background(), query, args...)
+}
+
+// Exec logs the queries executed by the Exec method.
+func (db *DBLogger) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.ExecContext(context.Background(), query, args...)
+}
+
+// QueryContext logs and traces the queries executed by the QueryContext method.
+func (db *DBLogger) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := startQuerySpan(ctx, db.DriverName(), query)
+	defer span.End()
+
 	start := time.Now()
-	rows, err := db.DB.Query(query, args...)
+	rows, err := db.DB.QueryContext(ctx, query, args...)
 	logQuery(query, time.Since(start), args...)
+	recordQueryError(span, err)
 	return rows, err
 }
 
-// Queryx logs the queries executed by the Queryx method.
-func (db *DBLogger) Queryx(query string, args ...interface{}) (*sqlx.Rows, error) {
+// QueryxContext logs and traces the queries executed by the QueryxContext method.
+func (db *DBLogger) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	ctx, span := startQuerySpan(ctx, db.DriverName(), query)
+	defer span.End()
+
 	start := time.Now()
-	rows, err := db.DB.Queryx(query, args...)
+	rows, err := db.DB.QueryxContext(ctx, query, args...)
 	logQuery(query, time.Since(start), args...)
+	recordQueryError(span, err)
 	return rows, err
 }
 
-// QueryRowx logs the queries executed by the QueryRowx method.
-func (db *DBLogger) QueryRowx(query string, args ...interface{}) *sqlx.Row {
+// QueryRowxContext logs and traces the queries executed by the QueryRowxContext method.
+func (db *DBLogger) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row {
+	ctx, span := startQuerySpan(ctx, db.DriverName(), query)
+	defer span.End()
+
 	start := time.Now()
-	row := db.DB.QueryRowx(query, args...)
+	row := db.DB.QueryRowxContext(ctx, query, args...)
 	logQuery(query, time.Since(start), args...)
+	recordQueryError(span, row.Err())
 	return row
 }
 
-// Exec logs the queries executed by the Exec method.
-func (db *DBLogger) Exec(query string, args ...interface{}) (sql.Result, error) {
+// ExecContext logs and traces the queries executed by the ExecContext method.
+func (db *DBLogger) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startQuerySpan(ctx, db.DriverName(), query)
+	defer span.End()
+
 	start := time.Now()
-	res, err := db.DB.Exec(query, args...)
+	res, err := db.DB.ExecContext(ctx, query, args...)
 	logQuery(query, time.Since(start), args...)
+	recordQueryError(span, err)
 	return res, err
 }
 
@@ -73,36 +125,105 @@ type TxLogger struct {
 
 // Query logs the queries executed by the Query method.
 func (q *TxLogger) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return q.QueryContext(context.Background(), query, args...)
+}
+
+// Queryx logs the queries executed by the Queryx method.
+func (q *TxLogger) Queryx(query string, args ...interface{}) (*sqlx.Rows, error) {
+	return q.QueryxContext(context.Background(), query, args...)
+}
+
+// QueryRowx logs the queries executed by the QueryRowx method.
+func (q *TxLogger) QueryRowx(query string, args ...interface{}) *sqlx.Row {
+	return q.QueryRowxContext(context.Background(), query, args...)
+}
+
+// Exec logs the queries executed by the Exec method.
+func (q *TxLogger) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return q.ExecContext(context.Background(), query, args...)
+}
+
+// QueryContext logs and traces the queries executed by the QueryContext method.
+func (q *TxLogger) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := startQuerySpan(ctx, q.DriverName(), query)
+	defer span.End()
+
 	start := time.Now()
-	rows, err := q.Tx.Query(query, args...)
+	rows, err := q.Tx.QueryContext(ctx, query, args...)
 	logQuery(query, time.Since(start), args...)
+	recordQueryError(span, err)
 	return rows, err
 }
 
-// Queryx logs the queries executed by the Queryx method.
-func (q *TxLogger) Queryx(query string, args ...interface{}) (*sqlx.Rows, error) {
+// QueryxContext logs and traces the queries executed by the QueryxContext method.
+func (q *TxLogger) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	ctx, span := startQuerySpan(ctx, q.DriverName(), query)
+	defer span.End()
+
 	start := time.Now()
-	rows, err := q.Tx.Queryx(query, args...)
+	rows, err := q.Tx.QueryxContext(ctx, query, args...)
 	logQuery(query, time.Since(start), args...)
+	recordQueryError(span, err)
 	return rows, err
 }
 
-// QueryRowx logs the queries executed by the QueryRowx method.
-func (q *TxLogger) QueryRowx(query string, args ...interface{}) *sqlx.Row {
+// QueryRowxContext logs and traces the queries executed by the QueryRowxContext method.
+func (q *TxLogger) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row {
+	ctx, span := startQuerySpan(ctx, q.DriverName(), query)
+	defer span.End()
+
 	start := time.Now()
-	row := q.Tx.QueryRowx(query, args...)
+	row := q.Tx.QueryRowxContext(ctx, query, args...)
 	logQuery(query, time.Since(start), args...)
+	recordQueryError(span, row.Err())
 	return row
 }
 
-// Exec logs the queries executed by the Exec method.
-func (q *TxLogger) Exec(query string, args ...interface{}) (sql.Result, error) {
+// ExecContext logs and traces the queries executed by the ExecContext method.
+func (q *TxLogger) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startQuerySpan(ctx, q.DriverName(), query)
+	defer span.End()
+
 	start := time.Now()
-	res, err := q.Tx.Exec(query, args...)
+	res, err := q.Tx.ExecContext(ctx, query, args...)
 	logQuery(query, time.Since(start), args...)
+	recordQueryError(span, err)
 	return res, err
 }
 
+// dbSystem returns the db.system attribute for the given driver.
+func dbSystem(driverName string) attribute.KeyValue {
+	if driverName == DriverSQLite {
+		return semconv.DBSystemSqlite
+	}
+	return semconv.DBSystemPostgreSQL
+}
+
+// startQuerySpan starts a client span for the given query as a child of the
+// span in ctx.
+func startQuerySpan(ctx context.Context, driverName, query string) (context.Context, trace.Span) {
+	name := "sql"
+	if f := strings.Fields(query); len(f) > 0 {
+		name = "sql " + strings.ToUpper(f[0])
+	}
+
+	return tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			dbSystem(driverName),
+			semconv.DBStatementKey.String(query),
+		),
+	)
+}
+
+func recordQueryError(span trace.Span, err error) {
+	if err == nil || err == sql.ErrNoRows {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
 func logQuery(query string, duration time.Duration, args ...interface{}) {
 	log.WithFields(log.Fields{
 		"query":    query,
@@ -111,15 +232,16 @@ func logQuery(query string, duration time.Duration, args ...interface{}) {
 	}).Debug("sql query executed")
 }
 
-// DB returns the PostgreSQL database object.
+// DB returns the SQL database object.
 func DB() *DBLogger {
 	return db
 }
 
 // Transaction wraps the given function in a transaction. In case the given
-// functions returns an error, the transaction will be rolled back.
-func Transaction(f func(tx sqlx.Ext) error) error {
-	tx, err := db.Beginx()
+// functions returns an error or the context is cancelled, the transaction
+// will be rolled back.
+func Transaction(ctx context.Context, f func(tx sqlx.ExtContext) error) error {
+	tx, err := db.BeginTxx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("storage: can't begin the transaction %v", err)
 	}
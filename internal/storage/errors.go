@@ -1,10 +1,13 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 
 	"github.com/lib/pq"
 	"github.com/pkg/errors"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
 )
 
 // Action defines the action type.
@@ -24,6 +27,7 @@ var (
 	ErrAlreadyExists                   = errors.New("object already exists")
 	ErrDoesNotExist                    = errors.New("object does not exist")
 	ErrUsedByOtherObjects              = errors.New("this object is used by other objects, remove them first")
+	ErrQueryCanceled                   = errors.New("query canceled, the deadline or statement timeout exceeded")
 	ErrApplicationInvalidName          = errors.New("invalid application name")
 	ErrNodeInvalidName                 = errors.New("invalid node name")
 	ErrNodeMaxRXDelay                  = errors.New("max value of RXDelay is 15")
@@ -46,6 +50,10 @@ var (
 	ErrRoutingProfileName              = errors.New("invalid routing profile name")
 	ErrIrrelevantFCnt                  = errors.New("irrelevant fCnt")
 	ErrServiceProfileMaxDeviceCount    = errors.New("unable to set specified service-profile, limit of used devices reached")
+	ErrCompanyParentCycle              = errors.New("the parent company can't be the company itself or one of its subsidiaries")
+	ErrCompanyStatusChanged            = errors.New("the status of the company was changed meanwhile, retry")
+	ErrOwnershipExceeded               = errors.New("the direct stakes in the company exceed 100 percent")
+	ErrChangeRequestDecided            = errors.New("the change request is not pending anymore")
 )
 
 func handlePSQLError(action Action, err error, description string) error {
@@ -53,9 +61,16 @@ func handlePSQLError(action Action, err error, description string) error {
 		return ErrDoesNotExist
 	}
 
+	// the caller went away or its deadline exceeded
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return err
+	}
+
 	switch err := err.(type) {
 	case *pq.Error:
 		switch err.Code.Name() {
+		case "query_canceled":
+			return ErrQueryCanceled
 		case "unique_violation":
 			return ErrAlreadyExists
 		case "foreign_key_violation":
@@ -66,6 +81,20 @@ func handlePSQLError(action Action, err error, description string) error {
 				return ErrDoesNotExist
 			}
 		}
+	case *sqlite.Error:
+		switch err.Code() {
+		case sqlite3.SQLITE_INTERRUPT:
+			return ErrQueryCanceled
+		case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+			return ErrAlreadyExists
+		case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+			switch action {
+			case Delete:
+				return ErrUsedByOtherObjects
+			default:
+				return ErrDoesNotExist
+			}
+		}
 	}
 
 	return errors.Wrap(err, description)
@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+)
+
+// IdempotencyKey holds the result of a request sent with an idempotency
+// key, so that its retries can be answered without running it again.
+type IdempotencyKey struct {
+	// Username is the user who sent the request, the keys of the users are
+	// independent.
+	Username  string    `db:"username"`
+	Key       string    `db:"key"`
+	CreatedAt time.Time `db:"created_at"`
+	ExpiresAt time.Time `db:"expires_at"`
+	// Method is the full gRPC method name of the request.
+	Method string `db:"method"`
+	// RequestHash is the hex encoded SHA-256 hash of the request.
+	RequestHash string `db:"request_hash"`
+	// Completed is false while the request is in progress.
+	Completed bool `db:"completed"`
+	// Response is the marshaled response of the completed request.
+	Response []byte `db:"response"`
+	// ResponseHeader is the JSON encoded header metadata of the response of
+	// the completed request.
+	ResponseHeader []byte `db:"response_header"`
+}
+
+// CreateIdempotencyKey stores the given key of a request in progress. An
+// expired key is replaced, ErrAlreadyExists is returned if the user stored
+// the key already.
+func CreateIdempotencyKey(ctx context.Context, db sqlx.ExecerContext, k *IdempotencyKey) error {
+	// UTC, SQLite compares the times as text
+	k.CreatedAt = time.Now().UTC()
+	k.ExpiresAt = k.ExpiresAt.UTC()
+
+	_, err := db.ExecContext(ctx, "DELETE FROM idempotency_key WHERE username = $1 AND key = $2 AND expires_at <= $3",
+		k.Username,
+		k.Key,
+		k.CreatedAt,
+	)
+	if err != nil {
+		return handlePSQLError(Delete, err, "delete expired idempotency key error")
+	}
+
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO idempotency_key (
+			username,
+			key,
+			created_at,
+			expires_at,
+			method,
+			request_hash,
+			completed,
+			response,
+			response_header
+		) values ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		k.Username,
+		k.Key,
+		k.CreatedAt,
+		k.ExpiresAt,
+		k.Method,
+		k.RequestHash,
+		k.Completed,
+		k.Response,
+		k.ResponseHeader,
+	)
+	if err != nil {
+		return handlePSQLError(Insert, err, "insert idempotency key error")
+	}
+	return nil
+}
+
+// GetIdempotencyKey returns the key stored by the user, expired keys are
+// not returned.
+func GetIdempotencyKey(ctx context.Context, db sqlx.QueryerContext, username, key string) (IdempotencyKey, error) {
+	var k IdempotencyKey
+
+	err := sqlx.GetContext(ctx, db, &k, "SELECT * FROM idempotency_key WHERE username = $1 AND key = $2 AND expires_at > $3",
+		username,
+		key,
+		time.Now().UTC(),
+	)
+	if err != nil {
+		return k, handlePSQLError(Select, err, "select idempotency key error")
+	}
+	return k, nil
+}
+
+// CompleteIdempotencyKey stores the response and its header of the request
+// of the given key and marks it completed.
+func CompleteIdempotencyKey(ctx context.Context, db sqlx.ExecerContext, k *IdempotencyKey) error {
+	k.Completed = true
+
+	res, err := db.ExecContext(ctx, `
+		UPDATE idempotency_key
+		SET
+			completed = $3,
+			response = $4,
+			response_header = $5
+		WHERE username = $1 AND key = $2`,
+		k.Username,
+		k.Key,
+		k.Completed,
+		k.Response,
+		k.ResponseHeader,
+	)
+	if err != nil {
+		return handlePSQLError(Update, err, "update idempotency key error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("can't get rows affected %v", err)
+	}
+	if ra == 0 {
+		return ErrDoesNotExist
+	}
+	return nil
+}
+
+// DeleteIdempotencyKey deletes the given key of the user, e.g. when its
+// request failed and may be retried.
+func DeleteIdempotencyKey(ctx context.Context, db sqlx.ExecerContext, username, key string) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM idempotency_key WHERE username = $1 AND key = $2", username, key)
+	if err != nil {
+		return handlePSQLError(Delete, err, "delete idempotency key error")
+	}
+	return nil
+}
+
+// DeleteExpiredIdempotencyKeys deletes the expired keys and returns their
+// number.
+func DeleteExpiredIdempotencyKeys(ctx context.Context, db sqlx.ExecerContext) (int64, error) {
+	res, err := db.ExecContext(ctx, "DELETE FROM idempotency_key WHERE expires_at <= $1", time.Now().UTC())
+	if err != nil {
+		return 0, handlePSQLError(Delete, err, "delete expired idempotency keys error")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("can't get rows affected %v", err)
+	}
+
+	if n > 0 {
+		log.WithField("count", n).Info("storage: expired idempotency keys deleted")
+	}
+	return n, nil
+}
@@ -0,0 +1,199 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofrs/uuid"
+)
+
+// Column sizes of the PostgreSQL schema, enforced by the MemoryRepository
+// to keep the same semantics.
+const (
+	companyNameMaxLength        = 15
+	companyDescriptionMaxLength = 3000
+	userUsernameMaxLength       = 100
+	idempotencyKeyMaxLength     = 255
+)
+
+// columnLength holds the value of a character varying column and its size.
+type columnLength struct {
+	column string
+	value  string
+	size   int
+}
+
+// adminPasswordHash is the hash of the 'admin' password of the global admin
+// user created by the initial migration.
+const adminPasswordHash = "PBKDF2$sha512$1$l8zGKtxRESq3PA2kFhHRWA==$H3lGMxOt55wjwoc+myeOoABofJY9oDpldJa7fhqdjbh700V6FLPML75UmBOt9J5VFNjAL1AvqCozA1HJM0QVGA=="
+
+// MemoryRepository implements the repositories in memory. It is meant for
+// the tests and the demo mode, the data is lost on exit.
+type MemoryRepository struct {
+	mu sync.RWMutex
+	memoryState
+}
+
+// memoryState holds the data of a MemoryRepository, the transactions work
+// on a clone of it.
+type memoryState struct {
+	companies  map[uuid.UUID]Company
+	users      map[int64]User
+	lastUserID int64
+	keys       map[idempotencyKeyID]IdempotencyKey
+	redirects  map[uuid.UUID]uuid.UUID
+	addresses  map[uuid.UUID]CompanyAddress
+	contacts   map[uuid.UUID]CompanyContact
+	persons    map[uuid.UUID]Person
+	ownerships map[uuid.UUID]Ownership
+	files      map[uuid.UUID]CompanyAttachment
+	notes      map[uuid.UUID]CompanyNote
+	versions   map[uuid.UUID][]CompanyNoteVersion
+	statuses   map[uuid.UUID][]CompanyStatusChange
+	fieldEdits map[uuid.UUID][]CompanyFieldChange
+	changes    map[uuid.UUID]ChangeRequest
+	attributes map[attributeKey]AttributeDefinition
+}
+
+// NewMemoryRepository creates a new MemoryRepository containing the global
+// admin user (password: admin), like the initial migration does.
+func NewMemoryRepository() *MemoryRepository {
+	now := time.Now()
+	return &MemoryRepository{memoryState: memoryState{
+		companies: make(map[uuid.UUID]Company),
+		users: map[int64]User{
+			1: {
+				ID:           1,
+				IsAdmin:      true,
+				CreatedAt:    now,
+				UpdatedAt:    now,
+				PasswordHash: adminPasswordHash,
+				Username:     "admin",
+			},
+		},
+		lastUserID: 1,
+		keys:       make(map[idempotencyKeyID]IdempotencyKey),
+		redirects:  make(map[uuid.UUID]uuid.UUID),
+		addresses:  make(map[uuid.UUID]CompanyAddress),
+		contacts:   make(map[uuid.UUID]CompanyContact),
+		persons:    make(map[uuid.UUID]Person),
+		ownerships: make(map[uuid.UUID]Ownership),
+		files:      make(map[uuid.UUID]CompanyAttachment),
+		notes:      make(map[uuid.UUID]CompanyNote),
+		versions:   make(map[uuid.UUID][]CompanyNoteVersion),
+		statuses:   make(map[uuid.UUID][]CompanyStatusChange),
+		fieldEdits: make(map[uuid.UUID][]CompanyFieldChange),
+		changes:    make(map[uuid.UUID]ChangeRequest),
+		attributes: make(map[attributeKey]AttributeDefinition),
+	}}
+}
+
+// clone returns a copy of the state. The maps are copied, their values are
+// shared: they are replaced, never changed in place, and the slices are only
+// appended to.
+func (s memoryState) clone() memoryState {
+	c := memoryState{
+		companies:  make(map[uuid.UUID]Company, len(s.companies)),
+		users:      make(map[int64]User, len(s.users)),
+		lastUserID: s.lastUserID,
+		keys:       make(map[idempotencyKeyID]IdempotencyKey, len(s.keys)),
+		redirects:  make(map[uuid.UUID]uuid.UUID, len(s.redirects)),
+		addresses:  make(map[uuid.UUID]CompanyAddress, len(s.addresses)),
+		contacts:   make(map[uuid.UUID]CompanyContact, len(s.contacts)),
+		persons:    make(map[uuid.UUID]Person, len(s.persons)),
+		ownerships: make(map[uuid.UUID]Ownership, len(s.ownerships)),
+		files:      make(map[uuid.UUID]CompanyAttachment, len(s.files)),
+		notes:      make(map[uuid.UUID]CompanyNote, len(s.notes)),
+		versions:   make(map[uuid.UUID][]CompanyNoteVersion, len(s.versions)),
+		statuses:   make(map[uuid.UUID][]CompanyStatusChange, len(s.statuses)),
+		fieldEdits: make(map[uuid.UUID][]CompanyFieldChange, len(s.fieldEdits)),
+		changes:    make(map[uuid.UUID]ChangeRequest, len(s.changes)),
+		attributes: make(map[attributeKey]AttributeDefinition, len(s.attributes)),
+	}
+	for k, v := range s.companies {
+		c.companies[k] = v
+	}
+	for k, v := range s.users {
+		c.users[k] = v
+	}
+	for k, v := range s.keys {
+		c.keys[k] = v
+	}
+	for k, v := range s.redirects {
+		c.redirects[k] = v
+	}
+	for k, v := range s.addresses {
+		c.addresses[k] = v
+	}
+	for k, v := range s.contacts {
+		c.contacts[k] = v
+	}
+	for k, v := range s.persons {
+		c.persons[k] = v
+	}
+	for k, v := range s.ownerships {
+		c.ownerships[k] = v
+	}
+	for k, v := range s.files {
+		c.files[k] = v
+	}
+	for k, v := range s.notes {
+		c.notes[k] = v
+	}
+	for k, v := range s.versions {
+		c.versions[k] = v
+	}
+	for k, v := range s.statuses {
+		c.statuses[k] = v
+	}
+	for k, v := range s.fieldEdits {
+		c.fieldEdits[k] = v
+	}
+	for k, v := range s.changes {
+		c.changes[k] = v
+	}
+	for k, v := range s.attributes {
+		c.attributes[k] = v
+	}
+	return c
+}
+
+// Transaction runs f with a copy of the repository and applies its changes
+// if f succeeds. The repository is locked meanwhile, f must only use the
+// given copy.
+func (r *MemoryRepository) Transaction(ctx context.Context, f func(Repository) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tx := &MemoryRepository{memoryState: r.memoryState.clone()}
+	if err := f(tx); err != nil {
+		if err == ErrTransactionRollback {
+			return nil
+		}
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.memoryState = tx.memoryState
+	return nil
+}
+
+func validateColumnLengths(columns []columnLength) error {
+	for _, c := range columns {
+		if utf8.RuneCountInString(c.value) > c.size {
+			return errValueTooLong(c.column, c.size)
+		}
+	}
+	return nil
+}
+
+// errValueTooLong returns the error PostgreSQL would return for the too long
+// value of a character varying column.
+func errValueTooLong(column string, size int) error {
+	return fmt.Errorf("%s: value too long for type character varying(%d)", column, size)
+}
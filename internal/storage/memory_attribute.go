@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// attributeKey identifies an attribute definition.
+type attributeKey struct {
+	companyType uint32
+	name        string
+}
+
+// CreateAttributeDefinition creates the given attribute definition.
+func (r *MemoryRepository) CreateAttributeDefinition(ctx context.Context, d *AttributeDefinition) error {
+	if err := validateColumnLengths(attributeDefinitionColumnLengths(d)); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := attributeKey{d.CompanyType, d.Name}
+	if _, ok := r.attributes[key]; ok {
+		return ErrAlreadyExists
+	}
+
+	d.CreatedAt = time.Now()
+	d.UpdatedAt = d.CreatedAt
+	r.attributes[key] = *d
+	return nil
+}
+
+// GetAttributeDefinition returns the attribute definition of the given
+// company type and name.
+func (r *MemoryRepository) GetAttributeDefinition(ctx context.Context, companyType uint32, name string) (AttributeDefinition, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	d, ok := r.attributes[attributeKey{companyType, name}]
+	if !ok {
+		return AttributeDefinition{}, ErrDoesNotExist
+	}
+	return d, nil
+}
+
+// GetAttributeDefinitions returns the attribute definitions of the given
+// company type, ordered by type and name.
+func (r *MemoryRepository) GetAttributeDefinitions(ctx context.Context, companyType uint32) ([]AttributeDefinition, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var list []AttributeDefinition
+	for _, d := range r.attributes {
+		if companyType == 0 || d.CompanyType == companyType {
+			list = append(list, d)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].CompanyType != list[j].CompanyType {
+			return list[i].CompanyType < list[j].CompanyType
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list, nil
+}
+
+// UpdateAttributeDefinition updates the given attribute definition, the
+// kind is kept.
+func (r *MemoryRepository) UpdateAttributeDefinition(ctx context.Context, d *AttributeDefinition) error {
+	if err := validateColumnLengths(attributeDefinitionColumnLengths(d)); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := attributeKey{d.CompanyType, d.Name}
+	old, ok := r.attributes[key]
+	if !ok {
+		return ErrDoesNotExist
+	}
+
+	d.CreatedAt = old.CreatedAt
+	d.UpdatedAt = time.Now()
+	d.Kind = old.Kind
+	r.attributes[key] = *d
+	return nil
+}
+
+// DeleteAttributeDefinition deletes the given attribute definition and the
+// values of the attribute.
+func (r *MemoryRepository) DeleteAttributeDefinition(ctx context.Context, companyType uint32, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := attributeKey{companyType, name}
+	if _, ok := r.attributes[key]; !ok {
+		return ErrDoesNotExist
+	}
+	delete(r.attributes, key)
+
+	for id, c := range r.companies {
+		if _, ok := c.Attributes[name]; !ok || c.Type != companyType {
+			continue
+		}
+		// the maps may be shared with a transaction, they are replaced
+		c.Attributes = c.Attributes.clone()
+		delete(c.Attributes, name)
+		r.companies[id] = c
+	}
+	return nil
+}
+
+func attributeDefinitionColumnLengths(d *AttributeDefinition) []columnLength {
+	return []columnLength{
+		{"name", d.Name, 50},
+		{"description", d.Description, 500},
+	}
+}
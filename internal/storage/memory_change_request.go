@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// CreateChangeRequest creates the given pending change request.
+func (r *MemoryRepository) CreateChangeRequest(ctx context.Context, cr *ChangeRequest) error {
+	if err := validateColumnLengths(changeRequestColumnLengths(cr)); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.companies[cr.CompanyID]; !ok {
+		return ErrDoesNotExist
+	}
+	if _, ok := r.changes[cr.ID]; ok {
+		return ErrAlreadyExists
+	}
+	if _, ok := r.pendingChangeRequest(cr.CompanyID); ok {
+		return ErrAlreadyExists
+	}
+
+	cr.CreatedAt = time.Now()
+	cr.UpdatedAt = cr.CreatedAt
+	cr.ExpiresAt = cr.ExpiresAt.UTC()
+	cr.Status = ChangeRequestPending
+	r.changes[cr.ID] = *cr
+	return nil
+}
+
+// GetChangeRequest returns the change request for the given ID.
+func (r *MemoryRepository) GetChangeRequest(ctx context.Context, id uuid.UUID) (ChangeRequest, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	cr, ok := r.changes[id]
+	if !ok {
+		return cr, ErrDoesNotExist
+	}
+	return cr, nil
+}
+
+// GetPendingChangeRequest returns the pending change request of the given
+// company.
+func (r *MemoryRepository) GetPendingChangeRequest(ctx context.Context, companyID uuid.UUID) (ChangeRequest, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	cr, ok := r.pendingChangeRequest(companyID)
+	if !ok {
+		return cr, ErrDoesNotExist
+	}
+	return cr, nil
+}
+
+// GetChangeRequests returns the change requests matching the given filters,
+// the newest first.
+func (r *MemoryRepository) GetChangeRequests(ctx context.Context, filters ChangeRequestFilters) ([]ChangeRequest, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var list []ChangeRequest
+	for _, cr := range r.changes {
+		if filters.Status != 0 && cr.Status != filters.Status {
+			continue
+		}
+		if filters.CompanyID.Valid && cr.CompanyID != filters.CompanyID.UUID {
+			continue
+		}
+		list = append(list, cr)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].CreatedAt.After(list[j].CreatedAt)
+		}
+		return list[i].ID.String() < list[j].ID.String()
+	})
+	return list, nil
+}
+
+// DecideChangeRequest decides the given pending change request.
+func (r *MemoryRepository) DecideChangeRequest(ctx context.Context, cr *ChangeRequest) error {
+	if err := validateColumnLengths(changeRequestColumnLengths(cr)); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old, ok := r.changes[cr.ID]
+	if !ok {
+		return ErrDoesNotExist
+	}
+	if old.Status != ChangeRequestPending {
+		return ErrChangeRequestDecided
+	}
+
+	now := time.Now()
+	old.UpdatedAt = now
+	old.DecidedAt = sql.NullTime{Time: now, Valid: true}
+	old.Status = cr.Status
+	old.DecidedBy = cr.DecidedBy
+	old.Comment = cr.Comment
+	r.changes[cr.ID] = old
+
+	cr.UpdatedAt = old.UpdatedAt
+	cr.DecidedAt = old.DecidedAt
+	return nil
+}
+
+// ExpireChangeRequests expires the pending change requests expired at the
+// given time and returns them.
+func (r *MemoryRepository) ExpireChangeRequests(ctx context.Context, at time.Time) ([]ChangeRequest, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	var list []ChangeRequest
+	for id, cr := range r.changes {
+		if cr.Status != ChangeRequestPending || cr.ExpiresAt.After(at) {
+			continue
+		}
+		cr.UpdatedAt = now
+		cr.DecidedAt = sql.NullTime{Time: now, Valid: true}
+		cr.Status = ChangeRequestExpired
+		r.changes[id] = cr
+		list = append(list, cr)
+	}
+	return list, nil
+}
+
+// pendingChangeRequest returns the pending change request of the given
+// company, if any.
+func (r *MemoryRepository) pendingChangeRequest(companyID uuid.UUID) (ChangeRequest, bool) {
+	for _, cr := range r.changes {
+		if cr.CompanyID == companyID && cr.Status == ChangeRequestPending {
+			return cr, true
+		}
+	}
+	return ChangeRequest{}, false
+}
+
+func changeRequestColumnLengths(cr *ChangeRequest) []columnLength {
+	return []columnLength{
+		{"requested_by", cr.RequestedBy, 100},
+		{"decided_by", cr.DecidedBy, 100},
+		{"comment", cr.Comment, 500},
+	}
+}
@@ -0,0 +1,660 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofrs/uuid"
+)
+
+// CreateCompany creates the given company.
+func (r *MemoryRepository) CreateCompany(ctx context.Context, c *Company) error {
+	if err := validateCompanyColumns(c); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.companies[c.ID]; ok {
+		return ErrAlreadyExists
+	}
+	if r.companyNameTaken(c.Name, c.ID) || r.companyIdentifiersTaken(c, c.ID) {
+		return ErrAlreadyExists
+	}
+
+	if err := r.checkCompanyParent(c); err != nil {
+		return err
+	}
+
+	c.NormalizedName = NormalizeCompanyName(c.Name)
+	item := *c
+	item.Attributes = c.Attributes.clone()
+	item.Labels = c.Labels.clone()
+	item.CreatedAt = time.Now()
+	item.UpdatedAt = item.CreatedAt
+	r.companies[c.ID] = item
+	return nil
+}
+
+// GetCompany returns the company for the given ID.
+func (r *MemoryRepository) GetCompany(ctx context.Context, id uuid.UUID) (Company, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c, ok := r.companies[id]
+	if !ok {
+		return Company{}, ErrDoesNotExist
+	}
+	return c, nil
+}
+
+// UpdateCompany updates the given company by its ID.
+func (r *MemoryRepository) UpdateCompany(ctx context.Context, c *Company) error {
+	if err := validateCompanyColumns(c); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old, ok := r.companies[c.ID]
+	if !ok {
+		return ErrDoesNotExist
+	}
+	if r.companyNameTaken(c.Name, c.ID) || r.companyIdentifiersTaken(c, c.ID) {
+		return ErrAlreadyExists
+	}
+
+	if err := r.checkCompanyParent(c); err != nil {
+		return err
+	}
+
+	c.NormalizedName = NormalizeCompanyName(c.Name)
+	c.Status = old.Status
+	c.Labels = old.Labels.clone()
+	item := *c
+	item.Attributes = c.Attributes.clone()
+	item.CreatedAt = old.CreatedAt
+	item.UpdatedAt = time.Now()
+	r.companies[c.ID] = item
+	return nil
+}
+
+// DeleteCompany deletes the company for the given ID.
+func (r *MemoryRepository) DeleteCompany(ctx context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.companies[id]; !ok {
+		return ErrDoesNotExist
+	}
+	for _, c := range r.companies {
+		if c.ParentID.Valid && c.ParentID.UUID == id {
+			return ErrUsedByOtherObjects
+		}
+	}
+	delete(r.companies, id)
+	r.deleteRedirectsTo(id)
+	for k, a := range r.addresses {
+		if a.CompanyID == id {
+			delete(r.addresses, k)
+		}
+	}
+	for k, c := range r.contacts {
+		if c.CompanyID == id {
+			delete(r.contacts, k)
+		}
+	}
+	for k, f := range r.files {
+		if f.CompanyID.Valid && f.CompanyID.UUID == id {
+			f.CompanyID = uuid.NullUUID{}
+			r.files[k] = f
+		}
+	}
+	for k, n := range r.notes {
+		if n.CompanyID == id {
+			delete(r.notes, k)
+			delete(r.versions, k)
+		}
+	}
+	for k, o := range r.ownerships {
+		if o.CompanyID == id || (o.OwnerCompanyID.Valid && o.OwnerCompanyID.UUID == id) {
+			delete(r.ownerships, k)
+		}
+	}
+	delete(r.statuses, id)
+	delete(r.fieldEdits, id)
+	return nil
+}
+
+// MergeCompany merges the source company into the given target.
+func (r *MemoryRepository) MergeCompany(ctx context.Context, sourceID uuid.UUID, target *Company) error {
+	if err := validateCompanyColumns(target); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old, ok := r.companies[target.ID]
+	if !ok {
+		return ErrDoesNotExist
+	}
+	source, ok := r.companies[sourceID]
+	if !ok {
+		return ErrDoesNotExist
+	}
+	// a subsidiary of the source takes its place in the group
+	for _, a := range r.ancestors(target.ID) {
+		if a.ID == sourceID {
+			target.ParentID = source.ParentID
+		}
+	}
+	for _, c := range r.companies {
+		if c.Name == target.Name && c.ID != target.ID && c.ID != sourceID {
+			return ErrAlreadyExists
+		}
+	}
+	if r.companyIdentifiersTaken(target, target.ID, sourceID) {
+		return ErrAlreadyExists
+	}
+	// the stakes of the source are added to the ones of the target, but
+	// the stakes between both companies
+	var stakes []Ownership
+	for _, o := range r.ownerships {
+		ownedByPeer := o.OwnerCompanyID.Valid && (o.OwnerCompanyID.UUID == sourceID || o.OwnerCompanyID.UUID == target.ID)
+		if (o.CompanyID == sourceID || o.CompanyID == target.ID) && !ownedByPeer {
+			stakes = append(stakes, o)
+		}
+	}
+	if err := validateOwnershipTotals(stakes); err != nil {
+		return err
+	}
+
+	for id, to := range r.redirects {
+		if to == sourceID {
+			r.redirects[id] = target.ID
+		}
+	}
+	for id, c := range r.companies {
+		if c.ParentID.Valid && c.ParentID.UUID == sourceID {
+			c.ParentID.UUID = target.ID
+			r.companies[id] = c
+		}
+	}
+	for id, a := range r.addresses {
+		if a.CompanyID == sourceID {
+			a.CompanyID = target.ID
+			r.addresses[id] = a
+		}
+	}
+	for id, c := range r.contacts {
+		if c.CompanyID == sourceID {
+			c.CompanyID = target.ID
+			r.contacts[id] = c
+		}
+	}
+	for id, f := range r.files {
+		if f.CompanyID.Valid && f.CompanyID.UUID == sourceID {
+			f.CompanyID.UUID = target.ID
+			r.files[id] = f
+		}
+	}
+	for id, n := range r.notes {
+		if n.CompanyID == sourceID {
+			n.CompanyID = target.ID
+			r.notes[id] = n
+		}
+	}
+	for id, o := range r.ownerships {
+		ownedBySource := o.OwnerCompanyID.Valid && o.OwnerCompanyID.UUID == sourceID
+		ownedByTarget := o.OwnerCompanyID.Valid && o.OwnerCompanyID.UUID == target.ID
+		switch {
+		case (o.CompanyID == sourceID && ownedByTarget) || (o.CompanyID == target.ID && ownedBySource):
+			// it would become self-ownership
+			delete(r.ownerships, id)
+			continue
+		case o.CompanyID == sourceID:
+			o.CompanyID = target.ID
+		case ownedBySource:
+			o.OwnerCompanyID.UUID = target.ID
+		}
+		r.ownerships[id] = o
+	}
+	// the history of the source is kept in the one of the target
+	statuses := make([]CompanyStatusChange, 0, len(r.statuses[target.ID])+len(r.statuses[sourceID]))
+	statuses = append(statuses, r.statuses[target.ID]...)
+	for _, ch := range r.statuses[sourceID] {
+		ch.CompanyID = target.ID
+		statuses = append(statuses, ch)
+	}
+	sort.SliceStable(statuses, func(i, j int) bool {
+		return historyBefore(statuses[i].CreatedAt, statuses[i].ID, statuses[j].CreatedAt, statuses[j].ID)
+	})
+	r.statuses[target.ID] = statuses
+	fieldEdits := make([]CompanyFieldChange, 0, len(r.fieldEdits[target.ID])+len(r.fieldEdits[sourceID]))
+	fieldEdits = append(fieldEdits, r.fieldEdits[target.ID]...)
+	for _, ch := range r.fieldEdits[sourceID] {
+		ch.CompanyID = target.ID
+		fieldEdits = append(fieldEdits, ch)
+	}
+	sort.SliceStable(fieldEdits, func(i, j int) bool {
+		return historyBefore(fieldEdits[i].CreatedAt, fieldEdits[i].ID, fieldEdits[j].CreatedAt, fieldEdits[j].ID)
+	})
+	r.fieldEdits[target.ID] = fieldEdits
+
+	delete(r.companies, sourceID)
+	delete(r.statuses, sourceID)
+	delete(r.fieldEdits, sourceID)
+
+	target.NormalizedName = NormalizeCompanyName(target.Name)
+	target.Status = old.Status
+	target.Labels = old.Labels.clone()
+	item := *target
+	item.Attributes = target.Attributes.clone()
+	item.CreatedAt = old.CreatedAt
+	item.UpdatedAt = time.Now()
+	r.companies[target.ID] = item
+	r.redirects[sourceID] = target.ID
+	return nil
+}
+
+// historyBefore returns true if the history entry a sorts before b, by
+// time then ID like the SQL queries.
+func historyBefore(aTime time.Time, aID uuid.UUID, bTime time.Time, bID uuid.UUID) bool {
+	if !aTime.Equal(bTime) {
+		return aTime.Before(bTime)
+	}
+	return aID.String() < bID.String()
+}
+
+// GetCompanyRedirect returns the ID of the company the given company was
+// merged into.
+func (r *MemoryRepository) GetCompanyRedirect(ctx context.Context, id uuid.UUID) (uuid.UUID, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	target, ok := r.redirects[id]
+	if !ok {
+		return uuid.Nil, ErrDoesNotExist
+	}
+	return target, nil
+}
+
+// deleteRedirectsTo deletes the redirects to the given company, like the
+// foreign key does.
+func (r *MemoryRepository) deleteRedirectsTo(id uuid.UUID) {
+	for k, to := range r.redirects {
+		if to == id {
+			delete(r.redirects, k)
+		}
+	}
+}
+
+// ForEachCompany calls fn for every company matching the filters. It
+// iterates over a snapshot, fn may use the repository.
+func (r *MemoryRepository) ForEachCompany(ctx context.Context, filters CompanyFilters, fn func(Company) error) error {
+	r.mu.RLock()
+	var list []Company
+	for _, c := range r.companies {
+		if filters.Match(c) {
+			list = append(list, c)
+		}
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	for _, c := range list {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SearchCompanies returns the companies matching the query by substring,
+// like the SQL fallback search does.
+func (r *MemoryRepository) SearchCompanies(ctx context.Context, query string, filters CompanyFilters, limit int) ([]CompanySearchResult, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var results []CompanySearchResult
+	for _, c := range r.companies {
+		if !filters.Match(c) {
+			continue
+		}
+		if rank := likeSearchRank(c, query); rank > 0 {
+			results = append(results, CompanySearchResult{
+				Company: c,
+				Rank:    rank,
+				Snippet: highlightSnippet(c.Description, query),
+			})
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		return results[i].Name < results[j].Name
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// AddCompanyLabels adds the given labels to the company and returns all
+// its labels.
+func (r *MemoryRepository) AddCompanyLabels(ctx context.Context, id uuid.UUID, labels CompanyLabels) (CompanyLabels, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.companies[id]
+	if !ok {
+		return nil, ErrDoesNotExist
+	}
+	// the maps may be shared with a transaction, they are replaced
+	result := make(CompanyLabels, len(c.Labels)+len(labels))
+	for k, v := range c.Labels {
+		result[k] = v
+	}
+	for k, v := range labels {
+		result[k] = v
+	}
+	c.Labels = result
+	c.UpdatedAt = time.Now()
+	r.companies[id] = c
+	return result.clone(), nil
+}
+
+// RemoveCompanyLabels removes the labels of the given keys from the company
+// and returns its remaining labels.
+func (r *MemoryRepository) RemoveCompanyLabels(ctx context.Context, id uuid.UUID, keys []string) (CompanyLabels, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.companies[id]
+	if !ok {
+		return nil, ErrDoesNotExist
+	}
+	result := make(CompanyLabels, len(c.Labels))
+	for k, v := range c.Labels {
+		if !containsString(keys, k) {
+			result[k] = v
+		}
+	}
+	c.Labels = result
+	c.UpdatedAt = time.Now()
+	r.companies[id] = c
+	return result.clone(), nil
+}
+
+// CountCompanyLabels returns the number of companies matching the filters
+// per label.
+func (r *MemoryRepository) CountCompanyLabels(ctx context.Context, filters CompanyFilters, key string) ([]LabelCount, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var list []Company
+	for _, c := range r.companies {
+		if filters.Match(c) {
+			list = append(list, c)
+		}
+	}
+	return countLabels(list, key), nil
+}
+
+// FindCompanyDuplicates returns the companies which normalized name is the
+// one of the given name, like the SQL search without pg_trgm does.
+func (r *MemoryRepository) FindCompanyDuplicates(ctx context.Context, name string) ([]CompanyDuplicate, error) {
+	normalized := NormalizeCompanyName(name)
+	if normalized == "" {
+		return nil, nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var result []CompanyDuplicate
+	for _, c := range r.companies {
+		if c.NormalizedName == normalized {
+			result = append(result, CompanyDuplicate{Company: c, Similarity: 1})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	if len(result) > maxDuplicateCandidates {
+		result = result[:maxDuplicateCandidates]
+	}
+	return result, nil
+}
+
+// FindAllCompanyDuplicates returns the pairs of companies with the same
+// normalized name.
+func (r *MemoryRepository) FindAllCompanyDuplicates(ctx context.Context, limit int) ([]CompanyDuplicatePair, error) {
+	r.mu.RLock()
+	groups := make(map[string][]Company)
+	for _, c := range r.companies {
+		if c.NormalizedName != "" {
+			groups[c.NormalizedName] = append(groups[c.NormalizedName], c)
+		}
+	}
+	r.mu.RUnlock()
+
+	var result []CompanyDuplicatePair
+	for _, list := range groups {
+		for i := range list {
+			for j := range list {
+				if list[i].ID.String() < list[j].ID.String() {
+					result = append(result, CompanyDuplicatePair{First: list[i], Second: list[j], Similarity: 1})
+				}
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].First.Name != result[j].First.Name {
+			return result[i].First.Name < result[j].First.Name
+		}
+		return result[i].Second.Name < result[j].Second.Name
+	})
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+// GetCompanyAncestors returns the ancestors of the given company, the
+// nearest first.
+func (r *MemoryRepository) GetCompanyAncestors(ctx context.Context, id uuid.UUID) ([]Company, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.ancestors(id), nil
+}
+
+// GetCompanyDescendants returns the descendants of the given company, by
+// depth and name.
+func (r *MemoryRepository) GetCompanyDescendants(ctx context.Context, id uuid.UUID) ([]CompanyNode, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var result []CompanyNode
+	parents := map[uuid.UUID]bool{id: true}
+	for depth := 1; depth <= maxGroupDepth && len(parents) > 0; depth++ {
+		var level []CompanyNode
+		for _, c := range r.companies {
+			if c.ParentID.Valid && parents[c.ParentID.UUID] {
+				level = append(level, CompanyNode{Company: c, Depth: depth})
+			}
+		}
+		sort.Slice(level, func(i, j int) bool { return level[i].Name < level[j].Name })
+
+		parents = make(map[uuid.UUID]bool, len(level))
+		for _, n := range level {
+			parents[n.ID] = true
+		}
+		result = append(result, level...)
+	}
+	return result, nil
+}
+
+// ReparentCompanyChildren moves the children of the given company to its
+// parent.
+func (r *MemoryRepository) ReparentCompanyChildren(ctx context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	parent := r.companies[id].ParentID
+	for k, c := range r.companies {
+		if c.ParentID.Valid && c.ParentID.UUID == id {
+			c.ParentID = parent
+			r.companies[k] = c
+		}
+	}
+	return nil
+}
+
+// ancestors returns the ancestors of the given company, the nearest first.
+func (r *MemoryRepository) ancestors(id uuid.UUID) []Company {
+	var result []Company
+	c, ok := r.companies[id]
+	for depth := 0; ok && c.ParentID.Valid && depth < maxGroupDepth; depth++ {
+		c, ok = r.companies[c.ParentID.UUID]
+		if ok {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// checkCompanyParent returns ErrDoesNotExist if the parent of the given
+// company does not exist, like the foreign key does, and
+// ErrCompanyParentCycle if it is the company itself or a descendant.
+func (r *MemoryRepository) checkCompanyParent(c *Company) error {
+	if !c.ParentID.Valid {
+		return nil
+	}
+	if c.ParentID.UUID == c.ID {
+		return ErrCompanyParentCycle
+	}
+	if _, ok := r.companies[c.ParentID.UUID]; !ok {
+		return ErrDoesNotExist
+	}
+	for _, a := range r.ancestors(c.ParentID.UUID) {
+		if a.ID == c.ID {
+			return ErrCompanyParentCycle
+		}
+	}
+	return nil
+}
+
+// TransitionCompanyStatus changes the status of the company and records
+// the change.
+func (r *MemoryRepository) TransitionCompanyStatus(ctx context.Context, ch *CompanyStatusChange) error {
+	if err := validateColumnLengths(statusChangeColumnLengths(ch)); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.companies[ch.CompanyID]
+	if !ok {
+		return ErrDoesNotExist
+	}
+	if c.Status != ch.FromStatus {
+		return ErrCompanyStatusChanged
+	}
+	ch.CreatedAt = time.Now()
+	c.Status = ch.ToStatus
+	c.UpdatedAt = ch.CreatedAt
+	r.companies[c.ID] = c
+
+	// the slices are shared with the copies of the transactions
+	history := make([]CompanyStatusChange, 0, len(r.statuses[c.ID])+1)
+	r.statuses[c.ID] = append(append(history, r.statuses[c.ID]...), *ch)
+	return nil
+}
+
+// CreateCompanyStatusChange records the given status change.
+func (r *MemoryRepository) CreateCompanyStatusChange(ctx context.Context, ch *CompanyStatusChange) error {
+	if err := validateColumnLengths(statusChangeColumnLengths(ch)); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.companies[ch.CompanyID]; !ok {
+		return ErrDoesNotExist
+	}
+	ch.CreatedAt = time.Now()
+
+	// the slices are shared with the copies of the transactions
+	history := make([]CompanyStatusChange, 0, len(r.statuses[ch.CompanyID])+1)
+	r.statuses[ch.CompanyID] = append(append(history, r.statuses[ch.CompanyID]...), *ch)
+	return nil
+}
+
+// GetCompanyStatusHistory returns the status changes of the given company.
+func (r *MemoryRepository) GetCompanyStatusHistory(ctx context.Context, companyID uuid.UUID) ([]CompanyStatusChange, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]CompanyStatusChange(nil), r.statuses[companyID]...), nil
+}
+
+// companyIdentifiersTaken returns true if a company, other than the given
+// ones, has the registration number or the LEI of c.
+func (r *MemoryRepository) companyIdentifiersTaken(c *Company, ids ...uuid.UUID) bool {
+	for _, other := range r.companies {
+		if containsUUID(ids, other.ID) {
+			continue
+		}
+		if c.RegistrationNumber != "" && other.RegistrationNumber == c.RegistrationNumber && other.Jurisdiction == c.Jurisdiction {
+			return true
+		}
+		if c.LEI != "" && other.LEI == c.LEI {
+			return true
+		}
+	}
+	return false
+}
+
+// companyNameTaken returns true if another company has the given name.
+func (r *MemoryRepository) companyNameTaken(name string, id uuid.UUID) bool {
+	for _, c := range r.companies {
+		if c.Name == name && c.ID != id {
+			return true
+		}
+	}
+	return false
+}
+
+func validateCompanyColumns(c *Company) error {
+	if utf8.RuneCountInString(c.Name) > companyNameMaxLength {
+		return errValueTooLong("name", companyNameMaxLength)
+	}
+	if utf8.RuneCountInString(c.Description) > companyDescriptionMaxLength {
+		return errValueTooLong("description", companyDescriptionMaxLength)
+	}
+	return validateColumnLengths([]columnLength{
+		{"jurisdiction", c.Jurisdiction, 2},
+		{"registration_number", c.RegistrationNumber, 50},
+		{"vat_id", c.VATID, 15},
+		{"lei", c.LEI, 20},
+	})
+}
+
+func statusChangeColumnLengths(ch *CompanyStatusChange) []columnLength {
+	return []columnLength{
+		{"reason", ch.Reason, 500},
+		{"username", ch.Username, 100},
+	}
+}
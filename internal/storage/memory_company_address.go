@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// CreateCompanyAddress creates the given address.
+func (r *MemoryRepository) CreateCompanyAddress(ctx context.Context, a *CompanyAddress) error {
+	if err := validateColumnLengths(addressColumnLengths(a)); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.companies[a.CompanyID]; !ok {
+		return ErrDoesNotExist
+	}
+	if _, ok := r.addresses[a.ID]; ok {
+		return ErrAlreadyExists
+	}
+	a.CreatedAt = time.Now()
+	a.UpdatedAt = a.CreatedAt
+	r.addresses[a.ID] = *a
+	return nil
+}
+
+// GetCompanyAddress returns the address of the given company.
+func (r *MemoryRepository) GetCompanyAddress(ctx context.Context, companyID, id uuid.UUID) (CompanyAddress, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	a, ok := r.addresses[id]
+	if !ok || a.CompanyID != companyID {
+		return CompanyAddress{}, ErrDoesNotExist
+	}
+	return a, nil
+}
+
+// GetCompanyAddresses returns the addresses of the given company.
+func (r *MemoryRepository) GetCompanyAddresses(ctx context.Context, companyID uuid.UUID) ([]CompanyAddress, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var list []CompanyAddress
+	for _, a := range r.addresses {
+		if a.CompanyID == companyID {
+			list = append(list, a)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].CreatedAt.Before(list[j].CreatedAt)
+		}
+		return list[i].ID.String() < list[j].ID.String()
+	})
+	return list, nil
+}
+
+// UpdateCompanyAddress updates the given address.
+func (r *MemoryRepository) UpdateCompanyAddress(ctx context.Context, a *CompanyAddress) error {
+	if err := validateColumnLengths(addressColumnLengths(a)); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old, ok := r.addresses[a.ID]
+	if !ok || old.CompanyID != a.CompanyID {
+		return ErrDoesNotExist
+	}
+	a.CreatedAt = old.CreatedAt
+	a.UpdatedAt = time.Now()
+	r.addresses[a.ID] = *a
+	return nil
+}
+
+// DeleteCompanyAddress deletes the address of the given company.
+func (r *MemoryRepository) DeleteCompanyAddress(ctx context.Context, companyID, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	a, ok := r.addresses[id]
+	if !ok || a.CompanyID != companyID {
+		return ErrDoesNotExist
+	}
+	delete(r.addresses, id)
+	return nil
+}
+
+func addressColumnLengths(a *CompanyAddress) []columnLength {
+	return []columnLength{
+		{"country", a.Country, 2},
+		{"region", a.Region, 100},
+		{"city", a.City, 100},
+		{"postal_code", a.PostalCode, 20},
+		{"line1", a.Line1, 200},
+		{"line2", a.Line2, 200},
+	}
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// CreateCompanyAttachment creates the given attachment.
+func (r *MemoryRepository) CreateCompanyAttachment(ctx context.Context, a *CompanyAttachment) error {
+	if err := validateColumnLengths(attachmentColumnLengths(a)); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.companies[a.CompanyID.UUID]; !ok && a.CompanyID.Valid {
+		return ErrDoesNotExist
+	}
+	if _, ok := r.files[a.ID]; ok {
+		return ErrAlreadyExists
+	}
+	a.CreatedAt = time.Now()
+	r.files[a.ID] = *a
+	return nil
+}
+
+// GetCompanyAttachment returns the attachment of the given company.
+func (r *MemoryRepository) GetCompanyAttachment(ctx context.Context, companyID, id uuid.UUID) (CompanyAttachment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	a, ok := r.files[id]
+	if !ok || !a.CompanyID.Valid || a.CompanyID.UUID != companyID {
+		return CompanyAttachment{}, ErrDoesNotExist
+	}
+	return a, nil
+}
+
+// GetCompanyAttachments returns the attachments of the given company.
+func (r *MemoryRepository) GetCompanyAttachments(ctx context.Context, companyID uuid.UUID) ([]CompanyAttachment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var list []CompanyAttachment
+	for _, a := range r.files {
+		if a.CompanyID.Valid && a.CompanyID.UUID == companyID {
+			list = append(list, a)
+		}
+	}
+	sortAttachments(list)
+	return list, nil
+}
+
+// DeleteCompanyAttachment removes the attachment from the given company.
+func (r *MemoryRepository) DeleteCompanyAttachment(ctx context.Context, companyID, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	a, ok := r.files[id]
+	if !ok || !a.CompanyID.Valid || a.CompanyID.UUID != companyID {
+		return ErrDoesNotExist
+	}
+	a.CompanyID = uuid.NullUUID{}
+	r.files[id] = a
+	return nil
+}
+
+// GetOrphanAttachments returns the orphan attachments, the oldest first.
+func (r *MemoryRepository) GetOrphanAttachments(ctx context.Context, limit int) ([]CompanyAttachment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var list []CompanyAttachment
+	for _, a := range r.files {
+		if !a.CompanyID.Valid {
+			list = append(list, a)
+		}
+	}
+	sortAttachments(list)
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
+
+// DeleteOrphanAttachment deletes the given orphan attachment.
+func (r *MemoryRepository) DeleteOrphanAttachment(ctx context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	a, ok := r.files[id]
+	if !ok || a.CompanyID.Valid {
+		return ErrDoesNotExist
+	}
+	delete(r.files, id)
+	return nil
+}
+
+// sortAttachments sorts the attachments by creation time and ID, like the
+// SQL queries do.
+func sortAttachments(list []CompanyAttachment) {
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].CreatedAt.Before(list[j].CreatedAt)
+		}
+		return list[i].ID.String() < list[j].ID.String()
+	})
+}
+
+func attachmentColumnLengths(a *CompanyAttachment) []columnLength {
+	return []columnLength{
+		{"filename", a.Filename, 255},
+		{"content_type", a.ContentType, 255},
+		{"sha256", a.SHA256, 64},
+		{"blob_key", a.BlobKey, 300},
+		{"uploaded_by", a.UploadedBy, userUsernameMaxLength},
+	}
+}
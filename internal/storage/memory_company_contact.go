@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// CreateCompanyContact creates the given contact.
+func (r *MemoryRepository) CreateCompanyContact(ctx context.Context, c *CompanyContact) error {
+	if err := validateColumnLengths(contactColumnLengths(c)); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.companies[c.CompanyID]; !ok {
+		return ErrDoesNotExist
+	}
+	if _, ok := r.contacts[c.ID]; ok {
+		return ErrAlreadyExists
+	}
+	c.CreatedAt = time.Now()
+	c.UpdatedAt = c.CreatedAt
+	r.contacts[c.ID] = *c
+	return nil
+}
+
+// GetCompanyContact returns the contact of the given company.
+func (r *MemoryRepository) GetCompanyContact(ctx context.Context, companyID, id uuid.UUID) (CompanyContact, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c, ok := r.contacts[id]
+	if !ok || c.CompanyID != companyID {
+		return CompanyContact{}, ErrDoesNotExist
+	}
+	return c, nil
+}
+
+// GetCompanyContacts returns the contacts of the given company.
+func (r *MemoryRepository) GetCompanyContacts(ctx context.Context, companyID uuid.UUID) ([]CompanyContact, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var list []CompanyContact
+	for _, c := range r.contacts {
+		if c.CompanyID == companyID {
+			list = append(list, c)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].CreatedAt.Before(list[j].CreatedAt)
+		}
+		return list[i].ID.String() < list[j].ID.String()
+	})
+	return list, nil
+}
+
+// UpdateCompanyContact updates the given contact.
+func (r *MemoryRepository) UpdateCompanyContact(ctx context.Context, c *CompanyContact) error {
+	if err := validateColumnLengths(contactColumnLengths(c)); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old, ok := r.contacts[c.ID]
+	if !ok || old.CompanyID != c.CompanyID {
+		return ErrDoesNotExist
+	}
+	c.CreatedAt = old.CreatedAt
+	c.UpdatedAt = time.Now()
+	r.contacts[c.ID] = *c
+	return nil
+}
+
+// DeleteCompanyContact deletes the contact of the given company.
+func (r *MemoryRepository) DeleteCompanyContact(ctx context.Context, companyID, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.contacts[id]
+	if !ok || c.CompanyID != companyID {
+		return ErrDoesNotExist
+	}
+	delete(r.contacts, id)
+	return nil
+}
+
+func contactColumnLengths(c *CompanyContact) []columnLength {
+	return []columnLength{
+		{"name", c.Name, 100},
+		{"role", c.Role, 100},
+		{"email", c.Email, 254},
+		{"phone", c.Phone, 16},
+	}
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// CreateCompanyFieldChanges records the given field changes.
+func (r *MemoryRepository) CreateCompanyFieldChanges(ctx context.Context, changes []CompanyFieldChange) error {
+	for i := range changes {
+		if err := validateColumnLengths(fieldChangeColumnLengths(&changes[i])); err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for i := range changes {
+		ch := &changes[i]
+		if _, ok := r.companies[ch.CompanyID]; !ok {
+			return ErrDoesNotExist
+		}
+		ch.CreatedAt = now
+
+		// the slices are shared with the copies of the transactions
+		history := make([]CompanyFieldChange, 0, len(r.fieldEdits[ch.CompanyID])+1)
+		r.fieldEdits[ch.CompanyID] = append(append(history, r.fieldEdits[ch.CompanyID]...), *ch)
+	}
+	return nil
+}
+
+// GetCompanyFieldChanges returns the field changes of the given company.
+func (r *MemoryRepository) GetCompanyFieldChanges(ctx context.Context, companyID uuid.UUID) ([]CompanyFieldChange, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]CompanyFieldChange(nil), r.fieldEdits[companyID]...), nil
+}
+
+func fieldChangeColumnLengths(ch *CompanyFieldChange) []columnLength {
+	return []columnLength{
+		{"field", ch.Field, 100},
+		{"old_value", ch.OldValue, 3000},
+		{"new_value", ch.NewValue, 3000},
+		{"username", ch.Username, userUsernameMaxLength},
+	}
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// CreateCompanyNote creates the given note and its first version.
+func (r *MemoryRepository) CreateCompanyNote(ctx context.Context, n *CompanyNote) error {
+	if err := validateColumnLengths(noteColumnLengths(n, n.Author)); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.companies[n.CompanyID]; !ok {
+		return ErrDoesNotExist
+	}
+	if _, ok := r.notes[n.ID]; ok {
+		return ErrAlreadyExists
+	}
+	n.CreatedAt = time.Now()
+	n.UpdatedAt = n.CreatedAt
+	n.Version = 1
+	r.notes[n.ID] = *n
+	r.versions[n.ID] = []CompanyNoteVersion{noteVersion(n, n.Author)}
+	return nil
+}
+
+// GetCompanyNote returns the note of the given company.
+func (r *MemoryRepository) GetCompanyNote(ctx context.Context, companyID, id uuid.UUID) (CompanyNote, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	n, ok := r.notes[id]
+	if !ok || n.CompanyID != companyID {
+		return CompanyNote{}, ErrDoesNotExist
+	}
+	return n, nil
+}
+
+// GetCompanyNotes returns the notes of the given company, the pinned ones
+// first.
+func (r *MemoryRepository) GetCompanyNotes(ctx context.Context, companyID uuid.UUID) ([]CompanyNote, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var list []CompanyNote
+	for _, n := range r.notes {
+		if n.CompanyID == companyID {
+			list = append(list, n)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Pinned != list[j].Pinned {
+			return list[i].Pinned
+		}
+		if !list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].CreatedAt.Before(list[j].CreatedAt)
+		}
+		return list[i].ID.String() < list[j].ID.String()
+	})
+	return list, nil
+}
+
+// UpdateCompanyNote updates the given note and records its new version.
+func (r *MemoryRepository) UpdateCompanyNote(ctx context.Context, n *CompanyNote, username string) error {
+	if err := validateColumnLengths(noteColumnLengths(n, username)); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	item, ok := r.notes[n.ID]
+	if !ok || item.CompanyID != n.CompanyID {
+		return ErrDoesNotExist
+	}
+	item.UpdatedAt = time.Now()
+	item.Body = n.Body
+	item.Pinned = n.Pinned
+	item.Version++
+	r.notes[n.ID] = item
+	*n = item
+
+	// the slices are shared with the copies of the transactions
+	versions := make([]CompanyNoteVersion, 0, len(r.versions[n.ID])+1)
+	r.versions[n.ID] = append(append(versions, r.versions[n.ID]...), noteVersion(n, username))
+	return nil
+}
+
+// DeleteCompanyNote deletes the note of the given company.
+func (r *MemoryRepository) DeleteCompanyNote(ctx context.Context, companyID, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n, ok := r.notes[id]
+	if !ok || n.CompanyID != companyID {
+		return ErrDoesNotExist
+	}
+	delete(r.notes, id)
+	delete(r.versions, id)
+	return nil
+}
+
+// GetCompanyNoteVersions returns the versions of the note of the given
+// company.
+func (r *MemoryRepository) GetCompanyNoteVersions(ctx context.Context, companyID, noteID uuid.UUID) ([]CompanyNoteVersion, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	n, ok := r.notes[noteID]
+	if !ok || n.CompanyID != companyID {
+		return nil, ErrDoesNotExist
+	}
+	return append([]CompanyNoteVersion(nil), r.versions[noteID]...), nil
+}
+
+// noteVersion returns the current version of the given note.
+func noteVersion(n *CompanyNote, username string) CompanyNoteVersion {
+	return CompanyNoteVersion{
+		NoteID:    n.ID,
+		Version:   n.Version,
+		CreatedAt: n.UpdatedAt,
+		Username:  username,
+		Body:      n.Body,
+		Pinned:    n.Pinned,
+	}
+}
+
+func noteColumnLengths(n *CompanyNote, username string) []columnLength {
+	return []columnLength{
+		{"author", n.Author, userUsernameMaxLength},
+		{"body", n.Body, 10000},
+		{"username", username, userUsernameMaxLength},
+	}
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"context"
+	"sort"
+)
+
+// GetCompanyTimeline returns the page of the timeline of the company
+// selected by the query.
+func (r *MemoryRepository) GetCompanyTimeline(ctx context.Context, q CompanyTimelineQuery) ([]CompanyTimelineEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var entries []CompanyTimelineEntry
+	add := func(e CompanyTimelineEntry) {
+		if a := q.After; a != nil {
+			if q.NewestFirst && !historyBefore(e.CreatedAt, e.ID, a.CreatedAt, a.ID) ||
+				!q.NewestFirst && !historyBefore(a.CreatedAt, a.ID, e.CreatedAt, e.ID) {
+				return
+			}
+		}
+		entries = append(entries, e)
+	}
+	for _, n := range r.notes {
+		if n.CompanyID == q.CompanyID {
+			n := n
+			add(CompanyTimelineEntry{Kind: TimelineNote, CreatedAt: n.CreatedAt, ID: n.ID, Note: &n})
+		}
+	}
+	for _, ch := range r.fieldEdits[q.CompanyID] {
+		ch := ch
+		add(CompanyTimelineEntry{Kind: TimelineFieldChange, CreatedAt: ch.CreatedAt, ID: ch.ID, FieldChange: &ch})
+	}
+	for _, ch := range r.statuses[q.CompanyID] {
+		ch := ch
+		add(CompanyTimelineEntry{Kind: TimelineStatusChange, CreatedAt: ch.CreatedAt, ID: ch.ID, StatusChange: &ch})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if q.NewestFirst {
+			i, j = j, i
+		}
+		return historyBefore(entries[i].CreatedAt, entries[i].ID, entries[j].CreatedAt, entries[j].ID)
+	})
+	if len(entries) > q.Limit {
+		entries = entries[:q.Limit]
+	}
+	return entries, nil
+}
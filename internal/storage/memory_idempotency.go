@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"context"
+	"time"
+	"unicode/utf8"
+)
+
+// idempotencyKeyID identifies an idempotency key, the keys are scoped by
+// the user.
+type idempotencyKeyID struct {
+	username string
+	key      string
+}
+
+// CreateIdempotencyKey stores the given key of a request in progress.
+func (r *MemoryRepository) CreateIdempotencyKey(ctx context.Context, k *IdempotencyKey) error {
+	if utf8.RuneCountInString(k.Key) > idempotencyKeyMaxLength {
+		return errValueTooLong("key", idempotencyKeyMaxLength)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id := idempotencyKeyID{k.Username, k.Key}
+	k.CreatedAt = time.Now()
+	if old, ok := r.keys[id]; ok && old.ExpiresAt.After(k.CreatedAt) {
+		return ErrAlreadyExists
+	}
+	r.keys[id] = *k
+	return nil
+}
+
+// GetIdempotencyKey returns the given key of the user if it is not expired.
+func (r *MemoryRepository) GetIdempotencyKey(ctx context.Context, username, key string) (IdempotencyKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	k, ok := r.keys[idempotencyKeyID{username, key}]
+	if !ok || !k.ExpiresAt.After(time.Now()) {
+		return IdempotencyKey{}, ErrDoesNotExist
+	}
+	return k, nil
+}
+
+// CompleteIdempotencyKey stores the response and the response header of the
+// request of the given key.
+func (r *MemoryRepository) CompleteIdempotencyKey(ctx context.Context, k *IdempotencyKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id := idempotencyKeyID{k.Username, k.Key}
+	stored, ok := r.keys[id]
+	if !ok {
+		return ErrDoesNotExist
+	}
+	k.Completed = true
+	stored.Completed = true
+	stored.Response = k.Response
+	stored.ResponseHeader = k.ResponseHeader
+	r.keys[id] = stored
+	return nil
+}
+
+// DeleteIdempotencyKey deletes the given key of the user.
+func (r *MemoryRepository) DeleteIdempotencyKey(ctx context.Context, username, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.keys, idempotencyKeyID{username, key})
+	return nil
+}
+
+// DeleteExpiredIdempotencyKeys deletes the expired keys.
+func (r *MemoryRepository) DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var n int64
+	now := time.Now()
+	for key, k := range r.keys {
+		if !k.ExpiresAt.After(now) {
+			delete(r.keys, key)
+			n++
+		}
+	}
+	return n, nil
+}
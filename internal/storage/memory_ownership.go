@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// CreateOwnership creates the given stake.
+func (r *MemoryRepository) CreateOwnership(ctx context.Context, o *Ownership) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkOwnership(o); err != nil {
+		return err
+	}
+	if _, ok := r.ownerships[o.ID]; ok {
+		return ErrAlreadyExists
+	}
+	o.CreatedAt = time.Now()
+	o.UpdatedAt = o.CreatedAt
+	r.ownerships[o.ID] = *o
+	return nil
+}
+
+// GetOwnership returns the stake in the given company.
+func (r *MemoryRepository) GetOwnership(ctx context.Context, companyID, id uuid.UUID) (Ownership, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	o, ok := r.ownerships[id]
+	if !ok || o.CompanyID != companyID {
+		return Ownership{}, ErrDoesNotExist
+	}
+	return o, nil
+}
+
+// GetCompanyOwnerships returns the direct stakes in the given company.
+func (r *MemoryRepository) GetCompanyOwnerships(ctx context.Context, companyID uuid.UUID) ([]Ownership, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.companyOwnerships(companyID), nil
+}
+
+// UpdateOwnership updates the given stake.
+func (r *MemoryRepository) UpdateOwnership(ctx context.Context, o *Ownership) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old, ok := r.ownerships[o.ID]
+	if !ok || old.CompanyID != o.CompanyID {
+		return ErrDoesNotExist
+	}
+	if err := r.checkOwnership(o); err != nil {
+		return err
+	}
+	o.CreatedAt = old.CreatedAt
+	o.UpdatedAt = time.Now()
+	r.ownerships[o.ID] = *o
+	return nil
+}
+
+// DeleteOwnership deletes the stake in the given company.
+func (r *MemoryRepository) DeleteOwnership(ctx context.Context, companyID, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	o, ok := r.ownerships[id]
+	if !ok || o.CompanyID != companyID {
+		return ErrDoesNotExist
+	}
+	delete(r.ownerships, id)
+	return nil
+}
+
+// GetOwnershipGraph returns the stakes in the given company and in its
+// owners, recursively.
+func (r *MemoryRepository) GetOwnershipGraph(ctx context.Context, companyID uuid.UUID) ([]Ownership, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, ok := r.companies[companyID]; !ok {
+		return nil, nil
+	}
+
+	var list []Ownership
+	visited := map[uuid.UUID]bool{companyID: true}
+	queue := []uuid.UUID{companyID}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, o := range r.companyOwnerships(id) {
+			list = append(list, o)
+			if o.OwnerCompanyID.Valid && !visited[o.OwnerCompanyID.UUID] {
+				visited[o.OwnerCompanyID.UUID] = true
+				queue = append(queue, o.OwnerCompanyID.UUID)
+			}
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if !list[i].ValidFrom.Equal(list[j].ValidFrom) {
+			return list[i].ValidFrom.Before(list[j].ValidFrom)
+		}
+		return list[i].ID.String() < list[j].ID.String()
+	})
+	return list, nil
+}
+
+// companyOwnerships returns the direct stakes in the given company, by
+// start date.
+func (r *MemoryRepository) companyOwnerships(companyID uuid.UUID) []Ownership {
+	var list []Ownership
+	for _, o := range r.ownerships {
+		if o.CompanyID == companyID {
+			list = append(list, o)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].ValidFrom.Equal(list[j].ValidFrom) {
+			return list[i].ValidFrom.Before(list[j].ValidFrom)
+		}
+		return list[i].ID.String() < list[j].ID.String()
+	})
+	return list
+}
+
+// checkOwnership checks the references and the constraints of the schema,
+// then the total of the stakes.
+func (r *MemoryRepository) checkOwnership(o *Ownership) error {
+	if _, ok := r.companies[o.CompanyID]; !ok {
+		return ErrDoesNotExist
+	}
+	if o.OwnerCompanyID.Valid == o.OwnerPersonID.Valid {
+		return fmt.Errorf("ownership: exactly one owner must be set")
+	}
+	if o.OwnerCompanyID.Valid {
+		if o.OwnerCompanyID.UUID == o.CompanyID {
+			return fmt.Errorf("ownership: a company can't own itself")
+		}
+		if _, ok := r.companies[o.OwnerCompanyID.UUID]; !ok {
+			return ErrDoesNotExist
+		}
+	}
+	if o.OwnerPersonID.Valid {
+		if _, ok := r.persons[o.OwnerPersonID.UUID]; !ok {
+			return ErrDoesNotExist
+		}
+	}
+	return validateOwnershipTotal(r.companyOwnerships(o.CompanyID), o)
+}
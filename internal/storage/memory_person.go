@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// CreatePerson creates the given person.
+func (r *MemoryRepository) CreatePerson(ctx context.Context, p *Person) error {
+	if err := validateColumnLengths(personColumnLengths(p)); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.persons[p.ID]; ok {
+		return ErrAlreadyExists
+	}
+	p.CreatedAt = time.Now()
+	p.UpdatedAt = p.CreatedAt
+	r.persons[p.ID] = *p
+	return nil
+}
+
+// GetPerson returns the person for the given ID.
+func (r *MemoryRepository) GetPerson(ctx context.Context, id uuid.UUID) (Person, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	p, ok := r.persons[id]
+	if !ok {
+		return Person{}, ErrDoesNotExist
+	}
+	return p, nil
+}
+
+// UpdatePerson updates the given person.
+func (r *MemoryRepository) UpdatePerson(ctx context.Context, p *Person) error {
+	if err := validateColumnLengths(personColumnLengths(p)); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old, ok := r.persons[p.ID]
+	if !ok {
+		return ErrDoesNotExist
+	}
+	p.CreatedAt = old.CreatedAt
+	p.UpdatedAt = time.Now()
+	r.persons[p.ID] = *p
+	return nil
+}
+
+// DeletePerson deletes the person for the given ID.
+func (r *MemoryRepository) DeletePerson(ctx context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.persons[id]; !ok {
+		return ErrDoesNotExist
+	}
+	for _, o := range r.ownerships {
+		if o.OwnerPersonID.Valid && o.OwnerPersonID.UUID == id {
+			return ErrUsedByOtherObjects
+		}
+	}
+	delete(r.persons, id)
+	return nil
+}
+
+func personColumnLengths(p *Person) []columnLength {
+	return []columnLength{
+		{"name", p.Name, 100},
+		{"country", p.Country, 2},
+	}
+}
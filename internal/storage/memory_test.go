@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fillMemoryState sets every field of the state: an entry with the zero key
+// in the maps, the given number in the integers.
+func fillMemoryState(s *memoryState, n int64) {
+	v := reflect.ValueOf(s).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := reflect.NewAt(v.Field(i).Type(), v.Field(i).Addr().UnsafePointer()).Elem()
+		switch f.Kind() {
+		case reflect.Map:
+			f.Set(reflect.MakeMap(f.Type()))
+			f.SetMapIndex(reflect.Zero(f.Type().Key()), reflect.Zero(f.Type().Elem()))
+		case reflect.Int64:
+			f.SetInt(n)
+		default:
+			panic("fillMemoryState: unexpected field " + v.Type().Field(i).Name)
+		}
+	}
+}
+
+// emptyMemoryState empties every field of the state.
+func emptyMemoryState(s *memoryState) {
+	v := reflect.ValueOf(s).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := reflect.NewAt(v.Field(i).Type(), v.Field(i).Addr().UnsafePointer()).Elem()
+		switch f.Kind() {
+		case reflect.Map:
+			for _, k := range f.MapKeys() {
+				f.SetMapIndex(k, reflect.Value{})
+			}
+		default:
+			f.Set(reflect.Zero(f.Type()))
+		}
+	}
+}
+
+func TestMemoryTransaction(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Rollback", func(t *testing.T) {
+		assert := require.New(t)
+
+		r := &MemoryRepository{}
+		fillMemoryState(&r.memoryState, 1)
+		var want memoryState
+		fillMemoryState(&want, 1)
+
+		assert.NoError(r.Transaction(ctx, func(tx Repository) error {
+			emptyMemoryState(&tx.(*MemoryRepository).memoryState)
+			return ErrTransactionRollback
+		}))
+		assert.Equal(want, r.memoryState)
+	})
+
+	t.Run("Commit", func(t *testing.T) {
+		assert := require.New(t)
+
+		r := &MemoryRepository{}
+		fillMemoryState(&r.memoryState, 1)
+		var want memoryState
+		fillMemoryState(&want, 0)
+		emptyMemoryState(&want)
+
+		assert.NoError(r.Transaction(ctx, func(tx Repository) error {
+			emptyMemoryState(&tx.(*MemoryRepository).memoryState)
+			return nil
+		}))
+		assert.Equal(want, r.memoryState)
+	})
+
+	t.Run("Clone", func(t *testing.T) {
+		assert := require.New(t)
+
+		var s memoryState
+		fillMemoryState(&s, 1)
+		c := s.clone()
+		assert.Equal(s, c)
+
+		// the maps are not shared
+		emptyMemoryState(&c)
+		var want memoryState
+		fillMemoryState(&want, 1)
+		assert.Equal(want, s)
+	})
+}
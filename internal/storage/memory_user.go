@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"context"
+	"time"
+	"unicode/utf8"
+)
+
+// CreateUser creates the given user and sets its ID.
+func (r *MemoryRepository) CreateUser(ctx context.Context, u *User) error {
+	if utf8.RuneCountInString(u.Username) > userUsernameMaxLength {
+		return errValueTooLong("username", userUsernameMaxLength)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.users {
+		if existing.Username == u.Username {
+			return ErrAlreadyExists
+		}
+	}
+
+	r.lastUserID++
+	u.ID = r.lastUserID
+	u.CreatedAt = time.Now()
+	u.UpdatedAt = u.CreatedAt
+	r.users[u.ID] = *u
+	return nil
+}
+
+// GetUser returns the user for the given ID.
+func (r *MemoryRepository) GetUser(ctx context.Context, id int64) (User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	u, ok := r.users[id]
+	if !ok {
+		return User{}, ErrDoesNotExist
+	}
+	return u, nil
+}
+
+// GetUserByUsername returns the user for the given username.
+func (r *MemoryRepository) GetUserByUsername(ctx context.Context, username string) (User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, u := range r.users {
+		if u.Username == username {
+			return u, nil
+		}
+	}
+	return User{}, ErrDoesNotExist
+}
@@ -0,0 +1,424 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/httpfs"
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+)
+
+// Migrations, the PostgreSQL ones in migrations and the SQLite ones with the
+// same versions in migrations_sqlite.
+//
+//go:embed migrations/* migrations_sqlite/*
+var migrations embed.FS
+
+// MigrationInfo describes an embedded migration.
+type MigrationInfo struct {
+	Version    uint
+	Identifier string
+}
+
+// MigrationStep is a migration to apply in the given direction.
+type MigrationStep struct {
+	MigrationInfo
+	Direction source.Direction
+}
+
+// MigrationStatus holds the state of the database schema.
+type MigrationStatus struct {
+	// Version is the current schema version, 0 if no migration is applied.
+	Version uint
+	Dirty   bool
+	// Latest is the version of the latest embedded migration.
+	Latest     uint
+	Migrations []MigrationInfo
+}
+
+// Migrator applies the embedded migrations of the dialect of its database.
+type Migrator struct {
+	driverName string
+	m          *migrate.Migrate
+}
+
+// NewMigrator creates a new Migrator for the given database.
+func NewMigrator(db *sqlx.DB) (*Migrator, error) {
+	var driver database.Driver
+	var err error
+
+	switch db.DriverName() {
+	case DriverSQLite:
+		driver, err = sqlite.WithInstance(db.DB, &sqlite.Config{
+			MigrationsTable: "schema_migrations",
+		})
+	default:
+		driver, err = postgres.WithInstance(db.DB, &postgres.Config{
+			MigrationsTable: "schema_migrations",
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("storage: migrate %s driver error: %w", db.DriverName(), err)
+	}
+
+	src, err := httpfs.New(http.FS(migrations), migrationsDir(db.DriverName()))
+	if err != nil {
+		return nil, fmt.Errorf("new httpfs error: %w", err)
+	}
+
+	m, err := migrate.NewWithInstance("httpfs", src, db.DriverName(), driver)
+	if err != nil {
+		return nil, fmt.Errorf("storage: new migrate instance error: %w", err)
+	}
+	return &Migrator{driverName: db.DriverName(), m: m}, nil
+}
+
+// Status returns the state of the database schema.
+func (m *Migrator) Status() (MigrationStatus, error) {
+	var status MigrationStatus
+
+	version, dirty, err := m.m.Version()
+	if err != nil && err != migrate.ErrNilVersion {
+		return status, fmt.Errorf("storage: get schema version error: %w", err)
+	}
+	status.Version = version
+	status.Dirty = dirty
+
+	status.Migrations, err = embeddedMigrations(m.driverName)
+	if err != nil {
+		return status, err
+	}
+	if n := len(status.Migrations); n > 0 {
+		status.Latest = status.Migrations[n-1].Version
+	}
+	return status, nil
+}
+
+// Plan returns the migrations to apply to get from the current schema
+// version to the given one, in the order of their execution.
+func (m *Migrator) Plan(target uint) ([]MigrationStep, error) {
+	status, err := m.Status()
+	if err != nil {
+		return nil, err
+	}
+	if target != 0 && !hasMigration(status.Migrations, target) {
+		return nil, fmt.Errorf("storage: unknown migration version %d", target)
+	}
+
+	var steps []MigrationStep
+	if target >= status.Version {
+		for _, mi := range status.Migrations {
+			if mi.Version > status.Version && mi.Version <= target {
+				steps = append(steps, MigrationStep{MigrationInfo: mi, Direction: source.Up})
+			}
+		}
+		return steps, nil
+	}
+
+	for i := len(status.Migrations) - 1; i >= 0; i-- {
+		mi := status.Migrations[i]
+		if mi.Version > target && mi.Version <= status.Version {
+			steps = append(steps, MigrationStep{MigrationInfo: mi, Direction: source.Down})
+		}
+	}
+	return steps, nil
+}
+
+// DownTarget returns the schema version after reverting the last n applied
+// migrations.
+func (m *Migrator) DownTarget(n int) (uint, error) {
+	status, err := m.Status()
+	if err != nil {
+		return 0, err
+	}
+
+	var applied []uint
+	for _, mi := range status.Migrations {
+		if mi.Version <= status.Version {
+			applied = append(applied, mi.Version)
+		}
+	}
+	if n >= len(applied) {
+		return 0, nil
+	}
+	return applied[len(applied)-n-1], nil
+}
+
+// Up applies all the pending migrations.
+func (m *Migrator) Up() error {
+	return m.run("applied", m.m.Up)
+}
+
+// Down reverts the last n applied migrations.
+func (m *Migrator) Down(n int) error {
+	target, err := m.DownTarget(n)
+	if err != nil {
+		return err
+	}
+	return m.Goto(target)
+}
+
+// Goto migrates the schema up or down to the given version, 0 reverts all
+// the migrations.
+func (m *Migrator) Goto(version uint) error {
+	if version == 0 {
+		return m.run("reverted", m.m.Down)
+	}
+	return m.run("applied", func() error {
+		return m.m.Migrate(version)
+	})
+}
+
+// Force sets the schema version and clears the dirty flag without running
+// any migration, e.g. after a failed migration was repaired by hand. The
+// version -1 means no migration is applied.
+func (m *Migrator) Force(version int) error {
+	if err := m.m.Force(version); err != nil {
+		return fmt.Errorf("storage: force schema version error: %w", err)
+	}
+	log.WithField("version", version).Warningf("storage: %s schema version forced", driverTitle(m.driverName))
+	return nil
+}
+
+// run runs the given migrate function and logs the version change.
+func (m *Migrator) run(action string, f func() error) error {
+	oldVersion, _, _ := m.m.Version()
+
+	if err := f(); err != nil && err != migrate.ErrNoChange {
+		if _, ok := err.(migrate.ErrDirty); ok {
+			return fmt.Errorf("storage: %w, repair the schema and mark the version with the 'migrate force' command", err)
+		}
+		return fmt.Errorf("storage: migrate error: %w", err)
+	}
+
+	newVersion, _, _ := m.m.Version()
+
+	if oldVersion != newVersion {
+		log.WithFields(log.Fields{
+			"from_version": oldVersion,
+			"to_version":   newVersion,
+		}).Infof("storage: %s data migrations %s", driverTitle(m.driverName), action)
+	}
+	return nil
+}
+
+// MigrateUp applies the pending data migrations.
+func MigrateUp(db *sqlx.DB) error {
+	log.Infof("storage: applying %s data migrations from migrations dir ...", driverTitle(db.DriverName()))
+
+	m, err := NewMigrator(db)
+	if err != nil {
+		return err
+	}
+	return m.Up()
+}
+
+// MigrateDown reverts all the data migrations.
+func MigrateDown(db *sqlx.DB) error {
+	log.Infof("storage: reverting %s data migrations from migrations dir ...", driverTitle(db.DriverName()))
+
+	m, err := NewMigrator(db)
+	if err != nil {
+		return err
+	}
+	return m.Goto(0)
+}
+
+// SchemaVersion returns the current schema version of the database, 0 if
+// no migration is applied.
+func SchemaVersion(ctx context.Context) (uint, bool, error) {
+	if db == nil {
+		return 0, false, fmt.Errorf("storage: not initialized")
+	}
+
+	query := "SELECT to_regclass('schema_migrations') IS NOT NULL"
+	if db.DriverName() == DriverSQLite {
+		query = "SELECT count(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'"
+	}
+	var exists bool
+	if err := sqlx.GetContext(ctx, db, &exists, query); err != nil {
+		return 0, false, handlePSQLError(Select, err, "select schema migrations table error")
+	}
+	if !exists {
+		return 0, false, nil
+	}
+
+	var v struct {
+		Version int64 `db:"version"`
+		Dirty   bool  `db:"dirty"`
+	}
+	err := sqlx.GetContext(ctx, db, &v, "SELECT version, dirty FROM schema_migrations LIMIT 1")
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, handlePSQLError(Select, err, "select schema version error")
+	}
+	return uint(v.Version), v.Dirty, nil
+}
+
+// CheckSchemaVersion verifies that the database schema is clean and at the
+// version of the latest embedded migration.
+func CheckSchemaVersion(ctx context.Context) error {
+	if db == nil {
+		return fmt.Errorf("storage: not initialized")
+	}
+
+	expected, err := LatestSchemaVersion(db.DriverName())
+	if err != nil {
+		return err
+	}
+
+	version, dirty, err := SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	if dirty {
+		return fmt.Errorf("schema version %d is dirty", version)
+	}
+	if version != expected {
+		return fmt.Errorf("schema version is %d, expected %d", version, expected)
+	}
+	return nil
+}
+
+// checkSchemaCompatibility returns an error if the database schema is dirty
+// or newer than the embedded migrations, the binary can't run against it.
+func checkSchemaCompatibility(ctx context.Context) error {
+	latest, err := LatestSchemaVersion(db.DriverName())
+	if err != nil {
+		return err
+	}
+
+	version, dirty, err := SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	if dirty {
+		return fmt.Errorf("storage: schema version %d is dirty, repair the schema and mark the version with the 'migrate force' command", version)
+	}
+	if version > latest {
+		return fmt.Errorf("storage: schema version %d is newer than the latest known version %d, upgrade the binary", version, latest)
+	}
+	return nil
+}
+
+// LatestSchemaVersion returns the version of the latest embedded migration
+// of the given driver.
+func LatestSchemaVersion(driverName string) (uint, error) {
+	list, err := embeddedMigrations(driverName)
+	if err != nil {
+		return 0, err
+	}
+	if len(list) == 0 {
+		return 0, nil
+	}
+	return list[len(list)-1].Version, nil
+}
+
+// migrationsDir returns the directory of the embedded migrations for the
+// given driver.
+func migrationsDir(driverName string) string {
+	if driverName == DriverSQLite {
+		return "migrations_sqlite"
+	}
+	return "migrations"
+}
+
+// embeddedMigrations returns the embedded migrations of the given driver
+// sorted by version.
+func embeddedMigrations(driverName string) ([]MigrationInfo, error) {
+	return readMigrations(migrations, migrationsDir(driverName))
+}
+
+// readMigrations returns the migrations of the given directory sorted by
+// version.
+func readMigrations(fsys fs.FS, dir string) ([]MigrationInfo, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("read migrations dir error: %w", err)
+	}
+
+	var list []MigrationInfo
+	for _, e := range entries {
+		m, err := source.Parse(e.Name())
+		if err != nil {
+			return nil, fmt.Errorf("parse migration %s error: %w", e.Name(), err)
+		}
+		if m.Direction == source.Up {
+			list = append(list, MigrationInfo{Version: m.Version, Identifier: m.Identifier})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, nil
+}
+
+// migrationNamePattern matches the names of the new migrations.
+var migrationNamePattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// CreateMigration writes the empty up and down files of a new migration with
+// the given name in the migrations directories of both dialects under dir,
+// the source directory of this package. Its version follows the latest one
+// of both directories. The paths of the created files are returned.
+func CreateMigration(dir, name string) ([]string, error) {
+	if !migrationNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid migration name %q, it must match %s", name, migrationNamePattern)
+	}
+
+	dirs := []string{
+		filepath.Join(dir, migrationsDir(DriverPostgres)),
+		filepath.Join(dir, migrationsDir(DriverSQLite)),
+	}
+	var version uint
+	for _, d := range dirs {
+		list, err := readMigrations(os.DirFS(d), ".")
+		if err != nil {
+			return nil, err
+		}
+		if len(list) != 0 && list[len(list)-1].Version > version {
+			version = list[len(list)-1].Version
+		}
+	}
+	version++
+
+	var paths []string
+	for _, d := range dirs {
+		for _, direction := range []source.Direction{source.Up, source.Down} {
+			path := filepath.Join(d, fmt.Sprintf("%06d_%s.%s.sql", version, name, direction))
+			f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+			if err != nil {
+				return paths, fmt.Errorf("create migration error: %w", err)
+			}
+			if err := f.Close(); err != nil {
+				return paths, fmt.Errorf("create migration error: %w", err)
+			}
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+func hasMigration(list []MigrationInfo, version uint) bool {
+	for _, mi := range list {
+		if mi.Version == version {
+			return true
+		}
+	}
+	return false
+}
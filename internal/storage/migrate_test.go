@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrator(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+
+	d := newSQLiteDB(t)
+	db = d
+	defer func() { db = nil }()
+
+	m, err := NewMigrator(d.DB)
+	assert.NoError(err)
+
+	latest, err := LatestSchemaVersion(DriverSQLite)
+	assert.NoError(err)
+
+	t.Run("Status", func(t *testing.T) {
+		assert := require.New(t)
+
+		status, err := m.Status()
+		assert.NoError(err)
+		assert.Equal(latest, status.Version)
+		assert.Equal(latest, status.Latest)
+		assert.False(status.Dirty)
+		assert.Len(status.Migrations, int(latest))
+		assert.NoError(checkSchemaCompatibility(ctx))
+	})
+
+	t.Run("Plan", func(t *testing.T) {
+		assert := require.New(t)
+
+		steps, err := m.Plan(latest)
+		assert.NoError(err)
+		assert.Empty(steps)
+
+		target, err := m.DownTarget(100)
+		assert.NoError(err)
+		assert.Equal(uint(0), target)
+
+		steps, err = m.Plan(0)
+		assert.NoError(err)
+		assert.Len(steps, int(latest))
+		assert.Equal(latest, steps[0].Version)
+		assert.Equal(source.Down, steps[0].Direction)
+
+		_, err = m.Plan(latest + 1)
+		assert.Error(err)
+	})
+
+	t.Run("Down and Up", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(m.Down(int(latest)))
+		version, dirty, err := SchemaVersion(ctx)
+		assert.NoError(err)
+		assert.Equal(uint(0), version)
+		assert.False(dirty)
+
+		steps, err := m.Plan(latest)
+		assert.NoError(err)
+		assert.Len(steps, int(latest))
+		assert.Equal(source.Up, steps[0].Direction)
+
+		assert.NoError(m.Up())
+		assert.NoError(CheckSchemaVersion(ctx))
+	})
+
+	t.Run("Newer schema", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(m.Force(int(latest) + 1))
+		assert.Error(checkSchemaCompatibility(ctx))
+		assert.NoError(m.Force(int(latest)))
+		assert.NoError(checkSchemaCompatibility(ctx))
+	})
+
+	t.Run("Dirty schema", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := d.Exec("UPDATE schema_migrations SET dirty = true")
+		assert.NoError(err)
+		assert.Error(checkSchemaCompatibility(ctx))
+		assert.Error(m.Up())
+
+		assert.NoError(m.Force(int(latest)))
+		assert.NoError(checkSchemaCompatibility(ctx))
+	})
+}
+
+func TestCreateMigration(t *testing.T) {
+	assert := require.New(t)
+
+	dir := t.TempDir()
+	for _, f := range []string{
+		"migrations/000001_initial.up.sql",
+		"migrations/000001_initial.down.sql",
+		"migrations_sqlite/000001_initial.up.sql",
+		"migrations_sqlite/000001_initial.down.sql",
+		// the versions of both dialects may differ while they are written
+		"migrations_sqlite/000002_next.up.sql",
+		"migrations_sqlite/000002_next.down.sql",
+	} {
+		assert.NoError(os.MkdirAll(filepath.Join(dir, filepath.Dir(f)), 0755))
+		assert.NoError(os.WriteFile(filepath.Join(dir, f), nil, 0644))
+	}
+
+	paths, err := CreateMigration(dir, "add_column")
+	assert.NoError(err)
+	assert.Equal([]string{
+		filepath.Join(dir, "migrations/000003_add_column.up.sql"),
+		filepath.Join(dir, "migrations/000003_add_column.down.sql"),
+		filepath.Join(dir, "migrations_sqlite/000003_add_column.up.sql"),
+		filepath.Join(dir, "migrations_sqlite/000003_add_column.down.sql"),
+	}, paths)
+	for _, p := range paths {
+		assert.FileExists(p)
+	}
+
+	_, err = CreateMigration(dir, "Bad name")
+	assert.Error(err)
+
+	// the embedded migrations are parsed the same way
+	list, err := readMigrations(os.DirFS(filepath.Join(dir, "migrations")), ".")
+	assert.NoError(err)
+	assert.Equal([]MigrationInfo{{Version: 1, Identifier: "initial"}, {Version: 3, Identifier: "add_column"}}, list)
+}
@@ -0,0 +1,11 @@
+create table idempotency_key (
+	key character varying (255) primary key,
+	created_at timestamp with time zone not null,
+	expires_at timestamp with time zone not null,
+	method character varying (255) not null,
+	request_hash character (64) not null,
+	completed boolean not null,
+	response bytea
+);
+
+create index idx_idempotency_key_expires_at on idempotency_key(expires_at);
@@ -0,0 +1,4 @@
+drop index idx_company_description_fts;
+drop index if exists idx_company_name_trgm;
+
+-- the pg_trgm extension is kept, other objects may use it
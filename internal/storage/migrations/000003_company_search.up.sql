@@ -0,0 +1,19 @@
+-- pg_trgm may not be available or the user may lack the privilege to create
+-- it, the search falls back to ILIKE then
+do $$
+begin
+	create extension if not exists pg_trgm;
+exception when others then
+	raise notice 'pg_trgm is not available, the company search falls back to ILIKE: %', sqlerrm;
+end
+$$;
+
+do $$
+begin
+	if exists (select 1 from pg_extension where extname = 'pg_trgm') then
+		create index idx_company_name_trgm on company using gin (name gin_trgm_ops);
+	end if;
+end
+$$;
+
+create index idx_company_description_fts on company using gin (to_tsvector('english', description));
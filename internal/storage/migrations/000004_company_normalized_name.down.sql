@@ -0,0 +1,4 @@
+drop index if exists idx_company_normalized_name_trgm;
+drop index idx_company_normalized_name;
+
+alter table company drop column normalized_name;
@@ -0,0 +1,13 @@
+-- set by the application from the name, the existing companies are
+-- backfilled on start
+alter table company add column normalized_name character varying (100) not null default '';
+
+create index idx_company_normalized_name on company(normalized_name);
+
+do $$
+begin
+	if exists (select 1 from pg_extension where extname = 'pg_trgm') then
+		create index idx_company_normalized_name_trgm on company using gin (normalized_name gin_trgm_ops);
+	end if;
+end
+$$;
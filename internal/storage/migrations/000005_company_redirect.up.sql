@@ -0,0 +1,8 @@
+-- the IDs of the merged companies, Get on them returns the target
+create table company_redirect (
+	id uuid primary key,
+	created_at timestamp with time zone not null,
+	target_id uuid not null references company on delete cascade
+);
+
+create index idx_company_redirect_target_id on company_redirect(target_id);
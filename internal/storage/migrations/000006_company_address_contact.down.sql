@@ -0,0 +1,5 @@
+drop index idx_company_contact_company_id;
+drop table company_contact;
+
+drop index idx_company_address_company_id;
+drop table company_address;
@@ -0,0 +1,28 @@
+create table company_address (
+	id uuid primary key,
+	company_id uuid not null references company on delete cascade,
+	created_at timestamp with time zone not null,
+	updated_at timestamp with time zone not null,
+	type integer not null,
+	country character (2) not null,
+	region character varying (100) not null,
+	city character varying (100) not null,
+	postal_code character varying (20) not null,
+	line1 character varying (200) not null,
+	line2 character varying (200) not null
+);
+
+create index idx_company_address_company_id on company_address(company_id);
+
+create table company_contact (
+	id uuid primary key,
+	company_id uuid not null references company on delete cascade,
+	created_at timestamp with time zone not null,
+	updated_at timestamp with time zone not null,
+	name character varying (100) not null,
+	role character varying (100) not null,
+	email character varying (254) not null,
+	phone character varying (16) not null
+);
+
+create index idx_company_contact_company_id on company_contact(company_id);
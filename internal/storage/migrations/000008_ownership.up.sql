@@ -0,0 +1,29 @@
+create table person (
+	id uuid primary key,
+	created_at timestamp with time zone not null,
+	updated_at timestamp with time zone not null,
+	name character varying (100) not null,
+	country character (2) not null
+);
+
+-- a stake in a company held by another company or by a natural person,
+-- effective from valid_from (inclusive) to valid_to (exclusive, open-ended
+-- if null)
+create table ownership (
+	id uuid primary key,
+	company_id uuid not null references company on delete cascade,
+	created_at timestamp with time zone not null,
+	updated_at timestamp with time zone not null,
+	owner_company_id uuid references company on delete cascade,
+	-- deleting a person holding stakes fails
+	owner_person_id uuid references person,
+	percentage double precision not null check (percentage > 0 and percentage <= 100),
+	valid_from timestamp with time zone not null,
+	valid_to timestamp with time zone check (valid_to > valid_from),
+	check ((owner_company_id is null) <> (owner_person_id is null)),
+	check (owner_company_id <> company_id)
+);
+
+create index idx_ownership_company_id on ownership(company_id);
+create index idx_ownership_owner_company_id on ownership(owner_company_id);
+create index idx_ownership_owner_person_id on ownership(owner_person_id);
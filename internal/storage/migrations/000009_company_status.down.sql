@@ -0,0 +1,4 @@
+drop index idx_company_status_history_company_id;
+drop table company_status_history;
+
+alter table company drop column status;
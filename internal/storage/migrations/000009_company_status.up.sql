@@ -0,0 +1,16 @@
+-- the values of the CompanyStatus enum of the API: 1 draft, 3 active
+alter table company add column status integer not null default 1;
+
+update company set status = 3 where registered;
+
+create table company_status_history (
+	id uuid primary key,
+	company_id uuid not null references company on delete cascade,
+	created_at timestamp with time zone not null,
+	from_status integer not null,
+	to_status integer not null,
+	reason character varying (500) not null,
+	username character varying (100) not null
+);
+
+create index idx_company_status_history_company_id on company_status_history(company_id, created_at);
@@ -0,0 +1,6 @@
+drop index idx_change_request_pending;
+drop index idx_change_request_status_expires_at;
+drop index idx_change_request_company_id;
+drop table change_request;
+
+alter table "user" drop column is_approver;
@@ -0,0 +1,23 @@
+alter table "user" add column is_approver boolean not null default false;
+
+-- the kinds and the statuses are the values of the ChangeKind and the
+-- ChangeRequestStatus enums of the API
+create table change_request (
+	id uuid primary key,
+	company_id uuid not null references company on delete cascade,
+	created_at timestamp with time zone not null,
+	updated_at timestamp with time zone not null,
+	expires_at timestamp with time zone not null,
+	decided_at timestamp with time zone,
+	kind integer not null,
+	status integer not null,
+	payload text not null,
+	requested_by character varying (100) not null,
+	decided_by character varying (100) not null,
+	comment character varying (500) not null
+);
+
+create index idx_change_request_company_id on change_request(company_id);
+create index idx_change_request_status_expires_at on change_request(status, expires_at);
+-- a single pending request per company
+create unique index idx_change_request_pending on change_request(company_id) where status = 1;
@@ -0,0 +1,8 @@
+drop index idx_company_vat_id;
+drop index idx_company_lei;
+drop index idx_company_registration_number;
+
+alter table company drop column lei;
+alter table company drop column vat_id;
+alter table company drop column registration_number;
+alter table company drop column jurisdiction;
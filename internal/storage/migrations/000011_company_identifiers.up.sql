@@ -0,0 +1,8 @@
+alter table company add column jurisdiction character (2) not null default '';
+alter table company add column registration_number character varying (50) not null default '';
+alter table company add column vat_id character varying (15) not null default '';
+alter table company add column lei character varying (20) not null default '';
+
+create unique index idx_company_registration_number on company(jurisdiction, registration_number) where registration_number <> '';
+create unique index idx_company_lei on company(lei) where lei <> '';
+create index idx_company_vat_id on company(vat_id) where vat_id <> '';
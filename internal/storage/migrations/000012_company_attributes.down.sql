@@ -0,0 +1,5 @@
+drop index idx_company_attributes;
+
+alter table company drop column attributes;
+
+drop table attribute_definition;
@@ -0,0 +1,17 @@
+-- the company types and the kinds are the values of the CompanyType and the
+-- AttributeKind enums of the API
+create table attribute_definition (
+	company_type integer not null,
+	name character varying (50) not null,
+	created_at timestamp with time zone not null,
+	updated_at timestamp with time zone not null,
+	kind integer not null,
+	required boolean not null,
+	enum_values text not null,
+	description character varying (500) not null,
+	primary key (company_type, name)
+);
+
+alter table company add column attributes jsonb not null default '{}';
+
+create index idx_company_attributes on company using gin (attributes jsonb_path_ops);
@@ -0,0 +1,3 @@
+drop index idx_company_labels;
+
+alter table company drop column labels;
@@ -0,0 +1,3 @@
+alter table company add column labels jsonb not null default '{}';
+
+create index idx_company_labels on company using gin (labels jsonb_path_ops);
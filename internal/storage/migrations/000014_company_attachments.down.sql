@@ -0,0 +1,2 @@
+drop index idx_company_attachment_company_id;
+drop table company_attachment;
@@ -0,0 +1,15 @@
+create table company_attachment (
+	id uuid primary key,
+	-- NULL once the attachment is deleted or its company is, the content is
+	-- purged from the blob store before the row
+	company_id uuid references company on delete set null,
+	created_at timestamp with time zone not null,
+	filename character varying (255) not null,
+	content_type character varying (255) not null,
+	size bigint not null,
+	sha256 character (64) not null,
+	blob_key character varying (300) not null,
+	uploaded_by character varying (100) not null
+);
+
+create index idx_company_attachment_company_id on company_attachment(company_id);
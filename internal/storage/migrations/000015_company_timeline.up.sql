@@ -0,0 +1,36 @@
+create table company_note (
+	id uuid primary key,
+	company_id uuid not null references company on delete cascade,
+	created_at timestamp with time zone not null,
+	updated_at timestamp with time zone not null,
+	author character varying (100) not null,
+	body character varying (10000) not null,
+	pinned boolean not null,
+	-- number of the current version, see company_note_version
+	version integer not null
+);
+
+create index idx_company_note_company_id on company_note(company_id);
+
+-- the versions of the notes, the first one and one per edit
+create table company_note_version (
+	note_id uuid not null references company_note on delete cascade,
+	version integer not null,
+	created_at timestamp with time zone not null,
+	username character varying (100) not null,
+	body character varying (10000) not null,
+	pinned boolean not null,
+	primary key (note_id, version)
+);
+
+create table company_field_change (
+	id uuid primary key,
+	company_id uuid not null references company on delete cascade,
+	created_at timestamp with time zone not null,
+	field character varying (100) not null,
+	old_value character varying (3000) not null,
+	new_value character varying (3000) not null,
+	username character varying (100) not null
+);
+
+create index idx_company_field_change_company_id on company_field_change(company_id, created_at);
@@ -0,0 +1,6 @@
+-- the keys of several users may be the same
+delete from idempotency_key;
+alter table idempotency_key drop constraint idempotency_key_pkey;
+alter table idempotency_key add primary key (key);
+alter table idempotency_key drop column response_header;
+alter table idempotency_key drop column username;
@@ -0,0 +1,6 @@
+-- the keys are scoped by the user, the keys stored before belong to nobody
+-- and expire
+alter table idempotency_key add column username character varying (100) not null default '';
+alter table idempotency_key add column response_header bytea;
+alter table idempotency_key drop constraint idempotency_key_pkey;
+alter table idempotency_key add primary key (username, key);
@@ -0,0 +1,5 @@
+-- the data migrations done in Go, run once
+create table data_migration (
+	name character varying (100) primary key,
+	completed_at timestamp with time zone not null
+);
@@ -0,0 +1,4 @@
+delete from change_request where company_id not in (select id from company);
+
+alter table change_request
+	add constraint change_request_company_id_fkey foreign key (company_id) references company on delete cascade;
@@ -0,0 +1,3 @@
+-- the decided requests are kept as the audit trail of the deleted and the
+-- merged companies
+alter table change_request drop constraint change_request_company_id_fkey;
@@ -0,0 +1,5 @@
+drop index idx_company_name;
+drop table company;
+
+drop index idx_user_username;
+drop table "user";
@@ -0,0 +1,44 @@
+create table "user" (
+	id integer primary key autoincrement,
+	created_at timestamp not null,
+	updated_at timestamp not null,
+	username varchar (100) not null check (length(username) <= 100),
+	password_hash varchar (200) not null check (length(password_hash) <= 200),
+	session_ttl bigint not null,
+	is_admin boolean not null
+);
+
+create unique index idx_user_username on "user"(username);
+
+-- global admin (password: admin)
+insert into "user" (
+	created_at,
+	updated_at,
+	username,
+	password_hash,
+	session_ttl,
+	is_admin
+) values (
+	strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'),
+	strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'),
+	'admin',
+	'PBKDF2$sha512$1$l8zGKtxRESq3PA2kFhHRWA==$H3lGMxOt55wjwoc+myeOoABofJY9oDpldJa7fhqdjbh700V6FLPML75UmBOt9J5VFNjAL1AvqCozA1HJM0QVGA==',
+	0,
+	true
+);
+
+
+-- the column sizes are not enforced by SQLite, the checks keep the
+-- PostgreSQL semantics
+create table company (
+	id text primary key,
+	created_at timestamp not null,
+	updated_at timestamp not null,
+	name varchar (15) unique not null check (length(name) <= 15),
+	description varchar (3000) not null check (length(description) <= 3000),
+	employees_cnt integer not null,
+	registered boolean not null,
+	type integer not null
+);
+
+create index idx_company_name on company(name);
@@ -0,0 +1,2 @@
+drop index idx_idempotency_key_expires_at;
+drop table idempotency_key;
@@ -0,0 +1,11 @@
+create table idempotency_key (
+	key varchar (255) primary key check (length(key) <= 255),
+	created_at timestamp not null,
+	expires_at timestamp not null,
+	method varchar (255) not null check (length(method) <= 255),
+	request_hash char (64) not null,
+	completed boolean not null,
+	response blob
+);
+
+create index idx_idempotency_key_expires_at on idempotency_key(expires_at);
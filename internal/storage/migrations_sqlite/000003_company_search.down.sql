@@ -0,0 +1 @@
+drop index idx_company_name_nocase;
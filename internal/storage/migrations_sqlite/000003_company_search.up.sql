@@ -0,0 +1,3 @@
+-- SQLite has no trigram nor full-text index on the company table, the search
+-- uses the case-insensitive LIKE fallback
+create index idx_company_name_nocase on company(name collate nocase);
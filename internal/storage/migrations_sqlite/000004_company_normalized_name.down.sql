@@ -0,0 +1,3 @@
+drop index idx_company_normalized_name;
+
+alter table company drop column normalized_name;
@@ -0,0 +1,5 @@
+-- set by the application from the name, the existing companies are
+-- backfilled on start
+alter table company add column normalized_name varchar (100) not null default '' check (length(normalized_name) <= 100);
+
+create index idx_company_normalized_name on company(normalized_name);
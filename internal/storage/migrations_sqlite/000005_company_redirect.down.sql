@@ -0,0 +1,2 @@
+drop index idx_company_redirect_target_id;
+drop table company_redirect;
@@ -0,0 +1,8 @@
+-- the IDs of the merged companies, Get on them returns the target
+create table company_redirect (
+	id text primary key,
+	created_at timestamp not null,
+	target_id text not null references company(id) on delete cascade
+);
+
+create index idx_company_redirect_target_id on company_redirect(target_id);
@@ -0,0 +1,28 @@
+create table company_address (
+	id text primary key,
+	company_id text not null references company(id) on delete cascade,
+	created_at timestamp not null,
+	updated_at timestamp not null,
+	type integer not null,
+	country char (2) not null check (length(country) <= 2),
+	region varchar (100) not null check (length(region) <= 100),
+	city varchar (100) not null check (length(city) <= 100),
+	postal_code varchar (20) not null check (length(postal_code) <= 20),
+	line1 varchar (200) not null check (length(line1) <= 200),
+	line2 varchar (200) not null check (length(line2) <= 200)
+);
+
+create index idx_company_address_company_id on company_address(company_id);
+
+create table company_contact (
+	id text primary key,
+	company_id text not null references company(id) on delete cascade,
+	created_at timestamp not null,
+	updated_at timestamp not null,
+	name varchar (100) not null check (length(name) <= 100),
+	role varchar (100) not null check (length(role) <= 100),
+	email varchar (254) not null check (length(email) <= 254),
+	phone varchar (16) not null check (length(phone) <= 16)
+);
+
+create index idx_company_contact_company_id on company_contact(company_id);
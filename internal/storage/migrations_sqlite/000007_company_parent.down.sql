@@ -0,0 +1,3 @@
+drop index idx_company_parent_id;
+
+alter table company drop column parent_id;
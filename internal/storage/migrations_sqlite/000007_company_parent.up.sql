@@ -0,0 +1,5 @@
+-- deleting a company with subsidiaries fails, they must be deleted or
+-- reparented first
+alter table company add column parent_id text references company(id);
+
+create index idx_company_parent_id on company(parent_id);
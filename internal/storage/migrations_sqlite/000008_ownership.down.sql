@@ -0,0 +1,5 @@
+drop index idx_ownership_owner_person_id;
+drop index idx_ownership_owner_company_id;
+drop index idx_ownership_company_id;
+drop table ownership;
+drop table person;
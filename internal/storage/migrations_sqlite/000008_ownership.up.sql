@@ -0,0 +1,29 @@
+create table person (
+	id text primary key,
+	created_at timestamp not null,
+	updated_at timestamp not null,
+	name varchar (100) not null check (length(name) <= 100),
+	country char (2) not null check (length(country) <= 2)
+);
+
+-- a stake in a company held by another company or by a natural person,
+-- effective from valid_from (inclusive) to valid_to (exclusive, open-ended
+-- if null)
+create table ownership (
+	id text primary key,
+	company_id text not null references company(id) on delete cascade,
+	created_at timestamp not null,
+	updated_at timestamp not null,
+	owner_company_id text references company(id) on delete cascade,
+	-- deleting a person holding stakes fails
+	owner_person_id text references person(id),
+	percentage real not null check (percentage > 0 and percentage <= 100),
+	valid_from timestamp not null,
+	valid_to timestamp,
+	check ((owner_company_id is null) <> (owner_person_id is null)),
+	check (owner_company_id <> company_id)
+);
+
+create index idx_ownership_company_id on ownership(company_id);
+create index idx_ownership_owner_company_id on ownership(owner_company_id);
+create index idx_ownership_owner_person_id on ownership(owner_person_id);
@@ -0,0 +1,16 @@
+-- the values of the CompanyStatus enum of the API: 1 draft, 3 active
+alter table company add column status integer not null default 1;
+
+update company set status = 3 where registered;
+
+create table company_status_history (
+	id text primary key,
+	company_id text not null references company(id) on delete cascade,
+	created_at timestamp not null,
+	from_status integer not null,
+	to_status integer not null,
+	reason varchar (500) not null check (length(reason) <= 500),
+	username varchar (100) not null check (length(username) <= 100)
+);
+
+create index idx_company_status_history_company_id on company_status_history(company_id, created_at);
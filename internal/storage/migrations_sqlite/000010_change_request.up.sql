@@ -0,0 +1,23 @@
+alter table "user" add column is_approver boolean not null default false;
+
+-- the kinds and the statuses are the values of the ChangeKind and the
+-- ChangeRequestStatus enums of the API
+create table change_request (
+	id text primary key,
+	company_id text not null references company(id) on delete cascade,
+	created_at timestamp not null,
+	updated_at timestamp not null,
+	expires_at timestamp not null,
+	decided_at timestamp,
+	kind integer not null,
+	status integer not null,
+	payload text not null,
+	requested_by varchar (100) not null check (length(requested_by) <= 100),
+	decided_by varchar (100) not null check (length(decided_by) <= 100),
+	comment varchar (500) not null check (length(comment) <= 500)
+);
+
+create index idx_change_request_company_id on change_request(company_id);
+create index idx_change_request_status_expires_at on change_request(status, expires_at);
+-- a single pending request per company
+create unique index idx_change_request_pending on change_request(company_id) where status = 1;
@@ -0,0 +1,8 @@
+alter table company add column jurisdiction char (2) not null default '' check (length(jurisdiction) <= 2);
+alter table company add column registration_number varchar (50) not null default '' check (length(registration_number) <= 50);
+alter table company add column vat_id varchar (15) not null default '' check (length(vat_id) <= 15);
+alter table company add column lei varchar (20) not null default '' check (length(lei) <= 20);
+
+create unique index idx_company_registration_number on company(jurisdiction, registration_number) where registration_number <> '';
+create unique index idx_company_lei on company(lei) where lei <> '';
+create index idx_company_vat_id on company(vat_id) where vat_id <> '';
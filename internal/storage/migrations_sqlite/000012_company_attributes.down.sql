@@ -0,0 +1,3 @@
+alter table company drop column attributes;
+
+drop table attribute_definition;
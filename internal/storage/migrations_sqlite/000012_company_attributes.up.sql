@@ -0,0 +1,15 @@
+-- the company types and the kinds are the values of the CompanyType and the
+-- AttributeKind enums of the API
+create table attribute_definition (
+	company_type integer not null,
+	name varchar (50) not null check (length(name) <= 50),
+	created_at timestamp not null,
+	updated_at timestamp not null,
+	kind integer not null,
+	required boolean not null,
+	enum_values text not null,
+	description varchar (500) not null check (length(description) <= 500),
+	primary key (company_type, name)
+);
+
+alter table company add column attributes text not null default '{}';
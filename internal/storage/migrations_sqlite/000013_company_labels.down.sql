@@ -0,0 +1 @@
+alter table company drop column labels;
@@ -0,0 +1 @@
+alter table company add column labels text not null default '{}';
@@ -0,0 +1,15 @@
+create table company_attachment (
+	id text primary key,
+	-- NULL once the attachment is deleted or its company is, the content is
+	-- purged from the blob store before the row
+	company_id text references company(id) on delete set null,
+	created_at timestamp not null,
+	filename varchar (255) not null check (length(filename) <= 255),
+	content_type varchar (255) not null check (length(content_type) <= 255),
+	size integer not null,
+	sha256 char (64) not null check (length(sha256) <= 64),
+	blob_key varchar (300) not null check (length(blob_key) <= 300),
+	uploaded_by varchar (100) not null check (length(uploaded_by) <= 100)
+);
+
+create index idx_company_attachment_company_id on company_attachment(company_id);
@@ -0,0 +1,5 @@
+drop index idx_company_field_change_company_id;
+drop table company_field_change;
+drop table company_note_version;
+drop index idx_company_note_company_id;
+drop table company_note;
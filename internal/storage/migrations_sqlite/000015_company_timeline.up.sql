@@ -0,0 +1,36 @@
+create table company_note (
+	id text primary key,
+	company_id text not null references company(id) on delete cascade,
+	created_at timestamp not null,
+	updated_at timestamp not null,
+	author varchar (100) not null check (length(author) <= 100),
+	body varchar (10000) not null check (length(body) <= 10000),
+	pinned boolean not null,
+	-- number of the current version, see company_note_version
+	version integer not null
+);
+
+create index idx_company_note_company_id on company_note(company_id);
+
+-- the versions of the notes, the first one and one per edit
+create table company_note_version (
+	note_id text not null references company_note(id) on delete cascade,
+	version integer not null,
+	created_at timestamp not null,
+	username varchar (100) not null check (length(username) <= 100),
+	body varchar (10000) not null check (length(body) <= 10000),
+	pinned boolean not null,
+	primary key (note_id, version)
+);
+
+create table company_field_change (
+	id text primary key,
+	company_id text not null references company(id) on delete cascade,
+	created_at timestamp not null,
+	field varchar (100) not null check (length(field) <= 100),
+	old_value varchar (3000) not null check (length(old_value) <= 3000),
+	new_value varchar (3000) not null check (length(new_value) <= 3000),
+	username varchar (100) not null check (length(username) <= 100)
+);
+
+create index idx_company_field_change_company_id on company_field_change(company_id, created_at);
@@ -0,0 +1,17 @@
+create table idempotency_key_old (
+	key varchar (255) primary key check (length(key) <= 255),
+	created_at timestamp not null,
+	expires_at timestamp not null,
+	method varchar (255) not null check (length(method) <= 255),
+	request_hash char (64) not null,
+	completed boolean not null,
+	response blob
+);
+
+-- the keys of several users may be the same, they are dropped
+
+drop index idx_idempotency_key_expires_at;
+drop table idempotency_key;
+alter table idempotency_key_old rename to idempotency_key;
+
+create index idx_idempotency_key_expires_at on idempotency_key(expires_at);
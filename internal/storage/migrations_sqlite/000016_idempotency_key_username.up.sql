@@ -0,0 +1,23 @@
+-- the keys are scoped by the user, the keys stored before belong to nobody
+-- and expire. SQLite can't change the primary key, the table is rebuilt.
+create table idempotency_key_new (
+	username varchar (100) not null check (length(username) <= 100),
+	key varchar (255) not null check (length(key) <= 255),
+	created_at timestamp not null,
+	expires_at timestamp not null,
+	method varchar (255) not null check (length(method) <= 255),
+	request_hash char (64) not null,
+	completed boolean not null,
+	response blob,
+	response_header blob,
+	primary key (username, key)
+);
+
+insert into idempotency_key_new (username, key, created_at, expires_at, method, request_hash, completed, response)
+	select '', key, created_at, expires_at, method, request_hash, completed, response from idempotency_key;
+
+drop index idx_idempotency_key_expires_at;
+drop table idempotency_key;
+alter table idempotency_key_new rename to idempotency_key;
+
+create index idx_idempotency_key_expires_at on idempotency_key(expires_at);
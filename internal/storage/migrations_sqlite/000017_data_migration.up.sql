@@ -0,0 +1,5 @@
+-- the data migrations done in Go, run once
+create table data_migration (
+	name varchar (100) primary key check (length(name) <= 100),
+	completed_at timestamp not null
+);
@@ -0,0 +1,28 @@
+create table change_request_old (
+	id text primary key,
+	company_id text not null references company(id) on delete cascade,
+	created_at timestamp not null,
+	updated_at timestamp not null,
+	expires_at timestamp not null,
+	decided_at timestamp,
+	kind integer not null,
+	status integer not null,
+	payload text not null,
+	requested_by varchar (100) not null check (length(requested_by) <= 100),
+	decided_by varchar (100) not null check (length(decided_by) <= 100),
+	comment varchar (500) not null check (length(comment) <= 500)
+);
+
+-- the requests of the deleted companies are dropped
+insert into change_request_old select * from change_request where company_id in (select id from company);
+
+drop index idx_change_request_pending;
+drop index idx_change_request_status_expires_at;
+drop index idx_change_request_company_id;
+drop table change_request;
+alter table change_request_old rename to change_request;
+
+create index idx_change_request_company_id on change_request(company_id);
+create index idx_change_request_status_expires_at on change_request(status, expires_at);
+-- a single pending request per company
+create unique index idx_change_request_pending on change_request(company_id) where status = 1;
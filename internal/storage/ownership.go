@@ -0,0 +1,360 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// ownershipEpsilon absorbs the rounding errors of the sums of the stakes.
+const ownershipEpsilon = 1e-9
+
+// minIndirectShare defines the share (in percent) below which an indirect
+// stake is not walked further, it bounds the walk of dense graphs.
+const minIndirectShare = 1e-6
+
+// Ownership is a stake in a company held by another company or by a natural
+// person. It is effective from ValidFrom (inclusive) to ValidTo (exclusive),
+// it has no end if ValidTo is not set.
+type Ownership struct {
+	ID        uuid.UUID `db:"id"`
+	CompanyID uuid.UUID `db:"company_id"`
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+
+	// Exactly one of the owners is set.
+	OwnerCompanyID uuid.NullUUID `db:"owner_company_id"`
+	OwnerPersonID  uuid.NullUUID `db:"owner_person_id"`
+
+	// Percentage is the stake, in (0, 100].
+	Percentage float64      `db:"percentage"`
+	ValidFrom  time.Time    `db:"valid_from"`
+	ValidTo    sql.NullTime `db:"valid_to"`
+}
+
+// ActiveAt returns true if the stake is effective at the given time.
+func (o Ownership) ActiveAt(t time.Time) bool {
+	return !t.Before(o.ValidFrom) && (!o.ValidTo.Valid || t.Before(o.ValidTo.Time))
+}
+
+// overlaps returns true if both stakes are effective at some point in time.
+func (o Ownership) overlaps(other Ownership) bool {
+	return (!o.ValidTo.Valid || other.ValidFrom.Before(o.ValidTo.Time)) &&
+		(!other.ValidTo.Valid || o.ValidFrom.Before(other.ValidTo.Time))
+}
+
+// CreateOwnership creates the given stake, ErrOwnershipExceeded is returned
+// if the direct stakes in the company would exceed 100% and ErrDoesNotExist
+// if the company or the owner does not exist. It must be called in a
+// transaction.
+func CreateOwnership(ctx context.Context, db sqlx.ExtContext, o *Ownership) error {
+	if err := checkOwnershipTotal(ctx, db, o); err != nil {
+		return err
+	}
+
+	o.CreatedAt = time.Now()
+	o.UpdatedAt = o.CreatedAt
+
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO ownership (
+			id,
+			company_id,
+			created_at,
+			updated_at,
+			owner_company_id,
+			owner_person_id,
+			percentage,
+			valid_from,
+			valid_to
+		) values ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		o.ID,
+		o.CompanyID,
+		o.CreatedAt,
+		o.UpdatedAt,
+		o.OwnerCompanyID,
+		o.OwnerPersonID,
+		o.Percentage,
+		o.ValidFrom,
+		o.ValidTo,
+	)
+	if err != nil {
+		return handlePSQLError(Insert, err, "insert ownership error")
+	}
+	return nil
+}
+
+// GetOwnership returns the stake in the given company.
+func GetOwnership(ctx context.Context, db sqlx.QueryerContext, companyID, id uuid.UUID) (Ownership, error) {
+	var o Ownership
+	err := sqlx.GetContext(ctx, db, &o, "SELECT * FROM ownership WHERE id = $1 AND company_id = $2", id, companyID)
+	if err != nil {
+		return o, handlePSQLError(Select, err, "select ownership error")
+	}
+	return o, nil
+}
+
+// GetCompanyOwnerships returns the direct stakes in the given company, by
+// start date.
+func GetCompanyOwnerships(ctx context.Context, db sqlx.QueryerContext, companyID uuid.UUID) ([]Ownership, error) {
+	var list []Ownership
+	err := sqlx.SelectContext(ctx, db, &list, "SELECT * FROM ownership WHERE company_id = $1 ORDER BY valid_from, id", companyID)
+	if err != nil {
+		return nil, handlePSQLError(Select, err, "select ownerships error")
+	}
+	return list, nil
+}
+
+// UpdateOwnership updates the given stake by its ID and company ID, see
+// CreateOwnership for the errors. It must be called in a transaction.
+func UpdateOwnership(ctx context.Context, db sqlx.ExtContext, o *Ownership) error {
+	if err := checkOwnershipTotal(ctx, db, o); err != nil {
+		return err
+	}
+
+	o.UpdatedAt = time.Now()
+
+	res, err := db.ExecContext(ctx, `
+		UPDATE ownership
+		SET
+			updated_at = $3,
+			owner_company_id = $4,
+			owner_person_id = $5,
+			percentage = $6,
+			valid_from = $7,
+			valid_to = $8
+		WHERE
+			id = $1 AND company_id = $2`,
+		o.ID,
+		o.CompanyID,
+		o.UpdatedAt,
+		o.OwnerCompanyID,
+		o.OwnerPersonID,
+		o.Percentage,
+		o.ValidFrom,
+		o.ValidTo,
+	)
+	if err != nil {
+		return handlePSQLError(Update, err, "update ownership error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("can't get rows affected %v", err)
+	}
+	if ra == 0 {
+		return ErrDoesNotExist
+	}
+	return nil
+}
+
+// DeleteOwnership deletes the stake in the given company.
+func DeleteOwnership(ctx context.Context, db sqlx.ExecerContext, companyID, id uuid.UUID) error {
+	res, err := db.ExecContext(ctx, "DELETE FROM ownership WHERE id = $1 AND company_id = $2", id, companyID)
+	if err != nil {
+		return handlePSQLError(Delete, err, "delete ownership error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("can't get rows affected %v", err)
+	}
+	if ra == 0 {
+		return ErrDoesNotExist
+	}
+	return nil
+}
+
+// GetOwnershipGraph returns the stakes in the given company, the stakes in
+// the companies owning it and so on, whatever their effective dates.
+func GetOwnershipGraph(ctx context.Context, db sqlx.QueryerContext, companyID uuid.UUID) ([]Ownership, error) {
+	// UNION drops the companies already visited, the walk ends on cycles
+	var list []Ownership
+	err := sqlx.SelectContext(ctx, db, &list, `
+		WITH RECURSIVE owners (id) AS (
+			SELECT id FROM company WHERE id = $1
+			UNION
+			SELECT o.owner_company_id
+			FROM ownership o
+			JOIN owners ON o.company_id = owners.id
+			WHERE o.owner_company_id IS NOT NULL
+		)
+		SELECT o.*
+		FROM ownership o
+		JOIN owners ON o.company_id = owners.id
+		ORDER BY o.valid_from, o.id`,
+		companyID,
+	)
+	if err != nil {
+		return nil, handlePSQLError(Select, err, "select ownership graph error")
+	}
+	return list, nil
+}
+
+// checkOwnershipTotal returns ErrOwnershipExceeded if the given stake and
+// the other direct stakes in its company effective at the same time exceed
+// 100%. The company row is locked on PostgreSQL so that concurrent changes
+// are checked one after the other.
+func checkOwnershipTotal(ctx context.Context, db sqlx.ExtContext, o *Ownership) error {
+	if err := lockCompanyOwnerships(ctx, db, o.CompanyID); err != nil {
+		return err
+	}
+
+	stakes, err := GetCompanyOwnerships(ctx, db, o.CompanyID)
+	if err != nil {
+		return err
+	}
+	return validateOwnershipTotal(stakes, o)
+}
+
+// lockCompanyOwnerships locks the company row on PostgreSQL, so that the
+// concurrent changes of its stakes are checked one after the other.
+// ErrDoesNotExist is returned if the company does not exist.
+func lockCompanyOwnerships(ctx context.Context, db sqlx.ExtContext, companyID uuid.UUID) error {
+	if db.DriverName() != DriverPostgres {
+		return nil
+	}
+	var id uuid.UUID
+	err := sqlx.GetContext(ctx, db, &id, "SELECT id FROM company WHERE id = $1 FOR UPDATE", companyID)
+	if err != nil {
+		return handlePSQLError(Select, err, "lock company error")
+	}
+	return nil
+}
+
+// validateOwnershipTotals checks the total of the given stakes in the same
+// company, at the start of each of them.
+func validateOwnershipTotals(stakes []Ownership) error {
+	for i := range stakes {
+		if err := validateOwnershipTotal(stakes, &stakes[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateOwnershipTotal checks the total of the given stake and of the
+// other stakes in the same company. The total only grows when a stake
+// starts, so it is computed at the start of every overlapping stake.
+func validateOwnershipTotal(stakes []Ownership, o *Ownership) error {
+	var overlapping []Ownership
+	for _, s := range stakes {
+		if s.ID != o.ID && s.overlaps(*o) {
+			overlapping = append(overlapping, s)
+		}
+	}
+
+	points := []time.Time{o.ValidFrom}
+	for _, s := range overlapping {
+		if s.ValidFrom.After(o.ValidFrom) {
+			points = append(points, s.ValidFrom)
+		}
+	}
+
+	for _, p := range points {
+		total := o.Percentage
+		for _, s := range overlapping {
+			if s.ActiveAt(p) {
+				total += s.Percentage
+			}
+		}
+		if total > 100+ownershipEpsilon {
+			return ErrOwnershipExceeded
+		}
+	}
+	return nil
+}
+
+// BeneficialOwner is a natural person owning a company directly or through
+// other companies.
+type BeneficialOwner struct {
+	PersonID uuid.UUID
+	// Percentage is the total stake, the sum of the stakes over all paths.
+	Percentage float64
+	// Paths are the chains of stakes through which the company is owned,
+	// the largest first.
+	Paths []OwnershipPath
+}
+
+// OwnershipPath is a chain of stakes from a company to a person.
+type OwnershipPath struct {
+	// CompanyIDs are the owned company, the company owning it and so on,
+	// the last one is held directly by the person.
+	CompanyIDs []uuid.UUID
+	// Percentage is the product of the stakes along the chain.
+	Percentage float64
+}
+
+// UltimateBeneficialOwners walks the given stakes (see GetOwnershipGraph)
+// upwards from the given company and returns the persons owning at least
+// threshold percent of it at the given time, the largest owner first. The
+// indirect stakes are the products of the stakes along the chains, the
+// chains going through a company twice (cross-holdings) are not followed.
+func UltimateBeneficialOwners(stakes []Ownership, companyID uuid.UUID, at time.Time, threshold float64) []BeneficialOwner {
+	owners := make(map[uuid.UUID][]Ownership)
+	for _, s := range stakes {
+		if s.ActiveAt(at) {
+			owners[s.CompanyID] = append(owners[s.CompanyID], s)
+		}
+	}
+
+	byPerson := make(map[uuid.UUID]*BeneficialOwner)
+	var walk func(path []uuid.UUID, share float64)
+	walk = func(path []uuid.UUID, share float64) {
+		for _, s := range owners[path[len(path)-1]] {
+			indirect := share * s.Percentage / 100
+			if indirect < minIndirectShare {
+				continue
+			}
+
+			if s.OwnerPersonID.Valid {
+				bo, ok := byPerson[s.OwnerPersonID.UUID]
+				if !ok {
+					bo = &BeneficialOwner{PersonID: s.OwnerPersonID.UUID}
+					byPerson[s.OwnerPersonID.UUID] = bo
+				}
+				bo.Percentage += indirect
+				bo.Paths = append(bo.Paths, OwnershipPath{
+					CompanyIDs: append([]uuid.UUID(nil), path...),
+					Percentage: indirect,
+				})
+				continue
+			}
+
+			if len(path) > maxGroupDepth || containsUUID(path, s.OwnerCompanyID.UUID) {
+				continue
+			}
+			walk(append(path, s.OwnerCompanyID.UUID), indirect)
+		}
+	}
+	walk([]uuid.UUID{companyID}, 100)
+
+	var list []BeneficialOwner
+	for _, bo := range byPerson {
+		if bo.Percentage+ownershipEpsilon < threshold {
+			continue
+		}
+		sort.SliceStable(bo.Paths, func(i, j int) bool {
+			return bo.Paths[i].Percentage > bo.Paths[j].Percentage
+		})
+		list = append(list, *bo)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Percentage != list[j].Percentage {
+			return list[i].Percentage > list[j].Percentage
+		}
+		return list[i].PersonID.String() < list[j].PersonID.String()
+	})
+	return list
+}
+
+func containsUUID(list []uuid.UUID, id uuid.UUID) bool {
+	for _, v := range list {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
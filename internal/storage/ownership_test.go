@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUltimateBeneficialOwners(t *testing.T) {
+	assert := require.New(t)
+
+	from := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	id := func() uuid.UUID { return uuid.Must(uuid.NewV4()) }
+	a, b, c := id(), id(), id()
+	alice, bob := id(), id()
+
+	byCompany := func(company, owner uuid.UUID, pct float64) Ownership {
+		return Ownership{ID: id(), CompanyID: company, OwnerCompanyID: uuid.NullUUID{UUID: owner, Valid: true}, Percentage: pct, ValidFrom: from}
+	}
+	byPerson := func(company, owner uuid.UUID, pct float64) Ownership {
+		return Ownership{ID: id(), CompanyID: company, OwnerPersonID: uuid.NullUUID{UUID: owner, Valid: true}, Percentage: pct, ValidFrom: from}
+	}
+
+	// a is owned by b (50%), c (40%) and bob (10%), b by alice (100%),
+	// c by alice (50%) and a (50%, cross-holding)
+	stakes := []Ownership{
+		byCompany(a, b, 50),
+		byCompany(a, c, 40),
+		byPerson(a, bob, 10),
+		byPerson(b, alice, 100),
+		byPerson(c, alice, 50),
+		byCompany(c, a, 50),
+	}
+
+	t.Run("Paths", func(t *testing.T) {
+		list := UltimateBeneficialOwners(stakes, a, from, 0)
+		assert.Len(list, 2)
+		assert.Equal(alice, list[0].PersonID)
+		assert.InDelta(70, list[0].Percentage, 1e-9)
+		assert.Len(list[0].Paths, 2)
+		assert.Equal([]uuid.UUID{a, b}, list[0].Paths[0].CompanyIDs)
+		assert.InDelta(50, list[0].Paths[0].Percentage, 1e-9)
+		assert.Equal([]uuid.UUID{a, c}, list[0].Paths[1].CompanyIDs)
+		assert.InDelta(20, list[0].Paths[1].Percentage, 1e-9)
+		assert.Equal(bob, list[1].PersonID)
+		assert.InDelta(10, list[1].Percentage, 1e-9)
+	})
+
+	t.Run("Threshold", func(t *testing.T) {
+		list := UltimateBeneficialOwners(stakes, a, from, 25)
+		assert.Len(list, 1)
+		assert.Equal(alice, list[0].PersonID)
+	})
+
+	t.Run("Effective dates", func(t *testing.T) {
+		ended := append([]Ownership(nil), stakes...)
+		ended[3].ValidTo = sql.NullTime{Time: from.AddDate(1, 0, 0), Valid: true}
+
+		list := UltimateBeneficialOwners(ended, a, from.AddDate(1, 0, 0), 0)
+		assert.Len(list, 2)
+		assert.InDelta(20, list[0].Percentage, 1e-9)
+		assert.Empty(UltimateBeneficialOwners(ended, a, from.AddDate(-1, 0, 0), 0))
+	})
+}
+
+func TestValidateOwnershipTotal(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC) }
+	until := func(d int) sql.NullTime { return sql.NullTime{Time: day(d), Valid: true} }
+	stakes := []Ownership{
+		{ID: uuid.Must(uuid.NewV4()), Percentage: 60, ValidFrom: day(1), ValidTo: until(10)},
+		{ID: uuid.Must(uuid.NewV4()), Percentage: 30, ValidFrom: day(5)},
+	}
+
+	tests := []struct {
+		name     string
+		stake    Ownership
+		expected error
+	}{
+		{"Before", Ownership{Percentage: 100, ValidFrom: day(-30), ValidTo: until(1)}, nil},
+		{"Within the free share", Ownership{Percentage: 10, ValidFrom: day(1)}, nil},
+		{"Exceeding from a later start", Ownership{Percentage: 11, ValidFrom: day(1)}, ErrOwnershipExceeded},
+		{"After the first ended", Ownership{Percentage: 70, ValidFrom: day(10)}, nil},
+		{"Exceeding after the first ended", Ownership{Percentage: 71, ValidFrom: day(10)}, ErrOwnershipExceeded},
+		{"Updated stake", Ownership{ID: stakes[1].ID, Percentage: 40, ValidFrom: day(5)}, nil},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			require.Equal(t, tst.expected, validateOwnershipTotal(stakes, &tst.stake))
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// Person is a natural person, e.g. a shareholder of a company.
+type Person struct {
+	ID        uuid.UUID `db:"id"`
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+	Name      string    `db:"name"`
+	// Country is the ISO 3166-1 alpha-2 code of the country of residence,
+	// it is optional.
+	Country string `db:"country"`
+}
+
+// CreatePerson creates the given person.
+func CreatePerson(ctx context.Context, db sqlx.ExecerContext, p *Person) error {
+	p.CreatedAt = time.Now()
+	p.UpdatedAt = p.CreatedAt
+
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO person (
+			id,
+			created_at,
+			updated_at,
+			name,
+			country
+		) values ($1, $2, $3, $4, $5)`,
+		p.ID,
+		p.CreatedAt,
+		p.UpdatedAt,
+		p.Name,
+		p.Country,
+	)
+	if err != nil {
+		return handlePSQLError(Insert, err, "insert person error")
+	}
+	return nil
+}
+
+// GetPerson returns the person for the given ID.
+func GetPerson(ctx context.Context, db sqlx.QueryerContext, id uuid.UUID) (Person, error) {
+	var p Person
+	err := sqlx.GetContext(ctx, db, &p, "SELECT * FROM person WHERE id = $1", id)
+	if err != nil {
+		return p, handlePSQLError(Select, err, "select person error")
+	}
+	return p, nil
+}
+
+// UpdatePerson updates the given person by its ID.
+func UpdatePerson(ctx context.Context, db sqlx.ExecerContext, p *Person) error {
+	p.UpdatedAt = time.Now()
+
+	res, err := db.ExecContext(ctx, `
+		UPDATE person
+		SET
+			updated_at = $2,
+			name = $3,
+			country = $4
+		WHERE
+			id = $1`,
+		p.ID,
+		p.UpdatedAt,
+		p.Name,
+		p.Country,
+	)
+	if err != nil {
+		return handlePSQLError(Update, err, "update person error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("can't get rows affected %v", err)
+	}
+	if ra == 0 {
+		return ErrDoesNotExist
+	}
+	return nil
+}
+
+// DeletePerson deletes the person for the given ID, ErrUsedByOtherObjects
+// is returned if the person holds stakes in companies.
+func DeletePerson(ctx context.Context, db sqlx.ExecerContext, id uuid.UUID) error {
+	res, err := db.ExecContext(ctx, "DELETE FROM person WHERE id = $1", id)
+	if err != nil {
+		return handlePSQLError(Delete, err, "delete person error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("can't get rows affected %v", err)
+	}
+	if ra == 0 {
+		return ErrDoesNotExist
+	}
+	return nil
+}
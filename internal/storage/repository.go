@@ -0,0 +1,794 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// CompanyRepository defines the persistence of the companies.
+type CompanyRepository interface {
+	// CreateCompany creates the given company.
+	CreateCompany(ctx context.Context, c *Company) error
+
+	// GetCompany returns the company for the given ID.
+	GetCompany(ctx context.Context, id uuid.UUID) (Company, error)
+
+	// UpdateCompany updates the given company by its ID.
+	UpdateCompany(ctx context.Context, c *Company) error
+
+	// DeleteCompany deletes the company for the given ID.
+	DeleteCompany(ctx context.Context, id uuid.UUID) error
+
+	// ForEachCompany calls fn for every company matching the filters,
+	// ordered by name, until fn returns an error.
+	ForEachCompany(ctx context.Context, filters CompanyFilters, fn func(Company) error) error
+
+	// SearchCompanies returns the companies best matching the query and
+	// the filters, at most limit, ordered by rank.
+	SearchCompanies(ctx context.Context, query string, filters CompanyFilters, limit int) ([]CompanySearchResult, error)
+
+	// AddCompanyLabels adds the given labels to the company, replacing the
+	// values of its labels with the same keys, and returns all its labels.
+	AddCompanyLabels(ctx context.Context, id uuid.UUID, labels CompanyLabels) (CompanyLabels, error)
+
+	// RemoveCompanyLabels removes the labels of the given keys from the
+	// company and returns its remaining labels.
+	RemoveCompanyLabels(ctx context.Context, id uuid.UUID, keys []string) (CompanyLabels, error)
+
+	// CountCompanyLabels returns the number of companies matching the
+	// filters per label, of the given key only if it is not empty, ordered
+	// by key and by count, the largest first.
+	CountCompanyLabels(ctx context.Context, filters CompanyFilters, key string) ([]LabelCount, error)
+
+	// FindCompanyDuplicates returns the companies which may be duplicates
+	// of a company with the given name, the most similar first.
+	FindCompanyDuplicates(ctx context.Context, name string) ([]CompanyDuplicate, error)
+
+	// FindAllCompanyDuplicates returns the pairs of companies which may be
+	// duplicates, the most similar first, at most limit.
+	FindAllCompanyDuplicates(ctx context.Context, limit int) ([]CompanyDuplicatePair, error)
+
+	// MergeCompany merges the source company into the given target, which
+	// is updated. The source is deleted and its ID redirected to the
+	// target. ErrOwnershipExceeded is returned if the direct stakes in the
+	// target would exceed 100%. It must be called in a transaction.
+	MergeCompany(ctx context.Context, sourceID uuid.UUID, target *Company) error
+
+	// GetCompanyRedirect returns the ID of the company the given company
+	// was merged into, ErrDoesNotExist if it was not merged.
+	GetCompanyRedirect(ctx context.Context, id uuid.UUID) (uuid.UUID, error)
+
+	// GetCompanyAncestors returns the parent of the given company, the
+	// parent of its parent and so on, the nearest first.
+	GetCompanyAncestors(ctx context.Context, id uuid.UUID) ([]Company, error)
+
+	// GetCompanyDescendants returns the subsidiaries of the given company,
+	// their subsidiaries and so on, by depth and name.
+	GetCompanyDescendants(ctx context.Context, id uuid.UUID) ([]CompanyNode, error)
+
+	// ReparentCompanyChildren moves the children of the given company to
+	// its parent, they become top-level companies if it has none.
+	ReparentCompanyChildren(ctx context.Context, id uuid.UUID) error
+
+	// TransitionCompanyStatus changes the status of the company from
+	// FromStatus to ToStatus and records the change, ErrCompanyStatusChanged
+	// is returned if the company is not in FromStatus anymore.
+	TransitionCompanyStatus(ctx context.Context, ch *CompanyStatusChange) error
+
+	// CreateCompanyStatusChange records the given status change without
+	// changing the status of the company, e.g. the initial status of a new
+	// company. ErrDoesNotExist is returned if the company does not exist.
+	CreateCompanyStatusChange(ctx context.Context, ch *CompanyStatusChange) error
+
+	// GetCompanyStatusHistory returns the status changes of the given
+	// company, the oldest first.
+	GetCompanyStatusHistory(ctx context.Context, companyID uuid.UUID) ([]CompanyStatusChange, error)
+}
+
+// CompanyAddressRepository defines the storage of the company addresses.
+type CompanyAddressRepository interface {
+	// CreateCompanyAddress creates the given address, ErrDoesNotExist is
+	// returned if its company does not exist.
+	CreateCompanyAddress(ctx context.Context, a *CompanyAddress) error
+
+	// GetCompanyAddress returns the address of the given company.
+	GetCompanyAddress(ctx context.Context, companyID, id uuid.UUID) (CompanyAddress, error)
+
+	// GetCompanyAddresses returns the addresses of the given company, in
+	// their creation order.
+	GetCompanyAddresses(ctx context.Context, companyID uuid.UUID) ([]CompanyAddress, error)
+
+	// UpdateCompanyAddress updates the given address by its ID and company
+	// ID.
+	UpdateCompanyAddress(ctx context.Context, a *CompanyAddress) error
+
+	// DeleteCompanyAddress deletes the address of the given company.
+	DeleteCompanyAddress(ctx context.Context, companyID, id uuid.UUID) error
+}
+
+// CompanyContactRepository defines the storage of the company contacts.
+type CompanyContactRepository interface {
+	// CreateCompanyContact creates the given contact, ErrDoesNotExist is
+	// returned if its company does not exist.
+	CreateCompanyContact(ctx context.Context, c *CompanyContact) error
+
+	// GetCompanyContact returns the contact of the given company.
+	GetCompanyContact(ctx context.Context, companyID, id uuid.UUID) (CompanyContact, error)
+
+	// GetCompanyContacts returns the contacts of the given company, in
+	// their creation order.
+	GetCompanyContacts(ctx context.Context, companyID uuid.UUID) ([]CompanyContact, error)
+
+	// UpdateCompanyContact updates the given contact by its ID and company
+	// ID.
+	UpdateCompanyContact(ctx context.Context, c *CompanyContact) error
+
+	// DeleteCompanyContact deletes the contact of the given company.
+	DeleteCompanyContact(ctx context.Context, companyID, id uuid.UUID) error
+}
+
+// CompanyAttachmentRepository defines the storage of the metadata of the
+// company attachments, their content is kept by the blob store.
+type CompanyAttachmentRepository interface {
+	// CreateCompanyAttachment creates the given attachment, ErrDoesNotExist
+	// is returned if its company does not exist.
+	CreateCompanyAttachment(ctx context.Context, a *CompanyAttachment) error
+
+	// GetCompanyAttachment returns the attachment of the given company.
+	GetCompanyAttachment(ctx context.Context, companyID, id uuid.UUID) (CompanyAttachment, error)
+
+	// GetCompanyAttachments returns the attachments of the given company,
+	// in their creation order.
+	GetCompanyAttachments(ctx context.Context, companyID uuid.UUID) ([]CompanyAttachment, error)
+
+	// DeleteCompanyAttachment removes the attachment from the given
+	// company, it is kept as an orphan until its content is deleted.
+	DeleteCompanyAttachment(ctx context.Context, companyID, id uuid.UUID) error
+
+	// GetOrphanAttachments returns at most limit attachments of the deleted
+	// companies and the deleted attachments, the oldest first.
+	GetOrphanAttachments(ctx context.Context, limit int) ([]CompanyAttachment, error)
+
+	// DeleteOrphanAttachment deletes the given orphan attachment.
+	DeleteOrphanAttachment(ctx context.Context, id uuid.UUID) error
+}
+
+// CompanyNoteRepository defines the storage of the notes about the
+// companies and of their versions.
+type CompanyNoteRepository interface {
+	// CreateCompanyNote creates the given note and its first version,
+	// ErrDoesNotExist is returned if its company does not exist. It must be
+	// called in a transaction.
+	CreateCompanyNote(ctx context.Context, n *CompanyNote) error
+
+	// GetCompanyNote returns the note of the given company.
+	GetCompanyNote(ctx context.Context, companyID, id uuid.UUID) (CompanyNote, error)
+
+	// GetCompanyNotes returns the notes of the given company, the pinned
+	// ones first, then in their creation order.
+	GetCompanyNotes(ctx context.Context, companyID uuid.UUID) ([]CompanyNote, error)
+
+	// UpdateCompanyNote updates the body and the pinned flag of the given
+	// note and records its new version, made by the given user. It must be
+	// called in a transaction.
+	UpdateCompanyNote(ctx context.Context, n *CompanyNote, username string) error
+
+	// DeleteCompanyNote deletes the note of the given company with its
+	// versions.
+	DeleteCompanyNote(ctx context.Context, companyID, id uuid.UUID) error
+
+	// GetCompanyNoteVersions returns the versions of the note of the given
+	// company, the oldest first.
+	GetCompanyNoteVersions(ctx context.Context, companyID, noteID uuid.UUID) ([]CompanyNoteVersion, error)
+}
+
+// CompanyFieldChangeRepository defines the storage of the history of the
+// changes of the company fields.
+type CompanyFieldChangeRepository interface {
+	// CreateCompanyFieldChanges records the given changes, made at the same
+	// time.
+	CreateCompanyFieldChanges(ctx context.Context, changes []CompanyFieldChange) error
+
+	// GetCompanyFieldChanges returns the field changes of the given
+	// company, the oldest first.
+	GetCompanyFieldChanges(ctx context.Context, companyID uuid.UUID) ([]CompanyFieldChange, error)
+}
+
+// CompanyTimelineRepository defines the storage of the timeline of the
+// companies.
+type CompanyTimelineRepository interface {
+	// GetCompanyTimeline returns the page of the notes, the field changes
+	// and the status changes of the company selected by the query.
+	GetCompanyTimeline(ctx context.Context, q CompanyTimelineQuery) ([]CompanyTimelineEntry, error)
+}
+
+// OwnershipRepository defines the storage of the persons and of the stakes
+// held in the companies.
+type OwnershipRepository interface {
+	// CreatePerson creates the given person.
+	CreatePerson(ctx context.Context, p *Person) error
+
+	// GetPerson returns the person for the given ID.
+	GetPerson(ctx context.Context, id uuid.UUID) (Person, error)
+
+	// UpdatePerson updates the given person by its ID.
+	UpdatePerson(ctx context.Context, p *Person) error
+
+	// DeletePerson deletes the person for the given ID,
+	// ErrUsedByOtherObjects is returned if the person holds stakes.
+	DeletePerson(ctx context.Context, id uuid.UUID) error
+
+	// CreateOwnership creates the given stake, ErrOwnershipExceeded is
+	// returned if the direct stakes in the company would exceed 100%. It
+	// must be called in a transaction.
+	CreateOwnership(ctx context.Context, o *Ownership) error
+
+	// GetOwnership returns the stake in the given company.
+	GetOwnership(ctx context.Context, companyID, id uuid.UUID) (Ownership, error)
+
+	// GetCompanyOwnerships returns the direct stakes in the given company,
+	// by start date.
+	GetCompanyOwnerships(ctx context.Context, companyID uuid.UUID) ([]Ownership, error)
+
+	// UpdateOwnership updates the given stake by its ID and company ID, see
+	// CreateOwnership for the errors. It must be called in a transaction.
+	UpdateOwnership(ctx context.Context, o *Ownership) error
+
+	// DeleteOwnership deletes the stake in the given company.
+	DeleteOwnership(ctx context.Context, companyID, id uuid.UUID) error
+
+	// GetOwnershipGraph returns the stakes in the given company, the
+	// stakes in the companies owning it and so on.
+	GetOwnershipGraph(ctx context.Context, companyID uuid.UUID) ([]Ownership, error)
+}
+
+// ChangeRequestRepository defines the storage of the changes waiting for an
+// approval.
+type ChangeRequestRepository interface {
+	// CreateChangeRequest creates the given pending change request,
+	// ErrAlreadyExists is returned if the company has a pending request.
+	CreateChangeRequest(ctx context.Context, cr *ChangeRequest) error
+
+	// GetChangeRequest returns the change request for the given ID.
+	GetChangeRequest(ctx context.Context, id uuid.UUID) (ChangeRequest, error)
+
+	// GetPendingChangeRequest returns the pending change request of the
+	// given company, ErrDoesNotExist if it has none.
+	GetPendingChangeRequest(ctx context.Context, companyID uuid.UUID) (ChangeRequest, error)
+
+	// GetChangeRequests returns the change requests matching the given
+	// filters, the newest first.
+	GetChangeRequests(ctx context.Context, filters ChangeRequestFilters) ([]ChangeRequest, error)
+
+	// DecideChangeRequest sets the status, the approver and the comment of
+	// the given pending change request, ErrChangeRequestDecided is
+	// returned if it is not pending anymore.
+	DecideChangeRequest(ctx context.Context, cr *ChangeRequest) error
+
+	// ExpireChangeRequests moves the pending change requests expired at
+	// the given time to the expired status and returns them.
+	ExpireChangeRequests(ctx context.Context, at time.Time) ([]ChangeRequest, error)
+}
+
+// AttributeDefinitionRepository defines the storage of the custom
+// attributes of the company types.
+type AttributeDefinitionRepository interface {
+	// CreateAttributeDefinition creates the given attribute definition,
+	// ErrAlreadyExists is returned if the company type has an attribute
+	// with the same name.
+	CreateAttributeDefinition(ctx context.Context, d *AttributeDefinition) error
+
+	// GetAttributeDefinition returns the attribute definition of the
+	// given company type and name.
+	GetAttributeDefinition(ctx context.Context, companyType uint32, name string) (AttributeDefinition, error)
+
+	// GetAttributeDefinitions returns the attribute definitions of the
+	// given company type, of all the types if it is 0, ordered by type and
+	// name.
+	GetAttributeDefinitions(ctx context.Context, companyType uint32) ([]AttributeDefinition, error)
+
+	// UpdateAttributeDefinition updates the required flag, the enum values
+	// and the description of the given attribute definition.
+	UpdateAttributeDefinition(ctx context.Context, d *AttributeDefinition) error
+
+	// DeleteAttributeDefinition deletes the given attribute definition and
+	// the values of the attribute from the companies of the type.
+	DeleteAttributeDefinition(ctx context.Context, companyType uint32, name string) error
+}
+
+// UserRepository defines the persistence of the users.
+type UserRepository interface {
+	// CreateUser creates the given user and sets its ID.
+	CreateUser(ctx context.Context, u *User) error
+
+	// GetUser returns the user for the given ID.
+	GetUser(ctx context.Context, id int64) (User, error)
+
+	// GetUserByUsername returns the user for the given username.
+	GetUserByUsername(ctx context.Context, username string) (User, error)
+}
+
+// IdempotencyRepository defines the persistence of the idempotency keys.
+type IdempotencyRepository interface {
+	// CreateIdempotencyKey stores the given key of a request in progress,
+	// it returns ErrAlreadyExists if the user stored the key and it is not
+	// expired.
+	CreateIdempotencyKey(ctx context.Context, k *IdempotencyKey) error
+
+	// GetIdempotencyKey returns the given key of the user if it is not
+	// expired.
+	GetIdempotencyKey(ctx context.Context, username, key string) (IdempotencyKey, error)
+
+	// CompleteIdempotencyKey stores the response and the response header
+	// of the request of the given key.
+	CompleteIdempotencyKey(ctx context.Context, k *IdempotencyKey) error
+
+	// DeleteIdempotencyKey deletes the given key of the user.
+	DeleteIdempotencyKey(ctx context.Context, username, key string) error
+
+	// DeleteExpiredIdempotencyKeys deletes the expired keys and returns
+	// their number.
+	DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error)
+}
+
+// Transactor runs functions in a transaction.
+type Transactor interface {
+	// Transaction runs f with a repository bound to a transaction. The
+	// transaction is committed if f returns nil and rolled back otherwise,
+	// ErrTransactionRollback rolls it back without returning an error.
+	// Nested calls join the outer transaction.
+	Transaction(ctx context.Context, f func(Repository) error) error
+}
+
+// Repository combines all the repositories of a storage backend.
+type Repository interface {
+	CompanyRepository
+	CompanyAddressRepository
+	CompanyContactRepository
+	CompanyAttachmentRepository
+	CompanyNoteRepository
+	CompanyFieldChangeRepository
+	CompanyTimelineRepository
+	OwnershipRepository
+	ChangeRequestRepository
+	AttributeDefinitionRepository
+	UserRepository
+	IdempotencyRepository
+	Transactor
+}
+
+// repo holds the repository of the configured storage backend.
+var repo Repository
+
+// Repo returns the repository of the configured storage backend.
+func Repo() Repository {
+	return repo
+}
+
+// SQLRepository implements the repositories on top of the PostgreSQL
+// database.
+type SQLRepository struct {
+	db sqlx.ExtContext
+}
+
+// NewSQLRepository creates a new SQLRepository. The db can be the connection
+// pool or a transaction.
+func NewSQLRepository(db sqlx.ExtContext) *SQLRepository {
+	return &SQLRepository{db: db}
+}
+
+// CreateCompany creates the given company.
+func (r *SQLRepository) CreateCompany(ctx context.Context, c *Company) error {
+	return CreateCompany(ctx, r.db, c)
+}
+
+// GetCompany returns the company for the given ID.
+func (r *SQLRepository) GetCompany(ctx context.Context, id uuid.UUID) (Company, error) {
+	return GetCompany(ctx, r.db, id)
+}
+
+// UpdateCompany updates the given company by its ID.
+func (r *SQLRepository) UpdateCompany(ctx context.Context, c *Company) error {
+	return UpdateCompany(ctx, r.db, c)
+}
+
+// DeleteCompany deletes the company for the given ID.
+func (r *SQLRepository) DeleteCompany(ctx context.Context, id uuid.UUID) error {
+	return DeleteCompany(ctx, r.db, id)
+}
+
+// ForEachCompany calls fn for every company matching the filters.
+func (r *SQLRepository) ForEachCompany(ctx context.Context, filters CompanyFilters, fn func(Company) error) error {
+	return ForEachCompany(ctx, r.db, filters, fn)
+}
+
+// SearchCompanies returns the companies best matching the query and the
+// filters.
+func (r *SQLRepository) SearchCompanies(ctx context.Context, query string, filters CompanyFilters, limit int) ([]CompanySearchResult, error) {
+	return SearchCompanies(ctx, r.db, query, filters, limit)
+}
+
+// AddCompanyLabels adds the given labels to the company and returns all its
+// labels.
+func (r *SQLRepository) AddCompanyLabels(ctx context.Context, id uuid.UUID, labels CompanyLabels) (CompanyLabels, error) {
+	return AddCompanyLabels(ctx, r.db, id, labels)
+}
+
+// RemoveCompanyLabels removes the labels of the given keys from the company
+// and returns its remaining labels.
+func (r *SQLRepository) RemoveCompanyLabels(ctx context.Context, id uuid.UUID, keys []string) (CompanyLabels, error) {
+	return RemoveCompanyLabels(ctx, r.db, id, keys)
+}
+
+// CountCompanyLabels returns the number of companies matching the filters
+// per label.
+func (r *SQLRepository) CountCompanyLabels(ctx context.Context, filters CompanyFilters, key string) ([]LabelCount, error) {
+	return CountCompanyLabels(ctx, r.db, filters, key)
+}
+
+// FindCompanyDuplicates returns the companies which may be duplicates of a
+// company with the given name.
+func (r *SQLRepository) FindCompanyDuplicates(ctx context.Context, name string) ([]CompanyDuplicate, error) {
+	return FindCompanyDuplicates(ctx, r.db, name)
+}
+
+// FindAllCompanyDuplicates returns the pairs of companies which may be
+// duplicates.
+func (r *SQLRepository) FindAllCompanyDuplicates(ctx context.Context, limit int) ([]CompanyDuplicatePair, error) {
+	return FindAllCompanyDuplicates(ctx, r.db, limit)
+}
+
+// MergeCompany merges the source company into the given target.
+func (r *SQLRepository) MergeCompany(ctx context.Context, sourceID uuid.UUID, target *Company) error {
+	return MergeCompany(ctx, r.db, sourceID, target)
+}
+
+// GetCompanyRedirect returns the ID of the company the given company was
+// merged into.
+func (r *SQLRepository) GetCompanyRedirect(ctx context.Context, id uuid.UUID) (uuid.UUID, error) {
+	return GetCompanyRedirect(ctx, r.db, id)
+}
+
+// GetCompanyAncestors returns the ancestors of the given company.
+func (r *SQLRepository) GetCompanyAncestors(ctx context.Context, id uuid.UUID) ([]Company, error) {
+	return GetCompanyAncestors(ctx, r.db, id)
+}
+
+// GetCompanyDescendants returns the descendants of the given company.
+func (r *SQLRepository) GetCompanyDescendants(ctx context.Context, id uuid.UUID) ([]CompanyNode, error) {
+	return GetCompanyDescendants(ctx, r.db, id)
+}
+
+// ReparentCompanyChildren moves the children of the given company to its
+// parent.
+func (r *SQLRepository) ReparentCompanyChildren(ctx context.Context, id uuid.UUID) error {
+	return ReparentCompanyChildren(ctx, r.db, id)
+}
+
+// TransitionCompanyStatus changes the status of the company and records
+// the change.
+func (r *SQLRepository) TransitionCompanyStatus(ctx context.Context, ch *CompanyStatusChange) error {
+	return TransitionCompanyStatus(ctx, r.db, ch)
+}
+
+// CreateCompanyStatusChange records the given status change.
+func (r *SQLRepository) CreateCompanyStatusChange(ctx context.Context, ch *CompanyStatusChange) error {
+	return CreateCompanyStatusChange(ctx, r.db, ch)
+}
+
+// GetCompanyStatusHistory returns the status changes of the given company.
+func (r *SQLRepository) GetCompanyStatusHistory(ctx context.Context, companyID uuid.UUID) ([]CompanyStatusChange, error) {
+	return GetCompanyStatusHistory(ctx, r.db, companyID)
+}
+
+// CreateCompanyAddress creates the given address.
+func (r *SQLRepository) CreateCompanyAddress(ctx context.Context, a *CompanyAddress) error {
+	return CreateCompanyAddress(ctx, r.db, a)
+}
+
+// GetCompanyAddress returns the address of the given company.
+func (r *SQLRepository) GetCompanyAddress(ctx context.Context, companyID, id uuid.UUID) (CompanyAddress, error) {
+	return GetCompanyAddress(ctx, r.db, companyID, id)
+}
+
+// GetCompanyAddresses returns the addresses of the given company.
+func (r *SQLRepository) GetCompanyAddresses(ctx context.Context, companyID uuid.UUID) ([]CompanyAddress, error) {
+	return GetCompanyAddresses(ctx, r.db, companyID)
+}
+
+// UpdateCompanyAddress updates the given address.
+func (r *SQLRepository) UpdateCompanyAddress(ctx context.Context, a *CompanyAddress) error {
+	return UpdateCompanyAddress(ctx, r.db, a)
+}
+
+// DeleteCompanyAddress deletes the address of the given company.
+func (r *SQLRepository) DeleteCompanyAddress(ctx context.Context, companyID, id uuid.UUID) error {
+	return DeleteCompanyAddress(ctx, r.db, companyID, id)
+}
+
+// CreateCompanyContact creates the given contact.
+func (r *SQLRepository) CreateCompanyContact(ctx context.Context, c *CompanyContact) error {
+	return CreateCompanyContact(ctx, r.db, c)
+}
+
+// GetCompanyContact returns the contact of the given company.
+func (r *SQLRepository) GetCompanyContact(ctx context.Context, companyID, id uuid.UUID) (CompanyContact, error) {
+	return GetCompanyContact(ctx, r.db, companyID, id)
+}
+
+// GetCompanyContacts returns the contacts of the given company.
+func (r *SQLRepository) GetCompanyContacts(ctx context.Context, companyID uuid.UUID) ([]CompanyContact, error) {
+	return GetCompanyContacts(ctx, r.db, companyID)
+}
+
+// UpdateCompanyContact updates the given contact.
+func (r *SQLRepository) UpdateCompanyContact(ctx context.Context, c *CompanyContact) error {
+	return UpdateCompanyContact(ctx, r.db, c)
+}
+
+// DeleteCompanyContact deletes the contact of the given company.
+func (r *SQLRepository) DeleteCompanyContact(ctx context.Context, companyID, id uuid.UUID) error {
+	return DeleteCompanyContact(ctx, r.db, companyID, id)
+}
+
+// CreateCompanyAttachment creates the given attachment.
+func (r *SQLRepository) CreateCompanyAttachment(ctx context.Context, a *CompanyAttachment) error {
+	return CreateCompanyAttachment(ctx, r.db, a)
+}
+
+// GetCompanyAttachment returns the attachment of the given company.
+func (r *SQLRepository) GetCompanyAttachment(ctx context.Context, companyID, id uuid.UUID) (CompanyAttachment, error) {
+	return GetCompanyAttachment(ctx, r.db, companyID, id)
+}
+
+// GetCompanyAttachments returns the attachments of the given company.
+func (r *SQLRepository) GetCompanyAttachments(ctx context.Context, companyID uuid.UUID) ([]CompanyAttachment, error) {
+	return GetCompanyAttachments(ctx, r.db, companyID)
+}
+
+// DeleteCompanyAttachment removes the attachment from the given company.
+func (r *SQLRepository) DeleteCompanyAttachment(ctx context.Context, companyID, id uuid.UUID) error {
+	return DeleteCompanyAttachment(ctx, r.db, companyID, id)
+}
+
+// GetOrphanAttachments returns the orphan attachments.
+func (r *SQLRepository) GetOrphanAttachments(ctx context.Context, limit int) ([]CompanyAttachment, error) {
+	return GetOrphanAttachments(ctx, r.db, limit)
+}
+
+// DeleteOrphanAttachment deletes the given orphan attachment.
+func (r *SQLRepository) DeleteOrphanAttachment(ctx context.Context, id uuid.UUID) error {
+	return DeleteOrphanAttachment(ctx, r.db, id)
+}
+
+// CreateCompanyNote creates the given note.
+func (r *SQLRepository) CreateCompanyNote(ctx context.Context, n *CompanyNote) error {
+	return CreateCompanyNote(ctx, r.db, n)
+}
+
+// GetCompanyNote returns the note of the given company.
+func (r *SQLRepository) GetCompanyNote(ctx context.Context, companyID, id uuid.UUID) (CompanyNote, error) {
+	return GetCompanyNote(ctx, r.db, companyID, id)
+}
+
+// GetCompanyNotes returns the notes of the given company.
+func (r *SQLRepository) GetCompanyNotes(ctx context.Context, companyID uuid.UUID) ([]CompanyNote, error) {
+	return GetCompanyNotes(ctx, r.db, companyID)
+}
+
+// UpdateCompanyNote updates the given note.
+func (r *SQLRepository) UpdateCompanyNote(ctx context.Context, n *CompanyNote, username string) error {
+	return UpdateCompanyNote(ctx, r.db, n, username)
+}
+
+// DeleteCompanyNote deletes the note of the given company.
+func (r *SQLRepository) DeleteCompanyNote(ctx context.Context, companyID, id uuid.UUID) error {
+	return DeleteCompanyNote(ctx, r.db, companyID, id)
+}
+
+// GetCompanyNoteVersions returns the versions of the note of the given
+// company.
+func (r *SQLRepository) GetCompanyNoteVersions(ctx context.Context, companyID, noteID uuid.UUID) ([]CompanyNoteVersion, error) {
+	return GetCompanyNoteVersions(ctx, r.db, companyID, noteID)
+}
+
+// CreateCompanyFieldChanges records the given field changes.
+func (r *SQLRepository) CreateCompanyFieldChanges(ctx context.Context, changes []CompanyFieldChange) error {
+	return CreateCompanyFieldChanges(ctx, r.db, changes)
+}
+
+// GetCompanyFieldChanges returns the field changes of the given company.
+func (r *SQLRepository) GetCompanyFieldChanges(ctx context.Context, companyID uuid.UUID) ([]CompanyFieldChange, error) {
+	return GetCompanyFieldChanges(ctx, r.db, companyID)
+}
+
+// GetCompanyTimeline returns the page of the timeline of the company
+// selected by the query.
+func (r *SQLRepository) GetCompanyTimeline(ctx context.Context, q CompanyTimelineQuery) ([]CompanyTimelineEntry, error) {
+	return GetCompanyTimeline(ctx, r.db, q)
+}
+
+// CreatePerson creates the given person.
+func (r *SQLRepository) CreatePerson(ctx context.Context, p *Person) error {
+	return CreatePerson(ctx, r.db, p)
+}
+
+// GetPerson returns the person for the given ID.
+func (r *SQLRepository) GetPerson(ctx context.Context, id uuid.UUID) (Person, error) {
+	return GetPerson(ctx, r.db, id)
+}
+
+// UpdatePerson updates the given person.
+func (r *SQLRepository) UpdatePerson(ctx context.Context, p *Person) error {
+	return UpdatePerson(ctx, r.db, p)
+}
+
+// DeletePerson deletes the person for the given ID.
+func (r *SQLRepository) DeletePerson(ctx context.Context, id uuid.UUID) error {
+	return DeletePerson(ctx, r.db, id)
+}
+
+// CreateOwnership creates the given stake.
+func (r *SQLRepository) CreateOwnership(ctx context.Context, o *Ownership) error {
+	return CreateOwnership(ctx, r.db, o)
+}
+
+// GetOwnership returns the stake in the given company.
+func (r *SQLRepository) GetOwnership(ctx context.Context, companyID, id uuid.UUID) (Ownership, error) {
+	return GetOwnership(ctx, r.db, companyID, id)
+}
+
+// GetCompanyOwnerships returns the direct stakes in the given company.
+func (r *SQLRepository) GetCompanyOwnerships(ctx context.Context, companyID uuid.UUID) ([]Ownership, error) {
+	return GetCompanyOwnerships(ctx, r.db, companyID)
+}
+
+// UpdateOwnership updates the given stake.
+func (r *SQLRepository) UpdateOwnership(ctx context.Context, o *Ownership) error {
+	return UpdateOwnership(ctx, r.db, o)
+}
+
+// DeleteOwnership deletes the stake in the given company.
+func (r *SQLRepository) DeleteOwnership(ctx context.Context, companyID, id uuid.UUID) error {
+	return DeleteOwnership(ctx, r.db, companyID, id)
+}
+
+// GetOwnershipGraph returns the stakes in the given company and in its
+// owners, recursively.
+func (r *SQLRepository) GetOwnershipGraph(ctx context.Context, companyID uuid.UUID) ([]Ownership, error) {
+	return GetOwnershipGraph(ctx, r.db, companyID)
+}
+
+// CreateChangeRequest creates the given pending change request.
+func (r *SQLRepository) CreateChangeRequest(ctx context.Context, cr *ChangeRequest) error {
+	return CreateChangeRequest(ctx, r.db, cr)
+}
+
+// GetChangeRequest returns the change request for the given ID.
+func (r *SQLRepository) GetChangeRequest(ctx context.Context, id uuid.UUID) (ChangeRequest, error) {
+	return GetChangeRequest(ctx, r.db, id)
+}
+
+// GetPendingChangeRequest returns the pending change request of the given
+// company.
+func (r *SQLRepository) GetPendingChangeRequest(ctx context.Context, companyID uuid.UUID) (ChangeRequest, error) {
+	return GetPendingChangeRequest(ctx, r.db, companyID)
+}
+
+// GetChangeRequests returns the change requests matching the given filters.
+func (r *SQLRepository) GetChangeRequests(ctx context.Context, filters ChangeRequestFilters) ([]ChangeRequest, error) {
+	return GetChangeRequests(ctx, r.db, filters)
+}
+
+// DecideChangeRequest decides the given pending change request.
+func (r *SQLRepository) DecideChangeRequest(ctx context.Context, cr *ChangeRequest) error {
+	return DecideChangeRequest(ctx, r.db, cr)
+}
+
+// ExpireChangeRequests expires the pending change requests expired at the
+// given time and returns them.
+func (r *SQLRepository) ExpireChangeRequests(ctx context.Context, at time.Time) ([]ChangeRequest, error) {
+	return ExpireChangeRequests(ctx, r.db, at)
+}
+
+// CreateAttributeDefinition creates the given attribute definition.
+func (r *SQLRepository) CreateAttributeDefinition(ctx context.Context, d *AttributeDefinition) error {
+	return CreateAttributeDefinition(ctx, r.db, d)
+}
+
+// GetAttributeDefinition returns the attribute definition of the given
+// company type and name.
+func (r *SQLRepository) GetAttributeDefinition(ctx context.Context, companyType uint32, name string) (AttributeDefinition, error) {
+	return GetAttributeDefinition(ctx, r.db, companyType, name)
+}
+
+// GetAttributeDefinitions returns the attribute definitions of the given
+// company type.
+func (r *SQLRepository) GetAttributeDefinitions(ctx context.Context, companyType uint32) ([]AttributeDefinition, error) {
+	return GetAttributeDefinitions(ctx, r.db, companyType)
+}
+
+// UpdateAttributeDefinition updates the given attribute definition.
+func (r *SQLRepository) UpdateAttributeDefinition(ctx context.Context, d *AttributeDefinition) error {
+	return UpdateAttributeDefinition(ctx, r.db, d)
+}
+
+// DeleteAttributeDefinition deletes the given attribute definition and the
+// values of the attribute.
+func (r *SQLRepository) DeleteAttributeDefinition(ctx context.Context, companyType uint32, name string) error {
+	return DeleteAttributeDefinition(ctx, r.db, companyType, name)
+}
+
+// CreateUser creates the given user and sets its ID.
+func (r *SQLRepository) CreateUser(ctx context.Context, u *User) error {
+	return CreateUser(ctx, r.db, u)
+}
+
+// GetUser returns the user for the given ID.
+func (r *SQLRepository) GetUser(ctx context.Context, id int64) (User, error) {
+	return GetUser(ctx, r.db, id)
+}
+
+// GetUserByUsername returns the user for the given username.
+func (r *SQLRepository) GetUserByUsername(ctx context.Context, username string) (User, error) {
+	return GetUserByUsername(ctx, r.db, username)
+}
+
+// CreateIdempotencyKey stores the given key of a request in progress.
+func (r *SQLRepository) CreateIdempotencyKey(ctx context.Context, k *IdempotencyKey) error {
+	return CreateIdempotencyKey(ctx, r.db, k)
+}
+
+// GetIdempotencyKey returns the given key of the user if it is not expired.
+func (r *SQLRepository) GetIdempotencyKey(ctx context.Context, username, key string) (IdempotencyKey, error) {
+	return GetIdempotencyKey(ctx, r.db, username, key)
+}
+
+// CompleteIdempotencyKey stores the response and the response header of the
+// request of the given key.
+func (r *SQLRepository) CompleteIdempotencyKey(ctx context.Context, k *IdempotencyKey) error {
+	return CompleteIdempotencyKey(ctx, r.db, k)
+}
+
+// DeleteIdempotencyKey deletes the given key of the user.
+func (r *SQLRepository) DeleteIdempotencyKey(ctx context.Context, username, key string) error {
+	return DeleteIdempotencyKey(ctx, r.db, username, key)
+}
+
+// DeleteExpiredIdempotencyKeys deletes the expired keys.
+func (r *SQLRepository) DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	return DeleteExpiredIdempotencyKeys(ctx, r.db)
+}
+
+// Transaction runs f with a repository bound to a transaction.
+func (r *SQLRepository) Transaction(ctx context.Context, f func(Repository) error) error {
+	d, ok := r.db.(*DBLogger)
+	if !ok {
+		// already in a transaction
+		return f(r)
+	}
+
+	tx, err := d.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("storage: can't begin the transaction %v", err)
+	}
+
+	if err := f(NewSQLRepository(tx)); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("storage: can't rollback the transaction %v", rbErr)
+		}
+		if err == ErrTransactionRollback {
+			return nil
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("storage: can't commit the transaction %v", err)
+	}
+	return nil
+}
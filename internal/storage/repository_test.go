@@ -0,0 +1,1322 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// testRepository verifies the semantics all the repository implementations
+// must share.
+func testRepository(t *testing.T, r Repository) {
+	ctx := context.Background()
+
+	t.Run("Company", func(t *testing.T) {
+		assert := require.New(t)
+
+		c := Company{
+			ID:           uuid.Must(uuid.NewV4()),
+			Name:         "repo_company",
+			Description:  "description",
+			EmployeesCnt: 10,
+			Registered:   true,
+			Type:         1,
+		}
+		assert.NoError(r.CreateCompany(ctx, &c))
+
+		got, err := r.GetCompany(ctx, c.ID)
+		assert.NoError(err)
+		assert.Equal(c.Name, got.Name)
+		assert.Equal(c.EmployeesCnt, got.EmployeesCnt)
+		assert.False(got.CreatedAt.IsZero())
+
+		t.Run("Create with the same ID", func(t *testing.T) {
+			dup := c
+			dup.Name = "other_name"
+			require.Equal(t, ErrAlreadyExists, r.CreateCompany(ctx, &dup))
+		})
+
+		t.Run("Create with the same name", func(t *testing.T) {
+			dup := c
+			dup.ID = uuid.Must(uuid.NewV4())
+			require.Equal(t, ErrAlreadyExists, r.CreateCompany(ctx, &dup))
+		})
+
+		t.Run("Create with a too long name", func(t *testing.T) {
+			long := c
+			long.ID = uuid.Must(uuid.NewV4())
+			long.Name = strings.Repeat("a", 16)
+			err := r.CreateCompany(ctx, &long)
+			require.Error(t, err)
+			require.NotEqual(t, ErrAlreadyExists, err)
+		})
+
+		t.Run("Update", func(t *testing.T) {
+			assert := require.New(t)
+
+			upd := c
+			upd.Name = "repo_renamed"
+			upd.EmployeesCnt = 20
+			assert.NoError(r.UpdateCompany(ctx, &upd))
+
+			got, err := r.GetCompany(ctx, c.ID)
+			assert.NoError(err)
+			assert.Equal("repo_renamed", got.Name)
+			assert.Equal(int32(20), got.EmployeesCnt)
+
+			missing := c
+			missing.ID = uuid.Must(uuid.NewV4())
+			assert.Equal(ErrDoesNotExist, r.UpdateCompany(ctx, &missing))
+		})
+
+		t.Run("Update to a taken name", func(t *testing.T) {
+			assert := require.New(t)
+
+			other := c
+			other.ID = uuid.Must(uuid.NewV4())
+			other.Name = "repo_other"
+			assert.NoError(r.CreateCompany(ctx, &other))
+
+			other.Name = "repo_renamed"
+			assert.Equal(ErrAlreadyExists, r.UpdateCompany(ctx, &other))
+			assert.NoError(r.DeleteCompany(ctx, other.ID))
+		})
+
+		t.Run("Delete", func(t *testing.T) {
+			assert := require.New(t)
+
+			assert.NoError(r.DeleteCompany(ctx, c.ID))
+			assert.Equal(ErrDoesNotExist, r.DeleteCompany(ctx, c.ID))
+
+			_, err := r.GetCompany(ctx, c.ID)
+			assert.Equal(ErrDoesNotExist, err)
+		})
+	})
+
+	t.Run("Transaction", func(t *testing.T) {
+		assert := require.New(t)
+
+		c1 := Company{ID: uuid.Must(uuid.NewV4()), Name: "tx_company_1", EmployeesCnt: 1, Type: 1}
+		c2 := Company{ID: uuid.Must(uuid.NewV4()), Name: "tx_company_2", EmployeesCnt: 1, Type: 1}
+
+		// a failing statement rolls back the whole transaction
+		err := r.Transaction(ctx, func(tx Repository) error {
+			if err := tx.CreateCompany(ctx, &c1); err != nil {
+				return err
+			}
+			dup := c2
+			dup.Name = c1.Name
+			return tx.CreateCompany(ctx, &dup)
+		})
+		assert.Equal(ErrAlreadyExists, err)
+		_, err = r.GetCompany(ctx, c1.ID)
+		assert.Equal(ErrDoesNotExist, err)
+
+		assert.NoError(r.Transaction(ctx, func(tx Repository) error {
+			if err := tx.CreateCompany(ctx, &c1); err != nil {
+				return err
+			}
+			return ErrTransactionRollback
+		}))
+		_, err = r.GetCompany(ctx, c1.ID)
+		assert.Equal(ErrDoesNotExist, err)
+
+		assert.NoError(r.Transaction(ctx, func(tx Repository) error {
+			if err := tx.CreateCompany(ctx, &c1); err != nil {
+				return err
+			}
+			return tx.Transaction(ctx, func(tx Repository) error {
+				return tx.CreateCompany(ctx, &c2)
+			})
+		}))
+		for _, c := range []Company{c1, c2} {
+			_, err := r.GetCompany(ctx, c.ID)
+			assert.NoError(err)
+			assert.NoError(r.DeleteCompany(ctx, c.ID))
+		}
+	})
+
+	t.Run("ForEachCompany", func(t *testing.T) {
+		assert := require.New(t)
+
+		list := []Company{
+			{ID: uuid.Must(uuid.NewV4()), Name: "each_b", EmployeesCnt: 1, Type: 1, Registered: true},
+			{ID: uuid.Must(uuid.NewV4()), Name: "each_a", EmployeesCnt: 1, Type: 2},
+			{ID: uuid.Must(uuid.NewV4()), Name: "each_c", EmployeesCnt: 1, Type: 1},
+			{ID: uuid.Must(uuid.NewV4()), Name: "Each_d", EmployeesCnt: 1, Type: 1},
+		}
+		for i := range list {
+			assert.NoError(r.CreateCompany(ctx, &list[i]))
+		}
+
+		names := func(filters CompanyFilters) []string {
+			var out []string
+			assert.NoError(r.ForEachCompany(ctx, filters, func(c Company) error {
+				out = append(out, c.Name)
+				return nil
+			}))
+			return out
+		}
+
+		registered := true
+		assert.Equal([]string{"each_a", "each_b", "each_c"}, names(CompanyFilters{NamePrefix: "each_"}))
+		assert.Equal([]string{"each_b", "each_c"}, names(CompanyFilters{NamePrefix: "each_", Type: 1}))
+		assert.Equal([]string{"each_b"}, names(CompanyFilters{NamePrefix: "each", Registered: &registered}))
+		assert.Empty(names(CompanyFilters{NamePrefix: "each_%"}))
+
+		// the error of fn stops the iteration
+		n := 0
+		err := r.ForEachCompany(ctx, CompanyFilters{NamePrefix: "each_"}, func(c Company) error {
+			n++
+			return ErrTransactionRollback
+		})
+		assert.Equal(ErrTransactionRollback, err)
+		assert.Equal(1, n)
+
+		// the iteration can be run again in the same transaction
+		assert.NoError(r.Transaction(ctx, func(tx Repository) error {
+			err := tx.ForEachCompany(ctx, CompanyFilters{NamePrefix: "each_"}, func(c Company) error {
+				return ErrTransactionRollback
+			})
+			assert.Equal(ErrTransactionRollback, err)
+			n = 0
+			assert.NoError(tx.ForEachCompany(ctx, CompanyFilters{NamePrefix: "each_"}, func(c Company) error {
+				n++
+				return nil
+			}))
+			return nil
+		}))
+		assert.Equal(3, n)
+
+		for _, c := range list {
+			assert.NoError(r.DeleteCompany(ctx, c.ID))
+		}
+	})
+
+	t.Run("SearchCompanies", func(t *testing.T) {
+		assert := require.New(t)
+
+		list := []Company{
+			{ID: uuid.Must(uuid.NewV4()), Name: "Acme", EmployeesCnt: 1, Type: 1},
+			{ID: uuid.Must(uuid.NewV4()), Name: "Acme Labs", EmployeesCnt: 1, Type: 1},
+			{ID: uuid.Must(uuid.NewV4()), Name: "Big Corp", EmployeesCnt: 1, Type: 1,
+				Description: "The main supplier of acme rockets."},
+			{ID: uuid.Must(uuid.NewV4()), Name: "100%_x", EmployeesCnt: 1, Type: 1},
+			{ID: uuid.Must(uuid.NewV4()), Name: "Markup", EmployeesCnt: 1, Type: 1,
+				Description: "Rockets <img src=x onerror=alert(1)> by zorg \ue000inc\ue001."},
+		}
+		for i := range list {
+			assert.NoError(r.CreateCompany(ctx, &list[i]))
+		}
+
+		// the description is escaped, only the markers are HTML
+		results, err := r.SearchCompanies(ctx, "zorg", CompanyFilters{}, 10)
+		assert.NoError(err)
+		assert.Len(results, 1)
+		assert.Contains(results[0].Snippet, "<b>zorg</b>")
+		assert.NotContains(results[0].Snippet, "<img")
+		assert.NotContains(results[0].Snippet, "<b>inc</b>")
+
+		results, err = r.SearchCompanies(ctx, "ACME", CompanyFilters{}, 10)
+		assert.NoError(err)
+		var names []string
+		for _, res := range results {
+			names = append(names, res.Name)
+		}
+		assert.Equal([]string{"Acme", "Acme Labs", "Big Corp"}, names)
+		assert.Equal("The main supplier of <b>acme</b> rockets.", results[2].Snippet)
+
+		results, err = r.SearchCompanies(ctx, "acme", CompanyFilters{}, 1)
+		assert.NoError(err)
+		assert.Len(results, 1)
+
+		// the wildcards are matched literally
+		results, err = r.SearchCompanies(ctx, "%_", CompanyFilters{}, 10)
+		assert.NoError(err)
+		assert.Len(results, 1)
+		assert.Equal("100%_x", results[0].Name)
+
+		for _, c := range list {
+			assert.NoError(r.DeleteCompany(ctx, c.ID))
+		}
+	})
+
+	t.Run("CompanyDuplicates", func(t *testing.T) {
+		assert := require.New(t)
+
+		list := []Company{
+			{ID: uuid.Must(uuid.NewV4()), Name: "Acme Ltd.", EmployeesCnt: 1, Type: 1},
+			{ID: uuid.Must(uuid.NewV4()), Name: "ACME, LLC", EmployeesCnt: 1, Type: 1},
+			{ID: uuid.Must(uuid.NewV4()), Name: "Other", EmployeesCnt: 1, Type: 1},
+		}
+		for i := range list {
+			assert.NoError(r.CreateCompany(ctx, &list[i]))
+		}
+		assert.Equal("acme", list[0].NormalizedName)
+
+		dups, err := r.FindCompanyDuplicates(ctx, "acme inc")
+		assert.NoError(err)
+		assert.Len(dups, 2)
+		assert.Equal("ACME, LLC", dups[0].Name)
+		assert.Equal("Acme Ltd.", dups[1].Name)
+		assert.Equal(1.0, dups[0].Similarity)
+
+		dups, err = r.FindCompanyDuplicates(ctx, "Unknown")
+		assert.NoError(err)
+		assert.Len(dups, 0)
+
+		pairs, err := r.FindAllCompanyDuplicates(ctx, 10)
+		assert.NoError(err)
+		assert.Len(pairs, 1)
+		assert.ElementsMatch([]string{"Acme Ltd.", "ACME, LLC"}, []string{pairs[0].First.Name, pairs[0].Second.Name})
+
+		// renaming updates the normalized name
+		list[1].Name = "Acme Labs"
+		assert.NoError(r.UpdateCompany(ctx, &list[1]))
+		pairs, err = r.FindAllCompanyDuplicates(ctx, 10)
+		assert.NoError(err)
+		assert.Len(pairs, 0)
+
+		for _, c := range list {
+			assert.NoError(r.DeleteCompany(ctx, c.ID))
+		}
+	})
+
+	t.Run("MergeCompany", func(t *testing.T) {
+		assert := require.New(t)
+
+		list := []Company{
+			{ID: uuid.Must(uuid.NewV4()), Name: "Merge A", EmployeesCnt: 1, Type: 1},
+			{ID: uuid.Must(uuid.NewV4()), Name: "Merge B", EmployeesCnt: 2, Type: 1},
+			{ID: uuid.Must(uuid.NewV4()), Name: "Merge C", EmployeesCnt: 3, Type: 1},
+		}
+		for i := range list {
+			assert.NoError(r.CreateCompany(ctx, &list[i]))
+		}
+
+		// the history of A is kept in the one of B
+		for _, c := range list[:2] {
+			assert.NoError(r.CreateCompanyFieldChanges(ctx, []CompanyFieldChange{
+				{ID: uuid.Must(uuid.NewV4()), CompanyID: c.ID, Field: "description", NewValue: c.Name, Username: "admin"},
+			}))
+		}
+		ch := CompanyStatusChange{ID: uuid.Must(uuid.NewV4()), CompanyID: list[0].ID, FromStatus: 0, ToStatus: 2, Username: "admin"}
+		assert.NoError(r.Transaction(ctx, func(tx Repository) error {
+			return tx.TransitionCompanyStatus(ctx, &ch)
+		}))
+
+		// A into B, B taking the name of A
+		target := list[1]
+		target.Name = list[0].Name
+		assert.NoError(r.Transaction(ctx, func(tx Repository) error {
+			return tx.MergeCompany(ctx, list[0].ID, &target)
+		}))
+		_, err := r.GetCompany(ctx, list[0].ID)
+		assert.Equal(ErrDoesNotExist, err)
+		c, err := r.GetCompany(ctx, list[1].ID)
+		assert.NoError(err)
+		assert.Equal("Merge A", c.Name)
+
+		edits, err := r.GetCompanyFieldChanges(ctx, list[1].ID)
+		assert.NoError(err)
+		assert.Len(edits, 2)
+		assert.Equal([]string{"Merge A", "Merge B"}, []string{edits[0].NewValue, edits[1].NewValue})
+		for _, e := range edits {
+			assert.Equal(list[1].ID, e.CompanyID)
+		}
+		statuses, err := r.GetCompanyStatusHistory(ctx, list[1].ID)
+		assert.NoError(err)
+		assert.Len(statuses, 1)
+		assert.Equal(ch.ID, statuses[0].ID)
+		assert.Equal(list[1].ID, statuses[0].CompanyID)
+		id, err := r.GetCompanyRedirect(ctx, list[0].ID)
+		assert.NoError(err)
+		assert.Equal(list[1].ID, id)
+
+		// B into C, the redirect of A follows
+		target = list[2]
+		assert.NoError(r.Transaction(ctx, func(tx Repository) error {
+			return tx.MergeCompany(ctx, list[1].ID, &target)
+		}))
+		id, err = r.GetCompanyRedirect(ctx, list[0].ID)
+		assert.NoError(err)
+		assert.Equal(list[2].ID, id)
+
+		_, err = r.GetCompanyRedirect(ctx, list[2].ID)
+		assert.Equal(ErrDoesNotExist, err)
+		assert.Equal(ErrDoesNotExist, r.Transaction(ctx, func(tx Repository) error {
+			return tx.MergeCompany(ctx, list[0].ID, &target)
+		}))
+
+		// deleting the target deletes the redirects
+		assert.NoError(r.DeleteCompany(ctx, list[2].ID))
+		_, err = r.GetCompanyRedirect(ctx, list[0].ID)
+		assert.Equal(ErrDoesNotExist, err)
+	})
+
+	t.Run("CompanyAddressContact", func(t *testing.T) {
+		assert := require.New(t)
+
+		c := Company{ID: uuid.Must(uuid.NewV4()), Name: "Sub A", EmployeesCnt: 1, Type: 1}
+		other := Company{ID: uuid.Must(uuid.NewV4()), Name: "Sub B", EmployeesCnt: 1, Type: 1}
+		assert.NoError(r.CreateCompany(ctx, &c))
+		assert.NoError(r.CreateCompany(ctx, &other))
+
+		a := CompanyAddress{ID: uuid.Must(uuid.NewV4()), CompanyID: c.ID, Type: 1, Country: "CY", City: "Limassol", Line1: "1 Main St"}
+		assert.NoError(r.CreateCompanyAddress(ctx, &a))
+		assert.Equal(ErrAlreadyExists, r.CreateCompanyAddress(ctx, &a))
+		unknown := CompanyAddress{ID: uuid.Must(uuid.NewV4()), CompanyID: uuid.Must(uuid.NewV4()), Type: 1, Country: "CY"}
+		assert.Equal(ErrDoesNotExist, r.CreateCompanyAddress(ctx, &unknown))
+
+		got, err := r.GetCompanyAddress(ctx, c.ID, a.ID)
+		assert.NoError(err)
+		assert.Equal("Limassol", got.City)
+		_, err = r.GetCompanyAddress(ctx, other.ID, a.ID)
+		assert.Equal(ErrDoesNotExist, err)
+
+		a.City = "Nicosia"
+		assert.NoError(r.UpdateCompanyAddress(ctx, &a))
+		list, err := r.GetCompanyAddresses(ctx, c.ID)
+		assert.NoError(err)
+		assert.Len(list, 1)
+		assert.Equal("Nicosia", list[0].City)
+
+		ct := CompanyContact{ID: uuid.Must(uuid.NewV4()), CompanyID: c.ID, Name: "John", Email: "john@example.com", Phone: "+35725123456"}
+		assert.NoError(r.CreateCompanyContact(ctx, &ct))
+		ct.Role = "CFO"
+		assert.NoError(r.UpdateCompanyContact(ctx, &ct))
+		gotContact, err := r.GetCompanyContact(ctx, c.ID, ct.ID)
+		assert.NoError(err)
+		assert.Equal("CFO", gotContact.Role)
+		assert.Equal(ErrDoesNotExist, r.DeleteCompanyContact(ctx, other.ID, ct.ID))
+
+		// merging moves them to the target
+		target := other
+		assert.NoError(r.Transaction(ctx, func(tx Repository) error {
+			return tx.MergeCompany(ctx, c.ID, &target)
+		}))
+		list, err = r.GetCompanyAddresses(ctx, other.ID)
+		assert.NoError(err)
+		assert.Len(list, 1)
+		contacts, err := r.GetCompanyContacts(ctx, other.ID)
+		assert.NoError(err)
+		assert.Len(contacts, 1)
+
+		assert.NoError(r.DeleteCompanyAddress(ctx, other.ID, a.ID))
+		assert.Equal(ErrDoesNotExist, r.DeleteCompanyAddress(ctx, other.ID, a.ID))
+
+		// deleting the company deletes its contacts
+		assert.NoError(r.DeleteCompany(ctx, other.ID))
+		_, err = r.GetCompanyContact(ctx, other.ID, ct.ID)
+		assert.Equal(ErrDoesNotExist, err)
+	})
+
+	t.Run("CompanyGroup", func(t *testing.T) {
+		assert := require.New(t)
+
+		parentOf := func(c Company) uuid.NullUUID {
+			return uuid.NullUUID{UUID: c.ID, Valid: true}
+		}
+		root := Company{ID: uuid.Must(uuid.NewV4()), Name: "Group Root", EmployeesCnt: 1, Type: 1}
+		child := Company{ID: uuid.Must(uuid.NewV4()), Name: "Group Child", EmployeesCnt: 1, Type: 1, ParentID: parentOf(root)}
+		leaf := Company{ID: uuid.Must(uuid.NewV4()), Name: "Group Leaf", EmployeesCnt: 1, Type: 1, ParentID: parentOf(child)}
+		for _, c := range []*Company{&root, &child, &leaf} {
+			assert.NoError(r.CreateCompany(ctx, c))
+		}
+
+		unknown := Company{ID: uuid.Must(uuid.NewV4()), Name: "Group X", EmployeesCnt: 1, Type: 1, ParentID: uuid.NullUUID{UUID: uuid.Must(uuid.NewV4()), Valid: true}}
+		assert.Equal(ErrDoesNotExist, r.CreateCompany(ctx, &unknown))
+
+		ancestors, err := r.GetCompanyAncestors(ctx, leaf.ID)
+		assert.NoError(err)
+		assert.Len(ancestors, 2)
+		assert.Equal(child.ID, ancestors[0].ID)
+		assert.Equal(root.ID, ancestors[1].ID)
+
+		descendants, err := r.GetCompanyDescendants(ctx, root.ID)
+		assert.NoError(err)
+		assert.Len(descendants, 2)
+		assert.Equal(child.ID, descendants[0].ID)
+		assert.Equal(1, descendants[0].Depth)
+		assert.Equal(leaf.ID, descendants[1].ID)
+		assert.Equal(2, descendants[1].Depth)
+
+		// cycles
+		root.ParentID = parentOf(leaf)
+		assert.Equal(ErrCompanyParentCycle, r.UpdateCompany(ctx, &root))
+		root.ParentID = parentOf(root)
+		assert.Equal(ErrCompanyParentCycle, r.UpdateCompany(ctx, &root))
+		root.ParentID = uuid.NullUUID{}
+
+		assert.Equal(ErrUsedByOtherObjects, r.DeleteCompany(ctx, root.ID))
+
+		assert.NoError(r.ReparentCompanyChildren(ctx, child.ID))
+		c, err := r.GetCompany(ctx, leaf.ID)
+		assert.NoError(err)
+		assert.Equal(root.ID, c.ParentID.UUID)
+
+		// merging the root into its child, the child takes its place
+		target := child
+		assert.NoError(r.Transaction(ctx, func(tx Repository) error {
+			return tx.MergeCompany(ctx, root.ID, &target)
+		}))
+		assert.False(target.ParentID.Valid)
+		c, err = r.GetCompany(ctx, leaf.ID)
+		assert.NoError(err)
+		assert.Equal(child.ID, c.ParentID.UUID)
+
+		assert.NoError(r.DeleteCompany(ctx, leaf.ID))
+		assert.NoError(r.DeleteCompany(ctx, child.ID))
+	})
+
+	t.Run("CompanyStatus", func(t *testing.T) {
+		assert := require.New(t)
+
+		c := Company{ID: uuid.Must(uuid.NewV4()), Name: "Status Co", EmployeesCnt: 1, Type: 1, Status: 1}
+		assert.NoError(r.CreateCompany(ctx, &c))
+
+		// the initial status is recorded without a change
+		initial := CompanyStatusChange{ID: uuid.Must(uuid.NewV4()), CompanyID: c.ID, ToStatus: 1, Username: "admin"}
+		assert.NoError(r.CreateCompanyStatusChange(ctx, &initial))
+		unknown := initial
+		unknown.ID = uuid.Must(uuid.NewV4())
+		unknown.CompanyID = uuid.Must(uuid.NewV4())
+		assert.Equal(ErrDoesNotExist, r.CreateCompanyStatusChange(ctx, &unknown))
+
+		ch := CompanyStatusChange{
+			ID:         uuid.Must(uuid.NewV4()),
+			CompanyID:  c.ID,
+			FromStatus: 1,
+			ToStatus:   2,
+			Reason:     "documents received",
+			Username:   "admin",
+		}
+		assert.NoError(r.Transaction(ctx, func(tx Repository) error {
+			return tx.TransitionCompanyStatus(ctx, &ch)
+		}))
+
+		// the status is not in FromStatus anymore
+		again := ch
+		again.ID = uuid.Must(uuid.NewV4())
+		assert.Equal(ErrCompanyStatusChanged, r.TransitionCompanyStatus(ctx, &again))
+		again.CompanyID = uuid.Must(uuid.NewV4())
+		assert.Equal(ErrDoesNotExist, r.TransitionCompanyStatus(ctx, &again))
+
+		// the status is kept by the updates
+		c.Status = 6
+		c.Description = "updated"
+		assert.NoError(r.UpdateCompany(ctx, &c))
+		assert.Equal(uint32(2), c.Status)
+		stored, err := r.GetCompany(ctx, c.ID)
+		assert.NoError(err)
+		assert.Equal(uint32(2), stored.Status)
+
+		history, err := r.GetCompanyStatusHistory(ctx, c.ID)
+		assert.NoError(err)
+		assert.Len(history, 2)
+		assert.Equal(uint32(0), history[0].FromStatus)
+		assert.Equal(uint32(1), history[0].ToStatus)
+		assert.Equal(uint32(1), history[1].FromStatus)
+		assert.Equal(uint32(2), history[1].ToStatus)
+		assert.Equal("documents received", history[1].Reason)
+		assert.Equal("admin", history[1].Username)
+
+		assert.NoError(r.DeleteCompany(ctx, c.ID))
+		history, err = r.GetCompanyStatusHistory(ctx, c.ID)
+		assert.NoError(err)
+		assert.Len(history, 0)
+	})
+
+	t.Run("CompanyIdentifiers", func(t *testing.T) {
+		assert := require.New(t)
+
+		c := Company{
+			ID:                 uuid.Must(uuid.NewV4()),
+			Name:               "Ident Co",
+			EmployeesCnt:       1,
+			Type:               1,
+			Jurisdiction:       "CY",
+			RegistrationNumber: "HE123456",
+			VATID:              "CY10259033P",
+			LEI:                "213800D1EI4B9WTWWD28",
+		}
+		assert.NoError(r.CreateCompany(ctx, &c))
+		stored, err := r.GetCompany(ctx, c.ID)
+		assert.NoError(err)
+		assert.Equal("CY", stored.Jurisdiction)
+		assert.Equal("HE123456", stored.RegistrationNumber)
+		assert.Equal("CY10259033P", stored.VATID)
+		assert.Equal("213800D1EI4B9WTWWD28", stored.LEI)
+
+		// the registration number is unique per jurisdiction, the VAT ID
+		// may be shared
+		other := Company{
+			ID:                 uuid.Must(uuid.NewV4()),
+			Name:               "Other Co",
+			EmployeesCnt:       1,
+			Type:               1,
+			Jurisdiction:       "CY",
+			RegistrationNumber: "HE123456",
+			VATID:              "CY10259033P",
+		}
+		assert.Equal(ErrAlreadyExists, r.CreateCompany(ctx, &other))
+		other.Jurisdiction = "GR"
+		assert.NoError(r.CreateCompany(ctx, &other))
+
+		other.LEI = c.LEI
+		assert.Equal(ErrAlreadyExists, r.UpdateCompany(ctx, &other))
+		other.LEI = ""
+		other.Jurisdiction = "CY"
+		assert.Equal(ErrAlreadyExists, r.UpdateCompany(ctx, &other))
+
+		// the empty identifiers are not unique
+		other.RegistrationNumber = ""
+		assert.NoError(r.UpdateCompany(ctx, &other))
+		third := Company{ID: uuid.Must(uuid.NewV4()), Name: "Third Co", EmployeesCnt: 1, Type: 1, Jurisdiction: "CY"}
+		assert.NoError(r.CreateCompany(ctx, &third))
+
+		for _, id := range []uuid.UUID{c.ID, other.ID, third.ID} {
+			assert.NoError(r.DeleteCompany(ctx, id))
+		}
+	})
+
+	t.Run("Attributes", func(t *testing.T) {
+		assert := require.New(t)
+
+		d := AttributeDefinition{CompanyType: 1, Name: "tier", Kind: AttributeEnum, EnumValues: StringList{"gold", "silver"}}
+		assert.NoError(r.CreateAttributeDefinition(ctx, &d))
+		assert.Equal(ErrAlreadyExists, r.CreateAttributeDefinition(ctx, &d))
+		assert.NoError(r.CreateAttributeDefinition(ctx, &AttributeDefinition{CompanyType: 1, Name: "seats", Kind: AttributeInt}))
+		assert.NoError(r.CreateAttributeDefinition(ctx, &AttributeDefinition{CompanyType: 2, Name: "tier", Kind: AttributeString}))
+
+		d.Required = true
+		d.Kind = AttributeString
+		d.EnumValues = append(d.EnumValues, "bronze")
+		assert.NoError(r.UpdateAttributeDefinition(ctx, &d))
+		got, err := r.GetAttributeDefinition(ctx, 1, "tier")
+		assert.NoError(err)
+		assert.True(got.Required)
+		assert.Equal(AttributeEnum, got.Kind, "the kind is kept")
+		assert.Equal(StringList{"gold", "silver", "bronze"}, got.EnumValues)
+
+		list, err := r.GetAttributeDefinitions(ctx, 1)
+		assert.NoError(err)
+		assert.Len(list, 2)
+		assert.Equal("seats", list[0].Name)
+		list, err = r.GetAttributeDefinitions(ctx, 0)
+		assert.NoError(err)
+		assert.Len(list, 3)
+
+		companies := []Company{
+			{ID: uuid.Must(uuid.NewV4()), Name: "Attr Gold", EmployeesCnt: 1, Type: 1,
+				Attributes: CompanyAttributes{"tier": "gold", "seats": float64(10), "active": true}},
+			{ID: uuid.Must(uuid.NewV4()), Name: "Attr Silver", EmployeesCnt: 1, Type: 1,
+				Attributes: CompanyAttributes{"tier": "silver", "seats": float64(10)}},
+			{ID: uuid.Must(uuid.NewV4()), Name: "Attr Other", EmployeesCnt: 1, Type: 2,
+				Attributes: CompanyAttributes{"tier": "gold"}},
+		}
+		for i := range companies {
+			assert.NoError(r.CreateCompany(ctx, &companies[i]))
+		}
+
+		c, err := r.GetCompany(ctx, companies[0].ID)
+		assert.NoError(err)
+		assert.Equal(companies[0].Attributes, c.Attributes)
+
+		names := func(filters CompanyFilters) []string {
+			var list []string
+			assert.NoError(r.ForEachCompany(ctx, filters, func(c Company) error {
+				list = append(list, c.Name)
+				return nil
+			}))
+			return list
+		}
+		assert.Equal([]string{"Attr Gold", "Attr Other"}, names(CompanyFilters{Attributes: CompanyAttributes{"tier": "gold"}}))
+		assert.Equal([]string{"Attr Gold"}, names(CompanyFilters{Type: 1, Attributes: CompanyAttributes{"tier": "gold", "seats": float64(10)}}))
+		assert.Equal([]string{"Attr Gold"}, names(CompanyFilters{Attributes: CompanyAttributes{"active": true}}))
+		assert.Empty(names(CompanyFilters{Attributes: CompanyAttributes{"seats": float64(11)}}))
+
+		results, err := r.SearchCompanies(ctx, "attr", CompanyFilters{Attributes: CompanyAttributes{"tier": "silver"}}, 10)
+		assert.NoError(err)
+		assert.Len(results, 1)
+		assert.Equal("Attr Silver", results[0].Name)
+
+		// the values are deleted with the definition, from the companies of
+		// the type only
+		assert.NoError(r.DeleteAttributeDefinition(ctx, 1, "tier"))
+		assert.Equal(ErrDoesNotExist, r.DeleteAttributeDefinition(ctx, 1, "tier"))
+		c, err = r.GetCompany(ctx, companies[0].ID)
+		assert.NoError(err)
+		assert.Equal(CompanyAttributes{"seats": float64(10), "active": true}, c.Attributes)
+		c, err = r.GetCompany(ctx, companies[2].ID)
+		assert.NoError(err)
+		assert.Equal(CompanyAttributes{"tier": "gold"}, c.Attributes)
+
+		for _, c := range companies {
+			assert.NoError(r.DeleteCompany(ctx, c.ID))
+		}
+		assert.NoError(r.DeleteAttributeDefinition(ctx, 1, "seats"))
+		assert.NoError(r.DeleteAttributeDefinition(ctx, 2, "tier"))
+	})
+
+	t.Run("Labels", func(t *testing.T) {
+		assert := require.New(t)
+
+		companies := []Company{
+			{ID: uuid.Must(uuid.NewV4()), Name: "Label Gold", EmployeesCnt: 1, Type: 1,
+				Labels: CompanyLabels{"env": "prod", "tier": "gold"}},
+			{ID: uuid.Must(uuid.NewV4()), Name: "Label Silver", EmployeesCnt: 1, Type: 1,
+				Labels: CompanyLabels{"env": "prod", "tier": "silver"}},
+			{ID: uuid.Must(uuid.NewV4()), Name: "Label Test", EmployeesCnt: 1, Type: 2,
+				Labels: CompanyLabels{"env": "test"}},
+		}
+		for i := range companies {
+			assert.NoError(r.CreateCompany(ctx, &companies[i]))
+		}
+
+		// the labels are kept by the updates
+		c := companies[2]
+		c.Labels = nil
+		c.Description = "updated"
+		assert.NoError(r.UpdateCompany(ctx, &c))
+		assert.Equal(CompanyLabels{"env": "test"}, c.Labels)
+		c, err := r.GetCompany(ctx, companies[2].ID)
+		assert.NoError(err)
+		assert.Equal(CompanyLabels{"env": "test"}, c.Labels)
+
+		labels, err := r.AddCompanyLabels(ctx, companies[2].ID, CompanyLabels{"env": "staging", "team": "core"})
+		assert.NoError(err)
+		assert.Equal(CompanyLabels{"env": "staging", "team": "core"}, labels)
+		labels, err = r.RemoveCompanyLabels(ctx, companies[2].ID, []string{"env", "missing"})
+		assert.NoError(err)
+		assert.Equal(CompanyLabels{"team": "core"}, labels)
+		c, err = r.GetCompany(ctx, companies[2].ID)
+		assert.NoError(err)
+		assert.Equal(CompanyLabels{"team": "core"}, c.Labels)
+		_, err = r.AddCompanyLabels(ctx, uuid.Must(uuid.NewV4()), CompanyLabels{"env": "prod"})
+		assert.Equal(ErrDoesNotExist, err)
+
+		names := func(selector LabelSelector) []string {
+			var list []string
+			assert.NoError(r.ForEachCompany(ctx, CompanyFilters{NamePrefix: "Label", Labels: selector}, func(c Company) error {
+				list = append(list, c.Name)
+				return nil
+			}))
+			return list
+		}
+		assert.Equal([]string{"Label Gold", "Label Silver"}, names(LabelSelector{{Key: "env", Operator: LabelEquals, Values: []string{"prod"}}}))
+		assert.Equal([]string{"Label Test"}, names(LabelSelector{{Key: "env", Operator: LabelNotEquals, Values: []string{"prod"}}}))
+		assert.Equal([]string{"Label Gold"}, names(LabelSelector{
+			{Key: "env", Operator: LabelEquals, Values: []string{"prod"}},
+			{Key: "tier", Operator: LabelNotIn, Values: []string{"silver", "bronze"}},
+		}))
+		assert.Equal([]string{"Label Gold", "Label Silver"}, names(LabelSelector{{Key: "tier", Operator: LabelIn, Values: []string{"gold", "silver"}}}))
+		assert.Equal([]string{"Label Test"}, names(LabelSelector{{Key: "team", Operator: LabelExists}}))
+		assert.Equal([]string{"Label Gold", "Label Silver"}, names(LabelSelector{{Key: "team", Operator: LabelNotExists}}))
+
+		counts, err := r.CountCompanyLabels(ctx, CompanyFilters{NamePrefix: "Label"}, "")
+		assert.NoError(err)
+		assert.Equal([]LabelCount{
+			{Key: "env", Value: "prod", Count: 2},
+			{Key: "team", Value: "core", Count: 1},
+			{Key: "tier", Value: "gold", Count: 1},
+			{Key: "tier", Value: "silver", Count: 1},
+		}, counts)
+		counts, err = r.CountCompanyLabels(ctx, CompanyFilters{Type: 1}, "tier")
+		assert.NoError(err)
+		assert.Len(counts, 2)
+
+		results, err := r.SearchCompanies(ctx, "label", CompanyFilters{
+			Labels: LabelSelector{{Key: "tier", Operator: LabelEquals, Values: []string{"silver"}}},
+		}, 10)
+		assert.NoError(err)
+		assert.Len(results, 1)
+		assert.Equal("Label Silver", results[0].Name)
+
+		for _, c := range companies {
+			assert.NoError(r.DeleteCompany(ctx, c.ID))
+		}
+	})
+
+	t.Run("Attachments", func(t *testing.T) {
+		assert := require.New(t)
+
+		c := Company{ID: uuid.Must(uuid.NewV4()), Name: "Files A", EmployeesCnt: 1, Type: 1}
+		other := Company{ID: uuid.Must(uuid.NewV4()), Name: "Files B", EmployeesCnt: 1, Type: 1}
+		assert.NoError(r.CreateCompany(ctx, &c))
+		assert.NoError(r.CreateCompany(ctx, &other))
+
+		newAttachment := func(companyID uuid.UUID, filename string) CompanyAttachment {
+			id := uuid.Must(uuid.NewV4())
+			return CompanyAttachment{
+				ID:          id,
+				CompanyID:   uuid.NullUUID{UUID: companyID, Valid: true},
+				Filename:    filename,
+				ContentType: "application/pdf",
+				Size:        3,
+				SHA256:      "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+				BlobKey:     "attachments/" + id.String(),
+				UploadedBy:  "admin",
+			}
+		}
+		a := newAttachment(c.ID, "certificate.pdf")
+		assert.NoError(r.CreateCompanyAttachment(ctx, &a))
+		assert.False(a.CreatedAt.IsZero())
+		assert.Equal(ErrAlreadyExists, r.CreateCompanyAttachment(ctx, &a))
+		unknown := newAttachment(uuid.Must(uuid.NewV4()), "unknown.pdf")
+		assert.Equal(ErrDoesNotExist, r.CreateCompanyAttachment(ctx, &unknown))
+		b := newAttachment(c.ID, "contract.pdf")
+		assert.NoError(r.CreateCompanyAttachment(ctx, &b))
+
+		got, err := r.GetCompanyAttachment(ctx, c.ID, a.ID)
+		assert.NoError(err)
+		assert.Equal("certificate.pdf", got.Filename)
+		assert.Equal(int64(3), got.Size)
+		_, err = r.GetCompanyAttachment(ctx, other.ID, a.ID)
+		assert.Equal(ErrDoesNotExist, err)
+
+		list, err := r.GetCompanyAttachments(ctx, c.ID)
+		assert.NoError(err)
+		assert.Len(list, 2)
+		assert.Equal(a.ID, list[0].ID)
+
+		// deleting leaves an orphan until the content is deleted
+		assert.NoError(r.DeleteCompanyAttachment(ctx, c.ID, a.ID))
+		assert.Equal(ErrDoesNotExist, r.DeleteCompanyAttachment(ctx, c.ID, a.ID))
+		_, err = r.GetCompanyAttachment(ctx, c.ID, a.ID)
+		assert.Equal(ErrDoesNotExist, err)
+		orphans, err := r.GetOrphanAttachments(ctx, 10)
+		assert.NoError(err)
+		assert.Len(orphans, 1)
+		assert.Equal(a.ID, orphans[0].ID)
+		assert.Equal(ErrDoesNotExist, r.DeleteOrphanAttachment(ctx, b.ID))
+		assert.NoError(r.DeleteOrphanAttachment(ctx, a.ID))
+		assert.Equal(ErrDoesNotExist, r.DeleteOrphanAttachment(ctx, a.ID))
+
+		// merging moves them to the target
+		target := other
+		assert.NoError(r.Transaction(ctx, func(tx Repository) error {
+			return tx.MergeCompany(ctx, c.ID, &target)
+		}))
+		list, err = r.GetCompanyAttachments(ctx, other.ID)
+		assert.NoError(err)
+		assert.Len(list, 1)
+		assert.Equal(b.ID, list[0].ID)
+
+		// deleting the company leaves them orphans
+		assert.NoError(r.DeleteCompany(ctx, other.ID))
+		orphans, err = r.GetOrphanAttachments(ctx, 10)
+		assert.NoError(err)
+		assert.Len(orphans, 1)
+		assert.Equal(b.ID, orphans[0].ID)
+		assert.NoError(r.DeleteOrphanAttachment(ctx, b.ID))
+	})
+
+	t.Run("Notes", func(t *testing.T) {
+		assert := require.New(t)
+
+		c := Company{ID: uuid.Must(uuid.NewV4()), Name: "Notes A", EmployeesCnt: 1, Type: 1}
+		other := Company{ID: uuid.Must(uuid.NewV4()), Name: "Notes B", EmployeesCnt: 1, Type: 1}
+		assert.NoError(r.CreateCompany(ctx, &c))
+		assert.NoError(r.CreateCompany(ctx, &other))
+
+		createNote := func(n *CompanyNote) error {
+			return r.Transaction(ctx, func(tx Repository) error {
+				return tx.CreateCompanyNote(ctx, n)
+			})
+		}
+		a := CompanyNote{ID: uuid.Must(uuid.NewV4()), CompanyID: c.ID, Author: "alice", Body: "Prefers *email*"}
+		assert.NoError(createNote(&a))
+		assert.False(a.CreatedAt.IsZero())
+		assert.Equal(int32(1), a.Version)
+		assert.Equal(ErrAlreadyExists, createNote(&a))
+		unknown := CompanyNote{ID: uuid.Must(uuid.NewV4()), CompanyID: uuid.Must(uuid.NewV4()), Author: "alice", Body: "?"}
+		assert.Equal(ErrDoesNotExist, createNote(&unknown))
+		b := CompanyNote{ID: uuid.Must(uuid.NewV4()), CompanyID: c.ID, Author: "bob", Body: "Renewal in May"}
+		assert.NoError(createNote(&b))
+
+		_, err := r.GetCompanyNote(ctx, other.ID, a.ID)
+		assert.Equal(ErrDoesNotExist, err)
+
+		// the update keeps the author and adds a version
+		upd := CompanyNote{ID: b.ID, CompanyID: c.ID, Body: "Renewal in June", Pinned: true}
+		assert.NoError(r.Transaction(ctx, func(tx Repository) error {
+			return tx.UpdateCompanyNote(ctx, &upd, "carol")
+		}))
+		assert.Equal("bob", upd.Author)
+		assert.Equal(int32(2), upd.Version)
+		assert.True(upd.CreatedAt.Equal(b.CreatedAt))
+		got, err := r.GetCompanyNote(ctx, c.ID, b.ID)
+		assert.NoError(err)
+		assert.Equal("Renewal in June", got.Body)
+		assert.True(got.Pinned)
+		upd.CompanyID = other.ID
+		assert.Equal(ErrDoesNotExist, r.UpdateCompanyNote(ctx, &upd, "carol"))
+
+		versions, err := r.GetCompanyNoteVersions(ctx, c.ID, b.ID)
+		assert.NoError(err)
+		assert.Len(versions, 2)
+		assert.Equal("bob", versions[0].Username)
+		assert.Equal("Renewal in May", versions[0].Body)
+		assert.Equal("carol", versions[1].Username)
+		assert.True(versions[1].Pinned)
+		_, err = r.GetCompanyNoteVersions(ctx, other.ID, b.ID)
+		assert.Equal(ErrDoesNotExist, err)
+
+		// the pinned ones first
+		list, err := r.GetCompanyNotes(ctx, c.ID)
+		assert.NoError(err)
+		assert.Len(list, 2)
+		assert.Equal(b.ID, list[0].ID)
+		assert.Equal(a.ID, list[1].ID)
+
+		assert.NoError(r.CreateCompanyFieldChanges(ctx, []CompanyFieldChange{
+			{ID: uuid.Must(uuid.NewV4()), CompanyID: c.ID, Field: "name", OldValue: "Notes", NewValue: "Notes A", Username: "alice"},
+			{ID: uuid.Must(uuid.NewV4()), CompanyID: other.ID, Field: "labels.tier", NewValue: "gold", Username: "alice"},
+		}))
+		changes, err := r.GetCompanyFieldChanges(ctx, c.ID)
+		assert.NoError(err)
+		assert.Len(changes, 1)
+		assert.Equal("name", changes[0].Field)
+		assert.False(changes[0].CreatedAt.IsZero())
+
+		assert.NoError(r.DeleteCompanyNote(ctx, c.ID, a.ID))
+		assert.Equal(ErrDoesNotExist, r.DeleteCompanyNote(ctx, c.ID, a.ID))
+		_, err = r.GetCompanyNoteVersions(ctx, c.ID, a.ID)
+		assert.Equal(ErrDoesNotExist, err)
+
+		// merging moves the notes, the field changes of the source go
+		target := other
+		assert.NoError(r.Transaction(ctx, func(tx Repository) error {
+			return tx.MergeCompany(ctx, c.ID, &target)
+		}))
+		list, err = r.GetCompanyNotes(ctx, other.ID)
+		assert.NoError(err)
+		assert.Len(list, 1)
+		assert.Equal(b.ID, list[0].ID)
+		versions, err = r.GetCompanyNoteVersions(ctx, other.ID, b.ID)
+		assert.NoError(err)
+		assert.Len(versions, 2)
+		changes, err = r.GetCompanyFieldChanges(ctx, c.ID)
+		assert.NoError(err)
+		assert.Empty(changes)
+
+		assert.NoError(r.DeleteCompany(ctx, other.ID))
+		list, err = r.GetCompanyNotes(ctx, other.ID)
+		assert.NoError(err)
+		assert.Empty(list)
+		changes, err = r.GetCompanyFieldChanges(ctx, other.ID)
+		assert.NoError(err)
+		assert.Empty(changes)
+	})
+
+	t.Run("ChangeRequest", func(t *testing.T) {
+		assert := require.New(t)
+
+		c := Company{ID: uuid.Must(uuid.NewV4()), Name: "Approval Co", EmployeesCnt: 1, Type: 1, Status: 1}
+		assert.NoError(r.CreateCompany(ctx, &c))
+
+		cr := ChangeRequest{
+			ID:          uuid.Must(uuid.NewV4()),
+			CompanyID:   c.ID,
+			ExpiresAt:   time.Now().Add(time.Hour),
+			Kind:        1,
+			Payload:     `{"id":"x"}`,
+			RequestedBy: "alice",
+		}
+		assert.NoError(r.CreateChangeRequest(ctx, &cr))
+		assert.Equal(ChangeRequestPending, cr.Status)
+
+		// a single pending request per company
+		dup := cr
+		dup.ID = uuid.Must(uuid.NewV4())
+		assert.Equal(ErrAlreadyExists, r.CreateChangeRequest(ctx, &dup))
+		dup.CompanyID = uuid.Must(uuid.NewV4())
+		assert.Equal(ErrDoesNotExist, r.CreateChangeRequest(ctx, &dup))
+
+		pending, err := r.GetPendingChangeRequest(ctx, c.ID)
+		assert.NoError(err)
+		assert.Equal(cr.ID, pending.ID)
+		assert.Equal(`{"id":"x"}`, pending.Payload)
+		assert.Equal("alice", pending.RequestedBy)
+		assert.False(pending.DecidedAt.Valid)
+
+		cr.Status = ChangeRequestRejected
+		cr.DecidedBy = "bob"
+		cr.Comment = "not now"
+		assert.NoError(r.DecideChangeRequest(ctx, &cr))
+		assert.True(cr.DecidedAt.Valid)
+		assert.Equal(ErrChangeRequestDecided, r.DecideChangeRequest(ctx, &cr))
+		_, err = r.GetPendingChangeRequest(ctx, c.ID)
+		assert.Equal(ErrDoesNotExist, err)
+
+		stored, err := r.GetChangeRequest(ctx, cr.ID)
+		assert.NoError(err)
+		assert.Equal(ChangeRequestRejected, stored.Status)
+		assert.Equal("bob", stored.DecidedBy)
+		assert.Equal("not now", stored.Comment)
+
+		// the stale requests expire
+		stale := ChangeRequest{
+			ID:          uuid.Must(uuid.NewV4()),
+			CompanyID:   c.ID,
+			ExpiresAt:   time.Now().Add(time.Minute),
+			Kind:        2,
+			Payload:     "{}",
+			RequestedBy: "alice",
+		}
+		assert.NoError(r.CreateChangeRequest(ctx, &stale))
+		expired, err := r.ExpireChangeRequests(ctx, time.Now())
+		assert.NoError(err)
+		assert.Len(expired, 0)
+		expired, err = r.ExpireChangeRequests(ctx, time.Now().Add(2*time.Minute))
+		assert.NoError(err)
+		assert.Len(expired, 1)
+		assert.Equal(stale.ID, expired[0].ID)
+		assert.Equal(ChangeRequestExpired, expired[0].Status)
+
+		list, err := r.GetChangeRequests(ctx, ChangeRequestFilters{CompanyID: uuid.NullUUID{UUID: c.ID, Valid: true}})
+		assert.NoError(err)
+		assert.Len(list, 2)
+		assert.Equal(stale.ID, list[0].ID)
+		list, err = r.GetChangeRequests(ctx, ChangeRequestFilters{Status: ChangeRequestRejected})
+		assert.NoError(err)
+		assert.Len(list, 1)
+		assert.Equal(cr.ID, list[0].ID)
+
+		// the decided requests are kept once the company is deleted
+		assert.NoError(r.DeleteCompany(ctx, c.ID))
+		stored, err = r.GetChangeRequest(ctx, cr.ID)
+		assert.NoError(err)
+		assert.Equal(ChangeRequestRejected, stored.Status)
+		assert.Equal(c.ID, stored.CompanyID)
+	})
+
+	t.Run("Ownership", func(t *testing.T) {
+		assert := require.New(t)
+
+		owned := Company{ID: uuid.Must(uuid.NewV4()), Name: "Owned Co", EmployeesCnt: 1, Type: 1}
+		holding := Company{ID: uuid.Must(uuid.NewV4()), Name: "Holding Co", EmployeesCnt: 1, Type: 1}
+		for _, c := range []*Company{&owned, &holding} {
+			assert.NoError(r.CreateCompany(ctx, c))
+		}
+		person := Person{ID: uuid.Must(uuid.NewV4()), Name: "Jane Doe", Country: "CY"}
+		assert.NoError(r.CreatePerson(ctx, &person))
+
+		from := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		until := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+		byHolding := Ownership{
+			ID:             uuid.Must(uuid.NewV4()),
+			CompanyID:      owned.ID,
+			OwnerCompanyID: uuid.NullUUID{UUID: holding.ID, Valid: true},
+			Percentage:     60,
+			ValidFrom:      from,
+			ValidTo:        sql.NullTime{Time: until, Valid: true},
+		}
+		byPerson := Ownership{
+			ID:            uuid.Must(uuid.NewV4()),
+			CompanyID:     holding.ID,
+			OwnerPersonID: uuid.NullUUID{UUID: person.ID, Valid: true},
+			Percentage:    50,
+			ValidFrom:     from,
+		}
+		create := func(o *Ownership) error {
+			return r.Transaction(ctx, func(tx Repository) error {
+				return tx.CreateOwnership(ctx, o)
+			})
+		}
+		assert.NoError(create(&byHolding))
+		assert.NoError(create(&byPerson))
+
+		// 60% + 50% while both stakes are effective
+		direct := Ownership{
+			ID:            uuid.Must(uuid.NewV4()),
+			CompanyID:     owned.ID,
+			OwnerPersonID: uuid.NullUUID{UUID: person.ID, Valid: true},
+			Percentage:    50,
+			ValidFrom:     from.AddDate(1, 0, 0),
+		}
+		assert.Equal(ErrOwnershipExceeded, create(&direct))
+		direct.ValidFrom = until
+		assert.NoError(create(&direct))
+
+		unknown := Ownership{
+			ID:            uuid.Must(uuid.NewV4()),
+			CompanyID:     owned.ID,
+			OwnerPersonID: uuid.NullUUID{UUID: uuid.Must(uuid.NewV4()), Valid: true},
+			Percentage:    1,
+			ValidFrom:     from,
+		}
+		assert.Equal(ErrDoesNotExist, create(&unknown))
+
+		o, err := r.GetOwnership(ctx, owned.ID, byHolding.ID)
+		assert.NoError(err)
+		assert.Equal(60.0, o.Percentage)
+		assert.True(o.ValidFrom.Equal(from))
+		assert.True(o.ValidTo.Valid)
+		assert.True(o.ValidTo.Time.Equal(until))
+
+		list, err := r.GetCompanyOwnerships(ctx, owned.ID)
+		assert.NoError(err)
+		assert.Len(list, 2)
+
+		graph, err := r.GetOwnershipGraph(ctx, owned.ID)
+		assert.NoError(err)
+		assert.Len(graph, 3)
+
+		ubo := UltimateBeneficialOwners(graph, owned.ID, from, 25)
+		assert.Len(ubo, 1)
+		assert.Equal(person.ID, ubo[0].PersonID)
+		assert.InDelta(30, ubo[0].Percentage, 1e-9)
+
+		assert.Equal(ErrUsedByOtherObjects, r.DeletePerson(ctx, person.ID))
+		assert.NoError(r.DeleteOwnership(ctx, owned.ID, direct.ID))
+		assert.Equal(ErrDoesNotExist, r.DeleteOwnership(ctx, owned.ID, direct.ID))
+
+		// the stakes of a deleted company go with it
+		assert.NoError(r.DeleteCompany(ctx, holding.ID))
+		list, err = r.GetCompanyOwnerships(ctx, owned.ID)
+		assert.NoError(err)
+		assert.Len(list, 0)
+		assert.NoError(r.DeletePerson(ctx, person.ID))
+		assert.NoError(r.DeleteCompany(ctx, owned.ID))
+	})
+
+	t.Run("MergeOwnership", func(t *testing.T) {
+		assert := require.New(t)
+
+		source := Company{ID: uuid.Must(uuid.NewV4()), Name: "Stake A", EmployeesCnt: 1, Type: 1}
+		target := Company{ID: uuid.Must(uuid.NewV4()), Name: "Stake B", EmployeesCnt: 1, Type: 1}
+		for _, c := range []*Company{&source, &target} {
+			assert.NoError(r.CreateCompany(ctx, c))
+		}
+		person := Person{ID: uuid.Must(uuid.NewV4()), Name: "John Doe", Country: "CY"}
+		assert.NoError(r.CreatePerson(ctx, &person))
+
+		from := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		stakes := []Ownership{
+			{ID: uuid.Must(uuid.NewV4()), CompanyID: source.ID, OwnerPersonID: uuid.NullUUID{UUID: person.ID, Valid: true}, Percentage: 70, ValidFrom: from},
+			{ID: uuid.Must(uuid.NewV4()), CompanyID: target.ID, OwnerPersonID: uuid.NullUUID{UUID: person.ID, Valid: true}, Percentage: 70, ValidFrom: from},
+		}
+		for i := range stakes {
+			assert.NoError(r.Transaction(ctx, func(tx Repository) error {
+				return tx.CreateOwnership(ctx, &stakes[i])
+			}))
+		}
+		merge := func() error {
+			merged := target
+			return r.Transaction(ctx, func(tx Repository) error {
+				return tx.MergeCompany(ctx, source.ID, &merged)
+			})
+		}
+
+		// 70% + 70% in the target
+		assert.Equal(ErrOwnershipExceeded, merge())
+		list, err := r.GetCompanyOwnerships(ctx, source.ID)
+		assert.NoError(err)
+		assert.Len(list, 1)
+
+		stakes[0].Percentage = 30
+		assert.NoError(r.Transaction(ctx, func(tx Repository) error {
+			return tx.UpdateOwnership(ctx, &stakes[0])
+		}))
+		assert.NoError(merge())
+		list, err = r.GetCompanyOwnerships(ctx, target.ID)
+		assert.NoError(err)
+		assert.Len(list, 2)
+
+		assert.NoError(r.DeleteCompany(ctx, target.ID))
+		assert.NoError(r.DeletePerson(ctx, person.ID))
+	})
+
+	t.Run("CompanyTimeline", func(t *testing.T) {
+		assert := require.New(t)
+
+		c := Company{ID: uuid.Must(uuid.NewV4()), Name: "Timeline", EmployeesCnt: 1, Type: 1, Status: 1}
+		assert.NoError(r.CreateCompany(ctx, &c))
+
+		n := CompanyNote{ID: uuid.Must(uuid.NewV4()), CompanyID: c.ID, Author: "alice", Body: "First call", Pinned: true}
+		assert.NoError(r.Transaction(ctx, func(tx Repository) error {
+			return tx.CreateCompanyNote(ctx, &n)
+		}))
+		// the changes made at the same time are sorted by ID
+		assert.NoError(r.CreateCompanyFieldChanges(ctx, []CompanyFieldChange{
+			{ID: uuid.Must(uuid.NewV4()), CompanyID: c.ID, Field: "name", OldValue: "Time", NewValue: "Timeline", Username: "alice"},
+			{ID: uuid.Must(uuid.NewV4()), CompanyID: c.ID, Field: "employeescnt", OldValue: "2", NewValue: "1", Username: "alice"},
+		}))
+		ch := CompanyStatusChange{ID: uuid.Must(uuid.NewV4()), CompanyID: c.ID, FromStatus: 1, ToStatus: 2, Reason: "documents", Username: "bob"}
+		assert.NoError(r.Transaction(ctx, func(tx Repository) error {
+			return tx.TransitionCompanyStatus(ctx, &ch)
+		}))
+
+		all, err := r.GetCompanyTimeline(ctx, CompanyTimelineQuery{CompanyID: c.ID, Limit: 10})
+		assert.NoError(err)
+		assert.Len(all, 4)
+		assert.Equal(TimelineNote, all[0].Kind)
+		assert.Equal("First call", all[0].Note.Body)
+		assert.True(all[0].Note.Pinned)
+		assert.Equal(int32(1), all[0].Note.Version)
+		assert.Equal(TimelineFieldChange, all[1].Kind)
+		assert.Equal(TimelineFieldChange, all[2].Kind)
+		assert.True(all[1].ID.String() < all[2].ID.String())
+		assert.Equal(TimelineStatusChange, all[3].Kind)
+		assert.Equal(uint32(2), all[3].StatusChange.ToStatus)
+		assert.Equal("documents", all[3].StatusChange.Reason)
+		assert.Equal("bob", all[3].StatusChange.Username)
+
+		for _, newestFirst := range []bool{false, true} {
+			var ids []uuid.UUID
+			q := CompanyTimelineQuery{CompanyID: c.ID, NewestFirst: newestFirst, Limit: 1}
+			for {
+				page, err := r.GetCompanyTimeline(ctx, q)
+				assert.NoError(err)
+				if len(page) == 0 {
+					break
+				}
+				assert.Len(page, 1)
+				ids = append(ids, page[0].ID)
+				q.After = &TimelinePosition{CreatedAt: page[0].CreatedAt, ID: page[0].ID}
+			}
+
+			var want []uuid.UUID
+			for i := range all {
+				if newestFirst {
+					i = len(all) - 1 - i
+				}
+				want = append(want, all[i].ID)
+			}
+			assert.Equal(want, ids)
+		}
+
+		list, err := r.GetCompanyTimeline(ctx, CompanyTimelineQuery{CompanyID: uuid.Must(uuid.NewV4()), Limit: 10})
+		assert.NoError(err)
+		assert.Len(list, 0)
+
+		assert.NoError(r.DeleteCompany(ctx, c.ID))
+	})
+
+	t.Run("IdempotencyKey", func(t *testing.T) {
+		assert := require.New(t)
+
+		k := IdempotencyKey{
+			Username:    "alice",
+			Key:         "repo_key",
+			ExpiresAt:   time.Now().Add(time.Hour),
+			Method:      "/api.CompanyService/Create",
+			RequestHash: strings.Repeat("a", 64),
+		}
+		assert.NoError(r.CreateIdempotencyKey(ctx, &k))
+		assert.Equal(ErrAlreadyExists, r.CreateIdempotencyKey(ctx, &k))
+
+		// the keys of the users are independent
+		other := k
+		other.Username = "bob"
+		assert.NoError(r.CreateIdempotencyKey(ctx, &other))
+		_, err := r.GetIdempotencyKey(ctx, "carol", k.Key)
+		assert.Equal(ErrDoesNotExist, err)
+
+		got, err := r.GetIdempotencyKey(ctx, k.Username, k.Key)
+		assert.NoError(err)
+		assert.Equal(k.Method, got.Method)
+		assert.Equal(k.RequestHash, got.RequestHash)
+		assert.False(got.Completed)
+
+		k.Response = []byte{1, 2}
+		k.ResponseHeader = []byte(`{"change-request-id":["1"]}`)
+		assert.NoError(r.CompleteIdempotencyKey(ctx, &k))
+		assert.True(k.Completed)
+		got, err = r.GetIdempotencyKey(ctx, k.Username, k.Key)
+		assert.NoError(err)
+		assert.True(got.Completed)
+		assert.Equal(k.Response, got.Response)
+		assert.Equal(k.ResponseHeader, got.ResponseHeader)
+		got, err = r.GetIdempotencyKey(ctx, other.Username, other.Key)
+		assert.NoError(err)
+		assert.False(got.Completed)
+		assert.Equal(ErrDoesNotExist, r.CompleteIdempotencyKey(ctx, &IdempotencyKey{Username: "alice", Key: "unknown"}))
+
+		// an expired key is not returned and can be created again
+		expired := IdempotencyKey{
+			Username:    "alice",
+			Key:         "repo_expired_key",
+			ExpiresAt:   time.Now().Add(-time.Second),
+			Method:      k.Method,
+			RequestHash: k.RequestHash,
+		}
+		assert.NoError(r.CreateIdempotencyKey(ctx, &expired))
+		_, err = r.GetIdempotencyKey(ctx, expired.Username, expired.Key)
+		assert.Equal(ErrDoesNotExist, err)
+		assert.NoError(r.CreateIdempotencyKey(ctx, &expired))
+
+		n, err := r.DeleteExpiredIdempotencyKeys(ctx)
+		assert.NoError(err)
+		assert.Equal(int64(1), n)
+
+		assert.NoError(r.DeleteIdempotencyKey(ctx, k.Username, k.Key))
+		_, err = r.GetIdempotencyKey(ctx, k.Username, k.Key)
+		assert.Equal(ErrDoesNotExist, err)
+		_, err = r.GetIdempotencyKey(ctx, other.Username, other.Key)
+		assert.NoError(err)
+		assert.NoError(r.DeleteIdempotencyKey(ctx, other.Username, other.Key))
+	})
+
+	t.Run("User", func(t *testing.T) {
+		assert := require.New(t)
+
+		admin, err := r.GetUserByUsername(ctx, "admin")
+		assert.NoError(err)
+		assert.True(admin.IsAdmin)
+
+		u := User{Username: "repo_user", SessionTTL: 10}
+		assert.NoError(u.SetPasswordHash("secret_password"))
+		assert.NoError(r.CreateUser(ctx, &u))
+		assert.NotZero(u.ID)
+
+		got, err := r.GetUser(ctx, u.ID)
+		assert.NoError(err)
+		assert.Equal(u.Username, got.Username)
+
+		dup := User{Username: "repo_user", PasswordHash: u.PasswordHash}
+		assert.Equal(ErrAlreadyExists, r.CreateUser(ctx, &dup))
+
+		_, err = r.GetUser(ctx, 9999)
+		assert.Equal(ErrDoesNotExist, err)
+		_, err = r.GetUserByUsername(ctx, "nobody")
+		assert.Equal(ErrDoesNotExist, err)
+
+		t.Run("LoginUserByPassword", func(t *testing.T) {
+			assert := require.New(t)
+
+			jwt, err := LoginUserByPassword(ctx, r, "admin", "admin")
+			assert.NoError(err)
+			assert.NotEmpty(jwt)
+
+			_, err = LoginUserByPassword(ctx, r, "repo_user", "wrong_password")
+			assert.Equal(ErrInvalidUsernameOrPassword, err)
+
+			_, err = LoginUserByPassword(ctx, r, "nobody", "admin")
+			assert.Equal(ErrInvalidUsernameOrPassword, err)
+		})
+	})
+}
+
+func TestMemoryRepository(t *testing.T) {
+	HashIterations = 1
+	testRepository(t, NewMemoryRepository())
+}
+
+func (ts *StorageTestSuite) TestSQLRepository() {
+	HashIterations = 1
+	// the failing statements would abort the test transaction
+	testRepository(ts.T(), NewSQLRepository(ts.DB()))
+}
+
+func TestSQLiteRepository(t *testing.T) {
+	HashIterations = 1
+	testRepository(t, NewSQLRepository(newSQLiteDB(t)))
+}
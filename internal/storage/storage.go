@@ -1,14 +1,13 @@
 package storage
 
 import (
-	"embed"
+	"context"
 	"fmt"
-	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/golang-migrate/migrate/v4"
-	"github.com/golang-migrate/migrate/v4/database/postgres"
-	"github.com/golang-migrate/migrate/v4/source/httpfs"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -16,9 +15,18 @@ import (
 	"github.com/fancar/tmp_xm/internal/config"
 )
 
-// Migrations
-//go:embed migrations/*
-var migrations embed.FS
+// SQL drivers.
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// Storage backends. The postgres backend uses SQLite instead when the DSN
+// has the sqlite:// scheme.
+const (
+	BackendPostgres = "postgres"
+	BackendMemory   = "memory"
+)
 
 var (
 	jwtsecret []byte
@@ -36,28 +44,47 @@ func Setup(c config.Config) error {
 	// 	return errors.Wrap(err, "set time location error")
 	// }
 
-	log.Info("storage: connecting to PostgreSQL database ...")
-	log.Debugf("storage: PostgreSQL DSN: %s \n", c.PostgreSQL.DSN)
-	d, err := sqlx.Open("postgres", c.PostgreSQL.DSN)
-	if err != nil {
-		return errors.Wrap(err, "storage: PostgreSQL connection error")
+	switch c.Storage.Backend {
+	case "", BackendPostgres:
+	case BackendMemory:
+		log.Warning("storage: using the in-memory storage, the data is lost on exit")
+		repo = NewMemoryRepository()
+		return nil
+	default:
+		return fmt.Errorf("storage: unknown backend %s", c.Storage.Backend)
+	}
+
+	if err := Connect(c); err != nil {
+		return err
 	}
-	d.SetMaxOpenConns(c.PostgreSQL.MaxOpenConnections)
-	d.SetMaxIdleConns(c.PostgreSQL.MaxIdleConnections)
 
 	for {
-		if err := d.Ping(); err != nil {
-			log.WithError(err).Warning("storage: ping PostgreSQL database error, will retry in 2s")
+		if err := db.Ping(); err != nil {
+			log.WithError(err).Warningf("storage: ping %s database error, will retry in 2s", driverTitle(db.DriverName()))
 			time.Sleep(2 * time.Second)
 		} else {
 			break
 		}
 	}
 
-	db = &DBLogger{d}
+	// refuse to run against a schema this binary does not know
+	if err := checkSchemaCompatibility(context.Background()); err != nil {
+		return err
+	}
 
 	if c.PostgreSQL.Automigrate {
-		if err := MigrateUp(d); err != nil {
+		if err := MigrateUp(db.DB); err != nil {
+			return err
+		}
+	} else if err := CheckSchemaVersion(context.Background()); err != nil {
+		log.WithError(err).Warning("storage: the schema is not up to date, apply the migrations with the 'migrate up' command")
+	}
+
+	// the companies created before the normalized names were stored, once
+	if v, _, err := SchemaVersion(context.Background()); err == nil && v >= dataMigrationSchemaVersion {
+		if err := Transaction(context.Background(), func(tx sqlx.ExtContext) error {
+			return BackfillNormalizedNames(context.Background(), tx)
+		}); err != nil {
 			return err
 		}
 	}
@@ -65,80 +92,125 @@ func Setup(c config.Config) error {
 	return nil
 }
 
-// MigrateUp configure postgres migration up
-func MigrateUp(db *sqlx.DB) error {
-	log.Info("storage: applying PostgreSQL data migrations from migrations dir ...")
+// Connect opens the connection pool of the configured SQL database, without
+// waiting for the database or applying the migrations.
+func Connect(c config.Config) error {
+	driverName, dsn := sqlDataSource(c.PostgreSQL.DSN, c.PostgreSQL.StatementTimeout)
 
-	driver, err := postgres.WithInstance(db.DB, &postgres.Config{
-		MigrationsTable: "schema_migrations",
-	})
+	log.Infof("storage: connecting to %s database ...", driverTitle(driverName))
+	log.Debugf("storage: %s DSN: %s \n", driverTitle(driverName), c.PostgreSQL.DSN)
+	d, err := sqlx.Open(driverName, dsn)
 	if err != nil {
-		return fmt.Errorf("storage: migrate postgres driver error: %w", err)
+		return errors.Wrapf(err, "storage: %s connection error", driverTitle(driverName))
+	}
+	if driverName == DriverSQLite {
+		// SQLite allows a single writer, a single connection avoids the
+		// SQLITE_BUSY errors and keeps an in-memory database alive
+		d.SetMaxOpenConns(1)
+	} else {
+		d.SetMaxOpenConns(c.PostgreSQL.MaxOpenConnections)
+		d.SetMaxIdleConns(c.PostgreSQL.MaxIdleConnections)
 	}
 
-	src, err := httpfs.New(http.FS(migrations), "migrations")
-	if err != nil {
-		return fmt.Errorf("new httpfs error: %w", err)
+	db = &DBLogger{d}
+	repo = NewSQLRepository(db)
+	return nil
+}
+
+// sqlDataSource returns the driver name and the data source name for the
+// given DSN. The driver is selected by the DSN scheme: sqlite:// (or
+// sqlite3://) selects SQLite, anything else PostgreSQL.
+func sqlDataSource(dsn string, statementTimeout time.Duration) (string, string) {
+	for _, scheme := range []string{"sqlite://", "sqlite3://"} {
+		if strings.HasPrefix(dsn, scheme) {
+			return DriverSQLite, sqliteDataSource(strings.TrimPrefix(dsn, scheme))
+		}
 	}
+	return DriverPostgres, withStatementTimeout(dsn, statementTimeout)
+}
 
-	m, err := migrate.NewWithInstance("httpfs", src, "postgres", driver)
+// sqliteDataSource adds the pragmas the storage relies on to the given
+// SQLite database path (e.g. /var/lib/xm/xm.db or :memory:).
+func sqliteDataSource(path string) string {
+	var query string
+	if i := strings.Index(path, "?"); i != -1 {
+		path, query = path[:i], path[i+1:]
+	}
+	q, err := url.ParseQuery(query)
 	if err != nil {
-		return fmt.Errorf("storage: new migrate instance error: %w", err)
+		// let the driver report the invalid DSN
+		return path + "?" + query
 	}
 
-	oldVersion, _, _ := m.Version()
-
-	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
-		return fmt.Errorf("storage: migrate up error: %w", err)
+	pragmas := map[string]string{
+		"foreign_keys": "foreign_keys(1)",
+		"busy_timeout": "busy_timeout(5000)",
 	}
-
-	newVersion, _, _ := m.Version()
-
-	if oldVersion != newVersion {
-		log.WithFields(log.Fields{
-			"from_version": oldVersion,
-			"to_version":   newVersion,
-		}).Info("storage: PostgreSQL data migrations applied")
+	for _, p := range q["_pragma"] {
+		for name := range pragmas {
+			if strings.HasPrefix(p, name) {
+				delete(pragmas, name)
+			}
+		}
+	}
+	for _, name := range []string{"foreign_keys", "busy_timeout"} {
+		if p, ok := pragmas[name]; ok {
+			q.Add("_pragma", p)
+		}
+	}
+	if q.Get("_time_format") == "" {
+		q.Set("_time_format", "sqlite")
 	}
 
-	return nil
+	return path + "?" + q.Encode()
 }
 
-// MigrateDown configure postgres migration down
-func MigrateDown(db *sqlx.DB) error {
-	log.Info("storage: reverting PostgreSQL data migrations from migrations dir ...")
-
-	driver, err := postgres.WithInstance(db.DB, &postgres.Config{
-		MigrationsTable: "schema_migrations",
-	})
-	if err != nil {
-		return fmt.Errorf("storage: migrate postgres driver error: %w", err)
+// driverTitle returns the human readable name of the given driver.
+func driverTitle(driverName string) string {
+	if driverName == DriverSQLite {
+		return "SQLite"
 	}
+	return "PostgreSQL"
+}
 
-	src, err := httpfs.New(http.FS(migrations), "migrations")
-	if err != nil {
-		return fmt.Errorf("new httpfs error: %w", err)
+// withStatementTimeout adds the statement_timeout run-time parameter to the
+// given DSN, unless it is already set. The driver sends the unknown DSN
+// parameters to the server on the connection startup, so every statement of
+// every pooled connection is limited by it.
+func withStatementTimeout(dsn string, timeout time.Duration) string {
+	if timeout <= 0 || strings.Contains(dsn, "statement_timeout") {
+		return dsn
 	}
+	ms := strconv.FormatInt(timeout.Milliseconds(), 10)
 
-	m, err := migrate.NewWithInstance("httpfs", src, "postgres", driver)
-	if err != nil {
-		return fmt.Errorf("storage: new migrate instance error: %w", err)
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			// let sqlx.Open report the invalid DSN
+			return dsn
+		}
+		q := u.Query()
+		q.Set("statement_timeout", ms)
+		u.RawQuery = q.Encode()
+		return u.String()
 	}
 
-	oldVersion, _, _ := m.Version()
+	return strings.TrimSpace(dsn) + " statement_timeout=" + ms
+}
 
-	if err := m.Down(); err != nil && err != migrate.ErrNoChange {
-		return fmt.Errorf("storage: migrate down error: %w", err)
+// Close closes the database connection pool.
+func Close() error {
+	if db == nil {
+		return nil
 	}
+	log.Infof("storage: closing %s connection pool ...", driverTitle(db.DriverName()))
+	return db.Close()
+}
 
-	newVersion, _, _ := m.Version()
-
-	if oldVersion != newVersion {
-		log.WithFields(log.Fields{
-			"from_version": oldVersion,
-			"to_version":   newVersion,
-		}).Info("storage: reverted PostgreSQL data migrations applied")
+// Ping verifies that the SQL database is reachable.
+func Ping(ctx context.Context) error {
+	if db == nil {
+		return fmt.Errorf("storage: not initialized")
 	}
-
-	return nil
+	return db.PingContext(ctx)
 }
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"testing"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/require"
@@ -44,7 +45,7 @@ func (b *StorageTestSuite) TearDownTest() {
 	}
 }
 
-func (b *StorageTestSuite) Tx() sqlx.Ext {
+func (b *StorageTestSuite) Tx() sqlx.ExtContext {
 	return b.tx
 }
 
@@ -55,3 +56,86 @@ func (b *StorageTestSuite) DB() *DBLogger {
 func TestStorage(t *testing.T) {
 	suite.Run(t, new(StorageTestSuite))
 }
+
+func TestLatestSchemaVersion(t *testing.T) {
+	assert := require.New(t)
+
+	v, err := LatestSchemaVersion(DriverPostgres)
+	assert.NoError(err)
+	assert.Equal(uint(18), v)
+
+	// the dialect migrations must be kept in sync
+	sv, err := LatestSchemaVersion(DriverSQLite)
+	assert.NoError(err)
+	assert.Equal(v, sv)
+}
+
+func TestWithStatementTimeout(t *testing.T) {
+	tests := []struct {
+		DSN      string
+		Timeout  time.Duration
+		Expected string
+	}{
+		{"postgres://app@localhost/app?sslmode=disable", 0, "postgres://app@localhost/app?sslmode=disable"},
+		{"postgres://app@localhost/app?sslmode=disable", 5 * time.Second, "postgres://app@localhost/app?sslmode=disable&statement_timeout=5000"},
+		{"postgres://app@localhost/app?statement_timeout=100", 5 * time.Second, "postgres://app@localhost/app?statement_timeout=100"},
+		{"user=app dbname=app sslmode=disable", 1500 * time.Millisecond, "user=app dbname=app sslmode=disable statement_timeout=1500"},
+	}
+
+	for _, tst := range tests {
+		require.Equal(t, tst.Expected, withStatementTimeout(tst.DSN, tst.Timeout))
+	}
+}
+
+func TestSQLDataSource(t *testing.T) {
+	tests := []struct {
+		DSN            string
+		ExpectedDriver string
+		ExpectedDSN    string
+	}{
+		{"postgres://app@localhost/app?sslmode=disable", DriverPostgres, "postgres://app@localhost/app?sslmode=disable&statement_timeout=1000"},
+		{"user=app dbname=app", DriverPostgres, "user=app dbname=app statement_timeout=1000"},
+		{"sqlite:///var/lib/xm/xm.db", DriverSQLite, "/var/lib/xm/xm.db?_pragma=foreign_keys%281%29&_pragma=busy_timeout%285000%29&_time_format=sqlite"},
+		{"sqlite3://:memory:", DriverSQLite, ":memory:?_pragma=foreign_keys%281%29&_pragma=busy_timeout%285000%29&_time_format=sqlite"},
+		{"sqlite://xm.db?_pragma=busy_timeout(100)&_time_format=sqlite", DriverSQLite, "xm.db?_pragma=busy_timeout%28100%29&_pragma=foreign_keys%281%29&_time_format=sqlite"},
+	}
+
+	for _, tst := range tests {
+		driverName, dsn := sqlDataSource(tst.DSN, time.Second)
+		require.Equal(t, tst.ExpectedDriver, driverName)
+		require.Equal(t, tst.ExpectedDSN, dsn)
+	}
+}
+
+// newSQLiteDB returns a migrated in-memory SQLite database.
+func newSQLiteDB(t *testing.T) *DBLogger {
+	assert := require.New(t)
+
+	_, dsn := sqlDataSource("sqlite://:memory:", 0)
+	d, err := sqlx.Open(DriverSQLite, dsn)
+	assert.NoError(err)
+	d.SetMaxOpenConns(1)
+	t.Cleanup(func() { d.Close() })
+
+	assert.NoError(MigrateUp(d))
+	return &DBLogger{d}
+}
+
+func TestSQLiteMigrations(t *testing.T) {
+	assert := require.New(t)
+	d := newSQLiteDB(t)
+
+	var v struct {
+		Version uint `db:"version"`
+		Dirty   bool `db:"dirty"`
+	}
+	assert.NoError(d.Get(&v, "SELECT version, dirty FROM schema_migrations"))
+	assert.False(v.Dirty)
+
+	latest, err := LatestSchemaVersion(DriverSQLite)
+	assert.NoError(err)
+	assert.Equal(latest, v.Version)
+
+	assert.NoError(MigrateDown(d.DB))
+	assert.NoError(MigrateUp(d.DB))
+}
@@ -5,7 +5,6 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/sha512"
-	"database/sql"
 	"encoding/base64"
 	"fmt"
 	"regexp"
@@ -33,6 +32,7 @@ var passwordValidator = regexp.MustCompile(`^.{6,}$`)
 type User struct {
 	ID           int64     `db:"id"`
 	IsAdmin      bool      `db:"is_admin"`
+	IsApprover   bool      `db:"is_approver"`
 	SessionTTL   int32     `db:"session_ttl"`
 	CreatedAt    time.Time `db:"created_at"`
 	UpdatedAt    time.Time `db:"updated_at"`
@@ -42,22 +42,14 @@ type User struct {
 
 // LoginUserByPassword returns a JWT token for the user matching the given email
 // and password combination.
-func LoginUserByPassword(ctx context.Context, db sqlx.Ext, name string, password string) (string, error) {
+func LoginUserByPassword(ctx context.Context, users UserRepository, name string, password string) (string, error) {
 	// get the user by email
-	var user User
-	err := sqlx.Get(db, &user, `
-		select
-			*
-		from
-			"user"
-		where
-			username = $1
-	`, name)
+	user, err := users.GetUserByUsername(ctx, name)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if err == ErrDoesNotExist {
 			return "", ErrInvalidUsernameOrPassword
 		}
-		return "", fmt.Errorf("select error %v", err)
+		return "", err
 	}
 
 	// Compare the passed in password with the hash in the database.
@@ -166,21 +158,22 @@ func (u *User) SetPasswordHash(pw string) error {
 }
 
 // CreateUser creates the given user.
-func CreateUser(ctx context.Context, db sqlx.Queryer, user *User) error {
+func CreateUser(ctx context.Context, db sqlx.QueryerContext, user *User) error {
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = time.Now()
 
-	err := sqlx.Get(db, &user.ID, `
+	err := sqlx.GetContext(ctx, db, &user.ID, `
 		insert into "user" (
 			created_at,
 			updated_at,
 			username,
 			password_hash,
 			session_ttl,
-			is_admin
+			is_admin,
+			is_approver
 		)
 		values (
-			$1, $2, $3, $4, $5, $6)
+			$1, $2, $3, $4, $5, $6, $7)
 		returning
 			id`,
 		user.CreatedAt,
@@ -189,6 +182,7 @@ func CreateUser(ctx context.Context, db sqlx.Queryer, user *User) error {
 		user.PasswordHash,
 		user.SessionTTL,
 		user.IsAdmin,
+		user.IsApprover,
 	)
 	if err != nil {
 		return handlePSQLError(Insert, err, "insert error")
@@ -196,3 +190,39 @@ func CreateUser(ctx context.Context, db sqlx.Queryer, user *User) error {
 
 	return nil
 }
+
+// GetUser returns the user for the given id.
+func GetUser(ctx context.Context, db sqlx.QueryerContext, id int64) (User, error) {
+	var user User
+	err := sqlx.GetContext(ctx, db, &user, `
+		select
+			*
+		from
+			"user"
+		where
+			id = $1
+	`, id)
+	if err != nil {
+		return user, handlePSQLError(Select, err, "select error")
+	}
+
+	return user, nil
+}
+
+// GetUserByUsername returns the user for the given username.
+func GetUserByUsername(ctx context.Context, db sqlx.QueryerContext, username string) (User, error) {
+	var user User
+	err := sqlx.GetContext(ctx, db, &user, `
+		select
+			*
+		from
+			"user"
+		where
+			username = $1
+	`, username)
+	if err != nil {
+		return user, handlePSQLError(Select, err, "select error")
+	}
+
+	return user, nil
+}
@@ -41,7 +41,7 @@ func (ts *StorageTestSuite) TestUser() {
 		t.Run("LoginUserByPassword", func(t *testing.T) {
 			assert := require.New(t)
 
-			jwt, err := LoginUserByPassword(context.Background(), DB(), user.Username, password)
+			jwt, err := LoginUserByPassword(context.Background(), NewSQLRepository(DB()), user.Username, password)
 			assert.NoError(err)
 			assert.NotEqual("", jwt)
 		})
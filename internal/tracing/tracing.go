@@ -0,0 +1,128 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+
+	"github.com/fancar/tmp_xm/internal/config"
+)
+
+// Exporter types.
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+)
+
+var (
+	provider *sdktrace.TracerProvider
+	output   io.Closer
+)
+
+// Setup configures the OpenTelemetry tracer provider and the W3C trace-context
+// propagator. When tracing is disabled the global no-op provider stays in
+// place, so instrumented code does not need to check for it.
+func Setup(ctx context.Context, cfg config.Config) error {
+	conf := cfg.Tracing
+
+	// always propagate the incoming context, even if we do not export
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if !conf.Enabled {
+		log.Info("tracing: disabled. Skipped.")
+		return nil
+	}
+
+	exp, err := newExporter(ctx, conf.Exporter, conf.Endpoint, conf.Insecure, conf.File)
+	if err != nil {
+		return fmt.Errorf("new exporter error: %w", err)
+	}
+
+	serviceName := conf.ServiceName
+	if serviceName == "" {
+		serviceName = config.AppName
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+		semconv.ServiceVersion(config.Version),
+	))
+	if err != nil {
+		return fmt.Errorf("new resource error: %w", err)
+	}
+
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(conf.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	log.WithFields(log.Fields{
+		"exporter":     conf.Exporter,
+		"endpoint":     conf.Endpoint,
+		"file":         conf.File,
+		"service_name": serviceName,
+		"sample_ratio": conf.SampleRatio,
+	}).Info("tracing: setup finished successfully!")
+
+	return nil
+}
+
+// Shutdown flushes the pending spans and stops the tracer provider.
+func Shutdown(ctx context.Context) error {
+	if provider == nil {
+		return nil
+	}
+
+	err := provider.Shutdown(ctx)
+	if output != nil {
+		if cErr := output.Close(); cErr != nil && err == nil {
+			err = cErr
+		}
+	}
+	return err
+}
+
+func newExporter(ctx context.Context, exporter, endpoint string, insecure bool, file string) (sdktrace.SpanExporter, error) {
+	switch exporter {
+	case ExporterOTLP:
+		opts := []otlptracegrpc.Option{}
+		if endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(endpoint))
+		}
+		if insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		return otlptracegrpc.New(ctx, opts...)
+	case ExporterStdout:
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stdout), stdouttrace.WithPrettyPrint())
+	case ExporterFile:
+		if file == "" {
+			return nil, fmt.Errorf("file must be set for the %s exporter", ExporterFile)
+		}
+		f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("open file error: %w", err)
+		}
+		output = f
+		return stdouttrace.New(stdouttrace.WithWriter(f))
+	default:
+		return nil, fmt.Errorf("unknown exporter %s", exporter)
+	}
+}